@@ -44,6 +44,7 @@ type Message struct { // TODO combine with server.message
 	Event      string
 	Time       int64
 	Topic      string
+	Seq        int64
 	Message    string
 	Title      string
 	Priority   int
@@ -227,8 +228,9 @@ func (c *Client) expandTopicURL(topic string) (string, error) {
 
 func handleSubscribeConnLoop(ctx context.Context, msgChan chan *Message, topicURL, subcriptionID string, options ...SubscribeOption) {
 	for {
-		// TODO The retry logic is crude and may lose messages. It should record the last message like the
-		//      Android client, use since=, and do incremental backoff too
+		// TODO The retry logic is crude and may lose messages, unless a durable subscription is used (see
+		//      WithConsumer). It should record the last message like the Android client, use since=, and do
+		//      incremental backoff too
 		if err := performSubscribeRequest(ctx, msgChan, topicURL, subcriptionID, options...); err != nil {
 			log.Warn("%s Connection failed: %s", util.ShortTopicURL(topicURL), err.Error())
 		}
@@ -133,6 +133,13 @@ func WithSinceUnixTime(since int64) SubscribeOption {
 	return WithSince(fmt.Sprintf("%d", since))
 }
 
+// WithConsumer makes the subscription a durable subscription with the given consumer name. The server stores
+// the ID of the last delivered message per topic, and resumes from there when the client reconnects, unless
+// a since parameter is passed as well (see WithSince).
+func WithConsumer(name string) SubscribeOption {
+	return WithQueryParam("consumer", name)
+}
+
 // WithPoll instructs the server to close the connection after messages have been returned. Don't use this option
 // directly. Use Client.Poll instead.
 func WithPoll() SubscribeOption {
@@ -8,6 +8,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
+	"time"
 )
 
 func init() {
@@ -21,6 +22,8 @@ const (
 var flagsAccess = append(
 	append([]cli.Flag{}, flagsUser...),
 	&cli.BoolFlag{Name: "reset", Aliases: []string{"r"}, Usage: "reset access for user (and topic)"},
+	&cli.StringFlag{Name: "expires", Aliases: []string{"e"}, Usage: "grant access only until the given time or for the given duration (e.g. 2d, \"tuesday, 8pm\")"},
+	&cli.BoolFlag{Name: "explain", Aliases: []string{"x"}, Usage: "show which access control entry applies to a user and topic"},
 )
 
 var cmdAccess = &cli.Command{
@@ -31,6 +34,24 @@ var cmdAccess = &cli.Command{
 	Before:    initConfigFileInputSourceFunc("config", flagsAccess, initLogFunc),
 	Action:    execUserAccess,
 	Category:  categoryServer,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "test",
+			Usage:     "Shows which access control entry applies to a user and topic",
+			UsageText: "ntfy access test USERNAME TOPIC",
+			Action:    execAccessTest,
+			Description: `Shows the effective access of a user to a topic, and explains which access control
+entry was used to determine it. This is the same as 'ntfy access --explain USERNAME TOPIC'.
+
+For a user named "test", 'ntfy access test' and 'ntfy access test TOPIC PERMISSION' still show and
+change the access of that user, since they do not match 'ntfy access test USERNAME TOPIC'. For topics
+named like a permission (e.g. "rw"), use 'ntfy access --explain USERNAME TOPIC' instead.
+
+Examples:
+  ntfy access test phil prod-db          # Shows which entry applies to user phil and topic prod-db
+  ntfy access test everyone prod-public  # Shows which entry applies to anonymous users`,
+		},
+	},
 	Description: `Manage the access control list for the ntfy server.
 
 This is a server-only command. It directly manages the user.db as defined in the server config
@@ -44,45 +65,66 @@ Usage:
   ntfy access                            # Shows access control list (alias: 'ntfy user list')
   ntfy access USERNAME                   # Shows access control entries for USERNAME
   ntfy access USERNAME TOPIC PERMISSION  # Allow/deny access for USERNAME to TOPIC
+  ntfy access --expires=DURATION USERNAME TOPIC PERMISSION  # Allow/deny access until the grant expires
+  ntfy access test USERNAME TOPIC        # Explain which entry applies to USERNAME and TOPIC
+  ntfy access --explain USERNAME TOPIC   # Same as 'ntfy access test USERNAME TOPIC'
 
 Arguments:
   USERNAME     an existing user, as created with 'ntfy user add', or "everyone"/"*"
                to define access rules for anonymous/unauthenticated clients
-  TOPIC        name of a topic with optional wildcards, e.g. "mytopic*"
+  TOPIC        name of a topic with optional wildcards, e.g. "mytopic*", "*-alerts" or "backup-??";
+               '*' matches any number of characters, '?' matches exactly one character
   PERMISSION   one of the following:
                - read-write (alias: rw) 
                - read-only (aliases: read, ro)
                - write-only (aliases: write, wo)
                - deny (alias: none)
 
+With 'test' or --explain, the command shows the effective access of a user to a topic, and which access
+control entry was used to determine it. Entries are evaluated as follows: User-specific entries
+take precedence over group entries, which take precedence over entries for "everyone". Within
+these, the most specific pattern wins (more literal characters, then fewer '*' wildcards). If
+equally specific entries match, an explicit deny entry wins. If no entry matches, the default
+access applies.
+
 Examples:
   ntfy access                        # Shows access control list (alias: 'ntfy user list')
   ntfy access phil                   # Shows access for user phil
   ntfy access phil mytopic rw        # Allow read-write access to mytopic for user phil
   ntfy access everyone mytopic rw    # Allow anonymous read-write access to mytopic
   ntfy access everyone "up*" write   # Allow anonymous write-only access to topics "up..." 
+  ntfy access -e 2d ben "inc*" rw    # Allow read-write access to topics "inc..." for user ben for 2 days
   ntfy access --reset                # Reset entire access control list
   ntfy access --reset phil           # Reset all access for user phil
   ntfy access --reset phil mytopic   # Reset access for user phil and topic mytopic
+  ntfy access test phil prod-db      # Explain which entry applies to user phil and topic prod-db
 `,
 }
 
 func execUserAccess(c *cli.Context) error {
-	if c.NArg() > 3 {
+	return execUserAccessArgs(c, c.Args().Slice())
+}
+
+func execUserAccessArgs(c *cli.Context, args []string) error {
+	if len(args) > 3 {
 		return errors.New("too many arguments, please check 'ntfy access --help' for usage details")
 	}
 	manager, err := createUserManager(c)
 	if err != nil {
 		return err
 	}
-	username := c.Args().Get(0)
+	args = append(args, "", "", "")
+	username, topic, perms := args[0], args[1], args[2]
 	if username == userEveryone {
 		username = user.Everyone
 	}
-	topic := c.Args().Get(1)
-	perms := c.Args().Get(2)
 	reset := c.Bool("reset")
-	if reset {
+	if c.Bool("explain") {
+		if reset || c.String("expires") != "" || topic == "" || perms != "" {
+			return errors.New("invalid syntax, please check 'ntfy access --help' for usage details")
+		}
+		return explainAccess(c, manager, username, topic)
+	} else if reset {
 		if perms != "" {
 			return errors.New("too many arguments, please check 'ntfy access --help' for usage details")
 		}
@@ -96,6 +138,60 @@ func execUserAccess(c *cli.Context) error {
 	return changeAccess(c, manager, username, topic, perms)
 }
 
+// execAccessTest handles 'ntfy access test USERNAME TOPIC'. Arguments that do not fit this form (e.g. a
+// permission as last argument, as in 'ntfy access test mytopic rw') are handled as 'ntfy access' arguments for
+// a user named "test". This only depends on the syntax, not on whether a user "test" exists.
+func execAccessTest(c *cli.Context) error {
+	if c.NArg() != 2 || c.Bool("reset") || c.String("expires") != "" || isPermission(c.Args().Get(1)) {
+		return execUserAccessArgs(c, append([]string{"test"}, c.Args().Slice()...))
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	username := c.Args().Get(0)
+	if username == userEveryone {
+		username = user.Everyone
+	}
+	return explainAccess(c, manager, username, c.Args().Get(1))
+}
+
+func explainAccess(c *cli.Context, manager *user.Manager, username string, topic string) error {
+	var u *user.User
+	var err error
+	if username == user.Everyone {
+		username = userEveryone
+	} else {
+		u, err = manager.User(username)
+		if err == user.ErrUserNotFound {
+			return fmt.Errorf("user %s does not exist", username)
+		} else if err != nil {
+			return err
+		}
+	}
+	if !user.AllowedTopic(topic) {
+		return errors.New("invalid topic name, wildcards are not allowed")
+	}
+	match, err := manager.ExplainAccess(u, topic)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.ErrWriter, "user %s has %s to topic %s\n", username, describePermission(match.Allow), topic)
+	switch match.Source {
+	case user.AccessSourceAdmin:
+		fmt.Fprintln(c.App.ErrWriter, "- read-write access to all topics (admin role)")
+	case user.AccessSourceUser:
+		fmt.Fprintf(c.App.ErrWriter, "- matched entry: %s to topic %s (user %s)\n", describePermission(match.Allow), match.TopicPattern, username)
+	case user.AccessSourceGroup:
+		fmt.Fprintf(c.App.ErrWriter, "- matched entry: %s to topic %s (group %s)\n", describePermission(match.Allow), match.TopicPattern, match.Group)
+	case user.AccessSourceEveryone:
+		fmt.Fprintf(c.App.ErrWriter, "- matched entry: %s to topic %s (user %s)\n", describePermission(match.Allow), match.TopicPattern, userEveryone)
+	default:
+		fmt.Fprintln(c.App.ErrWriter, "- no entry matched, default access applies (server config)")
+	}
+	return nil
+}
+
 func changeAccess(c *cli.Context, manager *user.Manager, username string, topic string, perms string) error {
 	if !util.Contains([]string{"", "read-write", "rw", "read-only", "read", "ro", "write-only", "write", "wo", "none", "deny"}, perms) {
 		return errors.New("permission must be one of: read-write, read-only, write-only, or deny (or the aliases: read, ro, write, wo, none)")
@@ -104,23 +200,37 @@ func changeAccess(c *cli.Context, manager *user.Manager, username string, topic
 	if err != nil {
 		return err
 	}
+	var expires time.Time
+	if c.String("expires") != "" {
+		expires, err = util.ParseFutureTime(c.String("expires"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
 	u, err := manager.User(username)
 	if err == user.ErrUserNotFound {
 		return fmt.Errorf("user %s does not exist", username)
 	} else if u.Role == user.RoleAdmin {
 		return fmt.Errorf("user %s is an admin user, access control entries have no effect", username)
 	}
-	if err := manager.AllowAccess(username, topic, permission); err != nil {
+	if err := manager.AllowAccessUntil(username, topic, permission, expires); err == user.ErrAccessPermanent {
+		return fmt.Errorf("user %s already has permanent access to topic %s, reset it before granting time-limited access", username, topic)
+	} else if err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditAccessAllow, username, "", user.Grant{TopicPattern: topic, Allow: permission, Expires: expires}.String())
+	until := ""
+	if !expires.IsZero() {
+		until = fmt.Sprintf(" until %s", expires.Format(time.UnixDate))
+	}
 	if permission.IsReadWrite() {
-		fmt.Fprintf(c.App.ErrWriter, "granted read-write access to topic %s\n\n", topic)
+		fmt.Fprintf(c.App.ErrWriter, "granted read-write access to topic %s%s\n\n", topic, until)
 	} else if permission.IsRead() {
-		fmt.Fprintf(c.App.ErrWriter, "granted read-only access to topic %s\n\n", topic)
+		fmt.Fprintf(c.App.ErrWriter, "granted read-only access to topic %s%s\n\n", topic, until)
 	} else if permission.IsWrite() {
-		fmt.Fprintf(c.App.ErrWriter, "granted write-only access to topic %s\n\n", topic)
+		fmt.Fprintf(c.App.ErrWriter, "granted write-only access to topic %s%s\n\n", topic, until)
 	} else {
-		fmt.Fprintf(c.App.ErrWriter, "revoked all access to topic %s\n\n", topic)
+		fmt.Fprintf(c.App.ErrWriter, "revoked all access to topic %s%s\n\n", topic, until)
 	}
 	return showUserAccess(c, manager, username)
 }
@@ -138,6 +248,7 @@ func resetAllAccess(c *cli.Context, manager *user.Manager) error {
 	if err := manager.ResetAccess("", ""); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditAccessReset, "", "", "")
 	fmt.Fprintln(c.App.ErrWriter, "reset access for all users")
 	return nil
 }
@@ -146,6 +257,7 @@ func resetUserAccess(c *cli.Context, manager *user.Manager, username string) err
 	if err := manager.ResetAccess(username, ""); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditAccessReset, username, "", "")
 	fmt.Fprintf(c.App.ErrWriter, "reset access for user %s\n\n", username)
 	return showUserAccess(c, manager, username)
 }
@@ -154,6 +266,7 @@ func resetUserTopicAccess(c *cli.Context, manager *user.Manager, username string
 	if err := manager.ResetAccess(username, topic); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditAccessReset, username, topic, "")
 	fmt.Fprintf(c.App.ErrWriter, "reset access for user %s and topic %s\n\n", username, topic)
 	return showUserAccess(c, manager, username)
 }
@@ -196,20 +309,24 @@ func showUsers(c *cli.Context, manager *user.Manager, users []*user.User) error
 		fmt.Fprintf(c.App.ErrWriter, "user %s (role: %s, tier: %s)\n", u.Name, u.Role, tier)
 		if u.Role == user.RoleAdmin {
 			fmt.Fprintf(c.App.ErrWriter, "- read-write access to all topics (admin role)\n")
-		} else if len(grants) > 0 {
-			for _, grant := range grants {
-				if grant.Allow.IsReadWrite() {
-					fmt.Fprintf(c.App.ErrWriter, "- read-write access to topic %s\n", grant.TopicPattern)
-				} else if grant.Allow.IsRead() {
-					fmt.Fprintf(c.App.ErrWriter, "- read-only access to topic %s\n", grant.TopicPattern)
-				} else if grant.Allow.IsWrite() {
-					fmt.Fprintf(c.App.ErrWriter, "- write-only access to topic %s\n", grant.TopicPattern)
-				} else {
-					fmt.Fprintf(c.App.ErrWriter, "- no access to topic %s\n", grant.TopicPattern)
+		} else {
+			groups, err := manager.UserGroups(u.Name)
+			if err != nil {
+				return err
+			}
+			groupGrants := 0
+			printGrants(c, grants, "")
+			for _, g := range groups {
+				gg, err := manager.GroupGrants(g.Name)
+				if err != nil {
+					return err
 				}
+				printGrants(c, gg, fmt.Sprintf(" (group %s)", g.Name))
+				groupGrants += len(gg)
+			}
+			if len(grants) == 0 && groupGrants == 0 {
+				fmt.Fprintf(c.App.ErrWriter, "- no topic-specific permissions\n")
 			}
-		} else {
-			fmt.Fprintf(c.App.ErrWriter, "- no topic-specific permissions\n")
 		}
 		if u.Name == user.Everyone {
 			access := manager.DefaultAccess()
@@ -226,3 +343,29 @@ func showUsers(c *cli.Context, manager *user.Manager, users []*user.User) error
 	}
 	return nil
 }
+
+func printGrants(c *cli.Context, grants []user.Grant, suffix string) {
+	for _, grant := range grants {
+		expires := ""
+		if !grant.Expires.IsZero() {
+			expires = fmt.Sprintf(" (expires %s)", grant.Expires.Format(time.UnixDate))
+		}
+		fmt.Fprintf(c.App.ErrWriter, "- %s to topic %s%s%s\n", describePermission(grant.Allow), grant.TopicPattern, suffix, expires)
+	}
+}
+
+func describePermission(p user.Permission) string {
+	if p.IsReadWrite() {
+		return "read-write access"
+	} else if p.IsRead() {
+		return "read-only access"
+	} else if p.IsWrite() {
+		return "write-only access"
+	}
+	return "no access"
+}
+
+func isPermission(s string) bool {
+	_, err := user.ParsePermission(s)
+	return err == nil
+}
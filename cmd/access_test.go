@@ -76,6 +76,86 @@ user * (role: anonymous, tier: none)
 	}))
 }
 
+func TestCLI_Access_Grant_Expires(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("benpass\nbenpass")
+	require.Nil(t, runUserCommand(app, conf, "add", "ben"))
+
+	app, _, _, stderr := newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "--expires=2d", "ben", "incident*", "rw"))
+	require.Regexp(t, `^granted read-write access to topic incident\* until .+
+
+user ben \(role: user, tier: none\)
+- read-write access to topic incident\* \(expires .+\)
+$`, stderr.String())
+
+	err := runAccessCommand(app, conf, "--expires=invalid", "ben", "incident*", "rw")
+	require.NotNil(t, err)
+}
+
+func TestCLI_Access_Explain(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("philpass\nphilpass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+	require.Nil(t, runAccessCommand(app, conf, "everyone", "prod-*", "deny"))
+	require.Nil(t, runAccessCommand(app, conf, "everyone", "prod-public", "read"))
+	require.Nil(t, runAccessCommand(app, conf, "phil", "prod-?", "rw"))
+
+	app, _, _, stderr := newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "--explain", "everyone", "prod-public"))
+	require.Equal(t, "user everyone has read-only access to topic prod-public\n- matched entry: read-only access to topic prod-public (user everyone)\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "--explain", "phil", "prod-db"))
+	require.Equal(t, "user phil has no access to topic prod-db\n- matched entry: no access to topic prod-* (user everyone)\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "--explain", "phil", "prod-1"))
+	require.Equal(t, "user phil has read-write access to topic prod-1\n- matched entry: read-write access to topic prod-? (user phil)\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "test", "phil", "prod-1"))
+	require.Equal(t, "user phil has read-write access to topic prod-1\n- matched entry: read-write access to topic prod-? (user phil)\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "--explain", "phil", "other"))
+	require.Equal(t, "user phil has no access to topic other\n- no entry matched, default access applies (server config)\n", stderr.String())
+
+	err := runAccessCommand(app, conf, "--explain", "nobody", "mytopic")
+	require.NotNil(t, err)
+	require.Equal(t, "user nobody does not exist", err.Error())
+
+	err = runAccessCommand(app, conf, "--explain", "phil")
+	require.NotNil(t, err)
+
+	// "test" is a regular username, and not confused with a command
+	app, stdin, _, _ = newTestApp()
+	stdin.WriteString("testpass\ntestpass")
+	require.Nil(t, runUserCommand(app, conf, "add", "test"))
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "test", "mytopic", "rw"))
+	require.Equal(t, "granted read-write access to topic mytopic\n\nuser test (role: user, tier: none)\n- read-write access to topic mytopic\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "--explain", "test", "mytopic"))
+	require.Equal(t, "user test has read-write access to topic mytopic\n- matched entry: read-write access to topic mytopic (user test)\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "test"))
+	require.Equal(t, "user test (role: user, tier: none)\n- read-write access to topic mytopic\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "--reset", "test", "mytopic"))
+	require.Contains(t, stderr.String(), "reset access for user test and topic mytopic\n")
+}
+
 func runAccessCommand(app *cli.App, conf *server.Config, args ...string) error {
 	userArgs := []string{
 		"ntfy",
@@ -0,0 +1,113 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"time"
+)
+
+func init() {
+	commands = append(commands, cmdAudit)
+}
+
+var flagsAudit = append(
+	append([]cli.Flag{}, flagsUser...),
+	&cli.StringFlag{Name: "actor", Aliases: []string{"a"}, Usage: "only show entries of this actor (username, \"(server)\" or \"(cli)\")"},
+	&cli.StringFlag{Name: "action", Usage: "only show entries of this action, or action group (e.g. \"user\" or \"user.add\")"},
+	&cli.StringFlag{Name: "target", Aliases: []string{"t"}, Usage: "only show entries affecting this user, group or tier"},
+	&cli.StringFlag{Name: "since", Aliases: []string{"s"}, Usage: "only show entries since this time (unix timestamp, or duration like 12h or 30d)"},
+	&cli.IntFlag{Name: "limit", Aliases: []string{"n"}, Value: 100, Usage: "maximum number of entries to show (0 for all)"},
+)
+
+var cmdAudit = &cli.Command{
+	Name:      "audit",
+	Usage:     "Show the audit log of administrative and security-relevant actions",
+	UsageText: "ntfy audit [--actor=USERNAME] [--action=ACTION] [--target=NAME] [--since=TIME] [--limit=N]",
+	Flags:     flagsAudit,
+	Before:    initConfigFileInputSourceFunc("config", flagsAudit, initLogFunc),
+	Action:    execAudit,
+	Category:  categoryServer,
+	Description: `Show the audit log of the ntfy server, newest entries first.
+
+The audit log records who created or removed users, changed roles and tiers, granted or
+revoked topic access, created or removed tokens and reservations, and which logins failed.
+Actions performed via the HTTP API record the acting user and IP address. Actions performed
+via the command line are recorded with the actor "(cli)", and actions performed by the server
+itself (e.g. expiring access control entries) with the actor "(server)".
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Examples:
+  ntfy audit                          # Shows the last 100 entries
+  ntfy audit --actor=phil --since=7d  # Shows all actions of user phil in the last 7 days
+  ntfy audit --action=user --limit=0  # Shows all user-related actions (user.add, user.role, ...)
+  ntfy audit --action=login.failed    # Shows failed logins
+`,
+}
+
+func execAudit(c *cli.Context) error {
+	filter := &user.AuditFilter{
+		Actor:  c.String("actor"),
+		Action: user.AuditAction(c.String("action")),
+		Target: c.String("target"),
+		Limit:  c.Int("limit"),
+	}
+	if c.String("since") != "" {
+		since, err := util.ParsePastTime(c.String("since"), time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid since time %s, must be a unix timestamp or a duration", c.String("since"))
+		}
+		filter.Since = since
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	entries, err := manager.AuditEntries(filter)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(c.App.ErrWriter, "no audit log entries")
+		return nil
+	}
+	for _, e := range entries {
+		actor := e.Actor
+		if actor == "" {
+			actor = "(anonymous)"
+		}
+		if e.IP.IsValid() {
+			actor = fmt.Sprintf("%s from %s", actor, e.IP.String())
+		}
+		var change string
+		if e.Before != "" && e.After != "" {
+			change = fmt.Sprintf(": %s -> %s", e.Before, e.After)
+		} else if e.Before != "" {
+			change = fmt.Sprintf(": %s", e.Before)
+		} else if e.After != "" {
+			change = fmt.Sprintf(": %s", e.After)
+		}
+		fmt.Fprintf(c.App.ErrWriter, "%s %s %s by %s%s\n", e.Time.Format(time.RFC3339), e.Action, e.Target, actor, change)
+	}
+	return nil
+}
+
+// auditCLI records an action performed via the command line in the audit log. Since the action
+// itself has already been performed, a failure is only printed as a warning.
+func auditCLI(c *cli.Context, manager *user.Manager, action user.AuditAction, target, before, after string) {
+	entry := &user.AuditEntry{
+		Actor:  user.AuditActorCLI,
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+	}
+	if err := manager.AddAuditEntry(entry); err != nil {
+		fmt.Fprintf(c.App.ErrWriter, "warning: cannot write audit log entry: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"regexp"
+	"testing"
+)
+
+func TestCLI_Audit(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, _, _, stderr := newTestApp()
+	require.Nil(t, runAuditCommand(app, conf))
+	require.Equal(t, "no audit log entries\n", stderr.String())
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+
+	app, _, _, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "change-role", "phil", "admin"))
+
+	app, _, _, _ = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "everyone", "announcements", "ro"))
+
+	timestamp := regexp.MustCompile(`(?m)^\S+ `)
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAuditCommand(app, conf))
+	require.Equal(t, `access.allow * by (cli): announcements: read-only
+user.role phil by (cli): user -> admin
+user.add phil by (cli): user
+`, timestamp.ReplaceAllString(stderr.String(), ""))
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAuditCommand(app, conf, "--action=user", "--limit=1"))
+	require.Equal(t, "user.role phil by (cli): user -> admin\n", timestamp.ReplaceAllString(stderr.String(), ""))
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAuditCommand(app, conf, "--actor=phil"))
+	require.Equal(t, "no audit log entries\n", stderr.String())
+
+	app, _, _, _ = newTestApp()
+	err := runAuditCommand(app, conf, "--since=yesterday")
+	require.NotNil(t, err)
+	require.Equal(t, "invalid since time yesterday, must be a unix timestamp or a duration", err.Error())
+}
+
+func runAuditCommand(app *cli.App, conf *server.Config, args ...string) error {
+	auditArgs := []string{
+		"ntfy",
+		"--log-level=ERROR",
+		"audit",
+		"--config=" + conf.File, // Dummy config file to avoid lookups of real file
+		"--auth-file=" + conf.AuthFile,
+		"--auth-default-access=" + conf.AuthDefault.String(),
+	}
+	return app.Run(append(auditArgs, args...))
+}
@@ -0,0 +1,323 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"strings"
+)
+
+func init() {
+	commands = append(commands, cmdGroup)
+}
+
+var flagsGroup = append([]cli.Flag{}, flagsUser...)
+
+var cmdGroup = &cli.Command{
+	Name:      "group",
+	Usage:     "Manage groups and their topic access",
+	UsageText: "ntfy group [list|add|remove|add-member|remove-member|access] ...",
+	Flags:     flagsGroup,
+	Before:    initConfigFileInputSourceFunc("config", flagsGroup, initLogFunc),
+	Category:  categoryServer,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "add",
+			Aliases:   []string{"a"},
+			Usage:     "Adds a new group",
+			UsageText: "ntfy group add [--ignore-exists] GROUP",
+			Action:    execGroupAdd,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "ignore-exists", Usage: "if the group already exists, perform no action and exit"},
+			},
+			Description: `Add a new, empty group to the ntfy user database.
+
+Group names may consist of letters, numbers, and the characters "_" and "-".
+
+Example:
+  ntfy group add ops                  # Add group "ops"`,
+		},
+		{
+			Name:      "remove",
+			Aliases:   []string{"del", "rm"},
+			Usage:     "Removes a group",
+			UsageText: "ntfy group remove GROUP",
+			Action:    execGroupDel,
+			Description: `Remove a group from the ntfy user database.
+
+Removing a group also removes all its memberships and access control entries. The
+users themselves are not removed.
+
+Example:
+  ntfy group del ops`,
+		},
+		{
+			Name:      "add-member",
+			Usage:     "Adds a user to a group",
+			UsageText: "ntfy group add-member GROUP USERNAME",
+			Action:    execGroupAddMember,
+			Description: `Add an existing user to a group.
+
+The user inherits all access control entries of the group, unless a user-specific
+entry for the same topic exists.
+
+Example:
+  ntfy group add-member ops phil`,
+		},
+		{
+			Name:      "remove-member",
+			Usage:     "Removes a user from a group",
+			UsageText: "ntfy group remove-member GROUP USERNAME",
+			Action:    execGroupRemoveMember,
+			Description: `Remove a user from a group.
+
+Example:
+  ntfy group remove-member ops phil`,
+		},
+		{
+			Name:      "access",
+			Usage:     "Grant/revoke topic access for a group, or show it",
+			UsageText: "ntfy group access [--reset] GROUP [TOPIC [PERMISSION]]",
+			Action:    execGroupAccess,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "reset", Aliases: []string{"r"}, Usage: "reset access for group (and topic)"},
+			},
+			Description: `Manage the access control list of a group.
+
+Access control entries of a group apply to all of its members. User-specific entries
+always take precedence over group entries, and group entries take precedence over
+entries for "everyone". If a user is a member of multiple groups, the most specific
+topic pattern wins. For equally specific patterns, a deny entry wins, and otherwise
+the most permissive one.
+
+PERMISSION is one of read-write (rw), read-only (read, ro), write-only (write, wo)
+or deny (none). See 'ntfy access --help' for details.
+
+Examples:
+  ntfy group access ops                   # Shows access for group ops
+  ntfy group access ops "alerts*" rw      # Allow read-write access to topics "alerts..."
+  ntfy group access --reset ops           # Reset all access for group ops
+  ntfy group access --reset ops alerts*   # Reset access for group ops and topic "alerts*"`,
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"l"},
+			Usage:   "Shows a list of groups",
+			Action:  execGroupList,
+			Description: `Shows a list of all groups, their members and their access control entries.
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.`,
+		},
+	},
+	Description: `Manage groups of the ntfy server.
+
+Groups bundle access control entries for multiple users. Instead of granting access to
+a topic for every user individually, users can be added to a group, and access can be
+granted to the group.
+
+This is a server-only command. It directly manages the user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined. Please also refer
+to the related commands 'ntfy user' and 'ntfy access'.
+
+Examples:
+  ntfy group add ops                      # Add group "ops"
+  ntfy group add-member ops phil          # Add user phil to group ops
+  ntfy group access ops "alerts*" rw      # Allow read-write access to topics "alerts..." for group ops
+  ntfy group remove-member ops phil       # Remove user phil from group ops
+  ntfy group del ops                      # Delete group ops
+`,
+}
+
+func execGroupAdd(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" {
+		return errors.New("group name expected, type 'ntfy group add --help' for help")
+	} else if !user.AllowedGroup(name) {
+		return errors.New("group name must consist only of letters, numbers, and the characters '_' and '-'")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.AddGroup(name); err == user.ErrGroupExists {
+		if c.Bool("ignore-exists") {
+			fmt.Fprintf(c.App.ErrWriter, "group %s already exists (exited successfully)\n", name)
+			return nil
+		}
+		return fmt.Errorf("group %s already exists", name)
+	} else if err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditGroupAdd, name, "", "")
+	fmt.Fprintf(c.App.ErrWriter, "group %s added\n", name)
+	return nil
+}
+
+func execGroupDel(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" {
+		return errors.New("group name expected, type 'ntfy group del --help' for help")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if _, err := manager.Group(name); err == user.ErrGroupNotFound {
+		return fmt.Errorf("group %s does not exist", name)
+	} else if err != nil {
+		return err
+	}
+	if err := manager.RemoveGroup(name); err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditGroupRemove, name, "", "")
+	fmt.Fprintf(c.App.ErrWriter, "group %s removed\n", name)
+	return nil
+}
+
+func execGroupAddMember(c *cli.Context) error {
+	name, username := c.Args().Get(0), c.Args().Get(1)
+	if name == "" || username == "" {
+		return errors.New("group name and username expected, type 'ntfy group add-member --help' for help")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.AddGroupMember(name, username); err == user.ErrGroupNotFound {
+		return fmt.Errorf("group %s does not exist", name)
+	} else if err == user.ErrUserNotFound {
+		return fmt.Errorf("user %s does not exist", username)
+	} else if err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditGroupMemberAdd, name, "", username)
+	fmt.Fprintf(c.App.ErrWriter, "user %s added to group %s\n", username, name)
+	return nil
+}
+
+func execGroupRemoveMember(c *cli.Context) error {
+	name, username := c.Args().Get(0), c.Args().Get(1)
+	if name == "" || username == "" {
+		return errors.New("group name and username expected, type 'ntfy group remove-member --help' for help")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.RemoveGroupMember(name, username); err == user.ErrGroupNotFound {
+		return fmt.Errorf("group %s does not exist", name)
+	} else if err == user.ErrUserNotFound {
+		return fmt.Errorf("user %s does not exist", username)
+	} else if err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditGroupMemberRemove, name, username, "")
+	fmt.Fprintf(c.App.ErrWriter, "user %s removed from group %s\n", username, name)
+	return nil
+}
+
+func execGroupAccess(c *cli.Context) error {
+	if c.NArg() > 3 {
+		return errors.New("too many arguments, please check 'ntfy group access --help' for usage details")
+	}
+	name, topic, perms := c.Args().Get(0), c.Args().Get(1), c.Args().Get(2)
+	if name == "" {
+		return errors.New("group name expected, type 'ntfy group access --help' for help")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	group, err := manager.Group(name)
+	if err == user.ErrGroupNotFound {
+		return fmt.Errorf("group %s does not exist", name)
+	} else if err != nil {
+		return err
+	}
+	if c.Bool("reset") {
+		if perms != "" {
+			return errors.New("too many arguments, please check 'ntfy group access --help' for usage details")
+		}
+		if err := manager.ResetGroupAccess(name, topic); err != nil {
+			return err
+		}
+		auditCLI(c, manager, user.AuditGroupAccessReset, name, topic, "")
+		if topic == "" {
+			fmt.Fprintf(c.App.ErrWriter, "reset access for group %s\n\n", name)
+		} else {
+			fmt.Fprintf(c.App.ErrWriter, "reset access for group %s and topic %s\n\n", name, topic)
+		}
+		return printGroup(c, manager, group)
+	} else if perms == "" {
+		if topic != "" {
+			return errors.New("invalid syntax, please check 'ntfy group access --help' for usage details")
+		}
+		return printGroup(c, manager, group)
+	}
+	if !util.Contains([]string{"read-write", "rw", "read-only", "read", "ro", "write-only", "write", "wo", "none", "deny"}, perms) {
+		return errors.New("permission must be one of: read-write, read-only, write-only, or deny (or the aliases: read, ro, write, wo, none)")
+	}
+	permission, err := user.ParsePermission(perms)
+	if err != nil {
+		return err
+	}
+	if err := manager.AllowGroupAccess(name, topic, permission); err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditGroupAccessAllow, name, "", user.Grant{TopicPattern: topic, Allow: permission}.String())
+	if permission.IsReadWrite() {
+		fmt.Fprintf(c.App.ErrWriter, "granted read-write access to topic %s\n\n", topic)
+	} else if permission.IsRead() {
+		fmt.Fprintf(c.App.ErrWriter, "granted read-only access to topic %s\n\n", topic)
+	} else if permission.IsWrite() {
+		fmt.Fprintf(c.App.ErrWriter, "granted write-only access to topic %s\n\n", topic)
+	} else {
+		fmt.Fprintf(c.App.ErrWriter, "revoked all access to topic %s\n\n", topic)
+	}
+	return printGroup(c, manager, group)
+}
+
+func execGroupList(c *cli.Context) error {
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	groups, err := manager.Groups()
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Fprintln(c.App.ErrWriter, "no groups")
+		return nil
+	}
+	for _, group := range groups {
+		if err := printGroup(c, manager, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printGroup(c *cli.Context, manager *user.Manager, group *user.Group) error {
+	grants, err := manager.GroupGrants(group.Name)
+	if err != nil {
+		return err
+	}
+	members := "(none)"
+	if len(group.Members) > 0 {
+		members = strings.Join(group.Members, ", ")
+	}
+	fmt.Fprintf(c.App.ErrWriter, "group %s (members: %s)\n", group.Name, members)
+	if len(grants) > 0 {
+		printGrants(c, grants, "")
+	} else {
+		fmt.Fprintf(c.App.ErrWriter, "- no topic-specific permissions\n")
+	}
+	return nil
+}
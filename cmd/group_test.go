@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"testing"
+)
+
+func TestCLI_Group_AddMemberAccessRemove(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+
+	app, _, _, stderr := newTestApp()
+	require.Nil(t, runGroupCommand(app, conf, "add", "ops"))
+	require.Equal(t, "group ops added\n", stderr.String())
+
+	err := runGroupCommand(app, conf, "add", "ops")
+	require.NotNil(t, err)
+	require.Equal(t, "group ops already exists", err.Error())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runGroupCommand(app, conf, "add-member", "ops", "phil"))
+	require.Equal(t, "user phil added to group ops\n", stderr.String())
+
+	err = runGroupCommand(app, conf, "add-member", "ops", "unknown")
+	require.NotNil(t, err)
+	require.Equal(t, "user unknown does not exist", err.Error())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runGroupCommand(app, conf, "access", "ops", "alerts*", "rw"))
+	require.Equal(t, `granted read-write access to topic alerts*
+
+group ops (members: phil)
+- read-write access to topic alerts*
+`, stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "phil"))
+	require.Equal(t, `user phil (role: user, tier: none)
+- read-write access to topic alerts* (group ops)
+`, stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runGroupCommand(app, conf, "list"))
+	require.Equal(t, `group ops (members: phil)
+- read-write access to topic alerts*
+`, stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runGroupCommand(app, conf, "access", "--reset", "ops"))
+	require.Equal(t, `reset access for group ops
+
+group ops (members: phil)
+- no topic-specific permissions
+`, stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runGroupCommand(app, conf, "remove-member", "ops", "phil"))
+	require.Equal(t, "user phil removed from group ops\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runGroupCommand(app, conf, "remove", "ops"))
+	require.Equal(t, "group ops removed\n", stderr.String())
+
+	err = runGroupCommand(app, conf, "remove", "ops")
+	require.NotNil(t, err)
+	require.Equal(t, "group ops does not exist", err.Error())
+}
+
+func runGroupCommand(app *cli.App, conf *server.Config, args ...string) error {
+	userArgs := []string{
+		"ntfy",
+		"--log-level=ERROR",
+		"group",
+		"--config=" + conf.File, // Dummy config file to avoid lookups of real file
+		"--auth-file=" + conf.AuthFile,
+		"--auth-default-access=" + conf.AuthDefault.String(),
+	}
+	return app.Run(append(userArgs, args...))
+}
@@ -0,0 +1,439 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"strconv"
+	"time"
+)
+
+func init() {
+	commands = append(commands, cmdSchedule)
+}
+
+const defaultSchedulePeriod = "7d"
+
+var flagsSchedule = append([]cli.Flag{}, flagsUser...)
+
+var cmdSchedule = &cli.Command{
+	Name:      "schedule",
+	Usage:     "Manage on-call schedules",
+	UsageText: "ntfy schedule [list|add|change|remove|add-member|remove-member|override|remove-override] ...",
+	Flags:     flagsSchedule,
+	Before:    initConfigFileInputSourceFunc("config", flagsSchedule, initLogFunc),
+	Category:  categoryServer,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "add",
+			Aliases:   []string{"a"},
+			Usage:     "Adds a new on-call schedule",
+			UsageText: "ntfy schedule add [--handoff=TIME] [--period=DURATION] [--owner=USERNAME] SCHEDULE",
+			Action:    execScheduleAdd,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "handoff", Usage: "time of the first handoff (unix timestamp, duration or natural language, e.g. \"monday, 9am\"); defaults to now"},
+				&cli.StringFlag{Name: "period", Value: defaultSchedulePeriod, Usage: "time between handoffs, e.g. 7d or 12h"},
+				&cli.StringFlag{Name: "owner", Usage: "user that may page the schedule via X-On-Call (besides admins)"},
+			},
+			Description: `Add a new, empty on-call schedule to the ntfy user database.
+
+At the handoff time, the first member of the rotation goes on call. After each period,
+the next member takes over, starting over with the first member after the last one.
+
+Schedule names may consist of letters, numbers, and the characters "_" and "-".
+
+Only admins and the owner of a schedule may page it when publishing with X-On-Call.
+
+Examples:
+  ntfy schedule add ops                                  # Weekly rotation, starting now
+  ntfy schedule add --handoff="monday, 9am" --period=7d ops  # Weekly rotation, handoff Mondays at 9am
+  ntfy schedule add --owner=phil ops                     # Weekly rotation, phil may page the schedule`,
+		},
+		{
+			Name:      "change",
+			Aliases:   []string{"chg"},
+			Usage:     "Changes the handoff time, rotation period or owner of a schedule",
+			UsageText: "ntfy schedule change [--handoff=TIME] [--period=DURATION] [--owner=USERNAME] SCHEDULE",
+			Action:    execScheduleChange,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "handoff", Usage: "time of the first handoff (unix timestamp, duration or natural language)"},
+				&cli.StringFlag{Name: "period", Usage: "time between handoffs, e.g. 7d or 12h"},
+				&cli.StringFlag{Name: "owner", Usage: "user that may page the schedule via X-On-Call (besides admins), empty to remove"},
+			},
+			Description: `Change the handoff time, rotation period or owner of an on-call schedule.
+
+Examples:
+  ntfy schedule change --period=14d ops   # Change the rotation period to two weeks
+  ntfy schedule change --owner=ben ops    # Allow ben to page the schedule
+  ntfy schedule change --owner= ops       # Remove the owner, only admins may page the schedule`,
+		},
+		{
+			Name:      "remove",
+			Aliases:   []string{"del", "rm"},
+			Usage:     "Removes a schedule",
+			UsageText: "ntfy schedule remove SCHEDULE",
+			Action:    execScheduleDel,
+			Description: `Remove an on-call schedule, including its rotation and overrides, from the ntfy user database.
+
+Example:
+  ntfy schedule del ops`,
+		},
+		{
+			Name:      "add-member",
+			Usage:     "Adds a user to the end of a schedule's rotation",
+			UsageText: "ntfy schedule add-member [--email=EMAIL] SCHEDULE USERNAME",
+			Action:    execScheduleAddMember,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "email", Aliases: []string{"e"}, Usage: "e-mail address to notify while the user is on call"},
+			},
+			Description: `Add an existing user to the end of a schedule's rotation.
+
+When the user is on call, messages published with "X-On-Call: SCHEDULE" are sent to the
+given e-mail address (if any), and to the user's first verified phone number (if any).
+If the user is already a member, only the e-mail address is updated.
+
+Example:
+  ntfy schedule add-member --email=phil@example.com ops phil`,
+		},
+		{
+			Name:      "remove-member",
+			Usage:     "Removes a user from a schedule's rotation",
+			UsageText: "ntfy schedule remove-member SCHEDULE USERNAME",
+			Action:    execScheduleRemoveMember,
+			Description: `Remove a user from a schedule's rotation.
+
+Example:
+  ntfy schedule remove-member ops phil`,
+		},
+		{
+			Name:      "override",
+			Usage:     "Puts a user on call for a limited time",
+			UsageText: "ntfy schedule override [--from=TIME] --until=TIME SCHEDULE USERNAME",
+			Action:    execScheduleOverride,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "from", Usage: "start of the override (unix timestamp, duration or natural language); defaults to now"},
+				&cli.StringFlag{Name: "until", Usage: "end of the override (unix timestamp, duration or natural language)"},
+			},
+			Description: `Put a user on call for a limited time, regardless of the rotation, e.g. to cover for
+vacations. The user does not have to be a member of the rotation. If overrides overlap,
+the most recently added one wins.
+
+Examples:
+  ntfy schedule override --until=2d ops ben                       # Ben is on call for 2 days
+  ntfy schedule override --from="friday, 6pm" --until="monday, 9am" ops ben`,
+		},
+		{
+			Name:      "remove-override",
+			Usage:     "Removes an override from a schedule",
+			UsageText: "ntfy schedule remove-override SCHEDULE ID",
+			Action:    execScheduleRemoveOverride,
+			Description: `Remove an override from a schedule. The override ID is shown in 'ntfy schedule list'.
+
+Example:
+  ntfy schedule remove-override ops 3`,
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"l"},
+			Usage:   "Shows a list of schedules",
+			Action:  execScheduleList,
+			Description: `Shows a list of all on-call schedules, their rotation, overrides, and who is currently on call.
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.`,
+		},
+	},
+	Description: `Manage on-call schedules of the ntfy server.
+
+An on-call schedule is a rotation of users that hand off to each other at regular intervals.
+Messages published with the "X-On-Call: SCHEDULE" header are e-mailed and/or phoned to the
+user that is currently on call, instead of everyone having to subscribe to every topic.
+
+This is a server-only command. It directly manages the user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Examples:
+  ntfy schedule add ops                               # Add weekly schedule "ops"
+  ntfy schedule add-member --email=phil@example.com ops phil
+  ntfy schedule add-member ops ben                    # Ben takes over from phil after a week
+  ntfy schedule override --until=2d ops ben           # Ben is on call for the next 2 days
+  ntfy schedule list                                  # Shows who is on call
+`,
+}
+
+func execScheduleAdd(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" {
+		return errors.New("schedule name expected, type 'ntfy schedule add --help' for help")
+	} else if !user.AllowedSchedule(name) {
+		return errors.New("schedule name must consist only of letters, numbers, and the characters '_' and '-'")
+	}
+	handoff := time.Now()
+	if c.String("handoff") != "" {
+		var err error
+		if handoff, err = parseScheduleTime(c.String("handoff")); err != nil {
+			return err
+		}
+	}
+	period, err := parseSchedulePeriod(c.String("period"))
+	if err != nil {
+		return err
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.AddSchedule(name, handoff, period); err == user.ErrScheduleExists {
+		return fmt.Errorf("schedule %s already exists", name)
+	} else if err != nil {
+		return err
+	}
+	owner := c.String("owner")
+	if owner != "" {
+		if err := manager.ChangeScheduleOwner(name, owner); err == user.ErrUserNotFound {
+			return fmt.Errorf("user %s does not exist", owner)
+		} else if err != nil {
+			return err
+		}
+	}
+	auditCLI(c, manager, user.AuditScheduleAdd, name, "", (&user.Schedule{Handoff: handoff, Period: period, Owner: owner}).Summary())
+	fmt.Fprintf(c.App.ErrWriter, "schedule %s added\n", name)
+	return nil
+}
+
+func execScheduleChange(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" {
+		return errors.New("schedule name expected, type 'ntfy schedule change --help' for help")
+	} else if c.String("handoff") == "" && c.String("period") == "" && !c.IsSet("owner") {
+		return errors.New("nothing to change, pass --handoff, --period and/or --owner")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	schedule, err := manager.Schedule(name)
+	if err == user.ErrScheduleNotFound {
+		return fmt.Errorf("schedule %s does not exist", name)
+	} else if err != nil {
+		return err
+	}
+	before := schedule.Summary()
+	if c.String("handoff") != "" {
+		if schedule.Handoff, err = parseScheduleTime(c.String("handoff")); err != nil {
+			return err
+		}
+	}
+	if c.String("period") != "" {
+		if schedule.Period, err = parseSchedulePeriod(c.String("period")); err != nil {
+			return err
+		}
+	}
+	if err := manager.ChangeSchedule(name, schedule.Handoff, schedule.Period); err != nil {
+		return err
+	}
+	if c.IsSet("owner") {
+		if err := manager.ChangeScheduleOwner(name, c.String("owner")); err == user.ErrUserNotFound {
+			return fmt.Errorf("user %s does not exist", c.String("owner"))
+		} else if err != nil {
+			return err
+		}
+		schedule.Owner = c.String("owner")
+	}
+	auditCLI(c, manager, user.AuditScheduleChange, name, before, schedule.Summary())
+	fmt.Fprintf(c.App.ErrWriter, "schedule %s changed\n", name)
+	return nil
+}
+
+func execScheduleDel(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" {
+		return errors.New("schedule name expected, type 'ntfy schedule del --help' for help")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if _, err := manager.Schedule(name); err == user.ErrScheduleNotFound {
+		return fmt.Errorf("schedule %s does not exist", name)
+	} else if err != nil {
+		return err
+	}
+	if err := manager.RemoveSchedule(name); err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditScheduleRemove, name, "", "")
+	fmt.Fprintf(c.App.ErrWriter, "schedule %s removed\n", name)
+	return nil
+}
+
+func execScheduleAddMember(c *cli.Context) error {
+	name, username := c.Args().Get(0), c.Args().Get(1)
+	if name == "" || username == "" {
+		return errors.New("schedule name and username expected, type 'ntfy schedule add-member --help' for help")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.AddScheduleMember(name, username, c.String("email")); err == user.ErrScheduleNotFound {
+		return fmt.Errorf("schedule %s does not exist", name)
+	} else if err == user.ErrUserNotFound {
+		return fmt.Errorf("user %s does not exist", username)
+	} else if err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditScheduleMemberAdd, name, "", username)
+	fmt.Fprintf(c.App.ErrWriter, "user %s added to schedule %s\n", username, name)
+	return nil
+}
+
+func execScheduleRemoveMember(c *cli.Context) error {
+	name, username := c.Args().Get(0), c.Args().Get(1)
+	if name == "" || username == "" {
+		return errors.New("schedule name and username expected, type 'ntfy schedule remove-member --help' for help")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.RemoveScheduleMember(name, username); err == user.ErrScheduleNotFound {
+		return fmt.Errorf("schedule %s does not exist", name)
+	} else if err == user.ErrUserNotFound {
+		return fmt.Errorf("user %s does not exist", username)
+	} else if err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditScheduleMemberRemove, name, username, "")
+	fmt.Fprintf(c.App.ErrWriter, "user %s removed from schedule %s\n", username, name)
+	return nil
+}
+
+func execScheduleOverride(c *cli.Context) error {
+	name, username := c.Args().Get(0), c.Args().Get(1)
+	if name == "" || username == "" {
+		return errors.New("schedule name and username expected, type 'ntfy schedule override --help' for help")
+	} else if c.String("until") == "" {
+		return errors.New("end of override expected, pass --until")
+	}
+	start := time.Now()
+	if c.String("from") != "" {
+		var err error
+		if start, err = parseScheduleTime(c.String("from")); err != nil {
+			return err
+		}
+	}
+	end, err := parseScheduleTime(c.String("until"))
+	if err != nil {
+		return err
+	} else if !end.After(start) {
+		return errors.New("end of override must be after its start")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	override := &user.ScheduleOverride{
+		Username: username,
+		Start:    start,
+		End:      end,
+	}
+	override.ID, err = manager.AddScheduleOverride(name, username, start, end)
+	if err == user.ErrScheduleNotFound {
+		return fmt.Errorf("schedule %s does not exist", name)
+	} else if err == user.ErrUserNotFound {
+		return fmt.Errorf("user %s does not exist", username)
+	} else if err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditScheduleOverrideAdd, name, "", override.String())
+	fmt.Fprintf(c.App.ErrWriter, "override %d added to schedule %s: %s\n", override.ID, name, override.String())
+	return nil
+}
+
+func execScheduleRemoveOverride(c *cli.Context) error {
+	name, idStr := c.Args().Get(0), c.Args().Get(1)
+	if name == "" || idStr == "" {
+		return errors.New("schedule name and override ID expected, type 'ntfy schedule remove-override --help' for help")
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid override ID %s", idStr)
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.RemoveScheduleOverride(name, id); err == user.ErrScheduleNotFound {
+		return fmt.Errorf("schedule %s does not exist", name)
+	} else if err != nil {
+		return err
+	}
+	auditCLI(c, manager, user.AuditScheduleOverrideRemove, name, idStr, "")
+	fmt.Fprintf(c.App.ErrWriter, "override %d removed from schedule %s\n", id, name)
+	return nil
+}
+
+func execScheduleList(c *cli.Context) error {
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	schedules, err := manager.Schedules()
+	if err != nil {
+		return err
+	}
+	if len(schedules) == 0 {
+		fmt.Fprintln(c.App.ErrWriter, "no schedules")
+		return nil
+	}
+	now := time.Now()
+	for _, schedule := range schedules {
+		onCall := "(no one)"
+		if m := schedule.OnCall(now); m != nil {
+			onCall = m.Username
+		}
+		fmt.Fprintf(c.App.ErrWriter, "schedule %s (on call: %s, next handoff: %s)\n", schedule.Name, onCall, schedule.NextHandoff(now).Format(time.RFC3339))
+		fmt.Fprintf(c.App.ErrWriter, "- rotation %s\n", schedule.Rotation())
+		if schedule.Owner != "" {
+			fmt.Fprintf(c.App.ErrWriter, "- owner %s\n", schedule.Owner)
+		}
+		if len(schedule.Members) == 0 {
+			fmt.Fprintf(c.App.ErrWriter, "- no members\n")
+		}
+		for i, m := range schedule.Members {
+			if m.Email != "" {
+				fmt.Fprintf(c.App.ErrWriter, "- member %d: %s (%s)\n", i+1, m.Username, m.Email)
+			} else {
+				fmt.Fprintf(c.App.ErrWriter, "- member %d: %s\n", i+1, m.Username)
+			}
+		}
+		for _, o := range schedule.Overrides {
+			fmt.Fprintf(c.App.ErrWriter, "- override %d: %s\n", o.ID, o.String())
+		}
+	}
+	return nil
+}
+
+// parseScheduleTime parses a handoff or override time, which may be in the future or in the past
+func parseScheduleTime(s string) (time.Time, error) {
+	now := time.Now()
+	if t, err := util.ParseFutureTime(s, now); err == nil {
+		return t, nil
+	} else if t, err := util.ParsePastTime(s, now); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s, must be a unix timestamp, a duration or natural language, e.g. \"monday, 9am\"", s)
+}
+
+func parseSchedulePeriod(s string) (time.Duration, error) {
+	period, err := util.ParseDuration(s)
+	if err != nil || period < time.Minute {
+		return 0, fmt.Errorf("invalid period %s, must be a duration of at least one minute, e.g. 7d or 12h", s)
+	}
+	return period, nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"testing"
+)
+
+func TestCLI_Schedule_AddMembersOverrideList(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+
+	app, stdin, _, _ = newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "ben"))
+
+	app, _, _, stderr := newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "list"))
+	require.Equal(t, "no schedules\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "add", "--period=7d", "ops"))
+	require.Equal(t, "schedule ops added\n", stderr.String())
+
+	app, _, _, _ = newTestApp()
+	require.Equal(t, "schedule ops already exists", runScheduleCommand(app, conf, "add", "ops").Error())
+
+	app, _, _, _ = newTestApp()
+	require.Equal(t, "invalid period 1s, must be a duration of at least one minute, e.g. 7d or 12h", runScheduleCommand(app, conf, "add", "--period=1s", "short").Error())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "add-member", "--email=phil@example.com", "ops", "phil"))
+	require.Equal(t, "user phil added to schedule ops\n", stderr.String())
+
+	app, _, _, _ = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "add-member", "ops", "ben"))
+
+	app, _, _, _ = newTestApp()
+	require.Equal(t, "user doesnotexist does not exist", runScheduleCommand(app, conf, "add-member", "ops", "doesnotexist").Error())
+
+	app, _, _, _ = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "change", "--owner=ben", "ops"))
+
+	app, _, _, _ = newTestApp()
+	require.Equal(t, "user doesnotexist does not exist", runScheduleCommand(app, conf, "change", "--owner=doesnotexist", "ops").Error())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "list"))
+	require.Contains(t, stderr.String(), "schedule ops (on call: phil, next handoff: ")
+	require.Contains(t, stderr.String(), "- rotation every 168h0m0s, starting ")
+	require.Contains(t, stderr.String(), "- owner ben\n")
+	require.Contains(t, stderr.String(), "- member 1: phil (phil@example.com)\n- member 2: ben\n")
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "override", "--until=2d", "ops", "ben"))
+	require.Contains(t, stderr.String(), "override 1 added to schedule ops: ben from ")
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "list"))
+	require.Contains(t, stderr.String(), "schedule ops (on call: ben, next handoff: ")
+	require.Contains(t, stderr.String(), "- override 1: ben from ")
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "remove-override", "ops", "1"))
+	require.Equal(t, "override 1 removed from schedule ops\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "remove-member", "ops", "phil"))
+	require.Equal(t, "user phil removed from schedule ops\n", stderr.String())
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "list"))
+	require.Contains(t, stderr.String(), "schedule ops (on call: ben, next handoff: ")
+
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runScheduleCommand(app, conf, "del", "ops"))
+	require.Equal(t, "schedule ops removed\n", stderr.String())
+
+	app, _, _, _ = newTestApp()
+	require.Equal(t, "schedule ops does not exist", runScheduleCommand(app, conf, "del", "ops").Error())
+}
+
+func runScheduleCommand(app *cli.App, conf *server.Config, args ...string) error {
+	scheduleArgs := []string{
+		"ntfy",
+		"--log-level=ERROR",
+		"schedule",
+		"--config=" + conf.File, // Dummy config file to avoid lookups of real file
+		"--auth-file=" + conf.AuthFile,
+		"--auth-default-access=" + conf.AuthDefault.String(),
+	}
+	return app.Run(append(scheduleArgs, args...))
+}
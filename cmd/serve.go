@@ -48,14 +48,22 @@ var flagsServe = append(
 	altsrc.NewDurationFlag(&cli.DurationFlag{Name: "cache-duration", Aliases: []string{"cache_duration", "b"}, EnvVars: []string{"NTFY_CACHE_DURATION"}, Value: server.DefaultCacheDuration, Usage: "buffer messages for this time to allow `since` requests"}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "cache-batch-size", Aliases: []string{"cache_batch_size"}, EnvVars: []string{"NTFY_BATCH_SIZE"}, Usage: "max size of messages to batch together when writing to message cache (if zero, writes are synchronous)"}),
 	altsrc.NewDurationFlag(&cli.DurationFlag{Name: "cache-batch-timeout", Aliases: []string{"cache_batch_timeout"}, EnvVars: []string{"NTFY_CACHE_BATCH_TIMEOUT"}, Usage: "timeout for batched async writes to the message cache (if zero, writes are synchronous)"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "cache-keep-last", Aliases: []string{"cache_keep_last"}, EnvVars: []string{"NTFY_CACHE_KEEP_LAST"}, Usage: "number of messages to retain per topic (if zero, messages are only deleted by age)"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "cache-keep-last-mode", Aliases: []string{"cache_keep_last_mode"}, EnvVars: []string{"NTFY_CACHE_KEEP_LAST_MODE"}, Value: server.KeepLastModeKeep, Usage: "keep-last retention mode, either 'keep' (keep N messages regardless of age) or 'cap' (keep at most N messages)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "cache-startup-queries", Aliases: []string{"cache_startup_queries"}, EnvVars: []string{"NTFY_CACHE_STARTUP_QUERIES"}, Usage: "queries run when the cache database is initialized"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-file", Aliases: []string{"auth_file", "H"}, EnvVars: []string{"NTFY_AUTH_FILE"}, Usage: "auth database file used for access control"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-startup-queries", Aliases: []string{"auth_startup_queries"}, EnvVars: []string{"NTFY_AUTH_STARTUP_QUERIES"}, Usage: "queries run when the auth database is initialized"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-default-access", Aliases: []string{"auth_default_access", "p"}, EnvVars: []string{"NTFY_AUTH_DEFAULT_ACCESS"}, Value: "read-write", Usage: "default permissions if no matching entries in the auth database are found"}),
+	altsrc.NewDurationFlag(&cli.DurationFlag{Name: "auth-audit-retention", Aliases: []string{"auth_audit_retention"}, EnvVars: []string{"NTFY_AUTH_AUDIT_RETENTION"}, Value: server.DefaultAuthAuditRetention, Usage: "keep audit log entries for this time before deleting them (0 = forever)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-cache-dir", Aliases: []string{"attachment_cache_dir"}, EnvVars: []string{"NTFY_ATTACHMENT_CACHE_DIR"}, Usage: "cache directory for attached files"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-total-size-limit", Aliases: []string{"attachment_total_size_limit", "A"}, EnvVars: []string{"NTFY_ATTACHMENT_TOTAL_SIZE_LIMIT"}, DefaultText: "5G", Usage: "limit of the on-disk attachment cache"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-file-size-limit", Aliases: []string{"attachment_file_size_limit", "Y"}, EnvVars: []string{"NTFY_ATTACHMENT_FILE_SIZE_LIMIT"}, DefaultText: "15M", Usage: "per-file attachment size limit (e.g. 300k, 2M, 100M)"}),
 	altsrc.NewDurationFlag(&cli.DurationFlag{Name: "attachment-expiry-duration", Aliases: []string{"attachment_expiry_duration", "X"}, EnvVars: []string{"NTFY_ATTACHMENT_EXPIRY_DURATION"}, Value: server.DefaultAttachmentExpiryDuration, DefaultText: "3h", Usage: "duration after which uploaded attachments will be deleted (e.g. 3h, 20h)"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "subscriber-queue-size", Aliases: []string{"subscriber_queue_size"}, EnvVars: []string{"NTFY_SUBSCRIBER_QUEUE_SIZE"}, Value: server.DefaultSubscriberQueueSize, Usage: "max number of messages queued per subscriber before the overflow policy applies"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "subscriber-queue-overflow-policy", Aliases: []string{"subscriber_queue_overflow_policy"}, EnvVars: []string{"NTFY_SUBSCRIBER_QUEUE_OVERFLOW_POLICY"}, Value: server.SubscriberQueueOverflowDropOldest, Usage: "what to do if a subscriber queue is full, either 'drop-oldest' or 'disconnect'"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "subscriber-pattern-topic-limit", Aliases: []string{"subscriber_pattern_topic_limit"}, EnvVars: []string{"NTFY_SUBSCRIBER_PATTERN_TOPIC_LIMIT"}, Value: server.DefaultSubscriberPatternTopicLimit, Usage: "max number of topics a topic pattern subscription (e.g. alerts-*) may match"}),
+	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "enable-topic-patterns", Aliases: []string{"enable_topic_patterns"}, EnvVars: []string{"NTFY_ENABLE_TOPIC_PATTERNS"}, Value: false, Usage: "allows logged-in users to subscribe to topic patterns (e.g. alerts-*)"}),
+	altsrc.NewDurationFlag(&cli.DurationFlag{Name: "sse-retry", Aliases: []string{"sse_retry"}, EnvVars: []string{"NTFY_SSE_RETRY"}, Usage: "reconnection delay sent to SSE (EventSource) clients, if set"}),
 	altsrc.NewDurationFlag(&cli.DurationFlag{Name: "keepalive-interval", Aliases: []string{"keepalive_interval", "k"}, EnvVars: []string{"NTFY_KEEPALIVE_INTERVAL"}, Value: server.DefaultKeepaliveInterval, Usage: "interval of keepalive messages"}),
 	altsrc.NewDurationFlag(&cli.DurationFlag{Name: "manager-interval", Aliases: []string{"manager_interval", "m"}, EnvVars: []string{"NTFY_MANAGER_INTERVAL"}, Value: server.DefaultManagerInterval, Usage: "interval of for message pruning and stats printing"}),
 	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "disallowed-topics", Aliases: []string{"disallowed_topics"}, EnvVars: []string{"NTFY_DISALLOWED_TOPICS"}, Usage: "topics that are not allowed to be used"}),
@@ -144,14 +152,22 @@ func execServe(c *cli.Context) error {
 	cacheStartupQueries := c.String("cache-startup-queries")
 	cacheBatchSize := c.Int("cache-batch-size")
 	cacheBatchTimeout := c.Duration("cache-batch-timeout")
+	cacheKeepLast := c.Int("cache-keep-last")
+	cacheKeepLastMode := c.String("cache-keep-last-mode")
 	authFile := c.String("auth-file")
 	authStartupQueries := c.String("auth-startup-queries")
 	authDefaultAccess := c.String("auth-default-access")
+	authAuditRetention := c.Duration("auth-audit-retention")
 	attachmentCacheDir := c.String("attachment-cache-dir")
 	attachmentTotalSizeLimitStr := c.String("attachment-total-size-limit")
 	attachmentFileSizeLimitStr := c.String("attachment-file-size-limit")
 	attachmentExpiryDuration := c.Duration("attachment-expiry-duration")
 	keepaliveInterval := c.Duration("keepalive-interval")
+	sseRetry := c.Duration("sse-retry")
+	subscriberQueueSize := c.Int("subscriber-queue-size")
+	subscriberQueueOverflowPolicy := c.String("subscriber-queue-overflow-policy")
+	subscriberPatternTopicLimit := c.Int("subscriber-pattern-topic-limit")
+	enableTopicPatterns := c.Bool("enable-topic-patterns")
 	managerInterval := c.Duration("manager-interval")
 	disallowedTopics := c.StringSlice("disallowed-topics")
 	webRoot := c.String("web-root")
@@ -197,10 +213,22 @@ func execServe(c *cli.Context) error {
 		return errors.New("if web push is enabled, web-push-private-key, web-push-public-key, web-push-file, web-push-email-address, and base-url should be set. run 'ntfy webpush keys' to generate keys")
 	} else if keepaliveInterval < 5*time.Second {
 		return errors.New("keepalive interval cannot be lower than five seconds")
+	} else if sseRetry < 0 {
+		return errors.New("sse-retry cannot be negative")
+	} else if subscriberQueueSize < 1 {
+		return errors.New("subscriber queue size must be at least one")
+	} else if subscriberQueueOverflowPolicy != server.SubscriberQueueOverflowDropOldest && subscriberQueueOverflowPolicy != server.SubscriberQueueOverflowDisconnect {
+		return errors.New("subscriber queue overflow policy must be either 'drop-oldest' or 'disconnect'")
+	} else if subscriberPatternTopicLimit < 1 {
+		return errors.New("subscriber pattern topic limit must be at least one")
 	} else if managerInterval < 5*time.Second {
 		return errors.New("manager interval cannot be lower than five seconds")
 	} else if cacheDuration > 0 && cacheDuration < managerInterval {
 		return errors.New("cache duration cannot be lower than manager interval")
+	} else if cacheKeepLast < 0 {
+		return errors.New("cache keep last cannot be negative")
+	} else if cacheKeepLastMode != server.KeepLastModeKeep && cacheKeepLastMode != server.KeepLastModeCap {
+		return errors.New("cache keep last mode must be either 'keep' or 'cap'")
 	} else if keyFile != "" && !util.FileExists(keyFile) {
 		return errors.New("if set, key file must exist")
 	} else if certFile != "" && !util.FileExists(certFile) {
@@ -227,6 +255,8 @@ func execServe(c *cli.Context) error {
 		return errors.New("base-url and upstream-base-url cannot be identical, you'll likely want to set upstream-base-url to https://ntfy.sh, see https://ntfy.sh/docs/config/#ios-instant-notifications")
 	} else if authFile == "" && (enableSignup || enableLogin || enableReservations || stripeSecretKey != "") {
 		return errors.New("cannot set enable-signup, enable-login, enable-reserve-topics, or stripe-secret-key if auth-file is not set")
+	} else if authFile == "" && enableTopicPatterns {
+		return errors.New("cannot set enable-topic-patterns if auth-file is not set")
 	} else if enableSignup && !enableLogin {
 		return errors.New("cannot set enable-signup without also setting enable-login")
 	} else if stripeSecretKey != "" && (stripeWebhookKey == "" || baseURL == "") {
@@ -313,14 +343,22 @@ func execServe(c *cli.Context) error {
 	conf.CacheStartupQueries = cacheStartupQueries
 	conf.CacheBatchSize = cacheBatchSize
 	conf.CacheBatchTimeout = cacheBatchTimeout
+	conf.CacheKeepLast = cacheKeepLast
+	conf.CacheKeepLastMode = cacheKeepLastMode
 	conf.AuthFile = authFile
 	conf.AuthStartupQueries = authStartupQueries
 	conf.AuthDefault = authDefault
+	conf.AuthAuditRetention = authAuditRetention
 	conf.AttachmentCacheDir = attachmentCacheDir
 	conf.AttachmentTotalSizeLimit = attachmentTotalSizeLimit
 	conf.AttachmentFileSizeLimit = attachmentFileSizeLimit
 	conf.AttachmentExpiryDuration = attachmentExpiryDuration
 	conf.KeepaliveInterval = keepaliveInterval
+	conf.SSERetry = sseRetry
+	conf.SubscriberQueueSize = subscriberQueueSize
+	conf.SubscriberQueueOverflowPolicy = subscriberQueueOverflowPolicy
+	conf.SubscriberPatternTopicLimit = subscriberPatternTopicLimit
+	conf.EnableTopicPatterns = enableTopicPatterns
 	conf.ManagerInterval = managerInterval
 	conf.DisallowedTopics = disallowedTopics
 	conf.WebRoot = webRoot
@@ -29,6 +29,7 @@ var flagsSubscribe = append(
 	append([]cli.Flag{}, flagsDefault...),
 	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, Usage: "client config file"},
 	&cli.StringFlag{Name: "since", Aliases: []string{"s"}, Usage: "return events since `SINCE` (Unix timestamp, or all)"},
+	&cli.StringFlag{Name: "consumer", Usage: "durable subscription name; the server remembers the last delivered message and resumes from there"},
 	&cli.StringFlag{Name: "user", Aliases: []string{"u"}, EnvVars: []string{"NTFY_USER"}, Usage: "username[:password] used to auth against the server"},
 	&cli.StringFlag{Name: "token", Aliases: []string{"k"}, EnvVars: []string{"NTFY_TOKEN"}, Usage: "access token used to auth against the server"},
 	&cli.BoolFlag{Name: "from-config", Aliases: []string{"from_config", "C"}, Usage: "read subscriptions from config file (service mode)"},
@@ -58,6 +59,7 @@ ntfy subscribe TOPIC
     ntfy sub home.lan/backups         # Subscribe to topic on different server
     ntfy sub --poll home.lan/backups  # Just query for latest messages and exit
     ntfy sub -u phil:mypass secret    # Subscribe with username/password
+    ntfy sub --consumer=laptop alerts # Durable subscription, resumes where it left off
   
 ntfy subscribe TOPIC COMMAND
   This executes COMMAND for every incoming messages. The message fields are passed to the
@@ -97,6 +99,7 @@ func execSubscribe(c *cli.Context) error {
 	}
 	cl := client.New(conf)
 	since := c.String("since")
+	consumer := c.String("consumer")
 	user := c.String("user")
 	token := c.String("token")
 	poll := c.Bool("poll")
@@ -117,6 +120,9 @@ func execSubscribe(c *cli.Context) error {
 	if since != "" {
 		options = append(options, client.WithSince(since))
 	}
+	if consumer != "" {
+		options = append(options, client.WithConsumer(consumer))
+	}
 	if token != "" {
 		options = append(options, client.WithBearerAuth(token))
 	} else if user != "" {
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/server"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
 )
@@ -48,6 +49,7 @@ var cmdTier = &cli.Command{
 				&cli.StringFlag{Name: "name", Usage: "tier name"},
 				&cli.Int64Flag{Name: "message-limit", Value: defaultMessageLimit, Usage: "daily message limit"},
 				&cli.StringFlag{Name: "message-expiry-duration", Value: defaultMessageExpiryDuration, Usage: "duration after which messages are deleted"},
+				&cli.Int64Flag{Name: "message-keep-last", Usage: "number of messages to keep per reserved topic (overrides cache-keep-last)"},
 				&cli.Int64Flag{Name: "email-limit", Value: defaultEmailLimit, Usage: "daily email limit"},
 				&cli.Int64Flag{Name: "call-limit", Value: defaultCallLimit, Usage: "daily phone call limit"},
 				&cli.Int64Flag{Name: "reservation-limit", Value: defaultReservationLimit, Usage: "topic reservation limit"},
@@ -92,6 +94,7 @@ Examples:
 				&cli.StringFlag{Name: "name", Usage: "tier name"},
 				&cli.Int64Flag{Name: "message-limit", Usage: "daily message limit"},
 				&cli.StringFlag{Name: "message-expiry-duration", Usage: "duration after which messages are deleted"},
+				&cli.Int64Flag{Name: "message-keep-last", Usage: "number of messages to keep per reserved topic (overrides cache-keep-last)"},
 				&cli.Int64Flag{Name: "email-limit", Usage: "daily email limit"},
 				&cli.Int64Flag{Name: "call-limit", Usage: "daily phone call limit"},
 				&cli.Int64Flag{Name: "reservation-limit", Usage: "topic reservation limit"},
@@ -217,6 +220,7 @@ func execTierAdd(c *cli.Context) error {
 		Name:                     name,
 		MessageLimit:             c.Int64("message-limit"),
 		MessageExpiryDuration:    messageExpiryDuration,
+		MessageKeepLast:          c.Int64("message-keep-last"),
 		EmailLimit:               c.Int64("email-limit"),
 		CallLimit:                c.Int64("call-limit"),
 		ReservationLimit:         c.Int64("reservation-limit"),
@@ -234,6 +238,7 @@ func execTierAdd(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditTierAdd, code, "", server.DescribeTier(tier))
 	fmt.Fprintf(c.App.ErrWriter, "tier added\n\n")
 	printTier(c, tier)
 	return nil
@@ -256,6 +261,7 @@ func execTierChange(c *cli.Context) error {
 	} else if err != nil {
 		return err
 	}
+	before := server.DescribeTier(tier)
 	if c.IsSet("name") {
 		tier.Name = c.String("name")
 	}
@@ -268,6 +274,9 @@ func execTierChange(c *cli.Context) error {
 			return err
 		}
 	}
+	if c.IsSet("message-keep-last") {
+		tier.MessageKeepLast = c.Int64("message-keep-last")
+	}
 	if c.IsSet("email-limit") {
 		tier.EmailLimit = c.Int64("email-limit")
 	}
@@ -315,6 +324,7 @@ func execTierChange(c *cli.Context) error {
 	if err := manager.UpdateTier(tier); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditTierChange, code, before, server.DescribeTier(tier))
 	fmt.Fprintf(c.App.ErrWriter, "tier updated\n\n")
 	printTier(c, tier)
 	return nil
@@ -329,12 +339,16 @@ func execTierDel(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	if _, err := manager.Tier(code); err == user.ErrTierNotFound {
+	tier, err := manager.Tier(code)
+	if err == user.ErrTierNotFound {
 		return fmt.Errorf("tier %s does not exist", code)
+	} else if err != nil {
+		return err
 	}
 	if err := manager.RemoveTier(code); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditTierRemove, code, server.DescribeTier(tier), "")
 	fmt.Fprintf(c.App.ErrWriter, "tier %s removed\n", code)
 	return nil
 }
@@ -363,6 +377,9 @@ func printTier(c *cli.Context, tier *user.Tier) {
 	fmt.Fprintf(c.App.ErrWriter, "- Name: %s\n", tier.Name)
 	fmt.Fprintf(c.App.ErrWriter, "- Message limit: %d\n", tier.MessageLimit)
 	fmt.Fprintf(c.App.ErrWriter, "- Message expiry duration: %s (%d seconds)\n", tier.MessageExpiryDuration.String(), int64(tier.MessageExpiryDuration.Seconds()))
+	if tier.MessageKeepLast > 0 {
+		fmt.Fprintf(c.App.ErrWriter, "- Message keep last: %d\n", tier.MessageKeepLast)
+	}
 	fmt.Fprintf(c.App.ErrWriter, "- Email limit: %d\n", tier.EmailLimit)
 	fmt.Fprintf(c.App.ErrWriter, "- Phone call limit: %d\n", tier.CallLimit)
 	fmt.Fprintf(c.App.ErrWriter, "- Reservation limit: %d\n", tier.ReservationLimit)
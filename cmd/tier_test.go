@@ -5,6 +5,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"heckel.io/ntfy/v2/server"
 	"heckel.io/ntfy/v2/test"
+	"strings"
 	"testing"
 )
 
@@ -52,6 +53,15 @@ func TestCLI_Tier_AddListChangeDelete(t *testing.T) {
 	app, _, _, stderr = newTestApp()
 	require.Nil(t, runTierCommand(app, conf, "remove", "pro"))
 	require.Contains(t, stderr.String(), "tier pro removed")
+
+	// Audit log contains the same tier descriptions as the HTTP API
+	app, _, _, stderr = newTestApp()
+	require.Nil(t, runAuditCommand(app, conf, "--action=tier"))
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	require.Equal(t, 3, len(lines))
+	require.Contains(t, lines[0], `tier.remove pro by (cli): {"code":"pro"`)
+	require.Regexp(t, `tier.change pro by \(cli\): \{.*"messages":1234.* -> \{.*"messages":999`, lines[1])
+	require.Contains(t, lines[2], `tier.add pro by (cli): {"code":"pro","name":"Pro"`)
 }
 
 func runTierCommand(app *cli.App, conf *server.Config, args ...string) error {
@@ -121,6 +121,7 @@ func execTokenAdd(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditTokenCreate, u.Name, "", user.MaskToken(token.Value))
 	if expires.Unix() == 0 {
 		fmt.Fprintf(c.App.ErrWriter, "token %s created for user %s, never expires\n", token.Value, u.Name)
 	} else {
@@ -149,6 +150,7 @@ func execTokenDel(c *cli.Context) error {
 	if err := manager.RemoveToken(u.ID, token); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditTokenRemove, u.Name, user.MaskToken(token), "")
 	fmt.Fprintf(c.App.ErrWriter, "token %s for user %s removed\n", token, username)
 	return nil
 }
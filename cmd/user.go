@@ -203,6 +203,7 @@ func execUserAdd(c *cli.Context) error {
 	if err := manager.AddUser(username, password, role); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditUserAdd, username, "", string(role))
 	fmt.Fprintf(c.App.ErrWriter, "user %s added with role %s\n", username, role)
 	return nil
 }
@@ -224,6 +225,7 @@ func execUserDel(c *cli.Context) error {
 	if err := manager.RemoveUser(username); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditUserRemove, username, "", "")
 	fmt.Fprintf(c.App.ErrWriter, "user %s removed\n", username)
 	return nil
 }
@@ -252,6 +254,7 @@ func execUserChangePass(c *cli.Context) error {
 	if err := manager.ChangePassword(username, password); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditUserPassword, username, "", "")
 	fmt.Fprintf(c.App.ErrWriter, "changed password for user %s\n", username)
 	return nil
 }
@@ -268,12 +271,16 @@ func execUserChangeRole(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	if _, err := manager.User(username); err == user.ErrUserNotFound {
+	u, err := manager.User(username)
+	if err == user.ErrUserNotFound {
 		return fmt.Errorf("user %s does not exist", username)
+	} else if err != nil {
+		return err
 	}
 	if err := manager.ChangeRole(username, role); err != nil {
 		return err
 	}
+	auditCLI(c, manager, user.AuditUserRole, username, string(u.Role), string(role))
 	fmt.Fprintf(c.App.ErrWriter, "changed role for user %s to %s\n", username, role)
 	return nil
 }
@@ -292,18 +299,27 @@ func execUserChangeTier(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	if _, err := manager.User(username); err == user.ErrUserNotFound {
+	u, err := manager.User(username)
+	if err == user.ErrUserNotFound {
 		return fmt.Errorf("user %s does not exist", username)
+	} else if err != nil {
+		return err
+	}
+	var before string
+	if u.Tier != nil {
+		before = u.Tier.Code
 	}
 	if tier == tierReset {
 		if err := manager.ResetTier(username); err != nil {
 			return err
 		}
+		auditCLI(c, manager, user.AuditUserTier, username, before, "")
 		fmt.Fprintf(c.App.ErrWriter, "removed tier from user %s\n", username)
 	} else {
 		if err := manager.ChangeTier(username, tier); err != nil {
 			return err
 		}
+		auditCLI(c, manager, user.AuditUserTier, username, before, tier)
 		fmt.Fprintf(c.App.ErrWriter, "changed tier for user %s to %s\n", username, tier)
 	}
 	return nil
@@ -21,6 +21,21 @@ const (
 	DefaultFirebasePollInterval                 = 20 * time.Minute // ~poll topic (iOS), max. 2-3 times per hour (see docs)
 	DefaultFirebaseQuotaExceededPenaltyDuration = 10 * time.Minute // Time that over-users are locked out of Firebase if it returns "quota exceeded"
 	DefaultStripePriceCacheDuration             = 3 * time.Hour    // Time to keep Stripe prices cached in memory before a refresh is needed
+	DefaultSubscriberQueueSize                  = 1000             // Max. number of messages queued per subscriber before the overflow policy kicks in
+	DefaultSubscriberPatternTopicLimit          = 100              // Max. number of topics a topic pattern subscription (e.g. alerts-*) may match
+	DefaultAuthAuditRetention                   = 90 * 24 * time.Hour
+)
+
+// Defines the keep-last retention modes, see Config.CacheKeepLastMode
+const (
+	KeepLastModeKeep = "keep" // Keep the newest N messages of each topic, regardless of their age
+	KeepLastModeCap  = "cap"  // Keep at most N messages of each topic, within the cache duration
+)
+
+// Defines the overflow policies of the per-subscriber queues, see Config.SubscriberQueueOverflowPolicy
+const (
+	SubscriberQueueOverflowDropOldest = "drop-oldest" // Drop the oldest queued message to make room for the new one
+	SubscriberQueueOverflowDisconnect = "disconnect"  // Cancel the subscription, so the client can reconnect and catch up using since=
 )
 
 // Defines default Web Push settings
@@ -87,16 +102,24 @@ type Config struct {
 	CacheStartupQueries                  string
 	CacheBatchSize                       int
 	CacheBatchTimeout                    time.Duration
+	CacheKeepLast                        int
+	CacheKeepLastMode                    string
 	AuthFile                             string
 	AuthStartupQueries                   string
 	AuthDefault                          user.Permission
 	AuthBcryptCost                       int
 	AuthStatsQueueWriterInterval         time.Duration
+	AuthAuditRetention                   time.Duration
 	AttachmentCacheDir                   string
 	AttachmentTotalSizeLimit             int64
 	AttachmentFileSizeLimit              int64
 	AttachmentExpiryDuration             time.Duration
 	KeepaliveInterval                    time.Duration
+	SSERetry                             time.Duration // Reconnection delay hint sent to SSE clients, 0 to not send one
+	SubscriberQueueSize                  int
+	SubscriberQueueOverflowPolicy        string
+	SubscriberPatternTopicLimit          int
+	EnableTopicPatterns                  bool // Allow logged-in users to subscribe to topic patterns (e.g. alerts-*)
 	ManagerInterval                      time.Duration
 	DisallowedTopics                     []string
 	WebRoot                              string // empty to disable
@@ -179,16 +202,23 @@ func NewConfig() *Config {
 		CacheStartupQueries:                  "",
 		CacheBatchSize:                       0,
 		CacheBatchTimeout:                    0,
+		CacheKeepLast:                        0,
+		CacheKeepLastMode:                    KeepLastModeKeep,
 		AuthFile:                             "",
 		AuthStartupQueries:                   "",
 		AuthDefault:                          user.PermissionReadWrite,
 		AuthBcryptCost:                       user.DefaultUserPasswordBcryptCost,
 		AuthStatsQueueWriterInterval:         user.DefaultUserStatsQueueWriterInterval,
+		AuthAuditRetention:                   DefaultAuthAuditRetention,
 		AttachmentCacheDir:                   "",
 		AttachmentTotalSizeLimit:             DefaultAttachmentTotalSizeLimit,
 		AttachmentFileSizeLimit:              DefaultAttachmentFileSizeLimit,
 		AttachmentExpiryDuration:             DefaultAttachmentExpiryDuration,
 		KeepaliveInterval:                    DefaultKeepaliveInterval,
+		SubscriberQueueSize:                  DefaultSubscriberQueueSize,
+		SubscriberQueueOverflowPolicy:        SubscriberQueueOverflowDropOldest,
+		SubscriberPatternTopicLimit:          DefaultSubscriberPatternTopicLimit,
+		EnableTopicPatterns:                  false,
 		ManagerInterval:                      DefaultManagerInterval,
 		DisallowedTopics:                     DefaultDisallowedTopics,
 		WebRoot:                              "/",
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// dedupIndex is a bounded in-memory index of recently published messages with a deduplication key. It maps
+// topic and key to the ID of the surviving message. The index is only a fast path in front of the message cache,
+// so evicting entries (or losing them on restart) does not break deduplication.
+type dedupIndex struct {
+	entries map[string]*dedupEntry // topic/key -> entry
+	max     int
+	mu      sync.Mutex
+}
+
+type dedupEntry struct {
+	messageID string
+	expires   int64 // Unix time in seconds at which the deduplication window ends
+}
+
+func newDedupIndex(max int) *dedupIndex {
+	return &dedupIndex{
+		entries: make(map[string]*dedupEntry),
+		max:     max,
+	}
+}
+
+// Get returns the ID of the message for the given topic and key, if the deduplication window has not passed
+func (d *dedupIndex) Get(topic, key string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[dedupIndexKey(topic, key)]
+	if !ok || e.expires <= time.Now().Unix() {
+		return "", false
+	}
+	return e.messageID, true
+}
+
+// Put adds or replaces the entry for the given topic and key. If the index is full, expired entries are removed
+// first, and if that is not enough, the entry that expires first is evicted.
+func (d *dedupIndex) Put(topic, key, messageID string, expires int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := dedupIndexKey(topic, key)
+	if _, ok := d.entries[k]; !ok && len(d.entries) >= d.max {
+		d.pruneExpired()
+		if len(d.entries) >= d.max {
+			d.evictFirstExpiring()
+		}
+	}
+	d.entries[k] = &dedupEntry{
+		messageID: messageID,
+		expires:   expires,
+	}
+}
+
+// Remove removes the entry for the given topic and key
+func (d *dedupIndex) Remove(topic, key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, dedupIndexKey(topic, key))
+}
+
+// Prune removes all entries whose deduplication window has passed
+func (d *dedupIndex) Prune() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pruneExpired()
+}
+
+// Len returns the number of entries in the index
+func (d *dedupIndex) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries)
+}
+
+func (d *dedupIndex) pruneExpired() {
+	now := time.Now().Unix()
+	for k, e := range d.entries {
+		if e.expires <= now {
+			delete(d.entries, k)
+		}
+	}
+}
+
+func (d *dedupIndex) evictFirstExpiring() {
+	var first string
+	var firstExpires int64
+	for k, e := range d.entries {
+		if first == "" || e.expires < firstExpires {
+			first, firstExpires = k, e.expires
+		}
+	}
+	delete(d.entries, first)
+}
+
+func dedupIndexKey(topic, key string) string {
+	return topic + "/" + key
+}
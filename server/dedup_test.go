@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDedupIndex_GetPutExpire(t *testing.T) {
+	d := newDedupIndex(10)
+	_, ok := d.Get("mytopic", "key1")
+	require.False(t, ok)
+
+	d.Put("mytopic", "key1", "msg1", time.Now().Add(time.Minute).Unix())
+	d.Put("mytopic", "key2", "msg2", time.Now().Add(-time.Second).Unix())
+	messageID, ok := d.Get("mytopic", "key1")
+	require.True(t, ok)
+	require.Equal(t, "msg1", messageID)
+	_, ok = d.Get("othertopic", "key1")
+	require.False(t, ok)
+	_, ok = d.Get("mytopic", "key2") // Expired
+	require.False(t, ok)
+
+	d.Prune()
+	require.Equal(t, 1, d.Len())
+	d.Remove("mytopic", "key1")
+	require.Equal(t, 0, d.Len())
+}
+
+func TestDedupIndex_Bounded(t *testing.T) {
+	d := newDedupIndex(3)
+	now := time.Now()
+	d.Put("mytopic", "expired", "msg0", now.Add(-time.Second).Unix())
+	for i := 1; i <= 5; i++ {
+		d.Put("mytopic", fmt.Sprintf("key%d", i), fmt.Sprintf("msg%d", i), now.Add(time.Duration(i)*time.Minute).Unix())
+	}
+	require.Equal(t, 3, d.Len())
+
+	// Entries that expire first are evicted
+	_, ok := d.Get("mytopic", "key2")
+	require.False(t, ok)
+	messageID, ok := d.Get("mytopic", "key5")
+	require.True(t, ok)
+	require.Equal(t, "msg5", messageID)
+
+	// Replacing an existing entry does not evict
+	d.Put("mytopic", "key5", "msg6", now.Add(time.Hour).Unix())
+	require.Equal(t, 3, d.Len())
+	_, ok = d.Get("mytopic", "key3")
+	require.True(t, ok)
+}
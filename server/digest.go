@@ -0,0 +1,40 @@
+package server
+
+import (
+	"heckel.io/ntfy/v2/util"
+	"net/netip"
+)
+
+// digest is the collected state of one digest window of a topic (see the "digest" topic setting). The messages
+// themselves are delivered to stream subscribers and cached as usual; the digest only holds what is needed to build
+// the summary notification for push channels and e-mail. Digests are stored in the message cache, so that pending
+// digests survive a restart.
+type digest struct {
+	Topic    string
+	Due      int64      // Unix time in seconds at which the digest is delivered
+	Count    int        // Number of messages in the window
+	Priority int        // Highest priority of all messages in the window
+	Titles   []string   // Titles of the latest messages, oldest first
+	Last     *message   // Latest message, delivered as-is if it is the only message in the window
+	Emails   []string   // Distinct e-mail addresses to send the digest to
+	Firebase bool       // True if any message in the window was allowed to be forwarded to Firebase
+	Sender   netip.Addr // IP address of the publisher of the latest message, used for rate limiting
+	User     string     // User ID of the publisher of the latest message, used for rate limiting
+}
+
+// add adds the message to the digest. Later messages do not extend the window of the digest.
+func (d *digest) add(m *message, email string, firebase bool) {
+	d.Count++
+	d.Priority = max(d.Priority, m.Priority)
+	d.Titles = append(d.Titles, digestTitle(m))
+	if len(d.Titles) > digestTitlesMax {
+		d.Titles = d.Titles[len(d.Titles)-digestTitlesMax:]
+	}
+	d.Last = m
+	d.Sender = m.Sender
+	d.User = m.User
+	d.Firebase = d.Firebase || firebase
+	if email != "" && !util.Contains(d.Emails, email) {
+		d.Emails = append(d.Emails, email)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDigest_Add(t *testing.T) {
+	d := &digest{Topic: "deploys"}
+	for i := 1; i <= 7; i++ {
+		m := newDefaultMessage("deploys", fmt.Sprintf("deploy %d\nsome details", i))
+		m.Priority = i % 5
+		d.add(m, "phil@example.com", i == 3)
+	}
+	require.Equal(t, 7, d.Count)
+	require.Equal(t, 4, d.Priority)
+	require.Equal(t, []string{"deploy 3", "deploy 4", "deploy 5", "deploy 6", "deploy 7"}, d.Titles)
+	require.Equal(t, []string{"phil@example.com"}, d.Emails)
+	require.Equal(t, "deploy 7\nsome details", d.Last.Message)
+	require.True(t, d.Firebase)
+}
+
+func TestDigest_NewDigestMessage(t *testing.T) {
+	d := &digest{Topic: "deploys"}
+	m := newDefaultMessage("deploys", "deploy 1")
+	d.add(m, "", true)
+	require.Equal(t, m, newDigestMessage(d)) // Single message is delivered as-is
+
+	d = &digest{Topic: "deploys"}
+	for i := 1; i <= 7; i++ {
+		m := newDefaultMessage("deploys", "body")
+		m.Title = fmt.Sprintf("Deploy %d finished", i)
+		d.add(m, "", true)
+	}
+	summary := newDigestMessage(d)
+	require.Equal(t, "7 new messages", summary.Title)
+	require.Equal(t, "- Deploy 3 finished\n- Deploy 4 finished\n- Deploy 5 finished\n- Deploy 6 finished\n- Deploy 7 finished\n... and 2 more", summary.Message)
+	require.Equal(t, 7, summary.Count)
+}
@@ -117,13 +117,51 @@ var (
 	errHTTPBadRequestWebPushSubscriptionInvalid      = &errHTTP{40038, http.StatusBadRequest, "invalid request: web push payload malformed", "", nil}
 	errHTTPBadRequestWebPushEndpointUnknown          = &errHTTP{40039, http.StatusBadRequest, "invalid request: web push endpoint unknown", "", nil}
 	errHTTPBadRequestWebPushTopicCountTooHigh        = &errHTTP{40040, http.StatusBadRequest, "invalid request: too many web push topic subscriptions", "", nil}
+	errHTTPBadRequestGroupNotFound                   = &errHTTP{40041, http.StatusBadRequest, "invalid request: group does not exist", "", nil}
+	errHTTPBadRequestRoleInvalid                     = &errHTTP{40042, http.StatusBadRequest, "invalid request: role invalid", "", nil}
+	errHTTPBadRequestTierCodeInvalid                 = &errHTTP{40043, http.StatusBadRequest, "invalid request: tier code invalid", "", nil}
+	errHTTPBadRequestReservationNotFound             = &errHTTP{40044, http.StatusBadRequest, "invalid request: topic reservation does not exist", "", nil}
+	errHTTPBadRequestEscalateInvalid                 = &errHTTP{40045, http.StatusBadRequest, "invalid request: escalation policy invalid, e.g. \"5m renotify, 15m email phil@example.com, 30m call\"", "https://ntfy.sh/docs/publish/#escalations", nil}
+	errHTTPBadRequestEscalateNoCache                 = &errHTTP{40046, http.StatusBadRequest, "invalid request: cannot disable cache for messages with escalation policy", "https://ntfy.sh/docs/publish/#escalations", nil}
+	errHTTPBadRequestOnCallAnonymous                 = &errHTTP{40047, http.StatusBadRequest, "invalid request: anonymous users cannot notify on-call users", "https://ntfy.sh/docs/publish/#on-call-schedules", nil}
+	errHTTPBadRequestScheduleNotFound                = &errHTTP{40048, http.StatusBadRequest, "invalid request: schedule does not exist", "https://ntfy.sh/docs/publish/#on-call-schedules", nil}
+	errHTTPBadRequestScheduleInvalid                 = &errHTTP{40049, http.StatusBadRequest, "invalid request: schedule name or rotation period invalid", "https://ntfy.sh/docs/config/#on-call-schedules", nil}
+	errHTTPBadRequestHeartbeatInvalid                = &errHTTP{40050, http.StatusBadRequest, "invalid request: heartbeat interval missing or invalid, must be between 1m and 30d", "https://ntfy.sh/docs/publish/#heartbeats", nil}
+	errHTTPBadRequestHeartbeatNoCache                = &errHTTP{40051, http.StatusBadRequest, "invalid request: heartbeats require the message cache to be enabled", "https://ntfy.sh/docs/publish/#heartbeats", nil}
+	errHTTPBadRequestDedupInvalid                    = &errHTTP{40052, http.StatusBadRequest, "invalid request: deduplication window must be between 1s and 24h, and key must be at most 64 characters", "https://ntfy.sh/docs/publish/#deduplication", nil}
+	errHTTPBadRequestDedupNoCache                    = &errHTTP{40053, http.StatusBadRequest, "invalid request: cannot disable cache for deduplicated messages", "https://ntfy.sh/docs/publish/#deduplication", nil}
+	errHTTPBadRequestDigestInvalid                   = &errHTTP{40054, http.StatusBadRequest, "invalid request: digest window must be between 10s and 1h", "https://ntfy.sh/docs/publish/#digests", nil}
+	errHTTPBadRequestQuietHoursInvalid               = &errHTTP{40055, http.StatusBadRequest, "invalid request: quiet hours invalid, start and end must be in the format HH:MM, and time zone must be valid", "https://ntfy.sh/docs/publish/#quiet-hours", nil}
+	errHTTPBadRequestExpiresInvalid                  = &errHTTP{40056, http.StatusBadRequest, "invalid request: unable to parse expiry, must be a duration or a time after the message time", "https://ntfy.sh/docs/publish/#message-expiry", nil}
+	errHTTPBadRequestTopicSettingsInvalid            = &errHTTP{40057, http.StatusBadRequest, "invalid request: topic settings invalid", "https://ntfy.sh/docs/publish/#topic-settings", nil}
+	errHTTPBadRequestTopicInfoInvalid                = &errHTTP{40058, http.StatusBadRequest, "invalid request: topic info invalid, display name must be at most 64 characters, and icon must be a URL", "https://ntfy.sh/docs/publish/#topic-info", nil}
+	errHTTPBadRequestConsumerInvalid                 = &errHTTP{40059, http.StatusBadRequest, "invalid request: consumer name invalid, must be 1-64 characters of [-_A-Za-z0-9]", "https://ntfy.sh/docs/subscribe/api/#durable-subscriptions", nil}
+	errHTTPBadRequestConsumerAckInvalid              = &errHTTP{40060, http.StatusBadRequest, "invalid request: message ID to acknowledge is invalid", "https://ntfy.sh/docs/subscribe/api/#durable-subscriptions", nil}
+	errHTTPBadRequestWebSocketRequestInvalid         = &errHTTP{40061, http.StatusBadRequest, "invalid request: WebSocket request invalid, must be a JSON object with a valid action and topic", "https://ntfy.sh/docs/subscribe/api/#websocket-protocol", nil}
+	errHTTPBadRequestTopicPatternTooBroad            = &errHTTP{40062, http.StatusBadRequest, "invalid request: topic pattern matches too many topics, please use a more specific pattern", "https://ntfy.sh/docs/subscribe/api/#subscribe-to-topic-patterns", nil}
+	errHTTPBadRequestLongPollWaitInvalid             = &errHTTP{40063, http.StatusBadRequest, "invalid wait parameter: must be a duration of at most 5m, and can only be used with poll=1", "https://ntfy.sh/docs/subscribe/api/#long-polling", nil}
+	errHTTPBadRequestCloudEventInvalid               = &errHTTP{40064, http.StatusBadRequest, "invalid request: CloudEvent invalid, specversion 1.0, id, source and type are required", "https://ntfy.sh/docs/publish/#cloudevents", nil}
+	errHTTPBadRequestAccessExpiresInvalid            = &errHTTP{40065, http.StatusBadRequest, "invalid request: access expiry must be in the future", "", nil}
+	errHTTPBadRequestTopicPatternInvalid             = &errHTTP{40066, http.StatusBadRequest, "invalid request: topic pattern must start with at least one literal character, e.g. alerts-*", "https://ntfy.sh/docs/subscribe/api/#subscribe-to-topic-patterns", nil}
+	errHTTPBadRequestTokenNotUnique                  = &errHTTP{40067, http.StatusBadRequest, "invalid request: token prefix or label must match exactly one token of the user", "", nil}
+	errHTTPBadRequestSinceSeqMultipleTopics          = &errHTTP{40068, http.StatusBadRequest, "invalid since parameter: sequence numbers are per topic, since=seq:... cannot be used with multiple topics or topic patterns", "https://ntfy.sh/docs/subscribe/api/#fetch-cached-messages", nil}
 	errHTTPNotFound                                  = &errHTTP{40401, http.StatusNotFound, "page not found", "", nil}
+	errHTTPNotFoundEscalation                        = &errHTTP{40402, http.StatusNotFound, "message not found, or message has no escalation policy", "https://ntfy.sh/docs/publish/#escalations", nil}
+	errHTTPNotFoundHeartbeat                         = &errHTTP{40403, http.StatusNotFound, "heartbeat not found", "https://ntfy.sh/docs/publish/#heartbeats", nil}
+	errHTTPNotFoundMessage                           = &errHTTP{40404, http.StatusNotFound, "message not found", "", nil}
 	errHTTPUnauthorized                              = &errHTTP{40101, http.StatusUnauthorized, "unauthorized", "https://ntfy.sh/docs/publish/#authentication", nil}
+	errHTTPUnauthorizedConsumer                      = &errHTTP{40102, http.StatusUnauthorized, "unauthorized: durable subscriptions are only available to logged-in users", "https://ntfy.sh/docs/subscribe/api/#durable-subscriptions", nil}
+	errHTTPUnauthorizedTopicPattern                  = &errHTTP{40103, http.StatusUnauthorized, "unauthorized: topic pattern subscriptions are only available to logged-in users", "https://ntfy.sh/docs/subscribe/api/#subscribe-to-topic-patterns", nil}
 	errHTTPForbidden                                 = &errHTTP{40301, http.StatusForbidden, "forbidden", "https://ntfy.sh/docs/publish/#authentication", nil}
 	errHTTPConflictUserExists                        = &errHTTP{40901, http.StatusConflict, "conflict: user already exists", "", nil}
 	errHTTPConflictTopicReserved                     = &errHTTP{40902, http.StatusConflict, "conflict: access control entry for topic or topic pattern already exists", "", nil}
 	errHTTPConflictSubscriptionExists                = &errHTTP{40903, http.StatusConflict, "conflict: topic subscription already exists", "", nil}
 	errHTTPConflictPhoneNumberExists                 = &errHTTP{40904, http.StatusConflict, "conflict: phone number already exists", "", nil}
+	errHTTPConflictGroupExists                       = &errHTTP{40905, http.StatusConflict, "conflict: group already exists", "", nil}
+	errHTTPConflictTierExists                        = &errHTTP{40906, http.StatusConflict, "conflict: tier already exists", "", nil}
+	errHTTPConflictTierInUse                         = &errHTTP{40907, http.StatusConflict, "conflict: tier is still assigned to users", "", nil}
+	errHTTPConflictScheduleExists                    = &errHTTP{40908, http.StatusConflict, "conflict: schedule already exists", "", nil}
+	errHTTPConflictAccessPermanent                   = &errHTTP{40909, http.StatusConflict, "conflict: a permanent access control entry for this topic exists, reset it before granting time-limited access", "", nil}
 	errHTTPGonePhoneVerificationExpired              = &errHTTP{41001, http.StatusGone, "phone number verification expired or does not exist", "", nil}
 	errHTTPEntityTooLargeAttachment                  = &errHTTP{41301, http.StatusRequestEntityTooLarge, "attachment too large, or bandwidth limit reached", "https://ntfy.sh/docs/publish/#limitations", nil}
 	errHTTPEntityTooLargeMatrixRequest               = &errHTTP{41302, http.StatusRequestEntityTooLarge, "Matrix request is larger than the max allowed length", "", nil}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/netip"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
@@ -17,6 +19,8 @@ import (
 var (
 	errUnexpectedMessageType = errors.New("unexpected message type")
 	errMessageNotFound       = errors.New("message not found")
+	errHeartbeatNotFound     = errors.New("heartbeat not found")
+	errConsumerNotFound      = errors.New("consumer not found")
 	errNoRows                = errors.New("no rows found")
 )
 
@@ -47,7 +51,11 @@ const (
 			user TEXT NOT NULL,
 			content_type TEXT NOT NULL,
 			encoding TEXT NOT NULL,
-			published INT NOT NULL
+			published INT NOT NULL,
+			count INT NOT NULL,
+			seq INT NOT NULL,
+			expires_explicit INT NOT NULL DEFAULT (0),
+			source TEXT NOT NULL DEFAULT ('')
 		);
 		CREATE INDEX IF NOT EXISTS idx_mid ON messages (mid);
 		CREATE INDEX IF NOT EXISTS idx_time ON messages (time);
@@ -56,57 +64,149 @@ const (
 		CREATE INDEX IF NOT EXISTS idx_sender ON messages (sender);
 		CREATE INDEX IF NOT EXISTS idx_user ON messages (user);
 		CREATE INDEX IF NOT EXISTS idx_attachment_expires ON messages (attachment_expires);
+		CREATE INDEX IF NOT EXISTS idx_topic_seq ON messages (topic, seq);
 		CREATE TABLE IF NOT EXISTS stats (
 			key TEXT PRIMARY KEY,
 			value INT
 		);
 		INSERT INTO stats (key, value) VALUES ('messages', 0);
+		CREATE TABLE IF NOT EXISTS escalations (
+			mid TEXT PRIMARY KEY,
+			topic TEXT NOT NULL,
+			ack_key TEXT NOT NULL,
+			steps TEXT NOT NULL,
+			next_step INT NOT NULL,
+			due INT NOT NULL,
+			acked INT NOT NULL,
+			acked_by TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_escalations_due ON escalations (due);
+		CREATE TABLE IF NOT EXISTS escalation_copies (
+			mid TEXT PRIMARY KEY,
+			original_mid TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_escalation_copies_original_mid ON escalation_copies (original_mid);
+		CREATE TABLE IF NOT EXISTS digests (
+			topic TEXT PRIMARY KEY,
+			due INT NOT NULL,
+			count INT NOT NULL,
+			priority INT NOT NULL,
+			titles TEXT NOT NULL,
+			last TEXT NOT NULL,
+			emails TEXT NOT NULL,
+			firebase INT NOT NULL,
+			sender TEXT NOT NULL,
+			user TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_digests_due ON digests (due);
+		CREATE TABLE IF NOT EXISTS heartbeats (
+			topic TEXT PRIMARY KEY,
+			interval INT NOT NULL,
+			last_ping INT NOT NULL,
+			overdue INT NOT NULL,
+			message TEXT NOT NULL,
+			recovery_message TEXT NOT NULL,
+			sender TEXT NOT NULL,
+			user TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS dedup (
+			topic TEXT NOT NULL,
+			key TEXT NOT NULL,
+			mid TEXT NOT NULL,
+			expires INT NOT NULL,
+			PRIMARY KEY (topic, key)
+		);
+		CREATE INDEX IF NOT EXISTS idx_dedup_mid ON dedup (mid);
+		CREATE INDEX IF NOT EXISTS idx_dedup_expires ON dedup (expires);
+		CREATE TABLE IF NOT EXISTS consumers (
+			user TEXT NOT NULL,
+			name TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			mid TEXT NOT NULL,
+			updated INT NOT NULL,
+			PRIMARY KEY (user, name, topic)
+		);
+		CREATE INDEX IF NOT EXISTS idx_consumers_updated ON consumers (updated);
+		CREATE TABLE IF NOT EXISTS sequences (
+			topic TEXT PRIMARY KEY,
+			seq INT NOT NULL
+		);
 		COMMIT;
 	`
 	insertMessageQuery = `
-		INSERT INTO messages (mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, attachment_deleted, sender, user, content_type, encoding, published)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-	deleteMessageQuery                = `DELETE FROM messages WHERE mid = ?`
-	updateMessagesForTopicExpiryQuery = `UPDATE messages SET expires = ? WHERE topic = ?`
-	selectRowIDFromMessageID          = `SELECT id FROM messages WHERE mid = ?` // Do not include topic, see #336 and TestServer_PollSinceID_MultipleTopics
-	selectMessagesByIDQuery           = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		INSERT INTO messages (mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, attachment_deleted, sender, user, content_type, encoding, published, count, seq, expires_explicit, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	deleteMessageQuery                           = `DELETE FROM messages WHERE mid = ?`
+	updateMessagesForTopicExpiryQuery            = `UPDATE messages SET expires = ? WHERE topic = ?`
+	updateMessagesForTopicExpiryBeforeQuery      = `UPDATE messages SET expires = ? WHERE topic = ? AND time < ? AND expires > ? AND published = 1`
+	updateMessagesForTopicExpiryBeyondCountQuery = `
+		UPDATE messages SET expires = ?
+		WHERE topic = ? AND expires > ? AND published = 1 AND id NOT IN (
+			SELECT id FROM messages WHERE topic = ? AND published = 1 ORDER BY time DESC, id DESC LIMIT ?
+		)
+	`
+	updateMessagesByTopicRankExpiryQuery = `
+		UPDATE messages SET expires = ?
+		WHERE expires > ? AND expires < ? %s AND id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY topic ORDER BY time DESC, id DESC) AS n
+				FROM messages
+				WHERE published = 1 %s
+			)
+			WHERE n %s ?
+		)
+	` // Expiry filter, topic filter and rank comparison are formatted in, see updateMessagesByTopicRank
+	selectRowIDFromMessageID = `SELECT id FROM messages WHERE mid = ?` // Do not include topic, see #336 and TestServer_PollSinceID_MultipleTopics
+	selectMessagesByIDQuery  = `
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, count, seq, expires_explicit, source
 		FROM messages 
 		WHERE mid = ?
 	`
 	selectMessagesSinceTimeQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, count, seq, expires_explicit, source
 		FROM messages 
 		WHERE topic = ? AND time >= ? AND published = 1
 		ORDER BY time, id
 	`
 	selectMessagesSinceTimeIncludeScheduledQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, count, seq, expires_explicit, source
 		FROM messages 
 		WHERE topic = ? AND time >= ?
 		ORDER BY time, id
 	`
 	selectMessagesSinceIDQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, count, seq, expires_explicit, source
 		FROM messages 
 		WHERE topic = ? AND id > ? AND published = 1 
 		ORDER BY time, id
 	`
 	selectMessagesSinceIDIncludeScheduledQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, count, seq, expires_explicit, source
 		FROM messages 
 		WHERE topic = ? AND (id > ? OR published = 0)
 		ORDER BY time, id
 	`
+	selectMessagesSinceSeqQuery = `
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, count, seq, expires_explicit, source
+		FROM messages 
+		WHERE topic = ? AND seq > ? AND published = 1 
+		ORDER BY seq
+	`
+	selectMessagesSinceSeqIncludeScheduledQuery = `
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, count, seq, expires_explicit, source
+		FROM messages 
+		WHERE topic = ? AND (seq > ? OR published = 0)
+		ORDER BY published DESC, seq, time, id
+	`
 	selectMessagesDueQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, count, seq, expires_explicit, source
 		FROM messages 
 		WHERE time <= ? AND published = 0
 		ORDER BY time, id
 	`
 	selectMessagesExpiredQuery      = `SELECT mid FROM messages WHERE expires <= ? AND published = 1`
-	updateMessagePublishedQuery     = `UPDATE messages SET published = 1 WHERE mid = ?`
+	updateMessagePublishedQuery     = `UPDATE messages SET published = 1, seq = ? WHERE mid = ?`
 	selectMessagesCountQuery        = `SELECT COUNT(*) FROM messages`
 	selectMessageCountPerTopicQuery = `SELECT topic, COUNT(*) FROM messages GROUP BY topic`
 	selectTopicsQuery               = `SELECT topic FROM messages GROUP BY topic`
@@ -116,13 +216,100 @@ const (
 	selectAttachmentsSizeBySenderQuery = `SELECT IFNULL(SUM(attachment_size), 0) FROM messages WHERE user = '' AND sender = ? AND attachment_expires >= ?`
 	selectAttachmentsSizeByUserIDQuery = `SELECT IFNULL(SUM(attachment_size), 0) FROM messages WHERE user = ? AND attachment_expires >= ?`
 
+	insertEscalationQuery = `
+		INSERT INTO escalations (mid, topic, ack_key, steps, next_step, due, acked, acked_by)
+		VALUES (?, ?, ?, ?, ?, ?, 0, '')
+	`
+	selectEscalationQuery = `
+		SELECT mid, topic, ack_key, steps, next_step, due, acked, acked_by
+		FROM escalations
+		WHERE mid = IFNULL((SELECT original_mid FROM escalation_copies WHERE mid = ?), ?)
+	`
+	selectEscalationsDueQuery = `
+		SELECT mid, topic, ack_key, steps, next_step, due, acked, acked_by
+		FROM escalations
+		WHERE acked = 0 AND due > 0 AND due <= ?
+		ORDER BY due
+	`
+	updateEscalationNextStepQuery = `UPDATE escalations SET next_step = ?, due = ? WHERE mid = ?`
+	updateEscalationAckedQuery    = `UPDATE escalations SET acked = ?, acked_by = ?, due = 0 WHERE mid = ? AND acked = 0`
+	deleteEscalationQuery         = `DELETE FROM escalations WHERE mid = ?`
+	insertEscalationCopyQuery     = `INSERT INTO escalation_copies (mid, original_mid) VALUES (?, ?)`
+	deleteEscalationCopiesQuery   = `DELETE FROM escalation_copies WHERE mid = ? OR original_mid = ?`
+
+	upsertHeartbeatQuery = `
+		INSERT INTO heartbeats (topic, interval, last_ping, overdue, message, recovery_message, sender, user)
+		VALUES (?, ?, ?, 0, ?, ?, ?, ?)
+		ON CONFLICT (topic)
+		DO UPDATE SET interval = excluded.interval, last_ping = excluded.last_ping, overdue = 0, message = excluded.message, recovery_message = excluded.recovery_message, sender = excluded.sender, user = excluded.user
+	`
+	updateMessageCountQuery = `UPDATE messages SET count = count + 1 WHERE mid = ?`
+	upsertDedupQuery        = `
+		INSERT INTO dedup (topic, key, mid, expires)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (topic, key)
+		DO UPDATE SET mid = excluded.mid, expires = excluded.expires
+	`
+	selectDedupQuery        = `SELECT mid, expires FROM dedup WHERE topic = ? AND key = ? AND expires > ?`
+	deleteDedupQuery        = `DELETE FROM dedup WHERE mid = ?`
+	deleteDedupExpiredQuery = `DELETE FROM dedup WHERE expires <= ?`
+
+	upsertConsumerQuery = `
+		INSERT INTO consumers (user, name, topic, mid, updated)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user, name, topic)
+		DO UPDATE SET mid = excluded.mid, updated = excluded.updated
+	`
+	selectConsumerQuery       = `SELECT mid FROM consumers WHERE user = ? AND name = ? AND topic = ?`
+	deleteConsumersStaleQuery = `DELETE FROM consumers WHERE updated < ?`
+
+	upsertSequenceQuery = `
+		INSERT INTO sequences (topic, seq)
+		VALUES (?, ?)
+		ON CONFLICT (topic)
+		DO UPDATE SET seq = MAX(seq, excluded.seq)
+	`
+	selectSequencesQuery = `SELECT topic, seq FROM sequences`
+
+	upsertDigestQuery = `
+		INSERT INTO digests (topic, due, count, priority, titles, last, emails, firebase, sender, user)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (topic)
+		DO UPDATE SET count = excluded.count, priority = excluded.priority, titles = excluded.titles, last = excluded.last, emails = excluded.emails, firebase = excluded.firebase, sender = excluded.sender, user = excluded.user
+	`
+	selectDigestQuery = `
+		SELECT topic, due, count, priority, titles, last, emails, firebase, sender, user
+		FROM digests
+		WHERE topic = ?
+	`
+	selectDigestsDueQuery = `
+		SELECT topic, due, count, priority, titles, last, emails, firebase, sender, user
+		FROM digests
+		WHERE due <= ?
+	`
+	deleteDigestsDueQuery = `DELETE FROM digests WHERE due <= ?`
+
+	selectHeartbeatQuery = `
+		SELECT topic, interval, last_ping, overdue, message, recovery_message, sender, user
+		FROM heartbeats
+		WHERE topic = ?
+	`
+	selectHeartbeatsOverdueQuery = `
+		SELECT topic, interval, last_ping, overdue, message, recovery_message, sender, user
+		FROM heartbeats
+		WHERE overdue = 0 AND last_ping + interval <= ?
+	`
+	selectHeartbeatOverdueQuery = `SELECT overdue FROM heartbeats WHERE topic = ?`
+	updateHeartbeatOverdueQuery = `UPDATE heartbeats SET overdue = 1 WHERE topic = ? AND overdue = 0 AND last_ping + interval <= ?`
+	deleteHeartbeatQuery        = `DELETE FROM heartbeats WHERE topic = ?`
+
 	selectStatsQuery = `SELECT value FROM stats WHERE key = 'messages'`
 	updateStatsQuery = `UPDATE stats SET value = ? WHERE key = 'messages'`
 )
 
 // Schema management queries
 const (
-	currentSchemaVersion          = 12
+	currentSchemaVersion          = 21
 	createSchemaVersionTableQuery = `
 		CREATE TABLE IF NOT EXISTS schemaVersion (
 			id INT PRIMARY KEY,
@@ -246,6 +433,116 @@ const (
 	migrate11To12AlterMessagesTableQuery = `
 		ALTER TABLE messages ADD COLUMN content_type TEXT NOT NULL DEFAULT('');
 	`
+
+	// 12 -> 13
+	migrate12To13AlterMessagesTableQuery = `
+		CREATE TABLE IF NOT EXISTS escalations (
+			mid TEXT PRIMARY KEY,
+			topic TEXT NOT NULL,
+			ack_key TEXT NOT NULL,
+			steps TEXT NOT NULL,
+			next_step INT NOT NULL,
+			due INT NOT NULL,
+			acked INT NOT NULL,
+			acked_by TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_escalations_due ON escalations (due);
+	`
+
+	// 13 -> 14
+	migrate13To14CreateHeartbeatsTableQuery = `
+		CREATE TABLE IF NOT EXISTS heartbeats (
+			topic TEXT PRIMARY KEY,
+			interval INT NOT NULL,
+			last_ping INT NOT NULL,
+			overdue INT NOT NULL,
+			message TEXT NOT NULL,
+			recovery_message TEXT NOT NULL,
+			sender TEXT NOT NULL,
+			user TEXT NOT NULL
+		);
+	`
+
+	// 14 -> 15
+	migrate14To15AlterMessagesTableQuery = `
+		ALTER TABLE messages ADD COLUMN count INT NOT NULL DEFAULT('0');
+		CREATE TABLE IF NOT EXISTS dedup (
+			topic TEXT NOT NULL,
+			key TEXT NOT NULL,
+			mid TEXT NOT NULL,
+			expires INT NOT NULL,
+			PRIMARY KEY (topic, key)
+		);
+		CREATE INDEX IF NOT EXISTS idx_dedup_mid ON dedup (mid);
+		CREATE INDEX IF NOT EXISTS idx_dedup_expires ON dedup (expires);
+	`
+
+	// 15 -> 16
+	migrate15To16CreateConsumersTableQuery = `
+		CREATE TABLE IF NOT EXISTS consumers (
+			user TEXT NOT NULL,
+			name TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			mid TEXT NOT NULL,
+			updated INT NOT NULL,
+			PRIMARY KEY (user, name, topic)
+		);
+		CREATE INDEX IF NOT EXISTS idx_consumers_updated ON consumers (updated);
+	`
+
+	// 16 -> 17
+	migrate16To17AlterMessagesTableQuery = `
+		ALTER TABLE messages ADD COLUMN seq INT NOT NULL DEFAULT('0');
+		UPDATE messages SET seq = numbered.n
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY topic ORDER BY time, id) AS n
+			FROM messages
+			WHERE published = 1
+		) AS numbered
+		WHERE messages.id = numbered.id;
+		CREATE INDEX IF NOT EXISTS idx_topic_seq ON messages (topic, seq);
+		CREATE TABLE IF NOT EXISTS sequences (
+			topic TEXT PRIMARY KEY,
+			seq INT NOT NULL
+		);
+		INSERT INTO sequences (topic, seq) SELECT topic, MAX(seq) FROM messages GROUP BY topic;
+	`
+
+	// 17 -> 18
+	migrate17To18CreateEscalationCopiesTableQuery = `
+		CREATE TABLE IF NOT EXISTS escalation_copies (
+			mid TEXT PRIMARY KEY,
+			original_mid TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_escalation_copies_original_mid ON escalation_copies (original_mid);
+	`
+
+	// 18 -> 19
+	migrate18To19CreateDigestsTableQuery = `
+		CREATE TABLE IF NOT EXISTS digests (
+			topic TEXT PRIMARY KEY,
+			due INT NOT NULL,
+			count INT NOT NULL,
+			priority INT NOT NULL,
+			titles TEXT NOT NULL,
+			last TEXT NOT NULL,
+			emails TEXT NOT NULL,
+			firebase INT NOT NULL,
+			sender TEXT NOT NULL,
+			user TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_digests_due ON digests (due);
+	`
+
+	// 19 -> 20
+	migrate19To20AlterMessagesTableQuery = `
+		ALTER TABLE messages ADD COLUMN expires_explicit INT NOT NULL DEFAULT (0);
+	`
+
+	// 20 -> 21
+	migrate20To21AlterMessagesTableQuery = `
+		ALTER TABLE messages ADD COLUMN source TEXT NOT NULL DEFAULT ('');
+	`
 )
 
 var (
@@ -262,13 +559,39 @@ var (
 		9:  migrateFrom9,
 		10: migrateFrom10,
 		11: migrateFrom11,
+		12: migrateFrom12,
+		13: migrateFrom13,
+		14: migrateFrom14,
+		15: migrateFrom15,
+		16: migrateFrom16,
+		17: migrateFrom17,
+		18: migrateFrom18,
+		19: migrateFrom19,
+		20: migrateFrom20,
 	}
 )
 
+const (
+	// consumersFlushInterval defines how often pending consumer cursors are written to the database
+	consumersFlushInterval = 5 * time.Second
+)
+
 type messageCache struct {
-	db    *sql.DB
-	queue *util.BatchingQueue[*message]
-	nop   bool
+	db          *sql.DB
+	queue       *util.BatchingQueue[*message]
+	consumers   map[consumerKey]string // Pending consumer cursors (message IDs), not yet written to the database
+	consumersMu sync.Mutex
+	seqs        map[string]int64 // Last sequence number per topic, loaded at startup, see NextSeq
+	seqsMu      sync.Mutex
+	closed      chan struct{}
+	nop         bool
+}
+
+// consumerKey identifies the cursor of a named consumer of a user on a topic
+type consumerKey struct {
+	userID string
+	name   string
+	topic  string
 }
 
 // newSqliteCache creates a SQLite file-backed cache
@@ -280,16 +603,24 @@ func newSqliteCache(filename, startupQueries string, cacheDuration time.Duration
 	if err := setupMessagesDB(db, startupQueries, cacheDuration); err != nil {
 		return nil, err
 	}
+	seqs, err := readSequences(db)
+	if err != nil {
+		return nil, err
+	}
 	var queue *util.BatchingQueue[*message]
 	if batchSize > 0 || batchTimeout > 0 {
 		queue = util.NewBatchingQueue[*message](batchSize, batchTimeout)
 	}
 	cache := &messageCache{
-		db:    db,
-		queue: queue,
-		nop:   nop,
+		db:        db,
+		queue:     queue,
+		consumers: make(map[consumerKey]string),
+		seqs:      seqs,
+		closed:    make(chan struct{}),
+		nop:       nop,
 	}
 	go cache.processMessageBatches()
+	go cache.processConsumers()
 	return cache, nil
 }
 
@@ -344,6 +675,11 @@ func (c *messageCache) addMessages(ms []*message) error {
 		return err
 	}
 	defer stmt.Close()
+	seqStmt, err := tx.Prepare(upsertSequenceQuery)
+	if err != nil {
+		return err
+	}
+	defer seqStmt.Close()
 	for _, m := range ms {
 		if m.Event != messageEvent {
 			return errUnexpectedMessageType
@@ -394,10 +730,19 @@ func (c *messageCache) addMessages(ms []*message) error {
 			m.ContentType,
 			m.Encoding,
 			published,
+			m.Count,
+			m.Seq,
+			m.ExpiresExplicit,
+			m.Source,
 		)
 		if err != nil {
 			return err
 		}
+		if m.Seq > 0 {
+			if _, err := seqStmt.Exec(m.Topic, m.Seq); err != nil {
+				return err
+			}
+		}
 	}
 	if err := tx.Commit(); err != nil {
 		log.Tag(tagMessageCache).Err(err).Error("Writing %d message(s) failed (took %v)", len(ms), time.Since(start))
@@ -408,12 +753,34 @@ func (c *messageCache) addMessages(ms []*message) error {
 }
 
 func (c *messageCache) Messages(topic string, since sinceMarker, scheduled bool) ([]*message, error) {
+	var messages []*message
+	var err error
 	if since.IsNone() {
 		return make([]*message, 0), nil
 	} else if since.IsID() {
-		return c.messagesSinceID(topic, since, scheduled)
+		messages, err = c.messagesSinceID(topic, since, scheduled)
+	} else if since.IsSeq() {
+		messages, err = c.messagesSinceSeq(topic, since, scheduled)
+	} else {
+		messages, err = c.messagesSinceTime(topic, since, scheduled)
 	}
-	return c.messagesSinceTime(topic, since, scheduled)
+	if err != nil {
+		return nil, err
+	}
+	return withoutExpiredMessages(messages), nil
+}
+
+// withoutExpiredMessages filters out messages that have expired, but have not been pruned by the manager yet.
+// This ensures that messages with a short expiry (see X-Expires) are never returned after they have expired.
+func withoutExpiredMessages(messages []*message) []*message {
+	now := time.Now().Unix()
+	filtered := messages[:0]
+	for _, m := range messages {
+		if m.Expires == 0 || m.Expires > now {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
 }
 
 func (c *messageCache) messagesSinceTime(topic string, since sinceMarker, scheduled bool) ([]*message, error) {
@@ -456,6 +823,20 @@ func (c *messageCache) messagesSinceID(topic string, since sinceMarker, schedule
 	return readMessages(rows)
 }
 
+func (c *messageCache) messagesSinceSeq(topic string, since sinceMarker, scheduled bool) ([]*message, error) {
+	var rows *sql.Rows
+	var err error
+	if scheduled {
+		rows, err = c.db.Query(selectMessagesSinceSeqIncludeScheduledQuery, topic, since.Seq())
+	} else {
+		rows, err = c.db.Query(selectMessagesSinceSeqQuery, topic, since.Seq())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readMessages(rows)
+}
+
 func (c *messageCache) MessagesDue() ([]*message, error) {
 	rows, err := c.db.Query(selectMessagesDueQuery, time.Now().Unix())
 	if err != nil {
@@ -497,9 +878,60 @@ func (c *messageCache) Message(id string) (*message, error) {
 	return readMessage(rows)
 }
 
+// MarkPublished marks a scheduled message as published, and stores the sequence number it was assigned
+// when it was delivered
 func (c *messageCache) MarkPublished(m *message) error {
-	_, err := c.db.Exec(updateMessagePublishedQuery, m.ID)
-	return err
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(updateMessagePublishedQuery, m.Seq, m.ID); err != nil {
+		return err
+	}
+	if m.Seq > 0 {
+		if _, err := tx.Exec(upsertSequenceQuery, m.Topic, m.Seq); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// NextSeq increments the sequence number of the given topic in memory, and returns it. The number is persisted
+// along with the message (see addMessages), and loaded again at startup. Numbers of messages that are not cached
+// are therefore not persisted, and may be handed out again after a restart.
+func (c *messageCache) NextSeq(topic string) int64 {
+	c.seqsMu.Lock()
+	defer c.seqsMu.Unlock()
+	c.seqs[topic]++
+	return c.seqs[topic]
+}
+
+// LastSeq returns the last sequence number assigned to a message in the given topic, or 0 if no message
+// was ever published to the topic
+func (c *messageCache) LastSeq(topic string) int64 {
+	c.seqsMu.Lock()
+	defer c.seqsMu.Unlock()
+	return c.seqs[topic]
+}
+
+// readSequences reads the last sequence number of all topics, see NextSeq
+func readSequences(db *sql.DB) (map[string]int64, error) {
+	rows, err := db.Query(selectSequencesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	seqs := make(map[string]int64)
+	for rows.Next() {
+		var topic string
+		var seq int64
+		if err := rows.Scan(&topic, &seq); err != nil {
+			return nil, err
+		}
+		seqs[topic] = seq
+	}
+	return seqs, rows.Err()
 }
 
 func (c *messageCache) MessageCounts() (map[string]int, error) {
@@ -552,10 +984,428 @@ func (c *messageCache) DeleteMessages(ids ...string) error {
 		if _, err := tx.Exec(deleteMessageQuery, id); err != nil {
 			return err
 		}
+		if _, err := tx.Exec(deleteEscalationQuery, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deleteEscalationCopiesQuery, id, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deleteDedupQuery, id); err != nil {
+			return err
+		}
 	}
 	return tx.Commit()
 }
 
+// AddEscalation stores the escalation policy of a message. The first step is due relative to the message time.
+func (c *messageCache) AddEscalation(e *escalation) error {
+	if c.nop {
+		return nil
+	}
+	steps, err := json.Marshal(e.Steps)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(insertEscalationQuery, e.MessageID, e.Topic, e.Key, string(steps), e.NextStep, e.Due)
+	return err
+}
+
+// AddEscalationCopy records that the message with the given ID is a copy of the original message with
+// an escalation policy (e.g. a re-notification), so that Escalation also finds the escalation by the copy's ID
+func (c *messageCache) AddEscalationCopy(id, originalID string) error {
+	if c.nop {
+		return nil
+	}
+	_, err := c.db.Exec(insertEscalationCopyQuery, id, originalID)
+	return err
+}
+
+// Escalation returns the escalation of the message with the given ID, or errMessageNotFound. The ID may
+// also be the ID of a copy of the message, see AddEscalationCopy.
+func (c *messageCache) Escalation(id string) (*escalation, error) {
+	rows, err := c.db.Query(selectEscalationQuery, id, id)
+	if err != nil {
+		return nil, err
+	}
+	escalations, err := readEscalations(rows)
+	if err != nil {
+		return nil, err
+	} else if len(escalations) == 0 {
+		return nil, errMessageNotFound
+	}
+	return escalations[0], nil
+}
+
+// EscalationsDue returns all unacknowledged escalations with a step that is due
+func (c *messageCache) EscalationsDue() ([]*escalation, error) {
+	rows, err := c.db.Query(selectEscalationsDueQuery, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	return readEscalations(rows)
+}
+
+// MarkEscalationStep advances the escalation to the given step, due at the given time (0 if no steps are left)
+func (c *messageCache) MarkEscalationStep(id string, nextStep int, due int64) error {
+	_, err := c.db.Exec(updateEscalationNextStepQuery, nextStep, due, id)
+	return err
+}
+
+// AckEscalation marks the escalation as acknowledged, stopping all further steps. It returns false if the
+// escalation was already acknowledged before.
+func (c *messageCache) AckEscalation(id, ackedBy string) (bool, error) {
+	res, err := c.db.Exec(updateEscalationAckedQuery, time.Now().Unix(), ackedBy, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func readEscalations(rows *sql.Rows) ([]*escalation, error) {
+	defer rows.Close()
+	escalations := make([]*escalation, 0)
+	for rows.Next() {
+		var e escalation
+		var steps string
+		if err := rows.Scan(&e.MessageID, &e.Topic, &e.Key, &steps, &e.NextStep, &e.Due, &e.Acked, &e.AckedBy); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(steps), &e.Steps); err != nil {
+			return nil, err
+		}
+		escalations = append(escalations, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return escalations, nil
+}
+
+// AddDedup stores the message ID for the given topic and deduplication key, replacing any previous entry.
+// The entry is valid until the given expiry time (Unix time in seconds).
+func (c *messageCache) AddDedup(topic, key, messageID string, expires int64) error {
+	if c.nop {
+		return nil
+	}
+	_, err := c.db.Exec(upsertDedupQuery, topic, key, messageID, expires)
+	return err
+}
+
+// Dedup returns the ID of the message for the given topic and deduplication key, and the end of its deduplication
+// window, or errMessageNotFound if there is no such message, or if the deduplication window has passed
+func (c *messageCache) Dedup(topic, key string) (string, int64, error) {
+	rows, err := c.db.Query(selectDedupQuery, topic, key, time.Now().Unix())
+	if err != nil {
+		return "", 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", 0, errMessageNotFound
+	}
+	var messageID string
+	var expires int64
+	if err := rows.Scan(&messageID, &expires); err != nil {
+		return "", 0, err
+	}
+	return messageID, expires, rows.Err()
+}
+
+// IncrementMessageCount increments the count of the given message, i.e. the number of identical messages that
+// were received within the deduplication window
+func (c *messageCache) IncrementMessageCount(messageID string) error {
+	res, err := c.db.Exec(updateMessageCountQuery, messageID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return errMessageNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredDedups removes all deduplication entries whose window has passed
+func (c *messageCache) DeleteExpiredDedups() error {
+	_, err := c.db.Exec(deleteDedupExpiredQuery, time.Now().Unix())
+	return err
+}
+
+// UpdateConsumer stores the ID of the last message delivered to the given named consumer (durable subscription)
+// of the given user on the given topic. Cursors advance with every delivered message, so they are only written
+// to the database every few seconds (see FlushConsumers), and only the latest cursor per consumer is written.
+func (c *messageCache) UpdateConsumer(userID, name, topic, messageID string) error {
+	if c.nop {
+		return nil
+	}
+	c.consumersMu.Lock()
+	defer c.consumersMu.Unlock()
+	c.consumers[consumerKey{userID, name, topic}] = messageID
+	return nil
+}
+
+// Consumer returns the ID of the last message delivered to the given named consumer on the given topic,
+// or errConsumerNotFound if the consumer has not received any messages on the topic yet
+func (c *messageCache) Consumer(userID, name, topic string) (string, error) {
+	c.consumersMu.Lock()
+	messageID, ok := c.consumers[consumerKey{userID, name, topic}]
+	c.consumersMu.Unlock()
+	if ok {
+		return messageID, nil
+	}
+	rows, err := c.db.Query(selectConsumerQuery, userID, name, topic)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", errConsumerNotFound
+	}
+	if err := rows.Scan(&messageID); err != nil {
+		return "", err
+	}
+	return messageID, rows.Err()
+}
+
+// FlushConsumers writes all pending consumer cursors to the database in a single transaction
+func (c *messageCache) FlushConsumers() error {
+	c.consumersMu.Lock()
+	consumers := c.consumers
+	c.consumers = make(map[consumerKey]string)
+	c.consumersMu.Unlock()
+	if len(consumers) == 0 {
+		return nil
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	updated := time.Now().Unix()
+	for key, messageID := range consumers {
+		if _, err := tx.Exec(upsertConsumerQuery, key.userID, key.name, key.topic, messageID, updated); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c *messageCache) processConsumers() {
+	ticker := time.NewTicker(consumersFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.FlushConsumers(); err != nil {
+				log.Tag(tagMessageCache).Err(err).Warn("Error writing consumer cursors")
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// DeleteStaleConsumers removes all consumer cursors that have not been updated since the given time
+func (c *messageCache) DeleteStaleConsumers(before time.Time) error {
+	if err := c.FlushConsumers(); err != nil {
+		return err
+	}
+	_, err := c.db.Exec(deleteConsumersStaleQuery, before.Unix())
+	return err
+}
+
+// AddToDigest adds the message to the digest of its topic. If there is no open digest window for the topic, a new
+// window is opened, which ends after the given duration.
+func (c *messageCache) AddToDigest(m *message, window time.Duration, email string, firebase bool) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(selectDigestQuery, m.Topic)
+	if err != nil {
+		return err
+	}
+	digests, err := readDigests(rows)
+	if err != nil {
+		return err
+	}
+	d := &digest{
+		Topic: m.Topic,
+		Due:   time.Now().Add(window).Unix(),
+	}
+	if len(digests) > 0 {
+		d = digests[0]
+	}
+	d.add(m, email, firebase)
+	titles, err := json.Marshal(d.Titles)
+	if err != nil {
+		return err
+	}
+	last, err := json.Marshal(d.Last)
+	if err != nil {
+		return err
+	}
+	emails, err := json.Marshal(d.Emails)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(upsertDigestQuery, d.Topic, d.Due, d.Count, d.Priority, string(titles), string(last), string(emails), d.Firebase, d.Sender.String(), d.User); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DigestsDue removes and returns all digests whose window has passed
+func (c *messageCache) DigestsDue() ([]*digest, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	rows, err := tx.Query(selectDigestsDueQuery, now)
+	if err != nil {
+		return nil, err
+	}
+	digests, err := readDigests(rows)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(deleteDigestsDueQuery, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+func readDigests(rows *sql.Rows) ([]*digest, error) {
+	defer rows.Close()
+	digests := make([]*digest, 0)
+	for rows.Next() {
+		var d digest
+		var titles, last, emails, sender string
+		if err := rows.Scan(&d.Topic, &d.Due, &d.Count, &d.Priority, &titles, &last, &emails, &d.Firebase, &sender, &d.User); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(titles), &d.Titles); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal([]byte(last), &d.Last); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal([]byte(emails), &d.Emails); err != nil {
+			return nil, err
+		}
+		senderIP, err := netip.ParseAddr(sender)
+		if err != nil {
+			senderIP = netip.Addr{} // if no IP stored in database, return invalid address
+		}
+		d.Sender = senderIP
+		d.Last.Sender = d.Sender
+		d.Last.User = d.User
+		digests = append(digests, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// PingHeartbeat stores the given heartbeat, and resets its last ping time and overdue state. It returns
+// true if the heartbeat was overdue before, i.e. if a recovery message should be published.
+func (c *messageCache) PingHeartbeat(h *heartbeat) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var overdue bool
+	if err := tx.QueryRow(selectHeartbeatOverdueQuery, h.Topic).Scan(&overdue); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	if _, err := tx.Exec(upsertHeartbeatQuery, h.Topic, h.Interval, h.LastPing, h.Message, h.RecoveryMessage, h.Sender.String(), h.User); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	h.Overdue = false
+	return overdue, nil
+}
+
+// Heartbeat returns the heartbeat of the given topic, or errHeartbeatNotFound
+func (c *messageCache) Heartbeat(topic string) (*heartbeat, error) {
+	rows, err := c.db.Query(selectHeartbeatQuery, topic)
+	if err != nil {
+		return nil, err
+	}
+	heartbeats, err := readHeartbeats(rows)
+	if err != nil {
+		return nil, err
+	} else if len(heartbeats) == 0 {
+		return nil, errHeartbeatNotFound
+	}
+	return heartbeats[0], nil
+}
+
+// HeartbeatsOverdue returns all heartbeats that have not been pinged within their interval, and
+// for which no alert has been published yet
+func (c *messageCache) HeartbeatsOverdue() ([]*heartbeat, error) {
+	rows, err := c.db.Query(selectHeartbeatsOverdueQuery, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	return readHeartbeats(rows)
+}
+
+// MarkHeartbeatOverdue marks the heartbeat as overdue. It returns false if the heartbeat was pinged in
+// the meantime, or if it was already marked overdue.
+func (c *messageCache) MarkHeartbeatOverdue(topic string) (bool, error) {
+	res, err := c.db.Exec(updateHeartbeatOverdueQuery, topic, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// DeleteHeartbeat removes the heartbeat of the given topic
+func (c *messageCache) DeleteHeartbeat(topic string) error {
+	_, err := c.db.Exec(deleteHeartbeatQuery, topic)
+	return err
+}
+
+func readHeartbeats(rows *sql.Rows) ([]*heartbeat, error) {
+	defer rows.Close()
+	heartbeats := make([]*heartbeat, 0)
+	for rows.Next() {
+		var h heartbeat
+		var sender string
+		if err := rows.Scan(&h.Topic, &h.Interval, &h.LastPing, &h.Overdue, &h.Message, &h.RecoveryMessage, &sender, &h.User); err != nil {
+			return nil, err
+		}
+		senderIP, err := netip.ParseAddr(sender)
+		if err != nil {
+			senderIP = netip.Addr{} // if no IP stored in database, return invalid address
+		}
+		h.Sender = senderIP
+		heartbeats = append(heartbeats, &h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return heartbeats, nil
+}
+
 func (c *messageCache) ExpireMessages(topics ...string) error {
 	tx, err := c.db.Begin()
 	if err != nil {
@@ -570,6 +1420,73 @@ func (c *messageCache) ExpireMessages(topics ...string) error {
 	return tx.Commit()
 }
 
+// ExpireMessagesBefore marks all messages of the topic that were published before the given time as expired,
+// so that they are deleted (along with their attachments) the next time expired messages are pruned
+func (c *messageCache) ExpireMessagesBefore(topic string, before int64) error {
+	if c.nop {
+		return nil
+	}
+	now := time.Now().Unix()
+	_, err := c.db.Exec(updateMessagesForTopicExpiryBeforeQuery, now-1, topic, before, now-1)
+	return err
+}
+
+// ExpireMessagesBeyondCount marks all but the newest keep messages of the topic as expired, so that they are
+// deleted (along with their attachments) the next time expired messages are pruned
+func (c *messageCache) ExpireMessagesBeyondCount(topic string, keep int64) error {
+	if c.nop {
+		return nil
+	}
+	now := time.Now().Unix()
+	_, err := c.db.Exec(updateMessagesForTopicExpiryBeyondCountQuery, now-1, topic, now-1, topic, keep)
+	return err
+}
+
+// KeepLastMessages extends the expiry of the newest keep messages of each topic to the given time, if they are
+// about to expire before then. If exclude is false, only the given topics are affected, otherwise all topics except
+// the given ones. Messages that have already expired are not brought back, and messages with an expiry set by the
+// publisher (X-Expires) are never extended.
+func (c *messageCache) KeepLastMessages(keep, until int64, topics []string, exclude bool) error {
+	now := time.Now().Unix()
+	return c.updateMessagesByTopicRank("<=", keep, until, now, until, topics, exclude, true)
+}
+
+// ExpireMessagesBeyondLast marks all but the newest keep messages of each topic as expired, so that they are
+// deleted (along with their attachments) the next time expired messages are pruned. The topics and exclude
+// arguments work as in KeepLastMessages.
+func (c *messageCache) ExpireMessagesBeyondLast(keep int64, topics []string, exclude bool) error {
+	now := time.Now().Unix()
+	return c.updateMessagesByTopicRank(">", keep, now-1, now-1, math.MaxInt64, topics, exclude, false)
+}
+
+// updateMessagesByTopicRank sets the expiry of all messages whose rank within their topic (newest first) matches
+// the given comparison, and whose expiry is within the given bounds. If skipExplicit is set, messages with an
+// expiry set by the publisher (X-Expires) are left alone.
+func (c *messageCache) updateMessagesByTopicRank(cmp string, rank, expires, expiresAfter, expiresBefore int64, topics []string, exclude, skipExplicit bool) error {
+	if c.nop || (!exclude && len(topics) == 0) {
+		return nil
+	}
+	args := []any{expires, expiresAfter, expiresBefore}
+	filter := ""
+	if len(topics) > 0 {
+		op := "IN"
+		if exclude {
+			op = "NOT IN"
+		}
+		filter = fmt.Sprintf("AND topic %s (%s)", op, strings.TrimSuffix(strings.Repeat("?, ", len(topics)), ", "))
+		for _, t := range topics {
+			args = append(args, t)
+		}
+	}
+	args = append(args, rank)
+	expiresFilter := ""
+	if skipExplicit {
+		expiresFilter = "AND expires_explicit = 0"
+	}
+	_, err := c.db.Exec(fmt.Sprintf(updateMessagesByTopicRankExpiryQuery, expiresFilter, filter, cmp), args...)
+	return err
+}
+
 func (c *messageCache) AttachmentsExpired() ([]string, error) {
 	rows, err := c.db.Query(selectAttachmentsExpiredQuery, time.Now().Unix())
 	if err != nil {
@@ -663,8 +1580,10 @@ func readMessages(rows *sql.Rows) ([]*message, error) {
 
 func readMessage(rows *sql.Rows) (*message, error) {
 	var timestamp, expires, attachmentSize, attachmentExpires int64
-	var priority int
-	var id, topic, msg, title, tagsStr, click, icon, actionsStr, attachmentName, attachmentType, attachmentURL, sender, user, contentType, encoding string
+	var priority, count int
+	var seq int64
+	var expiresExplicit bool
+	var id, topic, msg, title, tagsStr, click, icon, actionsStr, attachmentName, attachmentType, attachmentURL, sender, user, contentType, encoding, source string
 	err := rows.Scan(
 		&id,
 		&timestamp,
@@ -686,6 +1605,10 @@ func readMessage(rows *sql.Rows) (*message, error) {
 		&user,
 		&contentType,
 		&encoding,
+		&count,
+		&seq,
+		&expiresExplicit,
+		&source,
 	)
 	if err != nil {
 		return nil, err
@@ -715,23 +1638,27 @@ func readMessage(rows *sql.Rows) (*message, error) {
 		}
 	}
 	return &message{
-		ID:          id,
-		Time:        timestamp,
-		Expires:     expires,
-		Event:       messageEvent,
-		Topic:       topic,
-		Message:     msg,
-		Title:       title,
-		Priority:    priority,
-		Tags:        tags,
-		Click:       click,
-		Icon:        icon,
-		Actions:     actions,
-		Attachment:  att,
-		Sender:      senderIP, // Must parse assuming database must be correct
-		User:        user,
-		ContentType: contentType,
-		Encoding:    encoding,
+		ID:              id,
+		Time:            timestamp,
+		Expires:         expires,
+		Event:           messageEvent,
+		Topic:           topic,
+		Message:         msg,
+		Title:           title,
+		Priority:        priority,
+		Tags:            tags,
+		Click:           click,
+		Icon:            icon,
+		Actions:         actions,
+		Attachment:      att,
+		Sender:          senderIP, // Must parse assuming database must be correct
+		User:            user,
+		ContentType:     contentType,
+		Encoding:        encoding,
+		Count:           count,
+		Seq:             seq,
+		ExpiresExplicit: expiresExplicit,
+		Source:          source,
 	}, nil
 }
 
@@ -756,6 +1683,14 @@ func (c *messageCache) Stats() (messages int64, err error) {
 }
 
 func (c *messageCache) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	if err := c.FlushConsumers(); err != nil {
+		log.Tag(tagMessageCache).Err(err).Warn("Error writing consumer cursors")
+	}
 	return c.db.Close()
 }
 
@@ -970,3 +1905,147 @@ func migrateFrom11(db *sql.DB, _ time.Duration) error {
 	}
 	return tx.Commit()
 }
+
+func migrateFrom12(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 12 to 13")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate12To13AlterMessagesTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 13); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom13(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 13 to 14")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate13To14CreateHeartbeatsTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 14); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom14(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 14 to 15")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate14To15AlterMessagesTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 15); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom15(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 15 to 16")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate15To16CreateConsumersTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 16); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom16(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 16 to 17")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate16To17AlterMessagesTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 17); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom17(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 17 to 18")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate17To18CreateEscalationCopiesTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 18); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom18(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 18 to 19")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate18To19CreateDigestsTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 19); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom19(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 19 to 20")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate19To20AlterMessagesTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 20); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom20(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 20 to 21")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate20To21AlterMessagesTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 21); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -504,6 +504,9 @@ func TestSqliteCache_Migration_From1(t *testing.T) {
 	messages, err := c.Messages("mytopic", sinceAllMessages, false)
 	require.Nil(t, err)
 	require.Equal(t, 10, len(messages))
+	require.Equal(t, int64(1), messages[0].Seq) // Sequence numbers are assigned during migration
+	require.Equal(t, int64(10), messages[9].Seq)
+	require.Equal(t, int64(10), c.LastSeq("mytopic"))
 
 	// 11!
 	messages, err = c.Messages("mytopic", sinceAllMessages, true)
@@ -686,6 +689,411 @@ func TestMemCache_NopCache(t *testing.T) {
 	assert.Empty(t, topics)
 }
 
+func TestSqliteCache_Escalations(t *testing.T) {
+	testCacheEscalations(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_Escalations(t *testing.T) {
+	testCacheEscalations(t, newMemTestCache(t))
+}
+
+func testCacheEscalations(t *testing.T, c *messageCache) {
+	m := newDefaultMessage("mytopic", "disk full")
+	require.Nil(t, c.AddMessage(m))
+	require.Nil(t, c.AddEscalation(&escalation{
+		MessageID: m.ID,
+		Topic:     m.Topic,
+		Key:       "somekey",
+		Steps: []*escalationStep{
+			{After: 300, Action: escalateActionRenotify},
+			{After: 900, Action: escalateActionCall, Target: "+12223334444"},
+		},
+		Due: time.Now().Add(-time.Second).Unix(),
+	}))
+
+	// Due
+	escalations, err := c.EscalationsDue()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(escalations))
+	require.Equal(t, m.ID, escalations[0].MessageID)
+	require.Equal(t, "somekey", escalations[0].Key)
+	require.Equal(t, 2, len(escalations[0].Steps))
+	require.Equal(t, escalateActionCall, escalations[0].Steps[1].Action)
+	require.Equal(t, "+12223334444", escalations[0].Steps[1].Target)
+
+	// Advance step, no longer due
+	require.Nil(t, c.MarkEscalationStep(m.ID, 1, time.Now().Add(time.Hour).Unix()))
+	escalations, err = c.EscalationsDue()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(escalations))
+
+	// Ack, twice
+	acked, err := c.AckEscalation(m.ID, "phil")
+	require.Nil(t, err)
+	require.True(t, acked)
+	acked, err = c.AckEscalation(m.ID, "ben")
+	require.Nil(t, err)
+	require.False(t, acked)
+
+	e, err := c.Escalation(m.ID)
+	require.Nil(t, err)
+	require.Equal(t, 1, e.NextStep)
+	require.Equal(t, int64(0), e.Due)
+	require.True(t, e.Acked > 0)
+	require.Equal(t, "phil", e.AckedBy)
+
+	// Deleting the message deletes the escalation
+	require.Nil(t, c.DeleteMessages(m.ID))
+	_, err = c.Escalation(m.ID)
+	require.Equal(t, errMessageNotFound, err)
+}
+
+func TestSqliteCache_Heartbeats(t *testing.T) {
+	testCacheHeartbeats(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_Heartbeats(t *testing.T) {
+	testCacheHeartbeats(t, newMemTestCache(t))
+}
+
+func testCacheHeartbeats(t *testing.T, c *messageCache) {
+	_, err := c.Heartbeat("backups")
+	require.Equal(t, errHeartbeatNotFound, err)
+
+	// First ping, not overdue
+	recovered, err := c.PingHeartbeat(&heartbeat{
+		Topic:    "backups",
+		Interval: 600,
+		LastPing: time.Now().Add(-time.Hour).Unix(),
+		Message:  "backup did not run",
+		Sender:   netip.MustParseAddr("1.2.3.4"),
+	})
+	require.Nil(t, err)
+	require.False(t, recovered)
+
+	h, err := c.Heartbeat("backups")
+	require.Nil(t, err)
+	require.Equal(t, int64(600), h.Interval)
+	require.Equal(t, "backup did not run", h.Message)
+	require.Equal(t, "1.2.3.4", h.Sender.String())
+	require.False(t, h.Overdue)
+
+	// Overdue, marked only once
+	heartbeats, err := c.HeartbeatsOverdue()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(heartbeats))
+	marked, err := c.MarkHeartbeatOverdue("backups")
+	require.Nil(t, err)
+	require.True(t, marked)
+	marked, err = c.MarkHeartbeatOverdue("backups")
+	require.Nil(t, err)
+	require.False(t, marked)
+	heartbeats, err = c.HeartbeatsOverdue()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(heartbeats))
+
+	// Ping again, recovered
+	h.LastPing = time.Now().Unix()
+	recovered, err = c.PingHeartbeat(h)
+	require.Nil(t, err)
+	require.True(t, recovered)
+	h, err = c.Heartbeat("backups")
+	require.Nil(t, err)
+	require.False(t, h.Overdue)
+
+	// Delete
+	require.Nil(t, c.DeleteHeartbeat("backups"))
+	_, err = c.Heartbeat("backups")
+	require.Equal(t, errHeartbeatNotFound, err)
+}
+
+func TestSqliteCache_Digests(t *testing.T) {
+	testCacheDigests(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_Digests(t *testing.T) {
+	testCacheDigests(t, newMemTestCache(t))
+}
+
+func testCacheDigests(t *testing.T, c *messageCache) {
+	for i := 1; i <= 3; i++ {
+		m := newDefaultMessage("deploys", fmt.Sprintf("deploy %d", i))
+		m.User = "u_123"
+		require.Nil(t, c.AddToDigest(m, time.Minute, "phil@example.com", i == 2))
+	}
+	require.Nil(t, c.AddToDigest(newDefaultMessage("other", "hi"), time.Minute, "", false))
+	digests, err := c.DigestsDue()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(digests))
+
+	_, err = c.db.Exec(`UPDATE digests SET due = ? WHERE topic = 'deploys'`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	digests, err = c.DigestsDue()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(digests))
+	d := digests[0]
+	require.Equal(t, "deploys", d.Topic)
+	require.Equal(t, 3, d.Count)
+	require.Equal(t, []string{"deploy 1", "deploy 2", "deploy 3"}, d.Titles)
+	require.Equal(t, []string{"phil@example.com"}, d.Emails)
+	require.Equal(t, "deploy 3", d.Last.Message)
+	require.Equal(t, "u_123", d.Last.User)
+	require.True(t, d.Firebase)
+
+	// Due digests are removed
+	digests, err = c.DigestsDue()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(digests))
+}
+
+func TestSqliteCache_Dedup(t *testing.T) {
+	testCacheDedup(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_Dedup(t *testing.T) {
+	testCacheDedup(t, newMemTestCache(t))
+}
+
+func testCacheDedup(t *testing.T, c *messageCache) {
+	m := newDefaultMessage("mytopic", "disk full")
+	m.Count = 1
+	require.Nil(t, c.AddMessage(m))
+	expires := time.Now().Add(time.Minute).Unix()
+	require.Nil(t, c.AddDedup("mytopic", "key1", m.ID, expires))
+	require.Nil(t, c.AddDedup("mytopic", "key2", "expired", time.Now().Add(-time.Second).Unix()))
+
+	messageID, messageExpires, err := c.Dedup("mytopic", "key1")
+	require.Nil(t, err)
+	require.Equal(t, m.ID, messageID)
+	require.Equal(t, expires, messageExpires)
+	_, _, err = c.Dedup("othertopic", "key1")
+	require.Equal(t, errMessageNotFound, err)
+	_, _, err = c.Dedup("mytopic", "key2")
+	require.Equal(t, errMessageNotFound, err)
+
+	// Increment count
+	require.Nil(t, c.IncrementMessageCount(m.ID))
+	require.Nil(t, c.IncrementMessageCount(m.ID))
+	require.Equal(t, errMessageNotFound, c.IncrementMessageCount("doesnotexist"))
+	m, err = c.Message(m.ID)
+	require.Nil(t, err)
+	require.Equal(t, 3, m.Count)
+
+	// Expired entries are pruned, deleting the message deletes its entry
+	require.Nil(t, c.DeleteExpiredDedups())
+	var count int
+	require.Nil(t, c.db.QueryRow(`SELECT COUNT(*) FROM dedup`).Scan(&count))
+	require.Equal(t, 1, count)
+	require.Nil(t, c.DeleteMessages(m.ID))
+	_, _, err = c.Dedup("mytopic", "key1")
+	require.Equal(t, errMessageNotFound, err)
+}
+
+func TestSqliteCache_ExpireMessagesForTopic(t *testing.T) {
+	testCacheExpireMessagesForTopic(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_ExpireMessagesForTopic(t *testing.T) {
+	testCacheExpireMessagesForTopic(t, newMemTestCache(t))
+}
+
+func testCacheExpireMessagesForTopic(t *testing.T, c *messageCache) {
+	for i := 0; i < 5; i++ {
+		m := newDefaultMessage("mytopic", fmt.Sprintf("message %d", i))
+		m.Time = time.Now().Add(time.Duration(i-5) * time.Hour).Unix()
+		m.Expires = time.Now().Add(time.Hour).Unix()
+		require.Nil(t, c.AddMessage(m))
+	}
+	other := newDefaultMessage("othertopic", "old message")
+	other.Time = time.Now().Add(-10 * time.Hour).Unix()
+	other.Expires = time.Now().Add(time.Hour).Unix()
+	require.Nil(t, c.AddMessage(other))
+
+	// Messages older than 3h: message 0 (5h ago), message 1 (4h ago)
+	require.Nil(t, c.ExpireMessagesBefore("mytopic", time.Now().Add(-3*time.Hour).Unix()))
+	ids, err := c.MessagesExpired()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(ids))
+
+	// Keep only the newest two: additionally message 2
+	require.Nil(t, c.ExpireMessagesBeyondCount("mytopic", 2))
+	ids, err = c.MessagesExpired()
+	require.Nil(t, err)
+	require.Equal(t, 3, len(ids))
+	require.Nil(t, c.DeleteMessages(ids...))
+
+	messages, err := c.Messages("mytopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "message 3", messages[0].Message)
+	require.Equal(t, "message 4", messages[1].Message)
+	messages, err = c.Messages("othertopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+}
+
+func TestSqliteCache_KeepLastMessages(t *testing.T) {
+	testCacheKeepLastMessages(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_KeepLastMessages(t *testing.T) {
+	testCacheKeepLastMessages(t, newMemTestCache(t))
+}
+
+func testCacheKeepLastMessages(t *testing.T, c *messageCache) {
+	for _, topic := range []string{"mytopic", "othertopic"} {
+		for i := 0; i < 4; i++ {
+			m := newDefaultMessage(topic, fmt.Sprintf("message %d", i))
+			m.Time = time.Now().Add(time.Duration(i-4) * time.Hour).Unix()
+			m.Expires = time.Now().Add(time.Duration(i+1) * time.Minute).Unix()
+			m.ExpiresExplicit = topic == "mytopic" && i == 3 // e.g. X-Expires: 4m
+			require.Nil(t, c.AddMessage(m))
+		}
+	}
+	expired := newDefaultMessage("mytopic", "already expired")
+	expired.Expires = time.Now().Add(-time.Minute).Unix()
+	require.Nil(t, c.AddMessage(expired))
+
+	// Newest three of "mytopic" are extended, except for the expired one, which is not brought back, and the one
+	// with an explicit expiry, which must not outlive it; "othertopic" is untouched
+	until := time.Now().Add(time.Hour).Unix()
+	require.Nil(t, c.KeepLastMessages(3, until, []string{"othertopic"}, true))
+	messages, err := c.Messages("mytopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Equal(t, 4, len(messages))
+	require.Less(t, messages[1].Expires, until)
+	require.Equal(t, until, messages[2].Expires)
+	require.Equal(t, "message 3", messages[3].Message)
+	require.Less(t, messages[3].Expires, until)
+	messages, err = c.Messages("othertopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Less(t, messages[3].Expires, until)
+
+	// Cap "othertopic" to the newest message
+	require.Nil(t, c.ExpireMessagesBeyondLast(1, []string{"othertopic"}, false))
+	ids, err := c.MessagesExpired()
+	require.Nil(t, err)
+	require.Equal(t, 4, len(ids)) // 3 capped + 1 already expired
+	require.Nil(t, c.DeleteMessages(ids...))
+	messages, err = c.Messages("othertopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "message 3", messages[0].Message)
+}
+
+func TestSqliteCache_MessagesSinceSeq(t *testing.T) {
+	testCacheMessagesSinceSeq(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_MessagesSinceSeq(t *testing.T) {
+	testCacheMessagesSinceSeq(t, newMemTestCache(t))
+}
+
+func testCacheMessagesSinceSeq(t *testing.T, c *messageCache) {
+	require.Equal(t, int64(0), c.LastSeq("mytopic"))
+
+	for i := 1; i <= 3; i++ {
+		m := newDefaultMessage("mytopic", fmt.Sprintf("message %d", i))
+		m.Seq = c.NextSeq("mytopic")
+		require.Equal(t, int64(i), m.Seq)
+		require.Nil(t, c.AddMessage(m))
+	}
+	other := newDefaultMessage("othertopic", "other message")
+	other.Seq = c.NextSeq("othertopic")
+	require.Nil(t, c.AddMessage(other))
+	delayed := newDefaultMessage("mytopic", "delayed message")
+	delayed.Time = time.Now().Add(time.Hour).Unix()
+	require.Nil(t, c.AddMessage(delayed))
+
+	messages, err := c.Messages("mytopic", newSinceSeq(1), false)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "message 2", messages[0].Message)
+	require.Equal(t, int64(2), messages[0].Seq)
+	require.Equal(t, "message 3", messages[1].Message)
+
+	messages, err = c.Messages("mytopic", newSinceSeq(3), true)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "delayed message", messages[0].Message)
+	require.Equal(t, int64(0), messages[0].Seq)
+
+	require.Equal(t, int64(3), c.LastSeq("mytopic"))
+	require.Equal(t, int64(1), c.LastSeq("othertopic"))
+
+	// Delayed messages are assigned a sequence number when they are published
+	delayed.Seq = c.NextSeq("mytopic")
+	require.Nil(t, c.MarkPublished(delayed))
+	messages, err = c.Messages("mytopic", newSinceSeq(3), false)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, int64(4), messages[0].Seq)
+	require.Equal(t, int64(4), c.LastSeq("mytopic"))
+
+	// Sequence numbers are kept, even if all messages are gone
+	require.Nil(t, c.DeleteMessages(messages[0].ID))
+	require.Equal(t, int64(4), c.LastSeq("mytopic"))
+	require.Equal(t, int64(5), c.NextSeq("mytopic"))
+}
+
+func TestSqliteCache_SequencesLoadedAtStartup(t *testing.T) {
+	filename := newSqliteTestCacheFile(t)
+	c := newSqliteTestCacheFromFile(t, filename, "")
+	for i := 0; i < 3; i++ {
+		m := newDefaultMessage("mytopic", "some message")
+		m.Seq = c.NextSeq("mytopic")
+		require.Nil(t, c.AddMessage(m))
+	}
+	messages, err := c.Messages("mytopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Nil(t, c.DeleteMessages(messages[2].ID))
+	require.Nil(t, c.Close())
+
+	// Sequence numbers continue after a restart, even if the last message is gone
+	c = newSqliteTestCacheFromFile(t, filename, "")
+	require.Equal(t, int64(3), c.LastSeq("mytopic"))
+	require.Equal(t, int64(4), c.NextSeq("mytopic"))
+	require.Equal(t, int64(1), c.NextSeq("othertopic"))
+}
+
+func TestSqliteCache_Consumers(t *testing.T) {
+	testCacheConsumers(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_Consumers(t *testing.T) {
+	testCacheConsumers(t, newMemTestCache(t))
+}
+
+func testCacheConsumers(t *testing.T, c *messageCache) {
+	_, err := c.Consumer("", "laptop", "mytopic")
+	require.Equal(t, errConsumerNotFound, err)
+
+	require.Nil(t, c.UpdateConsumer("", "laptop", "mytopic", "msg1"))
+	require.Nil(t, c.UpdateConsumer("", "laptop", "mytopic", "msg2"))
+	require.Nil(t, c.UpdateConsumer("u_phil", "laptop", "mytopic", "msg3"))
+	messageID, err := c.Consumer("", "laptop", "mytopic")
+	require.Nil(t, err)
+	require.Equal(t, "msg2", messageID)
+	messageID, err = c.Consumer("u_phil", "laptop", "mytopic")
+	require.Nil(t, err)
+	require.Equal(t, "msg3", messageID)
+
+	// Cursors are written in batches, only the latest cursor per consumer
+	var count int
+	require.Nil(t, c.db.QueryRow(`SELECT COUNT(*) FROM consumers`).Scan(&count))
+	require.Equal(t, 0, count)
+	require.Nil(t, c.FlushConsumers())
+	require.Nil(t, c.db.QueryRow(`SELECT COUNT(*) FROM consumers`).Scan(&count))
+	require.Equal(t, 2, count)
+	messageID, err = c.Consumer("", "laptop", "mytopic")
+	require.Nil(t, err)
+	require.Equal(t, "msg2", messageID)
+
+	require.Nil(t, c.DeleteStaleConsumers(time.Now().Add(time.Minute)))
+	_, err = c.Consumer("", "laptop", "mytopic")
+	require.Equal(t, errConsumerNotFound, err)
+}
+
 func newSqliteTestCache(t *testing.T) *messageCache {
 	c, err := newSqliteCache(newSqliteTestCacheFile(t), "", time.Hour, 0, 0, false)
 	if err != nil {
@@ -30,6 +30,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
@@ -46,8 +47,9 @@ type Server struct {
 	smtpServer        *smtp.Server
 	smtpServerBackend *smtpBackend
 	smtpSender        mailer
-	topics            map[string]*topic
-	visitors          map[string]*visitor // ip:<ip> or user:<user>
+	topics            *util.ShardedMap[*topic]
+	topicPatterns     *topicPatternRegistry      // Subscriptions to topic patterns (e.g. alerts-*), attached to new topics
+	visitors          *util.ShardedMap[*visitor] // ip:<ip> or user:<user>
 	firebaseClient    *firebaseClient
 	messages          int64                               // Total number of messages (persisted if messageCache enabled)
 	messagesHistory   []int64                             // Last n values of the messages counter, used to determine rate
@@ -55,6 +57,9 @@ type Server struct {
 	messageCache      *messageCache                       // Database that stores the messages
 	webPush           *webPushStore                       // Database that stores web push subscriptions
 	fileCache         *fileCache                          // File system based cache that stores attachments
+	dedupIndex        *dedupIndex                         // In-memory index of recent deduplication keys, backed by messageCache
+	dedupLocks        [dedupLockShards]sync.Mutex         // Makes checking and storing deduplicated messages atomic, see lockDedup
+	auditLoginFailed  *rate.Limiter                       // Limits the number of failed logins written to the audit log
 	stripe            stripeAPI                           // Stripe API, can be replaced with a mock
 	priceCache        *util.LookupCache[map[string]int64] // Stripe price ID -> price as cents (USD implied!)
 	metricsHandler    http.Handler                        // Handles /metrics if enable-metrics set, and listen-metrics-http not set
@@ -70,10 +75,14 @@ var (
 	topicRegex             = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)               // No /!
 	topicPathRegex         = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}$`)              // Regex must match JS & Android app!
 	externalTopicPathRegex = regexp.MustCompile(`^/[^/]+\.[^/]+/[-_A-Za-z0-9]{1,64}$`) // Extended topic path, for web-app, e.g. /example.com/mytopic
-	jsonPathRegex          = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}(,[-_A-Za-z0-9]{1,64})*/json$`)
-	ssePathRegex           = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}(,[-_A-Za-z0-9]{1,64})*/sse$`)
-	rawPathRegex           = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}(,[-_A-Za-z0-9]{1,64})*/raw$`)
-	wsPathRegex            = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}(,[-_A-Za-z0-9]{1,64})*/ws$`)
+	jsonPathRegex          = regexp.MustCompile(`^/[-_A-Za-z0-9*]{1,64}(,[-_A-Za-z0-9*]{1,64})*/json$`)
+	ssePathRegex           = regexp.MustCompile(`^/[-_A-Za-z0-9*]{1,64}(,[-_A-Za-z0-9*]{1,64})*/sse$`)
+	rawPathRegex           = regexp.MustCompile(`^/[-_A-Za-z0-9*]{1,64}(,[-_A-Za-z0-9*]{1,64})*/raw$`)
+	wsPathRegex            = regexp.MustCompile(`^/[-_A-Za-z0-9*]{1,64}(,[-_A-Za-z0-9*]{1,64})*/ws$`)
+	rssPathRegex           = regexp.MustCompile(`^/[-_A-Za-z0-9*]{1,64}(,[-_A-Za-z0-9*]{1,64})*/rss$`)
+	atomPathRegex          = regexp.MustCompile(`^/[-_A-Za-z0-9*]{1,64}(,[-_A-Za-z0-9*]{1,64})*/atom$`)
+	jsonFeedPathRegex      = regexp.MustCompile(`^/[-_A-Za-z0-9*]{1,64}(,[-_A-Za-z0-9*]{1,64})*/feed\.json$`)
+	cloudEventsPathRegex   = regexp.MustCompile(`^/[-_A-Za-z0-9*]{1,64}(,[-_A-Za-z0-9*]{1,64})*/cloudevents$`)
 	authPathRegex          = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}(,[-_A-Za-z0-9]{1,64})*/auth$`)
 	publishPathRegex       = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}/(publish|send|trigger)$`)
 
@@ -90,6 +99,16 @@ var (
 	apiTiersPath                                         = "/v1/tiers"
 	apiUsersPath                                         = "/v1/users"
 	apiUsersAccessPath                                   = "/v1/users/access"
+	apiUsersTokensPath                                   = "/v1/users/tokens"
+	apiUsersReservationsPath                             = "/v1/users/reservations"
+	apiAdminTiersPath                                    = "/v1/admin/tiers"
+	apiAdminAuditPath                                    = "/v1/admin/audit"
+	apiGroupsPath                                        = "/v1/groups"
+	apiGroupsMembersPath                                 = "/v1/groups/members"
+	apiGroupsAccessPath                                  = "/v1/groups/access"
+	apiSchedulesPath                                     = "/v1/schedules"
+	apiSchedulesMembersPath                              = "/v1/schedules/members"
+	apiSchedulesOverridesPath                            = "/v1/schedules/overrides"
 	apiAccountPath                                       = "/v1/account"
 	apiAccountTokenPath                                  = "/v1/account/token"
 	apiAccountPasswordPath                               = "/v1/account/password"
@@ -104,6 +123,12 @@ var (
 	apiAccountBillingSubscriptionCheckoutSuccessTemplate = "/v1/account/billing/subscription/success/{CHECKOUT_SESSION_ID}"
 	apiAccountBillingSubscriptionCheckoutSuccessRegex    = regexp.MustCompile(`/v1/account/billing/subscription/success/(.+)$`)
 	apiAccountReservationSingleRegex                     = regexp.MustCompile(`/v1/account/reservation/([-_A-Za-z0-9]{1,64})$`)
+	apiMessageAckRegex                                   = regexp.MustCompile(`^/v1/messages/([-_A-Za-z0-9]{1,64})/ack$`)
+	apiTopicSettingsRegex                                = regexp.MustCompile(`^/v1/topics/([-_A-Za-z0-9]{1,64})/settings$`)
+	apiTopicInfoRegex                                    = regexp.MustCompile(`^/v1/topics/([-_A-Za-z0-9]{1,64})/info$`)
+	heartbeatPathRegex                                   = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}/heartbeat$`)
+	topicInfoPathRegex                                   = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}/info$`)
+	consumerAckPathRegex                                 = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}/ack$`)
 	staticRegex                                          = regexp.MustCompile(`^/static/.+`)
 	docsRegex                                            = regexp.MustCompile(`^/docs(|/.*)$`)
 	fileRegex                                            = regexp.MustCompile(`^/file/([-_A-Za-z0-9]{1,64})(?:\.[A-Za-z0-9]{1,16})?$`)
@@ -129,16 +154,23 @@ const (
 	defaultAttachmentMessage = "You received a file: %s" // Used if message body is empty, and there is an attachment
 	encodingBase64           = "base64"                  // Used mainly for binary UnifiedPush messages
 	jsonBodyBytesLimit       = 16384                     // Max number of bytes for a JSON request body
+	registryShards           = 64                        // Number of shards of the topic and visitor registries, see util.ShardedMap
 	unifiedPushTopicPrefix   = "up"                      // Temporarily, we rate limit all "up*" topics based on the subscriber
 	unifiedPushTopicLength   = 14                        // Length of UnifiedPush topics, including the "up" part
 	messagesHistoryMax       = 10                        // Number of message count values to keep in memory
+	longPollWaitMax          = 5 * time.Minute           // Max. time a long-poll request (poll=1&wait=...) may wait for new messages
+)
+
+// Audit log constants
+const (
+	auditLoginFailedLimitBurst     = 100              // Max. number of failed logins recorded in the audit log in a burst (across all visitors)
+	auditLoginFailedLimitReplenish = 10 * time.Second // Rate at which failed logins are recorded after the burst, to avoid flooding the database
 )
 
 // WebSocket constants
 const (
 	wsWriteWait  = 2 * time.Second
 	wsBufferSize = 1024
-	wsReadLimit  = 64 // We only ever receive PINGs
 	wsPongWait   = 15 * time.Second
 )
 
@@ -201,18 +233,24 @@ func New(conf *Config) (*Server, error) {
 		firebaseClient = newFirebaseClient(sender, auther)
 	}
 	s := &Server{
-		config:          conf,
-		messageCache:    messageCache,
-		webPush:         webPush,
-		fileCache:       fileCache,
-		firebaseClient:  firebaseClient,
-		smtpSender:      mailer,
-		topics:          topics,
-		userManager:     userManager,
-		messages:        messages,
-		messagesHistory: []int64{messages},
-		visitors:        make(map[string]*visitor),
-		stripe:          stripe,
+		config:           conf,
+		messageCache:     messageCache,
+		webPush:          webPush,
+		fileCache:        fileCache,
+		dedupIndex:       newDedupIndex(dedupIndexSizeMax),
+		auditLoginFailed: rate.NewLimiter(rate.Every(auditLoginFailedLimitReplenish), auditLoginFailedLimitBurst),
+		firebaseClient:   firebaseClient,
+		smtpSender:       mailer,
+		topics:           util.NewShardedMap[*topic](registryShards),
+		topicPatterns:    newTopicPatternRegistry(),
+		userManager:      userManager,
+		messages:         messages,
+		messagesHistory:  []int64{messages},
+		visitors:         util.NewShardedMap[*visitor](registryShards),
+		stripe:           stripe,
+	}
+	for id, t := range topics {
+		s.topics.Set(id, t)
 	}
 	s.priceCache = util.NewLookupCache(s.fetchStripePrices, conf.StripePriceCacheDuration)
 	return s, nil
@@ -326,6 +364,8 @@ func (s *Server) Run() error {
 	go s.runManager()
 	go s.runStatsResetter()
 	go s.runDelayedSender()
+	go s.runEscalationSender()
+	go s.runDigestSender()
 	go s.runFirebaseKeepaliver()
 
 	return <-errChan
@@ -439,12 +479,74 @@ func (s *Server) handleInternal(w http.ResponseWriter, r *http.Request, v *visit
 		return s.ensureAdmin(s.handleUsersGet)(w, r, v)
 	} else if r.Method == http.MethodPut && r.URL.Path == apiUsersPath {
 		return s.ensureAdmin(s.handleUsersAdd)(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiUsersPath {
+		return s.ensureAdmin(s.handleUsersChange)(w, r, v)
 	} else if r.Method == http.MethodDelete && r.URL.Path == apiUsersPath {
 		return s.ensureAdmin(s.handleUsersDelete)(w, r, v)
 	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == apiUsersAccessPath {
 		return s.ensureAdmin(s.handleAccessAllow)(w, r, v)
 	} else if r.Method == http.MethodDelete && r.URL.Path == apiUsersAccessPath {
 		return s.ensureAdmin(s.handleAccessReset)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiUsersTokensPath {
+		return s.ensureAdmin(s.handleUserTokensGet)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiUsersTokensPath {
+		return s.ensureAdmin(s.handleUserTokensDelete)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiUsersReservationsPath {
+		return s.ensureAdmin(s.handleUserReservationsGet)(w, r, v)
+	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == apiUsersReservationsPath {
+		return s.ensureAdmin(s.handleUserReservationsAdd)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiUsersReservationsPath {
+		return s.ensureAdmin(s.handleUserReservationsDelete)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAdminTiersPath {
+		return s.ensureAdmin(s.handleTiersGet)(w, r, v)
+	} else if r.Method == http.MethodPut && r.URL.Path == apiAdminTiersPath {
+		return s.ensureAdmin(s.handleTiersAdd)(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiAdminTiersPath {
+		return s.ensureAdmin(s.handleTiersChange)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiAdminTiersPath {
+		return s.ensureAdmin(s.handleTiersDelete)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAdminAuditPath {
+		return s.ensureAdmin(s.handleAuditGet)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiGroupsPath {
+		return s.ensureAdmin(s.handleGroupsGet)(w, r, v)
+	} else if r.Method == http.MethodPut && r.URL.Path == apiGroupsPath {
+		return s.ensureAdmin(s.handleGroupsAdd)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiGroupsPath {
+		return s.ensureAdmin(s.handleGroupsDelete)(w, r, v)
+	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == apiGroupsMembersPath {
+		return s.ensureAdmin(s.handleGroupMembersAdd)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiGroupsMembersPath {
+		return s.ensureAdmin(s.handleGroupMembersRemove)(w, r, v)
+	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == apiGroupsAccessPath {
+		return s.ensureAdmin(s.handleGroupAccessAllow)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiGroupsAccessPath {
+		return s.ensureAdmin(s.handleGroupAccessReset)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiSchedulesPath {
+		return s.ensureAdmin(s.handleSchedulesGet)(w, r, v)
+	} else if r.Method == http.MethodPut && r.URL.Path == apiSchedulesPath {
+		return s.ensureAdmin(s.handleSchedulesAdd)(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiSchedulesPath {
+		return s.ensureAdmin(s.handleSchedulesChange)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiSchedulesPath {
+		return s.ensureAdmin(s.handleSchedulesDelete)(w, r, v)
+	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == apiSchedulesMembersPath {
+		return s.ensureAdmin(s.handleScheduleMembersAdd)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiSchedulesMembersPath {
+		return s.ensureAdmin(s.handleScheduleMembersRemove)(w, r, v)
+	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == apiSchedulesOverridesPath {
+		return s.ensureAdmin(s.handleScheduleOverridesAdd)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiSchedulesOverridesPath {
+		return s.ensureAdmin(s.handleScheduleOverridesRemove)(w, r, v)
+	} else if r.Method == http.MethodGet && apiTopicSettingsRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleTopicSettingsGet)(w, r, v)
+	} else if r.Method == http.MethodPatch && apiTopicSettingsRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleTopicSettingsChange)(w, r, v)
+	} else if r.Method == http.MethodDelete && apiTopicSettingsRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleTopicSettingsDelete)(w, r, v)
+	} else if r.Method == http.MethodPatch && apiTopicInfoRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleTopicInfoChange)(w, r, v)
+	} else if r.Method == http.MethodDelete && apiTopicInfoRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleTopicInfoDelete)(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountPath {
 		return s.ensureUserManager(s.handleAccountCreate)(w, r, v)
 	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountPath {
@@ -507,6 +609,16 @@ func (s *Server) handleInternal(w http.ResponseWriter, r *http.Request, v *visit
 		return s.ensureWebEnabled(s.handleDocs)(w, r, v)
 	} else if (r.Method == http.MethodGet || r.Method == http.MethodHead) && fileRegex.MatchString(r.URL.Path) && s.config.AttachmentCacheDir != "" {
 		return s.limitRequests(s.handleFile)(w, r, v)
+	} else if (r.Method == http.MethodGet || r.Method == http.MethodPost || r.Method == http.MethodPut) && apiMessageAckRegex.MatchString(r.URL.Path) {
+		return s.limitRequests(s.handleMessageAck)(w, r, v)
+	} else if (r.Method == http.MethodGet || r.Method == http.MethodPost || r.Method == http.MethodPut) && heartbeatPathRegex.MatchString(r.URL.Path) {
+		return s.limitRequestsWithTopic(s.authorizeTopicWrite(s.handleHeartbeat))(w, r, v)
+	} else if r.Method == http.MethodDelete && heartbeatPathRegex.MatchString(r.URL.Path) {
+		return s.limitRequestsWithTopic(s.authorizeTopicWrite(s.handleHeartbeatDelete))(w, r, v)
+	} else if r.Method == http.MethodGet && topicInfoPathRegex.MatchString(r.URL.Path) {
+		return s.limitRequestsWithTopic(s.authorizeTopicRead(s.handleTopicInfo))(w, r, v)
+	} else if (r.Method == http.MethodPost || r.Method == http.MethodPut) && consumerAckPathRegex.MatchString(r.URL.Path) {
+		return s.limitRequestsWithTopic(s.authorizeTopicRead(s.handleConsumerAck))(w, r, v)
 	} else if r.Method == http.MethodOptions {
 		return s.limitRequests(s.handleOptions)(w, r, v) // Should work even if the web app is not enabled, see #598
 	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == "/" {
@@ -514,7 +626,7 @@ func (s *Server) handleInternal(w http.ResponseWriter, r *http.Request, v *visit
 	} else if r.Method == http.MethodPost && r.URL.Path == matrixPushPath {
 		return s.transformMatrixJSON(s.limitRequestsWithTopic(s.authorizeTopicWrite(s.handlePublishMatrix)))(w, r, v)
 	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && topicPathRegex.MatchString(r.URL.Path) {
-		return s.limitRequestsWithTopic(s.authorizeTopicWrite(s.handlePublish))(w, r, v)
+		return s.transformCloudEvent(s.limitRequestsWithTopic(s.authorizeTopicWrite(s.handlePublish)))(w, r, v)
 	} else if r.Method == http.MethodGet && publishPathRegex.MatchString(r.URL.Path) {
 		return s.limitRequestsWithTopic(s.authorizeTopicWrite(s.handlePublish))(w, r, v)
 	} else if r.Method == http.MethodGet && jsonPathRegex.MatchString(r.URL.Path) {
@@ -523,8 +635,16 @@ func (s *Server) handleInternal(w http.ResponseWriter, r *http.Request, v *visit
 		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeSSE))(w, r, v)
 	} else if r.Method == http.MethodGet && rawPathRegex.MatchString(r.URL.Path) {
 		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeRaw))(w, r, v)
+	} else if r.Method == http.MethodGet && cloudEventsPathRegex.MatchString(r.URL.Path) {
+		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeCloudEvents))(w, r, v)
 	} else if r.Method == http.MethodGet && wsPathRegex.MatchString(r.URL.Path) {
 		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeWS))(w, r, v)
+	} else if r.Method == http.MethodGet && rssPathRegex.MatchString(r.URL.Path) {
+		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeRSS))(w, r, v)
+	} else if r.Method == http.MethodGet && atomPathRegex.MatchString(r.URL.Path) {
+		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeAtom))(w, r, v)
+	} else if r.Method == http.MethodGet && jsonFeedPathRegex.MatchString(r.URL.Path) {
+		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeJSONFeed))(w, r, v)
 	} else if r.Method == http.MethodGet && authPathRegex.MatchString(r.URL.Path) {
 		return s.limitRequests(s.authorizeTopicRead(s.handleTopicAuth))(w, r, v)
 	} else if r.Method == http.MethodGet && (topicPathRegex.MatchString(r.URL.Path) || externalTopicPathRegex.MatchString(r.URL.Path)) {
@@ -742,6 +862,14 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 	if e != nil {
 		return nil, e.With(t)
 	}
+	settings, err := s.topicSettings(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	var digestWindow time.Duration
+	if settings != nil && m.Event == messageEvent && m.PollID == "" {
+		digestWindow = settings.Digest // E-mails are charged when the digest is sent, see sendDigest
+	}
 	if unifiedpush && s.config.VisitorSubscriberRateLimiting && t.RateVisitor() == nil {
 		// UnifiedPush clients must subscribe before publishing to allow proper subscriber-based rate limiting (see
 		// Rate-Topics header). The 5xx response is because some app servers (in particular Mastodon) will remove
@@ -750,7 +878,7 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 		return nil, errHTTPInsufficientStorageUnifiedPush.With(t)
 	} else if !util.ContainsIP(s.config.VisitorRequestExemptIPAddrs, v.ip) && !vrate.MessageAllowed() {
 		return nil, errHTTPTooManyRequestsLimitMessages.With(t)
-	} else if email != "" && !vrate.EmailAllowed() {
+	} else if email != "" && digestWindow == 0 && !vrate.EmailAllowed() {
 		return nil, errHTTPTooManyRequestsLimitEmails.With(t)
 	} else if call != "" {
 		var httpErr *errHTTP
@@ -761,20 +889,68 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 			return nil, errHTTPTooManyRequestsLimitCalls.With(t)
 		}
 	}
+	onCallEmail, onCallNumber, e := s.parseOnCall(r, v, vrate, m)
+	if e != nil {
+		return nil, e.With(t)
+	}
 	if m.PollID != "" {
 		m = newPollRequestMessage(t.ID, m.PollID)
 	}
 	m.Sender = v.IP()
 	m.User = v.MaybeUserID()
-	if cache {
-		m.Expires = time.Unix(m.Time, 0).Add(v.Limits().MessageExpiryDuration).Unix()
+	esc, e := s.parseEscalation(r, v, m, cache)
+	if e != nil {
+		return nil, e.With(t)
+	}
+	dedup, e := s.parseDedup(r, cache)
+	if e != nil {
+		return nil, e.With(t)
+	}
+	m.Expires, e = s.parseExpires(r, v, m, cache)
+	if e != nil {
+		return nil, e.With(t)
+	}
+	m.ExpiresExplicit = readParam(r, "x-expires", "expires", "x-ttl", "ttl") != ""
+	if source, err := fromContext[string](r, contextCloudEventSource); err == nil {
+		m.Source = source
+	}
+	if settings != nil && m.Event == messageEvent {
+		applyTopicSettings(m, settings)
+		firebase = firebase && settings.Firebase
 	}
-	if err := s.handlePublishBody(r, v, m, body, unifiedpush); err != nil {
+	if err := s.handlePublishBody(r, v, m, body, unifiedpush, settings); err != nil {
 		return nil, err
 	}
 	if m.Message == "" {
 		m.Message = emptyMessageBody
 	}
+	if email != "" {
+		suppressed, err := s.emailSuppressedByQuietHours(m)
+		if err != nil {
+			return nil, err
+		} else if suppressed {
+			logvrm(v, r, m).Tag(tagPublish).Debug("Quiet hours of topic owner active, not sending e-mail")
+			email = ""
+		}
+	}
+	if call != "" && suppressedByQuietHours(v.User(), m) { // Calls only go to the publisher's own verified numbers
+		logvrm(v, r, m).Tag(tagPublish).Debug("Quiet hours active, not sending phone call")
+		call = ""
+	}
+	dedupUnlock := func() {}
+	defer func() { dedupUnlock() }() // Usually released right after the message is stored, see below
+	if dedup != nil {
+		if dedup.Key == "" {
+			dedup.Key = dedupKey(m)
+		}
+		dedupUnlock = s.lockDedup(m.Topic, dedup.Key)
+		surviving, err := s.dedupMessage(v, m, dedup)
+		if err != nil {
+			return nil, err
+		} else if surviving != nil {
+			return surviving, nil
+		}
+	}
 	delayed := m.Time > time.Now().Unix()
 	ev := logvrm(v, r, m).
 		Tag(tagPublish).
@@ -785,6 +961,8 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 			"message_unifiedpush": unifiedpush,
 			"message_email":       email,
 			"message_call":        call,
+			"message_on_call":     onCallEmail != "" || onCallNumber != "",
+			"message_digest":      digestWindow > 0,
 		})
 	if ev.IsTrace() {
 		ev.Field("message_body", util.MaybeMarshalJSON(m)).Trace("Received message")
@@ -792,32 +970,57 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 		ev.Debug("Received message")
 	}
 	if !delayed {
-		if err := t.Publish(v, m); err != nil {
+		if err := t.PublishSeq(v, m, s.messageCache.NextSeq); err != nil {
 			return nil, err
 		}
-		if s.firebaseClient != nil && firebase {
-			go s.sendToFirebase(v, m)
-		}
-		if s.smtpSender != nil && email != "" {
-			go s.sendEmail(v, m, email)
+		if digestWindow > 0 {
+			if err := s.messageCache.AddToDigest(m, digestWindow, email, firebase); err != nil {
+				return nil, err
+			}
+		} else {
+			if s.firebaseClient != nil && firebase {
+				go s.sendToFirebase(v, m)
+			}
+			if s.smtpSender != nil && email != "" {
+				go s.sendEmail(v, m, email)
+			}
+			if s.config.WebPushPublicKey != "" {
+				go s.publishToWebPushEndpoints(v, m)
+			}
 		}
 		if s.config.TwilioAccount != "" && call != "" {
-			go s.callPhone(v, r, m, call)
+			go s.callPhone(v, m, call)
+		}
+		if s.smtpSender != nil && onCallEmail != "" {
+			go s.sendEmail(v, m, onCallEmail)
+		}
+		if s.config.TwilioAccount != "" && onCallNumber != "" {
+			go s.callPhone(v, m, onCallNumber)
 		}
 		if s.config.UpstreamBaseURL != "" && !unifiedpush { // UP messages are not sent to upstream
 			go s.forwardPollRequest(v, m)
 		}
-		if s.config.WebPushPublicKey != "" {
-			go s.publishToWebPushEndpoints(v, m)
-		}
 	} else {
 		logvrm(v, r, m).Tag(tagPublish).Debug("Message delayed, will process later")
 	}
 	if cache {
 		logvrm(v, r, m).Tag(tagPublish).Debug("Adding message to cache")
-		if err := s.messageCache.AddMessage(m); err != nil {
+		if dedup != nil {
+			// Bypass the batch queue, so that identical messages published right after can increment its count
+			if err := s.messageCache.addMessages([]*message{m}); err != nil {
+				return nil, err
+			} else if err := s.addDedup(m, dedup); err != nil {
+				return nil, err
+			}
+			dedupUnlock()
+		} else if err := s.messageCache.AddMessage(m); err != nil {
 			return nil, err
 		}
+		if esc != nil {
+			if err := s.messageCache.AddEscalation(esc); err != nil {
+				return nil, err
+			}
+		}
 	}
 	u := v.User()
 	if s.userManager != nil && u != nil && u.Tier != nil {
@@ -892,6 +1095,58 @@ func (s *Server) sendEmail(v *visitor, m *message, email string) {
 	minc(metricEmailsPublishedSuccess)
 }
 
+// parseExpires reads the X-Expires header (or its alias X-TTL), and returns the expiry time of the message. The value
+// may be a duration relative to the message time (which is the delivery time for delayed messages), or an absolute
+// time. It is capped by the message expiry duration of the visitor. Without the header, cached messages expire after
+// the message expiry duration, and non-cached messages do not have an expiry time.
+func (s *Server) parseExpires(r *http.Request, v *visitor, m *message, cache bool) (int64, *errHTTP) {
+	expiryDuration := v.Limits().MessageExpiryDuration
+	limit := time.Unix(m.Time, 0).Add(expiryDuration).Unix()
+	value := readParam(r, "x-expires", "expires", "x-ttl", "ttl")
+	if value == "" {
+		if !cache {
+			return 0, nil
+		}
+		return limit, nil
+	}
+	expires, err := util.ParseFutureTime(value, time.Unix(m.Time, 0))
+	if err != nil || expires.Unix() <= m.Time {
+		return 0, errHTTPBadRequestExpiresInvalid
+	} else if expiryDuration != 0 && expires.Unix() > limit {
+		return limit, nil
+	}
+	return expires.Unix(), nil
+}
+
+// suppressedByQuietHours returns true if the message must not be sent to the given user via e-mail, phone call
+// or web push right now, because the user's quiet hours are active and the message priority is not high enough
+func suppressedByQuietHours(u *user.User, m *message) bool {
+	if u == nil || u.Prefs == nil || u.Prefs.Notification == nil || u.Prefs.Notification.QuietHours == nil {
+		return false
+	}
+	return u.Prefs.Notification.QuietHours.Suppress(time.Now(), m.Priority)
+}
+
+// emailSuppressedByQuietHours returns true if e-mails for the given message must not be sent right now, because the
+// quiet hours of the owner of the topic reservation are active. E-mail addresses are not tied to user accounts, so
+// the topic owner stands in for the recipient. If the topic is not reserved, e-mails are never suppressed.
+func (s *Server) emailSuppressedByQuietHours(m *message) (bool, error) {
+	if s.userManager == nil {
+		return false, nil
+	}
+	ownerUserID, err := s.userManager.ReservationOwner(m.Topic)
+	if err != nil {
+		return false, err
+	} else if ownerUserID == "" {
+		return false, nil
+	}
+	owner, err := s.userManager.UserByID(ownerUserID)
+	if err != nil {
+		return false, err
+	}
+	return suppressedByQuietHours(owner, m), nil
+}
+
 func (s *Server) forwardPollRequest(v *visitor, m *message) {
 	topicURL := fmt.Sprintf("%s/%s", s.config.BaseURL, m.Topic)
 	topicHash := fmt.Sprintf("%x", sha256.Sum256([]byte(topicURL)))
@@ -1042,7 +1297,7 @@ func (s *Server) parsePublishParams(r *http.Request, m *message) (cache bool, fi
 //     If file.txt is <= 4096 (message limit) and valid UTF-8, treat it as a message
 //  6. curl -T file.txt ntfy.sh/mytopic
 //     If file.txt is > message limit, treat it as an attachment
-func (s *Server) handlePublishBody(r *http.Request, v *visitor, m *message, body *util.PeekedReadCloser, unifiedpush bool) error {
+func (s *Server) handlePublishBody(r *http.Request, v *visitor, m *message, body *util.PeekedReadCloser, unifiedpush bool, settings *user.TopicSettings) error {
 	if m.Event == pollRequestEvent { // Case 1
 		return s.handleBodyDiscard(body)
 	} else if unifiedpush {
@@ -1050,11 +1305,11 @@ func (s *Server) handlePublishBody(r *http.Request, v *visitor, m *message, body
 	} else if m.Attachment != nil && m.Attachment.URL != "" {
 		return s.handleBodyAsTextMessage(m, body) // Case 3
 	} else if m.Attachment != nil && m.Attachment.Name != "" {
-		return s.handleBodyAsAttachment(r, v, m, body) // Case 4
+		return s.handleBodyAsAttachment(r, v, m, body, settings) // Case 4
 	} else if !body.LimitReached && utf8.Valid(body.PeekedBytes) {
 		return s.handleBodyAsTextMessage(m, body) // Case 5
 	}
-	return s.handleBodyAsAttachment(r, v, m, body) // Case 6
+	return s.handleBodyAsAttachment(r, v, m, body, settings) // Case 6
 }
 
 func (s *Server) handleBodyDiscard(body *util.PeekedReadCloser) error {
@@ -1086,7 +1341,7 @@ func (s *Server) handleBodyAsTextMessage(m *message, body *util.PeekedReadCloser
 	return nil
 }
 
-func (s *Server) handleBodyAsAttachment(r *http.Request, v *visitor, m *message, body *util.PeekedReadCloser) error {
+func (s *Server) handleBodyAsAttachment(r *http.Request, v *visitor, m *message, body *util.PeekedReadCloser, settings *user.TopicSettings) error {
 	if s.fileCache == nil || s.config.BaseURL == "" || s.config.AttachmentCacheDir == "" {
 		return errHTTPBadRequestAttachmentsDisallowed.With(m)
 	}
@@ -1098,14 +1353,18 @@ func (s *Server) handleBodyAsAttachment(r *http.Request, v *visitor, m *message,
 	if m.Time > attachmentExpiry {
 		return errHTTPBadRequestAttachmentsExpiryBeforeDelivery.With(m)
 	}
+	attachmentFileSizeLimit := vinfo.Limits.AttachmentFileSizeLimit
+	if settings != nil && settings.AttachmentFileSizeLimit > 0 {
+		attachmentFileSizeLimit = min(attachmentFileSizeLimit, settings.AttachmentFileSizeLimit)
+	}
 	contentLengthStr := r.Header.Get("Content-Length")
 	if contentLengthStr != "" { // Early "do-not-trust" check, hard limit see below
 		contentLength, err := strconv.ParseInt(contentLengthStr, 10, 64)
-		if err == nil && (contentLength > vinfo.Stats.AttachmentTotalSizeRemaining || contentLength > vinfo.Limits.AttachmentFileSizeLimit) {
+		if err == nil && (contentLength > vinfo.Stats.AttachmentTotalSizeRemaining || contentLength > attachmentFileSizeLimit) {
 			return errHTTPEntityTooLargeAttachment.With(m).Fields(log.Context{
 				"message_content_length":          contentLength,
 				"attachment_total_size_remaining": vinfo.Stats.AttachmentTotalSizeRemaining,
-				"attachment_file_size_limit":      vinfo.Limits.AttachmentFileSizeLimit,
+				"attachment_file_size_limit":      attachmentFileSizeLimit,
 			})
 		}
 	}
@@ -1124,7 +1383,7 @@ func (s *Server) handleBodyAsAttachment(r *http.Request, v *visitor, m *message,
 	}
 	limiters := []util.Limiter{
 		v.BandwidthLimiter(),
-		util.NewFixedLimiter(vinfo.Limits.AttachmentFileSizeLimit),
+		util.NewFixedLimiter(attachmentFileSizeLimit),
 		util.NewFixedLimiter(vinfo.Stats.AttachmentTotalSizeRemaining),
 	}
 	m.Attachment.Size, err = s.fileCache.Write(m.ID, body, limiters...)
@@ -1153,10 +1412,13 @@ func (s *Server) handleSubscribeSSE(w http.ResponseWriter, r *http.Request, v *v
 		if err := json.NewEncoder(&buf).Encode(&msg); err != nil {
 			return "", err
 		}
-		if msg.Event != messageEvent {
+		if msg.Event == openEvent && s.config.SSERetry > 0 {
+			return fmt.Sprintf("retry: %d\nevent: %s\ndata: %s\n", s.config.SSERetry.Milliseconds(), msg.Event, buf.String()), nil
+		} else if msg.Event != messageEvent {
 			return fmt.Sprintf("event: %s\ndata: %s\n", msg.Event, buf.String()), nil // Browser's .onmessage() does not fire on this!
 		}
-		return fmt.Sprintf("data: %s\n", buf.String()), nil
+		// The "id:" line makes the browser send the ID as Last-Event-ID header when it reconnects, see parseSince
+		return fmt.Sprintf("id: %s\ndata: %s\n", msg.ID, buf.String()), nil
 	}
 	return s.handleSubscribeHTTP(w, r, v, "text/event-stream", encoder)
 }
@@ -1182,10 +1444,21 @@ func (s *Server) handleSubscribeHTTP(w http.ResponseWriter, r *http.Request, v *
 	if err != nil {
 		return err
 	}
+	patterns, err := s.topicPatternsFromRequest(r, v)
+	if err != nil {
+		return err
+	}
 	poll, since, scheduled, filters, rateTopics, err := parseSubscribeParams(r)
 	if err != nil {
 		return err
 	}
+	if err := checkSinceSeq(since, topics, patterns); err != nil {
+		return err
+	}
+	wait, err := parseLongPollWait(r, poll)
+	if err != nil {
+		return err
+	}
 	var wlock sync.Mutex
 	defer func() {
 		// Hack: This is the fix for a horrible data race that I have not been able to figure out in quite some time.
@@ -1212,6 +1485,15 @@ func (s *Server) handleSubscribeHTTP(w http.ResponseWriter, r *http.Request, v *
 		}
 		return nil
 	}
+	consumer, err := parseConsumer(r, v)
+	if err != nil {
+		return err
+	}
+	sub = s.topicPatternSubscriber(v, patterns, isTopicInFunc(topics), s.consumerSubscriber(consumer, sub))
+	patternTopics, err := s.cachedTopicsMatchingPatterns(v, patterns, topics)
+	if err != nil {
+		return err
+	}
 	if err := s.maybeSetRateVisitors(r, v, topics, rateTopics); err != nil {
 		return err
 	}
@@ -1221,23 +1503,33 @@ func (s *Server) handleSubscribeHTTP(w http.ResponseWriter, r *http.Request, v *
 		for _, t := range topics {
 			t.Keepalive()
 		}
-		return s.sendOldMessages(topics, since, scheduled, v, sub)
+		sendOldMessages := func(sub subscriber) error {
+			return s.sendOldMessages(append(patternTopics, topics...), since, consumer, scheduled, v, sub)
+		}
+		if wait > 0 {
+			return s.longPoll(r, v, topics, patterns, wait, filters, sub, sendOldMessages)
+		}
+		return sendOldMessages(sub)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	queue := newSubscriberQueue(sub, cancel, s.config.SubscriberQueueSize, s.config.SubscriberQueueOverflowPolicy)
+	defer queue.Close()
+	go queue.Run()
 	subscriberIDs := make([]int, 0)
 	for _, t := range topics {
-		subscriberIDs = append(subscriberIDs, t.Subscribe(sub, v.MaybeUserID(), cancel))
+		subscriberIDs = append(subscriberIDs, t.Subscribe(queue, v.MaybeUserID(), cancel))
 	}
 	defer func() {
 		for i, subscriberID := range subscriberIDs {
 			topics[i].Unsubscribe(subscriberID) // Order!
 		}
 	}()
+	defer s.subscribeTopicPatterns(patterns, isTopicInFunc(topics), queue, v.MaybeUserID(), cancel)()
 	if err := sub(v, newOpenMessage(topicsStr)); err != nil { // Send out open message
 		return err
 	}
-	if err := s.sendOldMessages(topics, since, scheduled, v, sub); err != nil {
+	if err := s.sendOldMessages(append(patternTopics, topics...), since, consumer, scheduled, v, sub); err != nil {
 		return err
 	}
 	for {
@@ -1278,10 +1570,17 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 	if err != nil {
 		return err
 	}
+	patterns, err := s.topicPatternsFromRequest(r, v)
+	if err != nil {
+		return err
+	}
 	poll, since, scheduled, filters, rateTopics, err := parseSubscribeParams(r)
 	if err != nil {
 		return err
 	}
+	if err := checkSinceSeq(since, topics, patterns); err != nil {
+		return err
+	}
 	upgrader := &websocket.Upgrader{
 		ReadBufferSize:  wsBufferSize,
 		WriteBufferSize: wsBufferSize,
@@ -1299,12 +1598,67 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 	cancelCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Use errgroup to run WebSocket reader and writer in Go routines
+	// All writes to the connection (messages, pings, responses to requests) must be synchronized
 	var wlock sync.Mutex
+	write := func(v any) error {
+		wlock.Lock()
+		defer wlock.Unlock()
+		if err := conn.SetWriteDeadline(time.Now().Add(wsWriteWait)); err != nil {
+			return err
+		}
+		return conn.WriteJSON(v)
+	}
+	sub := func(v *visitor, msg *message) error {
+		if !filters.Pass(msg) {
+			return nil
+		}
+		return write(msg)
+	}
+	consumer, err := parseConsumer(r, v)
+	if err != nil {
+		return err
+	}
+	// Topics can be added to and removed from a WebSocket session while the connection is open (see
+	// handleWebSocketSubscribe), so the explicitly subscribed topics are looked up in the session once it exists
+	var session *wsSession
+	initialTopics := isTopicInFunc(topics)
+	explicit := func(topicID string) bool {
+		if session != nil {
+			return session.Subscribed(topicID)
+		}
+		return initialTopics(topicID)
+	}
+	sub = s.topicPatternSubscriber(v, patterns, explicit, s.consumerSubscriber(consumer, sub))
+	patternTopics, err := s.cachedTopicsMatchingPatterns(v, patterns, topics)
+	if err != nil {
+		return err
+	}
+	if err := s.maybeSetRateVisitors(r, v, topics, rateTopics); err != nil {
+		return err
+	}
+	w.Header().Set("Access-Control-Allow-Origin", s.config.AccessControlAllowOrigin) // CORS, allow cross-origin requests
+	if poll {
+		for _, t := range topics {
+			t.Keepalive()
+		}
+		return s.sendOldMessages(append(patternTopics, topics...), since, consumer, scheduled, v, sub)
+	}
+	queue := newSubscriberQueue(sub, cancel, s.config.SubscriberQueueSize, s.config.SubscriberQueueOverflowPolicy)
+	defer queue.Close()
+	session = newWSSession(queue, sub, consumer, scheduled, rateTopics, v.MaybeUserID(), cancel)
+	go queue.Run()
+	defer session.UnsubscribeAll()
+	for _, t := range topics {
+		session.Subscribe(t)
+	}
+	defer s.subscribeTopicPatterns(patterns, explicit, queue, v.MaybeUserID(), cancel)()
+
+	// Use errgroup to run WebSocket reader and writer in Go routines. The reader handles requests
+	// sent by the client (see handleWebSocketRequest), the writer sends pings.
 	g, gctx := errgroup.WithContext(cancelCtx)
 	g.Go(func() error {
 		pongWait := s.config.KeepaliveInterval + wsPongWait
-		conn.SetReadLimit(wsReadLimit)
+		conn.SetReadLimit(s.wsReadLimit())
 		if err := conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
 			return err
 		}
@@ -1313,7 +1667,7 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 			return conn.SetReadDeadline(time.Now().Add(pongWait))
 		})
 		for {
-			_, _, err := conn.NextReader()
+			messageType, data, err := conn.ReadMessage()
 			if err != nil {
 				return err
 			}
@@ -1322,6 +1676,15 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 				return nil
 			default:
 			}
+			if messageType != websocket.TextMessage {
+				continue
+			}
+			if err := conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
+				return err
+			}
+			if err := write(s.handleWebSocketRequest(r, v, session, data)); err != nil {
+				return err
+			}
 		}
 	})
 	g.Go(func() error {
@@ -1344,7 +1707,7 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 				return &websocket.CloseError{Code: websocket.CloseNormalClosure, Text: "subscription was canceled"}
 			case <-time.After(s.config.KeepaliveInterval):
 				v.Keepalive()
-				for _, t := range topics {
+				for _, t := range session.Topics() {
 					t.Keepalive()
 				}
 				if err := ping(); err != nil {
@@ -1353,40 +1716,10 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 			}
 		}
 	})
-	sub := func(v *visitor, msg *message) error {
-		if !filters.Pass(msg) {
-			return nil
-		}
-		wlock.Lock()
-		defer wlock.Unlock()
-		if err := conn.SetWriteDeadline(time.Now().Add(wsWriteWait)); err != nil {
-			return err
-		}
-		return conn.WriteJSON(msg)
-	}
-	if err := s.maybeSetRateVisitors(r, v, topics, rateTopics); err != nil {
-		return err
-	}
-	w.Header().Set("Access-Control-Allow-Origin", s.config.AccessControlAllowOrigin) // CORS, allow cross-origin requests
-	if poll {
-		for _, t := range topics {
-			t.Keepalive()
-		}
-		return s.sendOldMessages(topics, since, scheduled, v, sub)
-	}
-	subscriberIDs := make([]int, 0)
-	for _, t := range topics {
-		subscriberIDs = append(subscriberIDs, t.Subscribe(sub, v.MaybeUserID(), cancel))
-	}
-	defer func() {
-		for i, subscriberID := range subscriberIDs {
-			topics[i].Unsubscribe(subscriberID) // Order!
-		}
-	}()
 	if err := sub(v, newOpenMessage(topicsStr)); err != nil { // Send out open message
 		return err
 	}
-	if err := s.sendOldMessages(topics, since, scheduled, v, sub); err != nil {
+	if err := s.sendOldMessages(append(patternTopics, topics...), since, consumer, scheduled, v, sub); err != nil {
 		return err
 	}
 	err = g.Wait()
@@ -1476,21 +1809,25 @@ func (s *Server) setRateVisitors(r *http.Request, v *visitor, rateTopics []*topi
 }
 
 // sendOldMessages selects old messages from the messageCache and calls sub for each of them. It uses since as the
-// marker, returning only messages that are newer than the marker.
-func (s *Server) sendOldMessages(topics []*topic, since sinceMarker, scheduled bool, v *visitor, sub subscriber) error {
-	if since.IsNone() {
-		return nil
-	}
+// marker, returning only messages that are newer than the marker. For durable subscriptions, the stored cursor of
+// the consumer is used instead, see consumerSince.
+func (s *Server) sendOldMessages(topics []*topic, since sinceMarker, consumer *consumer, scheduled bool, v *visitor, sub subscriber) error {
 	messages := make([]*message, 0)
 	for _, t := range topics {
-		topicMessages, err := s.messageCache.Messages(t.ID, since, scheduled)
+		topicSince, err := s.consumerSince(consumer, t.ID, since)
+		if err != nil {
+			return err
+		} else if topicSince.IsNone() {
+			continue
+		}
+		topicMessages, err := s.messageCache.Messages(t.ID, topicSince, scheduled)
 		if err != nil {
 			return err
 		}
 		messages = append(messages, topicMessages...)
 	}
-	sort.Slice(messages, func(i, j int) bool {
-		return messages[i].Time < messages[j].Time
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Time < messages[j].Time // Stable, to keep the per-topic order of messages within the same second
 	})
 	for _, m := range messages {
 		if err := sub(v, m); err != nil {
@@ -1502,11 +1839,29 @@ func (s *Server) sendOldMessages(topics []*topic, since sinceMarker, scheduled b
 
 // parseSince returns a timestamp identifying the time span from which cached messages should be received.
 //
-// Values in the "since=..." parameter can be either a unix timestamp or a duration (e.g. 12h), or
-// "all" for all messages.
+// Values in the "since=..." parameter can be either a unix timestamp or a duration (e.g. 12h), a message ID,
+// a per-topic sequence number (e.g. seq:123), or "all" for all messages.
+//
+// If the "Last-Event-ID" header is set to a valid message ID, it takes precedence over "since=...". It is sent
+// by browsers when an EventSource reconnects, so that they receive only the messages they missed.
 func parseSince(r *http.Request, poll bool) (sinceMarker, error) {
-	since := readParam(r, "x-since", "since", "si")
+	if lastEventID := r.Header.Get("Last-Event-ID"); validMessageID(lastEventID) {
+		return newSinceID(lastEventID), nil
+	}
+	return parseSinceString(readParam(r, "x-since", "since", "si"), poll)
+}
+
+// checkSinceSeq rejects since=seq:... if more than one topic is subscribed to, or a topic pattern is used, since
+// sequence numbers are per topic
+func checkSinceSeq(since sinceMarker, topics []*topic, patterns []string) error {
+	if since.IsSeq() && (len(topics) > 1 || len(patterns) > 0) {
+		return errHTTPBadRequestSinceSeqMultipleTopics
+	}
+	return nil
+}
 
+// parseSinceString parses the value of the "since=..." parameter, see parseSince
+func parseSinceString(since string, poll bool) (sinceMarker, error) {
 	// Easy cases (empty, all, none)
 	if since == "" {
 		if poll {
@@ -1519,9 +1874,15 @@ func parseSince(r *http.Request, poll bool) (sinceMarker, error) {
 		return sinceNoMessages, nil
 	}
 
-	// ID, timestamp, duration
+	// ID, sequence number, timestamp, duration
 	if validMessageID(since) {
 		return newSinceID(since), nil
+	} else if strings.HasPrefix(since, "seq:") {
+		seq, err := strconv.ParseInt(strings.TrimPrefix(since, "seq:"), 10, 64)
+		if err != nil || seq < 0 {
+			return sinceNoMessages, errHTTPBadRequestSinceInvalid
+		}
+		return newSinceSeq(seq), nil
 	} else if s, err := strconv.ParseInt(since, 10, 64); err == nil {
 		return newSinceTime(s), nil
 	} else if d, err := time.ParseDuration(since); err == nil {
@@ -1547,12 +1908,18 @@ func (s *Server) topicFromPath(path string) (*topic, error) {
 }
 
 // topicsFromPath returns the topic from a root path (e.g. /mytopic,mytopic2), creating it if it doesn't exist.
+// Topic patterns (e.g. /alerts-*) are skipped, see topicPatternsFromPath.
 func (s *Server) topicsFromPath(path string) ([]*topic, string, error) {
 	parts := strings.Split(path, "/")
 	if len(parts) < 2 {
 		return nil, "", errHTTPBadRequestTopicInvalid
 	}
-	topicIDs := util.SplitNoEmpty(parts[1], ",")
+	topicIDs := make([]string, 0)
+	for _, id := range util.SplitNoEmpty(parts[1], ",") {
+		if !isTopicPattern(id) {
+			topicIDs = append(topicIDs, id)
+		}
+	}
 	topics, err := s.topicsFromIDs(topicIDs...)
 	if err != nil {
 		return nil, "", errHTTPBadRequestTopicInvalid
@@ -1561,25 +1928,46 @@ func (s *Server) topicsFromPath(path string) ([]*topic, string, error) {
 }
 
 // topicsFromIDs returns the topics with the given IDs, creating them if they don't exist.
+// The total topic limit is enforced on a best-effort basis, i.e. concurrent requests may exceed it slightly.
 func (s *Server) topicsFromIDs(ids ...string) ([]*topic, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 	topics := make([]*topic, 0)
 	for _, id := range ids {
 		if util.Contains(s.config.DisallowedTopics, id) {
 			return nil, errHTTPBadRequestTopicDisallowed
 		}
-		if _, ok := s.topics[id]; !ok {
-			if len(s.topics) >= s.config.TotalTopicLimit {
+	}
+	for _, id := range ids {
+		t, loaded, err := s.topics.GetOrAdd(id, func() (*topic, error) {
+			if s.topics.Len() >= s.config.TotalTopicLimit {
 				return nil, errHTTPTooManyRequestsLimitTotalTopics
 			}
-			s.topics[id] = newTopic(id)
+			return newTopic(id), nil
+		})
+		if err != nil {
+			return nil, err
+		} else if !loaded {
+			s.topicPatterns.Attach(t)
 		}
-		topics = append(topics, s.topics[id])
+		topics = append(topics, t)
 	}
 	return topics, nil
 }
 
+// publishSeq assigns the next sequence number to a message that was not published by a publish request (e.g.
+// delayed messages), and publishes it to the topic's subscribers. If the topic is not in memory, it is created
+// regardless of the topic limit, so that the sequence numbers of the topic keep increasing.
+func (s *Server) publishSeq(v *visitor, m *message) error {
+	t, loaded, err := s.topics.GetOrAdd(m.Topic, func() (*topic, error) {
+		return newTopic(m.Topic), nil
+	})
+	if err != nil {
+		return err
+	} else if !loaded {
+		s.topicPatterns.Attach(t)
+	}
+	return t.PublishSeq(v, m, s.messageCache.NextSeq)
+}
+
 // topicFromID returns the topic with the given ID, creating it if it doesn't exist.
 func (s *Server) topicFromID(id string) (*topic, error) {
 	topics, err := s.topicsFromIDs(id)
@@ -1591,18 +1979,17 @@ func (s *Server) topicFromID(id string) (*topic, error) {
 
 // topicsFromPattern returns a list of topics matching the given pattern, but it does not create them.
 func (s *Server) topicsFromPattern(pattern string) ([]*topic, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	patternRegexp, err := regexp.Compile("^" + strings.ReplaceAll(pattern, "*", ".*") + "$")
+	patternRegexp, err := regexp.Compile("^" + strings.NewReplacer("*", ".*", "?", ".").Replace(pattern) + "$")
 	if err != nil {
 		return nil, err
 	}
 	topics := make([]*topic, 0)
-	for _, t := range s.topics {
+	s.topics.Range(func(_ string, t *topic) bool {
 		if patternRegexp.MatchString(t.ID) {
 			topics = append(topics, t)
 		}
-	}
+		return true
+	})
 	return topics, nil
 }
 
@@ -1656,9 +2043,10 @@ func (s *Server) resetStats() {
 	log.Info("Resetting all visitor stats (daily task)")
 	s.mu.Lock()
 	defer s.mu.Unlock() // Includes the database query to avoid races with other processes
-	for _, v := range s.visitors {
+	s.visitors.Range(func(_ string, v *visitor) bool {
 		v.ResetStats()
-	}
+		return true
+	})
 	if s.userManager != nil {
 		if err := s.userManager.ResetStats(); err != nil {
 			log.Tag(tagResetter).Warn("Failed to write to database: %s", err.Error())
@@ -1726,16 +2114,9 @@ func (s *Server) sendDelayedMessages() error {
 
 func (s *Server) sendDelayedMessage(v *visitor, m *message) error {
 	logvm(v, m).Debug("Sending delayed message")
-	s.mu.RLock()
-	t, ok := s.topics[m.Topic] // If no subscribers, just mark message as published
-	s.mu.RUnlock()
-	if ok {
-		go func() {
-			// We do not rate-limit messages here, since we've rate limited them in the PUT/POST handler
-			if err := t.Publish(v, m); err != nil {
-				logvm(v, m).Err(err).Warn("Unable to publish message")
-			}
-		}()
+	// We do not rate-limit messages here, since we've rate limited them in the PUT/POST handler
+	if err := s.publishSeq(v, m); err != nil {
+		return err
 	}
 	if s.firebaseClient != nil { // Firebase subscribers may not show up in topics map
 		go s.sendToFirebase(v, m)
@@ -1808,6 +2189,21 @@ func (s *Server) transformBodyJSON(next handleFunc) handleFunc {
 		if m.Call != "" {
 			r.Header.Set("X-Call", m.Call)
 		}
+		if m.Escalate != "" {
+			r.Header.Set("X-Escalate", m.Escalate)
+		}
+		if m.OnCall != "" {
+			r.Header.Set("X-On-Call", m.OnCall)
+		}
+		if m.Dedup != "" {
+			r.Header.Set("X-Dedup", m.Dedup)
+		}
+		if m.DedupKey != "" {
+			r.Header.Set("X-Dedup-Key", m.DedupKey)
+		}
+		if m.TTL != "" {
+			r.Header.Set("X-TTL", m.TTL)
+		}
 		return next(w, r, v)
 	}
 }
@@ -1890,6 +2286,12 @@ func (s *Server) maybeAuthenticate(r *http.Request) (*visitor, error) {
 	if err != nil {
 		vip.AuthFailed()
 		logr(r).Err(err).Debug("Authentication failed")
+		if s.auditLoginFailed.Allow() {
+			username, _, _ := r.BasicAuth() // Empty for token auth
+			s.audit(r, vip, user.AuditLoginFailed, username, "", "")
+		} else {
+			logr(r).Debug("Too many failed logins, not writing audit log entry")
+		}
 		return vip, errHTTPUnauthorized // Always return visitor, even when error occurs!
 	}
 	// Authentication with user was successful
@@ -1955,13 +2357,11 @@ func (s *Server) authenticateBearerAuth(r *http.Request, token string) (*user.Us
 }
 
 func (s *Server) visitor(ip netip.Addr, user *user.User) *visitor {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	id := visitorID(ip, user)
-	v, exists := s.visitors[id]
+	v, exists, _ := s.visitors.GetOrAdd(visitorID(ip, user), func() (*visitor, error) {
+		return newVisitor(s.config, s.messageCache, s.userManager, ip, user), nil
+	})
 	if !exists {
-		s.visitors[id] = newVisitor(s.config, s.messageCache, s.userManager, ip, user)
-		return s.visitors[id]
+		return v
 	}
 	v.Keepalive()
 	v.SetUser(user) // Always update with the latest user, may be nil!
@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
@@ -39,6 +40,7 @@ func (s *Server) handleAccountCreate(w http.ResponseWriter, r *http.Request, v *
 	if err := s.userManager.AddUser(newAccount.Username, newAccount.Password, user.RoleUser); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditUserAdd, newAccount.Username, "", string(user.RoleUser))
 	v.AccountCreated()
 	return s.writeJSON(w, newSuccessResponse())
 }
@@ -89,7 +91,10 @@ func (s *Server) handleAccountGet(w http.ResponseWriter, r *http.Request, v *vis
 				response.Notification = u.Prefs.Notification
 			}
 			if u.Prefs.Subscriptions != nil {
-				response.Subscriptions = u.Prefs.Subscriptions
+				response.Subscriptions, err = s.accountSubscriptions(u.Prefs.Subscriptions)
+				if err != nil {
+					return err
+				}
 			}
 		}
 		if u.Tier != nil {
@@ -159,6 +164,29 @@ func (s *Server) handleAccountGet(w http.ResponseWriter, r *http.Request, v *vis
 	return s.writeJSON(w, response)
 }
 
+// accountSubscriptions converts the subscriptions stored in the user's preferences for the account response, and
+// adds the topic metadata for topics on this server
+func (s *Server) accountSubscriptions(subscriptions []*user.Subscription) ([]*apiAccountSubscription, error) {
+	response := make([]*apiAccountSubscription, 0)
+	for _, sub := range subscriptions {
+		accountSubscription := &apiAccountSubscription{
+			BaseURL:     sub.BaseURL,
+			Topic:       sub.Topic,
+			DisplayName: sub.DisplayName,
+		}
+		if sub.BaseURL == s.config.BaseURL {
+			info, err := s.topicInfo(sub.Topic)
+			if err != nil {
+				return nil, err
+			} else if info != nil {
+				accountSubscription.Info = newTopicInfoResponse(info)
+			}
+		}
+		response = append(response, accountSubscription)
+	}
+	return response, nil
+}
+
 func (s *Server) handleAccountDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
 	req, err := readJSONWithLimit[apiAccountDeleteRequest](r.Body, jsonBodyBytesLimit, false)
 	if err != nil {
@@ -188,6 +216,7 @@ func (s *Server) handleAccountDelete(w http.ResponseWriter, r *http.Request, v *
 	if err := s.userManager.MarkUserRemoved(u); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditUserRemove, u.Name, "", "")
 	return s.writeJSON(w, newSuccessResponse())
 }
 
@@ -206,6 +235,7 @@ func (s *Server) handleAccountPasswordChange(w http.ResponseWriter, r *http.Requ
 	if err := s.userManager.ChangePassword(u.Name, req.NewPassword); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditUserPassword, u.Name, "", "")
 	return s.writeJSON(w, newSuccessResponse())
 }
 
@@ -234,6 +264,7 @@ func (s *Server) handleAccountTokenCreate(w http.ResponseWriter, r *http.Request
 	if err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditTokenCreate, u.Name, "", user.MaskToken(token.Value))
 	response := &apiAccountTokenResponse{
 		Token:      token.Value,
 		Label:      token.Label,
@@ -294,6 +325,7 @@ func (s *Server) handleAccountTokenDelete(w http.ResponseWriter, r *http.Request
 	if err := s.userManager.RemoveToken(u.ID, token); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditTokenRemove, u.Name, user.MaskToken(token), "")
 	logvr(v, r).
 		Tag(tagAccount).
 		Field("token", token).
@@ -327,6 +359,15 @@ func (s *Server) handleAccountSettingsChange(w http.ResponseWriter, r *http.Requ
 		if newPrefs.Notification.MinPriority != nil {
 			prefs.Notification.MinPriority = newPrefs.Notification.MinPriority
 		}
+		if newPrefs.Notification.QuietHours != nil {
+			if newPrefs.Notification.QuietHours.Start == "" && newPrefs.Notification.QuietHours.End == "" {
+				prefs.Notification.QuietHours = nil
+			} else if err := newPrefs.Notification.QuietHours.Validate(); err != nil {
+				return errHTTPBadRequestQuietHoursInvalid
+			} else {
+				prefs.Notification.QuietHours = newPrefs.Notification.QuietHours
+			}
+		}
 	}
 	logvr(v, r).Tag(tagAccount).Debug("Changing account settings for user %s", u.Name)
 	if err := s.userManager.ChangeSettings(u.ID, prefs); err != nil {
@@ -458,6 +499,7 @@ func (s *Server) handleAccountReservationAdd(w http.ResponseWriter, r *http.Requ
 	if err := s.userManager.AddReservation(u.Name, req.Topic, everyone); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditReservationAdd, u.Name, "", fmt.Sprintf("%s: %s", req.Topic, everyone.String()))
 	// Kill existing subscribers
 	t, err := s.topicFromID(req.Topic)
 	if err != nil {
@@ -495,6 +537,7 @@ func (s *Server) handleAccountReservationDelete(w http.ResponseWriter, r *http.R
 	if err := s.userManager.RemoveReservations(u.Name, topic); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditReservationRemove, u.Name, topic, "")
 	if deleteMessages {
 		if err := s.messageCache.ExpireMessages(topic); err != nil {
 			return err
@@ -1,8 +1,20 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
+	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+const (
+	auditEntriesLimitDefault = 100
+	auditEntriesLimitMax     = 10000
 )
 
 func (s *Server) handleUsersGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
@@ -26,6 +38,9 @@ func (s *Server) handleUsersGet(w http.ResponseWriter, r *http.Request, v *visit
 				Topic:      g.TopicPattern,
 				Permission: g.Allow.String(),
 			}
+			if !g.Expires.IsZero() {
+				userGrants[i].Expires = g.Expires.Unix()
+			}
 		}
 		usersResponse[i] = &apiUserResponse{
 			Username: u.Name,
@@ -62,10 +77,81 @@ func (s *Server) handleUsersAdd(w http.ResponseWriter, r *http.Request, v *visit
 	if err := s.userManager.AddUser(req.Username, req.Password, user.RoleUser); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditUserAdd, req.Username, "", string(user.RoleUser))
 	if tier != nil {
 		if err := s.userManager.ChangeTier(req.Username, req.Tier); err != nil {
 			return err
 		}
+		s.audit(r, v, user.AuditUserTier, req.Username, "", tier.Code)
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleUsersChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiUserChangeRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	u, err := s.userManager.User(req.Username)
+	if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	} else if u.Name == user.Everyone {
+		return errHTTPBadRequestUserNotFound
+	}
+	var tier *user.Tier
+	if req.Tier != nil && *req.Tier != "" {
+		tier, err = s.userManager.Tier(*req.Tier)
+		if err == user.ErrTierNotFound {
+			return errHTTPBadRequestTierInvalid
+		} else if err != nil {
+			return err
+		}
+	}
+	if req.Role != "" {
+		role := user.Role(req.Role)
+		if !user.AllowedRole(role) {
+			return errHTTPBadRequestRoleInvalid
+		}
+		if role != u.Role {
+			logvr(v, r).Tag(tagAccount).Info("Changing role of user %s to %s", u.Name, role)
+			if err := s.userManager.ChangeRole(u.Name, role); err != nil {
+				return err
+			}
+			s.audit(r, v, user.AuditUserRole, u.Name, string(u.Role), string(role))
+			if role == user.RoleUser {
+				if err := s.killUserSubscriber(u, "*"); err != nil { // Former admin may have lost access
+					return err
+				}
+			}
+		}
+	}
+	if req.Tier != nil {
+		reservationsLimit := visitorDefaultReservationsLimit
+		if tier != nil {
+			reservationsLimit = tier.ReservationLimit
+		}
+		if err := s.maybeRemoveMessagesAndExcessReservations(r, v, u, reservationsLimit); err != nil {
+			return err
+		}
+		if tier == nil && u.Tier != nil {
+			logvr(v, r).Tag(tagAccount).Info("Resetting tier for user %s", u.Name)
+			if err := s.userManager.ResetTier(u.Name); err != nil {
+				return err
+			}
+			s.audit(r, v, user.AuditUserTier, u.Name, u.Tier.Code, "")
+		} else if tier != nil && u.TierID() != tier.ID {
+			logvr(v, r).Tag(tagAccount).Info("Changing tier for user %s to %s", u.Name, tier.Code)
+			if err := s.userManager.ChangeTier(u.Name, tier.Code); err != nil {
+				return err
+			}
+			var before string
+			if u.Tier != nil {
+				before = u.Tier.Code
+			}
+			s.audit(r, v, user.AuditUserTier, u.Name, before, tier.Code)
+		}
 	}
 	return s.writeJSON(w, newSuccessResponse())
 }
@@ -86,6 +172,7 @@ func (s *Server) handleUsersDelete(w http.ResponseWriter, r *http.Request, v *vi
 	if err := s.userManager.RemoveUser(req.Username); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditUserRemove, req.Username, "", "")
 	if err := s.killUserSubscriber(u, "*"); err != nil { // FIXME super inefficient
 		return err
 	}
@@ -107,9 +194,19 @@ func (s *Server) handleAccessAllow(w http.ResponseWriter, r *http.Request, v *vi
 	if err != nil {
 		return errHTTPBadRequestPermissionInvalid
 	}
-	if err := s.userManager.AllowAccess(req.Username, req.Topic, permission); err != nil {
+	var expires time.Time
+	if req.Expires > 0 {
+		expires = time.Unix(req.Expires, 0)
+		if !expires.After(time.Now()) {
+			return errHTTPBadRequestAccessExpiresInvalid
+		}
+	}
+	if err := s.userManager.AllowAccessUntil(req.Username, req.Topic, permission, expires); err == user.ErrAccessPermanent {
+		return errHTTPConflictAccessPermanent
+	} else if err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditAccessAllow, req.Username, "", user.Grant{TopicPattern: req.Topic, Allow: permission, Expires: expires}.String())
 	return s.writeJSON(w, newSuccessResponse())
 }
 
@@ -125,19 +222,597 @@ func (s *Server) handleAccessReset(w http.ResponseWriter, r *http.Request, v *vi
 	if err := s.userManager.ResetAccess(req.Username, req.Topic); err != nil {
 		return err
 	}
+	s.audit(r, v, user.AuditAccessReset, req.Username, req.Topic, "")
 	if err := s.killUserSubscriber(u, req.Topic); err != nil { // This may be a pattern
 		return err
 	}
 	return s.writeJSON(w, newSuccessResponse())
 }
 
+func (s *Server) handleGroupsGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	groups, err := s.userManager.Groups()
+	if err != nil {
+		return err
+	}
+	groupsResponse := make([]*apiGroupResponse, len(groups))
+	for i, g := range groups {
+		grants, err := s.userManager.GroupGrants(g.Name)
+		if err != nil {
+			return err
+		}
+		groupGrants := make([]*apiUserGrantResponse, len(grants))
+		for i, g := range grants {
+			groupGrants[i] = &apiUserGrantResponse{
+				Topic:      g.TopicPattern,
+				Permission: g.Allow.String(),
+			}
+		}
+		groupsResponse[i] = &apiGroupResponse{
+			Name:    g.Name,
+			Members: g.Members,
+			Grants:  groupGrants,
+		}
+	}
+	return s.writeJSON(w, groupsResponse)
+}
+
+func (s *Server) handleGroupsAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiGroupAddRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if !user.AllowedGroup(req.Name) {
+		return errHTTPBadRequest.Wrap("group name invalid")
+	}
+	if err := s.userManager.AddGroup(req.Name); err == user.ErrGroupExists {
+		return errHTTPConflictGroupExists
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditGroupAdd, req.Name, "", "")
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleGroupsDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiGroupDeleteRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	g, err := s.userManager.Group(req.Name)
+	if err == user.ErrGroupNotFound {
+		return errHTTPBadRequestGroupNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := s.userManager.RemoveGroup(req.Name); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditGroupRemove, req.Name, "", "")
+	if err := s.killGroupSubscribers(g, "*"); err != nil { // FIXME super inefficient
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleGroupMembersAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiGroupMemberRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	if err := s.userManager.AddGroupMember(req.Group, req.Username); err == user.ErrGroupNotFound {
+		return errHTTPBadRequestGroupNotFound
+	} else if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditGroupMemberAdd, req.Group, "", req.Username)
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleGroupMembersRemove(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiGroupMemberRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	u, err := s.userManager.User(req.Username)
+	if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := s.userManager.RemoveGroupMember(req.Group, req.Username); err == user.ErrGroupNotFound {
+		return errHTTPBadRequestGroupNotFound
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditGroupMemberRemove, req.Group, req.Username, "")
+	if err := s.killUserSubscriber(u, "*"); err != nil { // FIXME super inefficient
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleGroupAccessAllow(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiGroupAccessAllowRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	permission, err := user.ParsePermission(req.Permission)
+	if err != nil {
+		return errHTTPBadRequestPermissionInvalid
+	}
+	if err := s.userManager.AllowGroupAccess(req.Group, req.Topic, permission); err == user.ErrGroupNotFound {
+		return errHTTPBadRequestGroupNotFound
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditGroupAccessAllow, req.Group, "", user.Grant{TopicPattern: req.Topic, Allow: permission}.String())
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleGroupAccessReset(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiGroupAccessResetRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	g, err := s.userManager.Group(req.Group)
+	if err == user.ErrGroupNotFound {
+		return errHTTPBadRequestGroupNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := s.userManager.ResetGroupAccess(req.Group, req.Topic); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditGroupAccessReset, req.Group, req.Topic, "")
+	topicPattern := req.Topic
+	if topicPattern == "" {
+		topicPattern = "*"
+	}
+	if err := s.killGroupSubscribers(g, topicPattern); err != nil { // This may be a pattern
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) killGroupSubscribers(g *user.Group, topicPattern string) error {
+	for _, username := range g.Members {
+		u, err := s.userManager.User(username)
+		if err != nil {
+			return err
+		}
+		if err := s.killUserSubscriber(u, topicPattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleUserTokensGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u, err := s.userManager.User(readQueryParam(r, "username"))
+	if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	tokens, err := s.userManager.Tokens(u.ID)
+	if err != nil {
+		return err
+	}
+	response := make([]*apiAccountTokenResponse, 0)
+	for _, t := range tokens {
+		var lastOrigin string
+		if t.LastOrigin != netip.IPv4Unspecified() {
+			lastOrigin = t.LastOrigin.String()
+		}
+		response = append(response, &apiAccountTokenResponse{
+			Token:      user.MaskToken(t.Value), // Never expose other users' tokens
+			Label:      t.Label,
+			LastAccess: t.LastAccess.Unix(),
+			LastOrigin: lastOrigin,
+			Expires:    t.Expires.Unix(),
+		})
+	}
+	return s.writeJSON(w, response)
+}
+
+func (s *Server) handleUserTokensDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiUserTokenDeleteRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if req.Token == "" && req.Label == "" {
+		return errHTTPBadRequestNoTokenProvided
+	}
+	u, err := s.userManager.User(req.Username)
+	if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	token, err := s.userTokenByMaskOrLabel(u, req.Token, req.Label)
+	if err != nil {
+		return err
+	}
+	if err := s.userManager.RemoveToken(u.ID, token.Value); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditTokenRemove, u.Name, user.MaskToken(token.Value), "")
+	logvr(v, r).
+		Tag(tagAccount).
+		Field("token", user.MaskToken(token.Value)).
+		Debug("Deleted token for user %s", u.Name)
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// userTokenByMaskOrLabel finds the token of the given user by its masked form (as returned by handleUserTokensGet),
+// or by its label. Admins never see the full token, so it must match exactly one of the user's tokens.
+func (s *Server) userTokenByMaskOrLabel(u *user.User, masked, label string) (*user.Token, error) {
+	tokens, err := s.userManager.Tokens(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	var match *user.Token
+	for _, t := range tokens {
+		if (masked == "" || masked == user.MaskToken(t.Value)) && (label == "" || label == t.Label) {
+			if match != nil {
+				return nil, errHTTPBadRequestTokenNotUnique
+			}
+			match = t
+		}
+	}
+	if match == nil {
+		return nil, errHTTPBadRequestTokenNotUnique
+	}
+	return match, nil
+}
+
+func (s *Server) handleUserReservationsGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u, err := s.userManager.User(readQueryParam(r, "username"))
+	if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	reservations, err := s.userManager.Reservations(u.Name)
+	if err != nil {
+		return err
+	}
+	response := make([]*apiAccountReservation, 0)
+	for _, res := range reservations {
+		response = append(response, &apiAccountReservation{
+			Topic:    res.Topic,
+			Everyone: res.Everyone.String(),
+		})
+	}
+	return s.writeJSON(w, response)
+}
+
+func (s *Server) handleUserReservationsAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiUserReservationRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	if !topicRegex.MatchString(req.Topic) {
+		return errHTTPBadRequestTopicInvalid
+	}
+	everyone, err := user.ParsePermission(req.Everyone)
+	if err != nil {
+		return errHTTPBadRequestPermissionInvalid
+	}
+	u, err := s.userManager.User(req.Username)
+	if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	} else if !u.IsUser() {
+		return errHTTPBadRequest.Wrap("can only add reservations for regular users")
+	}
+	// Admins may exceed the tier's reservation limit, but cannot take over other users' topics
+	if err := s.userManager.AllowReservation(u.Name, req.Topic); err == user.ErrTopicOwnedByOthers {
+		return errHTTPConflictTopicReserved
+	} else if err != nil {
+		return err
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":    req.Topic,
+			"everyone": everyone.String(),
+		}).
+		Debug("Adding topic reservation for user %s", u.Name)
+	if err := s.userManager.AddReservation(u.Name, req.Topic, everyone); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditReservationAdd, u.Name, "", fmt.Sprintf("%s: %s", req.Topic, everyone.String()))
+	t, err := s.topicFromID(req.Topic)
+	if err != nil {
+		return err
+	}
+	t.CancelSubscribersExceptUser(u.ID)
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleUserReservationsDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiUserReservationDeleteRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	if !topicRegex.MatchString(req.Topic) {
+		return errHTTPBadRequestTopicInvalid
+	}
+	u, err := s.userManager.User(req.Username)
+	if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	hasReservation, err := s.userManager.HasReservation(u.Name, req.Topic)
+	if err != nil {
+		return err
+	} else if !hasReservation {
+		return errHTTPBadRequestReservationNotFound
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":           req.Topic,
+			"delete_messages": req.DeleteMessages,
+		}).
+		Debug("Removing topic reservation for user %s", u.Name)
+	if err := s.userManager.RemoveReservations(u.Name, req.Topic); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditReservationRemove, u.Name, req.Topic, "")
+	if req.DeleteMessages {
+		if err := s.messageCache.ExpireMessages(req.Topic); err != nil {
+			return err
+		}
+		s.pruneMessages()
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleTiersGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	tiers, err := s.userManager.Tiers()
+	if err != nil {
+		return err
+	}
+	response := make([]*apiTierResponse, len(tiers))
+	for i, tier := range tiers {
+		response[i] = newTierResponse(tier)
+	}
+	return s.writeJSON(w, response)
+}
+
+func (s *Server) handleTiersAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiTierRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if !user.AllowedTier(req.Code) {
+		return errHTTPBadRequestTierCodeInvalid
+	}
+	if _, err := s.userManager.Tier(req.Code); err == nil {
+		return errHTTPConflictTierExists
+	} else if err != user.ErrTierNotFound {
+		return err
+	}
+	tier := &user.Tier{
+		Code: req.Code,
+		Name: req.Code,
+	}
+	if err := updateTierFromRequest(tier, req); err != nil {
+		return err
+	}
+	if err := s.userManager.AddTier(tier); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditTierAdd, tier.Code, "", DescribeTier(tier))
+	return s.writeJSON(w, newTierResponse(tier))
+}
+
+func (s *Server) handleTiersChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiTierRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	tier, err := s.userManager.Tier(req.Code)
+	if err == user.ErrTierNotFound {
+		return errHTTPBadRequestTierInvalid
+	} else if err != nil {
+		return err
+	}
+	before := DescribeTier(tier)
+	if err := updateTierFromRequest(tier, req); err != nil {
+		return err
+	}
+	if err := s.userManager.UpdateTier(tier); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditTierChange, tier.Code, before, DescribeTier(tier))
+	return s.writeJSON(w, newTierResponse(tier))
+}
+
+func (s *Server) handleTiersDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiTierDeleteRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	tier, err := s.userManager.Tier(req.Code)
+	if err == user.ErrTierNotFound {
+		return errHTTPBadRequestTierInvalid
+	} else if err != nil {
+		return err
+	}
+	users, err := s.userManager.Users()
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.TierID() == tier.ID {
+			return errHTTPConflictTierInUse
+		}
+	}
+	if err := s.userManager.RemoveTier(tier.Code); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditTierRemove, tier.Code, DescribeTier(tier), "")
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleAuditGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	filter := &user.AuditFilter{
+		Actor:  readQueryParam(r, "actor"),
+		Action: user.AuditAction(readQueryParam(r, "action")),
+		Target: readQueryParam(r, "target"),
+		Limit:  auditEntriesLimitDefault,
+	}
+	if since := readQueryParam(r, "since"); since != "" {
+		t, err := util.ParsePastTime(since, time.Now())
+		if err != nil {
+			return errHTTPBadRequestSinceInvalid
+		}
+		filter.Since = t
+	}
+	if limit := readQueryParam(r, "limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 || l > auditEntriesLimitMax {
+			return errHTTPBadRequest.Wrap("limit must be between 1 and %d", auditEntriesLimitMax)
+		}
+		filter.Limit = l
+	}
+	entries, err := s.userManager.AuditEntries(filter)
+	if err != nil {
+		return err
+	}
+	response := make([]*apiAuditEntryResponse, len(entries))
+	for i, e := range entries {
+		var ip string
+		if e.IP.IsValid() {
+			ip = e.IP.String()
+		}
+		response[i] = &apiAuditEntryResponse{
+			ID:     e.ID,
+			Time:   e.Time.Unix(),
+			Actor:  e.Actor,
+			IP:     ip,
+			Action: string(e.Action),
+			Target: e.Target,
+			Before: e.Before,
+			After:  e.After,
+		}
+	}
+	return s.writeJSON(w, response)
+}
+
+// audit writes an entry to the audit log, using the visitor's user and IP address as actor. Errors are
+// only logged, since the audited action has already been performed at this point.
+func (s *Server) audit(r *http.Request, v *visitor, action user.AuditAction, target, before, after string) {
+	if s.userManager == nil {
+		return
+	}
+	var actor string
+	if u := v.User(); u != nil {
+		actor = u.Name
+	}
+	entry := &user.AuditEntry{
+		Actor:  actor,
+		IP:     v.IP(),
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+	}
+	if err := s.userManager.AddAuditEntry(entry); err != nil {
+		logvr(v, r).Err(err).Warn("Cannot write audit log entry for action %s", action)
+	}
+}
+
+// DescribeTier returns the tier limits as JSON, to record before/after values in the audit log. It is
+// exported so that the CLI records the same values as the HTTP API.
+func DescribeTier(tier *user.Tier) string {
+	b, err := json.Marshal(newTierResponse(tier))
+	if err != nil {
+		return tier.Code
+	}
+	return string(b)
+}
+
+// updateTierFromRequest applies all fields that are set in the request to the given tier
+func updateTierFromRequest(tier *user.Tier, req *apiTierRequest) error {
+	if req.Name != nil {
+		tier.Name = *req.Name
+	}
+	if req.Messages != nil {
+		tier.MessageLimit = *req.Messages
+	}
+	if req.MessagesExpiryDuration != nil {
+		tier.MessageExpiryDuration = time.Duration(*req.MessagesExpiryDuration) * time.Second
+	}
+	if req.MessagesKeepLast != nil {
+		tier.MessageKeepLast = *req.MessagesKeepLast
+	}
+	if req.Emails != nil {
+		tier.EmailLimit = *req.Emails
+	}
+	if req.Calls != nil {
+		tier.CallLimit = *req.Calls
+	}
+	if req.Reservations != nil {
+		tier.ReservationLimit = *req.Reservations
+	}
+	if req.AttachmentTotalSize != nil {
+		tier.AttachmentTotalSizeLimit = *req.AttachmentTotalSize
+	}
+	if req.AttachmentFileSize != nil {
+		tier.AttachmentFileSizeLimit = *req.AttachmentFileSize
+	}
+	if req.AttachmentExpiryDuration != nil {
+		tier.AttachmentExpiryDuration = time.Duration(*req.AttachmentExpiryDuration) * time.Second
+	}
+	if req.AttachmentBandwidth != nil {
+		tier.AttachmentBandwidthLimit = *req.AttachmentBandwidth
+	}
+	if req.StripeMonthlyPriceID != nil {
+		tier.StripeMonthlyPriceID = *req.StripeMonthlyPriceID
+	}
+	if req.StripeYearlyPriceID != nil {
+		tier.StripeYearlyPriceID = *req.StripeYearlyPriceID
+	}
+	if (tier.StripeMonthlyPriceID == "") != (tier.StripeYearlyPriceID == "") {
+		return errHTTPBadRequest.Wrap("stripe_monthly_price_id and stripe_yearly_price_id must be set together")
+	}
+	return nil
+}
+
+func newTierResponse(tier *user.Tier) *apiTierResponse {
+	return &apiTierResponse{
+		Code: tier.Code,
+		Name: tier.Name,
+		Limits: &apiAccountLimits{
+			Basis:                    string(visitorLimitBasisTier),
+			Messages:                 tier.MessageLimit,
+			MessagesExpiryDuration:   int64(tier.MessageExpiryDuration.Seconds()),
+			MessagesKeepLast:         tier.MessageKeepLast,
+			Emails:                   tier.EmailLimit,
+			Calls:                    tier.CallLimit,
+			Reservations:             tier.ReservationLimit,
+			AttachmentTotalSize:      tier.AttachmentTotalSizeLimit,
+			AttachmentFileSize:       tier.AttachmentFileSizeLimit,
+			AttachmentExpiryDuration: int64(tier.AttachmentExpiryDuration.Seconds()),
+			AttachmentBandwidth:      tier.AttachmentBandwidthLimit,
+		},
+		StripeMonthlyPriceID: tier.StripeMonthlyPriceID,
+		StripeYearlyPriceID:  tier.StripeYearlyPriceID,
+	}
+}
+
 func (s *Server) killUserSubscriber(u *user.User, topicPattern string) error {
 	topics, err := s.topicsFromPattern(topicPattern)
 	if err != nil {
 		return err
 	}
 	for _, t := range topics {
-		t.CancelSubscriberUser(u.ID)
+		t.CancelSubscribersUser(u.ID)
 	}
 	return nil
 }
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
+	"io"
+	"net/netip"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -179,3 +183,619 @@ func TestAccess_AllowReset_KillConnection(t *testing.T) {
 		return timeTaken.Load() >= 500
 	})
 }
+
+func TestGroup_AddMembersAccess(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+
+	// Users and admin
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+
+	// Create group, add member, grant access via API
+	rr := request(t, s, "PUT", "/v1/groups", `{"name": "ops"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "PUT", "/v1/groups/members", `{"group": "ops", "username": "ben"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "POST", "/v1/groups/access", `{"group": "ops", "topic": "ops-*", "permission": "ro"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// List groups
+	rr = request(t, s, "GET", "/v1/groups", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	groups, err := util.UnmarshalJSON[[]*apiGroupResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(*groups))
+	require.Equal(t, "ops", (*groups)[0].Name)
+	require.Equal(t, []string{"ben"}, (*groups)[0].Members)
+	require.Equal(t, "ops-*", (*groups)[0].Grants[0].Topic)
+	require.Equal(t, "read-only", (*groups)[0].Grants[0].Permission)
+
+	// Subscribing is allowed, publishing is not
+	rr = request(t, s, "GET", "/ops-alerts/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "PUT", "/ops-alerts", "hi", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 403, rr.Code)
+
+	// Remove member, subscribing is not allowed anymore
+	rr = request(t, s, "DELETE", "/v1/groups/members", `{"group": "ops", "username": "ben"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/ops-alerts/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 403, rr.Code)
+
+	// Delete group
+	rr = request(t, s, "DELETE", "/v1/groups", `{"name": "ops"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	_, err = s.userManager.Group("ops")
+	require.Equal(t, user.ErrGroupNotFound, err)
+}
+
+func TestGroup_Failures(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddGroup("ops"))
+
+	// Cannot create group as non-admin
+	rr := request(t, s, "PUT", "/v1/groups", `{"name": "devs"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Cannot create group with invalid name, or if it already exists
+	rr = request(t, s, "PUT", "/v1/groups", `{"name": "not valid"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	rr = request(t, s, "PUT", "/v1/groups", `{"name": "ops"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40905, toHTTPError(t, rr.Body.String()).Code)
+
+	// Cannot add members to non-existing group, or non-existing users
+	rr = request(t, s, "PUT", "/v1/groups/members", `{"group": "devs", "username": "ben"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40041, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "PUT", "/v1/groups/members", `{"group": "ops", "username": "emma"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40031, toHTTPError(t, rr.Body.String()).Code)
+
+	// Cannot grant access with invalid permission
+	rr = request(t, s, "POST", "/v1/groups/access", `{"group": "ops", "topic": "ops-*", "permission": "invalid"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40025, toHTTPError(t, rr.Body.String()).Code)
+}
+
+func TestGroup_AccessReset_KillConnection(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+
+	// User and admin, grant group access to "gol*" topics
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddGroup("miners"))
+	require.Nil(t, s.userManager.AddGroupMember("miners", "ben"))
+	require.Nil(t, s.userManager.AllowGroupAccess("miners", "gol*", user.PermissionRead))
+
+	start, timeTaken := time.Now(), atomic.Int64{}
+	go func() {
+		rr := request(t, s, "GET", "/gold/json", "", map[string]string{
+			"Authorization": util.BasicAuth("ben", "ben"),
+		})
+		require.Equal(t, 200, rr.Code)
+		timeTaken.Store(time.Since(start).Milliseconds())
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	// Reset group access
+	rr := request(t, s, "DELETE", "/v1/groups/access", `{"group": "miners", "topic":"gol*"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// Wait for connection to be killed; this will fail if the connection is never killed
+	waitFor(t, func() bool {
+		return timeTaken.Load() >= 500
+	})
+}
+
+func TestAccess_AllowExpires_Invalid(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AllowAccess("ben", "mytopic", user.PermissionReadWrite))
+	admin := map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	}
+
+	// Expiry in the past
+	rr := request(t, s, "PUT", "/v1/users/access", fmt.Sprintf(`{"username": "ben", "topic":"other", "permission":"ro", "expires": %d}`, time.Now().Add(-time.Minute).Unix()), admin)
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40065, toHTTPError(t, rr.Body.String()).Code)
+
+	// Expiring entry does not replace the permanent entry
+	rr = request(t, s, "PUT", "/v1/users/access", fmt.Sprintf(`{"username": "ben", "topic":"mytopic", "permission":"ro", "expires": %d}`, time.Now().Add(time.Hour).Unix()), admin)
+	require.Equal(t, 409, rr.Code)
+	require.Equal(t, 40909, toHTTPError(t, rr.Body.String()).Code)
+	grants, err := s.userManager.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, []user.Grant{{TopicPattern: "mytopic", Allow: user.PermissionReadWrite}}, grants)
+}
+
+func TestAccess_AllowExpires_KillConnection(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+
+	// Grant access to "incident*" topics for 2 seconds
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	expires := time.Now().Add(2 * time.Second).Unix()
+	rr := request(t, s, "PUT", "/v1/users/access", fmt.Sprintf(`{"username": "ben", "topic":"incident*", "permission":"ro", "expires": %d}`, expires), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/users", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	users, err := util.UnmarshalJSON[[]apiUserResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "ben", (*users)[1].Username)
+	require.Equal(t, expires, (*users)[1].Grants[0].Expires)
+
+	// Two concurrent streams of the same user must both be killed
+	start, timeTaken1, timeTaken2 := time.Now(), atomic.Int64{}, atomic.Int64{}
+	for _, timeTaken := range []*atomic.Int64{&timeTaken1, &timeTaken2} {
+		go func(timeTaken *atomic.Int64) {
+			rr := request(t, s, "GET", "/incident42/json", "", map[string]string{
+				"Authorization": util.BasicAuth("ben", "ben"),
+			})
+			require.Equal(t, 200, rr.Code)
+			timeTaken.Store(time.Since(start).Milliseconds())
+		}(timeTaken)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	// Run manager before and after expiry; the connections must only be killed after
+	s.execManager()
+	require.Equal(t, int64(0), timeTaken1.Load())
+	require.Equal(t, int64(0), timeTaken2.Load())
+	waitFor(t, func() bool {
+		return time.Now().Unix() > expires
+	})
+	s.execManager()
+	waitFor(t, func() bool {
+		return timeTaken1.Load() >= 500 && timeTaken2.Load() >= 500
+	})
+
+	// Grant is gone, and access is denied
+	rr = request(t, s, "GET", "/incident42/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 403, rr.Code)
+}
+
+func TestUser_ChangeRoleAndTier(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddTier(&user.Tier{
+		Code:             "pro",
+		ReservationLimit: 2,
+	}))
+
+	// Change tier and role
+	rr := request(t, s, "POST", "/v1/users", `{"username": "ben", "tier": "pro"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	ben, err := s.userManager.User("ben")
+	require.Nil(t, err)
+	require.Equal(t, "pro", ben.Tier.Code)
+	require.Equal(t, user.RoleUser, ben.Role)
+
+	rr = request(t, s, "POST", "/v1/users", `{"username": "ben", "role": "admin", "tier": ""}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	ben, err = s.userManager.User("ben")
+	require.Nil(t, err)
+	require.Nil(t, ben.Tier)
+	require.Equal(t, user.RoleAdmin, ben.Role)
+
+	// Failures
+	rr = request(t, s, "POST", "/v1/users", `{"username": "ben", "role": "superuser"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40042, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "POST", "/v1/users", `{"username": "ben", "tier": "doesnotexist"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40030, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "POST", "/v1/users", `{"username": "nobody", "role": "user"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40031, toHTTPError(t, rr.Body.String()).Code)
+}
+
+func TestUser_Tokens_ListRevoke(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	ben, err := s.userManager.User("ben")
+	require.Nil(t, err)
+	token, err := s.userManager.CreateToken(ben.ID, "backups", time.Unix(0, 0), netip.IPv4Unspecified())
+	require.Nil(t, err)
+	other, err := s.userManager.CreateToken(ben.ID, "laptop", time.Unix(0, 0), netip.IPv4Unspecified())
+	require.Nil(t, err)
+
+	// Non-admins cannot list tokens of other users
+	rr := request(t, s, "GET", "/v1/users/tokens?username=phil", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// List tokens
+	rr = request(t, s, "GET", "/v1/users/tokens?username=ben", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	tokens, err := util.UnmarshalJSON[[]apiAccountTokenResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 2, len(*tokens))
+	for _, tok := range *tokens {
+		require.NotEqual(t, token.Value, tok.Token)
+		require.NotEqual(t, other.Value, tok.Token)
+	}
+	backups := (*tokens)[0]
+	if backups.Label != "backups" {
+		backups = (*tokens)[1]
+	}
+	require.Equal(t, user.MaskToken(token.Value), backups.Token)
+	require.Equal(t, "backups", backups.Label)
+
+	// Revoke token; it cannot be used anymore
+	rr = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"Authorization": util.BearerAuth(token.Value),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// The full token is not accepted, only the masked token or the label
+	rr = request(t, s, "DELETE", "/v1/users/tokens", fmt.Sprintf(`{"username": "ben", "token": "%s"}`, token.Value), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40067, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "DELETE", "/v1/users/tokens", fmt.Sprintf(`{"username": "ben", "token": "%s"}`, backups.Token), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"Authorization": util.BearerAuth(token.Value),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	rr = request(t, s, "DELETE", "/v1/users/tokens", `{"username": "ben", "label": "laptop"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/users/tokens?username=ben", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, "[]\n", rr.Body.String())
+
+	rr = request(t, s, "GET", "/v1/users/tokens?username=nobody", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40031, toHTTPError(t, rr.Body.String()).Code)
+}
+
+func TestUser_Reservations_AddListRemove(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddUser("emma", "emma", user.RoleUser))
+
+	// Add reservation; the user does not need a tier
+	rr := request(t, s, "POST", "/v1/users/reservations", `{"username": "ben", "topic": "bens-topic", "everyone": "read-only"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/users/reservations?username=ben", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	reservations, err := util.UnmarshalJSON[[]apiAccountReservation](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, []apiAccountReservation{{Topic: "bens-topic", Everyone: "read-only"}}, *reservations)
+
+	// Topic is reserved by another user
+	rr = request(t, s, "POST", "/v1/users/reservations", `{"username": "emma", "topic": "bens-topic", "everyone": "deny-all"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40902, toHTTPError(t, rr.Body.String()).Code)
+
+	// Reservations can only be added for regular users
+	rr = request(t, s, "POST", "/v1/users/reservations", `{"username": "phil", "topic": "phils-topic", "everyone": "deny-all"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	// Remove reservation
+	rr = request(t, s, "DELETE", "/v1/users/reservations", `{"username": "ben", "topic": "bens-topic"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "DELETE", "/v1/users/reservations", `{"username": "ben", "topic": "bens-topic"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40044, toHTTPError(t, rr.Body.String()).Code)
+
+	reservationsList, err := s.userManager.Reservations("ben")
+	require.Nil(t, err)
+	require.Empty(t, reservationsList)
+}
+
+func TestTier_AddListChangeDelete(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+
+	// Add tier
+	rr := request(t, s, "PUT", "/v1/admin/tiers", `{"code": "pro", "name": "Pro", "messages": 1000, "messages_expiry_duration": 3600}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	tier, err := util.UnmarshalJSON[apiTierResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "pro", tier.Code)
+	require.Equal(t, "Pro", tier.Name)
+	require.Equal(t, int64(1000), tier.Limits.Messages)
+	require.Equal(t, int64(3600), tier.Limits.MessagesExpiryDuration)
+
+	rr = request(t, s, "PUT", "/v1/admin/tiers", `{"code": "pro"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40906, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "PUT", "/v1/admin/tiers", `{"code": "not valid"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40043, toHTTPError(t, rr.Body.String()).Code)
+
+	// Change tier, only the given fields are updated
+	rr = request(t, s, "POST", "/v1/admin/tiers", `{"code": "pro", "reservations": 5, "stripe_monthly_price_id": "price_1"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	rr = request(t, s, "POST", "/v1/admin/tiers", `{"code": "pro", "reservations": 5}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/admin/tiers", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	tiers, err := util.UnmarshalJSON[[]apiTierResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(*tiers))
+	require.Equal(t, "Pro", (*tiers)[0].Name)
+	require.Equal(t, int64(1000), (*tiers)[0].Limits.Messages)
+	require.Equal(t, int64(5), (*tiers)[0].Limits.Reservations)
+
+	// Non-admins cannot manage tiers
+	rr = request(t, s, "GET", "/v1/admin/tiers", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Tier cannot be deleted while it is in use
+	require.Nil(t, s.userManager.ChangeTier("ben", "pro"))
+	rr = request(t, s, "DELETE", "/v1/admin/tiers", `{"code": "pro"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40907, toHTTPError(t, rr.Body.String()).Code)
+
+	require.Nil(t, s.userManager.ResetTier("ben"))
+	rr = request(t, s, "DELETE", "/v1/admin/tiers", `{"code": "pro"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	_, err = s.userManager.Tier("pro")
+	require.Equal(t, user.ErrTierNotFound, err)
+}
+
+func TestAudit_AdminActionsAndFailedLogin(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+
+	// Perform a few audited actions
+	rr := request(t, s, "PUT", "/v1/users", `{"username": "ben", "password":"ben"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "POST", "/v1/users", `{"username": "ben", "role": "admin"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "POST", "/v1/users/access", `{"username": "*", "topic":"gold", "permission":"ro"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "incorrect"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Non-admins cannot read the audit log
+	rr = request(t, s, "GET", "/v1/admin/audit", "", nil)
+	require.Equal(t, 401, rr.Code)
+
+	// Read audit log
+	rr = request(t, s, "GET", "/v1/admin/audit", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	entries, err := util.UnmarshalJSON[[]apiAuditEntryResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 4, len(*entries))
+
+	failed := (*entries)[0]
+	require.Equal(t, string(user.AuditLoginFailed), failed.Action)
+	require.Equal(t, "", failed.Actor)
+	require.Equal(t, "ben", failed.Target)
+	require.Equal(t, "9.9.9.9", failed.IP)
+
+	require.Equal(t, string(user.AuditAccessAllow), (*entries)[1].Action)
+	require.Equal(t, "phil", (*entries)[1].Actor)
+	require.Equal(t, "*", (*entries)[1].Target)
+	require.Equal(t, "gold: read-only", (*entries)[1].After)
+
+	require.Equal(t, string(user.AuditUserRole), (*entries)[2].Action)
+	require.Equal(t, "ben", (*entries)[2].Target)
+	require.Equal(t, "user", (*entries)[2].Before)
+	require.Equal(t, "admin", (*entries)[2].After)
+
+	require.Equal(t, string(user.AuditUserAdd), (*entries)[3].Action)
+
+	// Filters
+	rr = request(t, s, "GET", "/v1/admin/audit?action=user&target=ben&limit=1", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	entries, err = util.UnmarshalJSON[[]apiAuditEntryResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(*entries))
+	require.Equal(t, string(user.AuditUserRole), (*entries)[0].Action)
+
+	rr = request(t, s, "GET", "/v1/admin/audit?since=1h&actor=nobody", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, "[]\n", rr.Body.String())
+
+	rr = request(t, s, "GET", "/v1/admin/audit?since=yesterday", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40008, toHTTPError(t, rr.Body.String()).Code)
+}
+
+func TestAudit_RetentionAndFailedLoginLimit(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthAuditRetention = time.Hour
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+	s.auditLoginFailed = rate.NewLimiter(rate.Every(time.Hour), 2)
+
+	// Only the first failed logins are recorded
+	for i := 0; i < 5; i++ {
+		rr := request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+			"Authorization": util.BasicAuth("ben", "incorrect"),
+		})
+		require.Equal(t, 401, rr.Code)
+	}
+	entries, err := s.userManager.AuditEntries(&user.AuditFilter{})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+
+	// Entries older than the retention are removed by the manager
+	require.Nil(t, s.userManager.AddAuditEntry(&user.AuditEntry{
+		Time:   time.Now().Add(-2 * time.Hour),
+		Action: user.AuditLoginFailed,
+		Target: "phil",
+	}))
+	s.execManager()
+	entries, err = s.userManager.AuditEntries(&user.AuditFilter{})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "ben", entries[0].Target)
+	require.Equal(t, "ben", entries[1].Target)
+}
+
+func TestAccess_AllowExpires_Everyone_KillConnections(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+
+	// Anonymous subscribers share the same (empty) user ID, all of them must be killed
+	expires := time.Now().Add(2 * time.Second)
+	require.Nil(t, s.userManager.AllowAccessUntil(user.Everyone, "incident*", user.PermissionRead, expires))
+	start, timeTaken1, timeTaken2 := time.Now(), atomic.Int64{}, atomic.Int64{}
+	for _, timeTaken := range []*atomic.Int64{&timeTaken1, &timeTaken2} {
+		go func(timeTaken *atomic.Int64) {
+			rr := request(t, s, "GET", "/incident42/json", "", nil)
+			require.Equal(t, 200, rr.Code)
+			timeTaken.Store(time.Since(start).Milliseconds())
+		}(timeTaken)
+	}
+	time.Sleep(500 * time.Millisecond)
+	waitFor(t, func() bool {
+		return time.Now().After(expires)
+	})
+	s.execManager()
+	waitFor(t, func() bool {
+		return timeTaken1.Load() >= 500 && timeTaken2.Load() >= 500
+	})
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CloudEvents integration:
+//
+// ntfy speaks CloudEvents (https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md) in both directions:
+//
+// - Subscribing to /<topic>/cloudevents streams all events as CloudEvents in structured JSON mode, one per line.
+//   The ntfy message itself is the "data" of the event, and the event type is derived from the ntfy event,
+//   e.g. "sh.ntfy.message".
+// - Publishing a CloudEvent to /<topic> (in binary or structured HTTP mode) publishes a message, with the event
+//   type as title, the event data as message, and the event source in the "source" field of the message.
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventsTypePrefix  = "sh.ntfy."
+)
+
+// cloudEvent is a CloudEvent in structured JSON mode, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/formats/json-format.md
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+func (s *Server) handleSubscribeCloudEvents(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	encoder := func(msg *message) (string, error) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+		ce := &cloudEvent{
+			SpecVersion:     cloudEventsSpecVersion,
+			ID:              msg.ID,
+			Source:          fmt.Sprintf("%s/%s", s.config.BaseURL, msg.Topic),
+			Type:            cloudEventsTypePrefix + msg.Event,
+			Time:            time.Unix(msg.Time, 0).UTC().Format(time.RFC3339),
+			DataContentType: "application/json",
+			Data:            data,
+		}
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(ce); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	return s.handleSubscribeHTTP(w, r, v, "application/x-ndjson", encoder)
+}
+
+// transformCloudEvent translates a CloudEvent published to a topic into a regular publish request. Requests
+// that are not CloudEvents are passed through unchanged.
+//
+// In binary mode, the event attributes are passed as "ce-*" headers, and the body is the event data. In
+// structured mode, the entire event is passed as JSON body, with the "application/cloudevents+json" content type.
+// In both cases, the event type is used as title, unless it is explicitly set. The event source is passed on
+// via the request context and kept in the message's own "source" field, since it may contain commas.
+func (s *Server) transformCloudEvent(next handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
+		var ce *cloudEvent
+		if r.Header.Get("ce-specversion") != "" {
+			ce = &cloudEvent{
+				SpecVersion: r.Header.Get("ce-specversion"),
+				ID:          r.Header.Get("ce-id"),
+				Source:      r.Header.Get("ce-source"),
+				Type:        r.Header.Get("ce-type"),
+			}
+		} else if strings.HasPrefix(r.Header.Get("Content-Type"), cloudEventsContentType) {
+			var err error
+			ce, err = readJSONWithLimit[cloudEvent](r.Body, s.config.MessageLimit*2, false) // 2x to account for JSON format overhead
+			if err != nil {
+				return err
+			}
+			data, err := ce.data()
+			if err != nil {
+				return errHTTPBadRequestCloudEventInvalid
+			}
+			r.Body = io.NopCloser(strings.NewReader(data))
+			r.Header.Del("Content-Type")
+			if ce.DataContentType == "text/markdown" {
+				r.Header.Set("Content-Type", ce.DataContentType)
+			}
+		} else {
+			return next(w, r, v)
+		}
+		if ce.SpecVersion != cloudEventsSpecVersion || ce.ID == "" || ce.Source == "" || ce.Type == "" {
+			return errHTTPBadRequestCloudEventInvalid
+		}
+		if readParam(r, "x-title", "title", "t") == "" {
+			r.Header.Set("X-Title", ce.Type)
+		}
+		logvr(v, r).Tag(tagPublish).Field("cloudevent_id", ce.ID).Debug("Publishing CloudEvent of type %s from %s", ce.Type, ce.Source)
+		return next(w, withContext(r, map[contextKey]any{
+			contextCloudEventSource: ce.Source,
+		}), v)
+	}
+}
+
+// data returns the event data of a structured mode CloudEvent as message: Strings are used as they are,
+// base64-encoded data is decoded, and any other JSON value is used in its JSON form.
+func (ce *cloudEvent) data() (string, error) {
+	if ce.DataBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(ce.DataBase64)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	} else if len(ce.Data) == 0 {
+		return "", nil
+	}
+	var data string
+	if err := json.Unmarshal(ce.Data, &data); err == nil {
+		return data, nil
+	}
+	return string(ce.Data), nil
+}
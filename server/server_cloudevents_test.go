@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_CloudEvents_Subscribe(t *testing.T) {
+	c := newTestConfig(t)
+	c.BaseURL = "https://ntfy.example.com"
+	s := newTestServer(t, c)
+
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/mytopic/cloudevents", rr)
+	m := toMessage(t, request(t, s, "PUT", "/mytopic", "some message", map[string]string{"Title": "some title"}).Body.String())
+	cancel()
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	var open, event cloudEvent
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &open))
+	require.Equal(t, "sh.ntfy.open", open.Type)
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &event))
+	require.Equal(t, "1.0", event.SpecVersion)
+	require.Equal(t, m.ID, event.ID)
+	require.Equal(t, "https://ntfy.example.com/mytopic", event.Source)
+	require.Equal(t, "sh.ntfy.message", event.Type)
+	require.Equal(t, "application/json", event.DataContentType)
+	require.NotEmpty(t, event.Time)
+
+	var data message
+	require.Nil(t, json.Unmarshal(event.Data, &data))
+	require.Equal(t, "some message", data.Message)
+	require.Equal(t, "some title", data.Title)
+}
+
+func TestServer_CloudEvents_PublishBinary(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	response := request(t, s, "POST", "/mytopic", "Disk full on db1", map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "a1b2c3",
+		"ce-source":      "monitoring",
+		"ce-type":        "com.example.disk.full",
+		"Content-Type":   "text/plain",
+	})
+	require.Equal(t, 200, response.Code)
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, "Disk full on db1", m.Message)
+	require.Equal(t, "com.example.disk.full", m.Title)
+	require.Equal(t, "monitoring", m.Source)
+	require.Nil(t, m.Tags)
+
+	// Explicit ntfy headers take precedence
+	response = request(t, s, "POST", "/mytopic", "Disk full on db2", map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "d4e5f6",
+		"ce-source":      "urn:monitoring:db2,db3",
+		"ce-type":        "com.example.disk.full",
+		"Title":          "Disk full",
+		"Tags":           "warning",
+	})
+	m = toMessage(t, response.Body.String())
+	require.Equal(t, "Disk full", m.Title)
+	require.Equal(t, []string{"warning"}, m.Tags)
+	require.Equal(t, "urn:monitoring:db2,db3", m.Source)
+
+	// Source is persisted in the message cache
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "monitoring", messages[0].Source)
+	require.Equal(t, "urn:monitoring:db2,db3", messages[1].Source)
+}
+
+func TestServer_CloudEvents_TopicPattern(t *testing.T) {
+	s := newTestServerWithTopicPatterns(t, newTestConfigWithAuthFile(t))
+	request(t, s, "PUT", "/alerts-disk", "disk full", nil)
+	request(t, s, "PUT", "/other", "other message", nil)
+
+	response := request(t, s, "GET", "/alerts-*/cloudevents?poll=1", "", topicPatternAuth())
+	require.Equal(t, 200, response.Code)
+	lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+	require.Equal(t, 1, len(lines))
+	var event cloudEvent
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &event))
+	var data message
+	require.Nil(t, json.Unmarshal(event.Data, &data))
+	require.Equal(t, "disk full", data.Message)
+}
+
+func TestServer_CloudEvents_PublishStructured(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	headers := map[string]string{"Content-Type": "application/cloudevents+json; charset=utf-8"}
+
+	// String data
+	response := request(t, s, "POST", "/mytopic", `{"specversion":"1.0","id":"1","source":"backup","type":"backup.done","data":"Backup done"}`, headers)
+	require.Equal(t, 200, response.Code)
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, "Backup done", m.Message)
+	require.Equal(t, "backup.done", m.Title)
+	require.Equal(t, "backup", m.Source)
+
+	// JSON data
+	response = request(t, s, "POST", "/mytopic", `{"specversion":"1.0","id":"2","source":"backup","type":"backup.done","data":{"files":12}}`, headers)
+	m = toMessage(t, response.Body.String())
+	require.Equal(t, `{"files":12}`, m.Message)
+
+	// Base64 data
+	response = request(t, s, "POST", "/mytopic", `{"specversion":"1.0","id":"3","source":"backup","type":"backup.done","data_base64":"aGkgdGhlcmU="}`, headers)
+	m = toMessage(t, response.Body.String())
+	require.Equal(t, "hi there", m.Message)
+
+	// Markdown data
+	response = request(t, s, "POST", "/mytopic", `{"specversion":"1.0","id":"4","source":"backup","type":"backup.done","datacontenttype":"text/markdown","data":"**done**"}`, headers)
+	m = toMessage(t, response.Body.String())
+	require.Equal(t, "**done**", m.Message)
+	require.Equal(t, "text/markdown", m.ContentType)
+}
+
+func TestServer_CloudEvents_PublishInvalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "POST", "/mytopic", "message", map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "a1b2c3",
+		"ce-source":      "monitoring",
+	})
+	require.Equal(t, 40064, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "POST", "/mytopic", `{"specversion":"0.3","id":"1","source":"backup","type":"backup.done"}`, map[string]string{
+		"Content-Type": "application/cloudevents+json",
+	})
+	require.Equal(t, 40064, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "POST", "/mytopic", `not json`, map[string]string{
+		"Content-Type": "application/cloudevents+json",
+	})
+	require.Equal(t, 40024, toHTTPError(t, response.Body.String()).Code)
+}
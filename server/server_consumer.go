@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"heckel.io/ntfy/v2/log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const (
+	// consumerExpiryDuration defines how long a consumer cursor is kept after it was last updated
+	consumerExpiryDuration = 30 * 24 * time.Hour
+)
+
+var (
+	consumerNameRegex = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+)
+
+// consumer is a named durable subscription (?consumer=...), whose cursor, i.e. the ID of the last message that
+// was delivered, is stored per topic on the server. Consumers are scoped to the user; anonymous users cannot use
+// consumers, since they would all share the same cursors.
+type consumer struct {
+	Name       string
+	UserID     string
+	ManualAck  bool // If true, the cursor is only advanced via the ack endpoint
+	SinceGiven bool // If true, the since= parameter (or the Last-Event-ID header) overrides the stored cursor
+}
+
+// parseConsumer reads the X-Consumer and X-Ack headers (or their query parameter equivalents), and returns
+// the consumer, or nil if the subscription is not a durable subscription
+func parseConsumer(r *http.Request, v *visitor) (*consumer, error) {
+	name := readParam(r, "x-consumer", "consumer")
+	if name == "" {
+		return nil, nil
+	} else if !consumerNameRegex.MatchString(name) {
+		return nil, errHTTPBadRequestConsumerInvalid
+	} else if v.User() == nil {
+		return nil, errHTTPUnauthorizedConsumer
+	}
+	return &consumer{
+		Name:       name,
+		UserID:     v.User().ID,
+		ManualAck:  readParam(r, "x-ack", "ack") == "manual",
+		SinceGiven: readParam(r, "x-since", "since", "si") != "" || validMessageID(r.Header.Get("Last-Event-ID")),
+	}, nil
+}
+
+// consumerSince returns the since marker for the given topic: if the subscription is a durable subscription
+// without an explicit since= parameter, and the consumer has a stored cursor for the topic, the cursor is used.
+// Otherwise, since is returned as is.
+func (s *Server) consumerSince(c *consumer, topic string, since sinceMarker) (sinceMarker, error) {
+	if c == nil || c.SinceGiven {
+		return since, nil
+	}
+	messageID, err := s.messageCache.Consumer(c.UserID, c.Name, topic)
+	if errors.Is(err, errConsumerNotFound) {
+		return since, nil
+	} else if err != nil {
+		return sinceNoMessages, err
+	}
+	return newSinceID(messageID), nil
+}
+
+// consumerSubscriber wraps the given subscriber, and advances the cursor of the consumer whenever a message
+// was successfully delivered. If the consumer acknowledges messages manually, the subscriber is returned as is.
+func (s *Server) consumerSubscriber(c *consumer, sub subscriber) subscriber {
+	if c == nil || c.ManualAck {
+		return sub
+	}
+	return func(v *visitor, m *message) error {
+		if err := sub(v, m); err != nil {
+			return err
+		}
+		if m.Event == messageEvent {
+			if err := s.messageCache.UpdateConsumer(c.UserID, c.Name, m.Topic, m.ID); err != nil {
+				logvm(v, m).Tag(tagSubscribe).Field("consumer", c.Name).Err(err).Warn("Error updating consumer cursor")
+			}
+		}
+		return nil
+	}
+}
+
+// handleConsumerAck advances the cursor of a durable subscription to the given message, e.g.
+// POST /mytopic/ack?consumer=laptop-1&id=<message-id>
+func (s *Server) handleConsumerAck(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	t, err := fromContext[*topic](r, contextTopic)
+	if err != nil {
+		return err
+	}
+	c, err := parseConsumer(r, v)
+	if err != nil {
+		return err
+	} else if c == nil {
+		return errHTTPBadRequestConsumerInvalid
+	}
+	messageID := readParam(r, "x-id", "id")
+	if !validMessageID(messageID) {
+		return errHTTPBadRequestConsumerAckInvalid
+	}
+	m, err := s.messageCache.Message(messageID)
+	if errors.Is(err, errMessageNotFound) || (err == nil && m.Topic != t.ID) {
+		return errHTTPNotFoundMessage
+	} else if err != nil {
+		return err
+	}
+	logvr(v, r).
+		Tag(tagSubscribe).
+		With(t).
+		Fields(log.Context{
+			"consumer":   c.Name,
+			"message_id": messageID,
+		}).
+		Debug("Acknowledging message for consumer %s", c.Name)
+	if err := s.messageCache.UpdateConsumer(c.UserID, c.Name, t.ID, messageID); err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
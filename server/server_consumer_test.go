@@ -0,0 +1,125 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"testing"
+)
+
+func TestServer_Consumer_ResumeFromCursor(t *testing.T) {
+	s, auth := newTestServerWithConsumerUser(t)
+	request(t, s, "PUT", "/mytopic", "message 1", nil)
+	request(t, s, "PUT", "/mytopic", "message 2", nil)
+
+	// First poll returns everything, and advances the cursor
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop-1", "", auth).Body.String())
+	require.Equal(t, 2, len(messages))
+
+	// Second poll only returns new messages
+	request(t, s, "PUT", "/mytopic", "message 3", nil)
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop-1", "", auth).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "message 3", messages[0].Message)
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop-1", "", auth).Body.String())
+	require.Equal(t, 0, len(messages))
+
+	// Other consumers, and explicit since= are not affected
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop-2", "", auth).Body.String())
+	require.Equal(t, 3, len(messages))
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop-1&since=all", "", auth).Body.String())
+	require.Equal(t, 3, len(messages))
+}
+
+func TestServer_Consumer_MultipleTopics(t *testing.T) {
+	s, auth := newTestServerWithConsumerUser(t)
+	request(t, s, "PUT", "/topic1", "topic1 message 1", nil)
+	messages := toMessages(t, request(t, s, "GET", "/topic1/json?poll=1&consumer=laptop", "", auth).Body.String())
+	require.Equal(t, 1, len(messages))
+
+	// The cursor is stored per topic
+	request(t, s, "PUT", "/topic1", "topic1 message 2", nil)
+	request(t, s, "PUT", "/topic2", "topic2 message 1", nil)
+	messages = toMessages(t, request(t, s, "GET", "/topic1,topic2/json?poll=1&consumer=laptop", "", auth).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "topic1 message 2", messages[0].Message)
+	require.Equal(t, "topic2 message 1", messages[1].Message)
+}
+
+func TestServer_Consumer_ManualAck(t *testing.T) {
+	s, auth := newTestServerWithConsumerUser(t)
+	m1 := toMessage(t, request(t, s, "PUT", "/mytopic", "message 1", nil).Body.String())
+	request(t, s, "PUT", "/mytopic", "message 2", nil)
+
+	// Manual ack does not advance the cursor on delivery
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=worker&ack=manual", "", auth).Body.String())
+	require.Equal(t, 2, len(messages))
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=worker&ack=manual", "", auth).Body.String())
+	require.Equal(t, 2, len(messages))
+
+	// Ack the first message
+	response := request(t, s, "POST", "/mytopic/ack?consumer=worker&id="+m1.ID, "", auth)
+	require.Equal(t, 200, response.Code)
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=worker&ack=manual", "", auth).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "message 2", messages[0].Message)
+}
+
+func TestServer_Consumer_Invalid(t *testing.T) {
+	s, auth := newTestServerWithConsumerUser(t)
+	m := toMessage(t, request(t, s, "PUT", "/othertopic", "message 1", nil).Body.String())
+
+	response := request(t, s, "GET", "/mytopic/json?poll=1&consumer=no%20spaces", "", auth)
+	require.Equal(t, 40059, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/mytopic/ack?id="+m.ID, "", auth)
+	require.Equal(t, 40059, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/mytopic/ack?consumer=worker&id=invalid", "", auth)
+	require.Equal(t, 40060, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/mytopic/ack?consumer=worker&id="+m.ID, "", auth) // Wrong topic
+	require.Equal(t, 40404, toHTTPError(t, response.Body.String()).Code)
+}
+
+func TestServer_Consumer_ScopedToUser(t *testing.T) {
+	s, auth := newTestServerWithConsumerUser(t)
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	request(t, s, "PUT", "/mytopic", "message 1", nil)
+
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop", "", auth).Body.String())
+	require.Equal(t, 1, len(messages))
+
+	// Another user's consumer with the same name has its own cursor
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	}).Body.String())
+	require.Equal(t, 1, len(messages))
+
+	// Anonymous users cannot use consumers, since they would share the same cursors
+	response := request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop", "", nil)
+	require.Equal(t, 40102, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/mytopic/ack?consumer=laptop&id=abcdefghijkl", "", nil)
+	require.Equal(t, 40102, toHTTPError(t, response.Body.String()).Code)
+}
+
+func TestServer_Consumer_LastEventIDOverridesCursor(t *testing.T) {
+	s, auth := newTestServerWithConsumerUser(t)
+	m1 := toMessage(t, request(t, s, "PUT", "/mytopic", "message 1", nil).Body.String())
+	request(t, s, "PUT", "/mytopic", "message 2", nil)
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop", "", auth).Body.String())
+	require.Equal(t, 2, len(messages))
+
+	// A reconnecting EventSource sends the ID of the last message it received
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&consumer=laptop", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"Last-Event-ID": m1.ID,
+	}).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "message 2", messages[0].Message)
+}
+
+func newTestServerWithConsumerUser(t *testing.T) (*Server, map[string]string) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser))
+	return s, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"heckel.io/ntfy/v2/util"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	dedupWindowDefault = 10 * time.Minute
+	dedupWindowMin     = time.Second
+	dedupWindowMax     = 24 * time.Hour
+	dedupKeyLengthMax  = 64
+	dedupIndexSizeMax  = 10000
+	dedupLockShards    = 256 // Number of mutexes that deduplication keys are striped over, see lockDedup
+)
+
+// dedupOptions are the deduplication options of a published message, see parseDedup
+type dedupOptions struct {
+	Key    string // Explicit deduplication key, or empty to derive it from title and message (see dedupMessage)
+	Window time.Duration
+}
+
+// parseDedup reads the X-Dedup and X-Dedup-Key headers, and returns the deduplication options for the message, or
+// nil if deduplication was not requested. X-Dedup may be a duration (e.g. "10m"), or a boolean to use the default
+// window. Passing only X-Dedup-Key implies the default window.
+func (s *Server) parseDedup(r *http.Request, cache bool) (*dedupOptions, *errHTTP) {
+	value := readParam(r, "x-dedup", "dedup")
+	key := readParam(r, "x-dedup-key", "dedup-key")
+	if value == "" && key == "" {
+		return nil, nil
+	} else if value != "" && isBoolValue(value) && !toBool(value) {
+		return nil, nil
+	} else if !cache || s.config.CacheDuration == 0 {
+		return nil, errHTTPBadRequestDedupNoCache
+	} else if len(key) > dedupKeyLengthMax {
+		return nil, errHTTPBadRequestDedupInvalid
+	}
+	window := dedupWindowDefault
+	if value != "" && !isBoolValue(value) {
+		var err error
+		window, err = util.ParseDuration(value)
+		if err != nil || window < dedupWindowMin || window > dedupWindowMax {
+			return nil, errHTTPBadRequestDedupInvalid
+		}
+	}
+	return &dedupOptions{
+		Key:    key,
+		Window: window,
+	}, nil
+}
+
+// lockDedup locks the deduplication key of the given topic, and returns a function to release the lock, which may
+// be called more than once. Locks are striped over a fixed number of mutexes, so that messages with different keys
+// (or on different topics) rarely wait for each other, and identical messages are never published twice.
+func (s *Server) lockDedup(topic, key string) (unlock func()) {
+	h := fnv.New32a()
+	h.Write([]byte(topic + "\n" + key))
+	mu := &s.dedupLocks[h.Sum32()%dedupLockShards]
+	mu.Lock()
+	return sync.OnceFunc(mu.Unlock)
+}
+
+// dedupMessage checks if an identical message (same deduplication key) was published to the topic within the
+// deduplication window. If so, the count of the surviving message is incremented, and the surviving message is
+// returned, so the caller can skip fanning out the new message. If not, nil is returned, and the caller must
+// register the message as the surviving message with addDedup once it is stored in the message cache. The caller
+// must hold the lock of the key (see lockDedup) until then, so that concurrent identical messages find it.
+func (s *Server) dedupMessage(v *visitor, m *message, opts *dedupOptions) (*message, error) {
+	messageID, ok := s.dedupIndex.Get(m.Topic, opts.Key)
+	if !ok {
+		var expires int64
+		var err error
+		messageID, expires, err = s.messageCache.Dedup(m.Topic, opts.Key)
+		if err == nil {
+			s.dedupIndex.Put(m.Topic, opts.Key, messageID, expires)
+		} else if !errors.Is(err, errMessageNotFound) {
+			return nil, err
+		}
+	}
+	if messageID != "" {
+		if err := s.messageCache.IncrementMessageCount(messageID); err == nil {
+			surviving, err := s.messageCache.Message(messageID)
+			if err != nil {
+				return nil, err
+			}
+			if m.Attachment != nil && s.fileCache != nil {
+				if err := s.fileCache.Remove(m.ID); err != nil {
+					logvm(v, m).Tag(tagPublish).Err(err).Warn("Error deleting attachment of duplicate message")
+				}
+			}
+			logvm(v, surviving).
+				Tag(tagPublish).
+				Field("message_count", surviving.Count).
+				Debug("Duplicate message within deduplication window, incremented count of message %s", messageID)
+			minc(metricMessagesDeduplicated)
+			return surviving, nil
+		} else if !errors.Is(err, errMessageNotFound) {
+			return nil, err
+		}
+		// Surviving message has expired or was deleted, publish the new message instead
+	}
+	m.Count = 1
+	return nil, nil
+}
+
+// addDedup registers the given message as the surviving message for its deduplication key and window
+func (s *Server) addDedup(m *message, opts *dedupOptions) error {
+	expires := time.Now().Add(opts.Window).Unix()
+	if err := s.messageCache.AddDedup(m.Topic, opts.Key, m.ID, expires); err != nil {
+		return err
+	}
+	s.dedupIndex.Put(m.Topic, opts.Key, m.ID, expires)
+	return nil
+}
+
+// dedupKey derives the deduplication key from the message title and body
+func dedupKey(m *message) string {
+	h := sha256.Sum256([]byte(m.Title + "\n" + m.Message))
+	return hex.EncodeToString(h[:16])
+}
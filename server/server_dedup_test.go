@@ -0,0 +1,163 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServer_Dedup_CountsIdenticalMessages(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	headers := map[string]string{
+		"X-Title": "Monitor",
+		"X-Dedup": "10m",
+	}
+
+	response := request(t, s, "PUT", "/mytopic", "site is down", headers)
+	require.Equal(t, 200, response.Code)
+	m1 := toMessage(t, response.Body.String())
+	require.Equal(t, 1, m1.Count)
+
+	// Identical message is not published, but counted
+	response = request(t, s, "PUT", "/mytopic", "site is down", headers)
+	require.Equal(t, 200, response.Code)
+	m2 := toMessage(t, response.Body.String())
+	require.Equal(t, m1.ID, m2.ID)
+	require.Equal(t, 2, m2.Count)
+
+	// Different body or different topic is published
+	response = request(t, s, "PUT", "/mytopic", "site is up", headers)
+	require.NotEqual(t, m1.ID, toMessage(t, response.Body.String()).ID)
+	response = request(t, s, "PUT", "/othertopic", "site is down", headers)
+	require.NotEqual(t, m1.ID, toMessage(t, response.Body.String()).ID)
+
+	// Without dedup, it is published
+	response = request(t, s, "PUT", "/mytopic", "site is down", map[string]string{
+		"X-Title": "Monitor",
+	})
+	require.NotEqual(t, m1.ID, toMessage(t, response.Body.String()).ID)
+
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, m1.ID, messages[0].ID)
+	require.Equal(t, 2, messages[0].Count)
+	require.Equal(t, 0, messages[2].Count)
+}
+
+func TestServer_Dedup_KeyAndWindow(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	// Same key, different body: only counted
+	response := request(t, s, "PUT", "/mytopic", "cpu at 91%", map[string]string{
+		"X-Dedup-Key": "cpu-high",
+	})
+	m1 := toMessage(t, response.Body.String())
+	response = request(t, s, "PUT", "/mytopic", "cpu at 95%", map[string]string{
+		"X-Dedup-Key": "cpu-high",
+	})
+	m2 := toMessage(t, response.Body.String())
+	require.Equal(t, m1.ID, m2.ID)
+	require.Equal(t, "cpu at 91%", m2.Message)
+	require.Equal(t, 2, m2.Count)
+
+	// Window has passed: new message, also after a restart of the in-memory index
+	_, err := s.messageCache.db.Exec(`UPDATE dedup SET expires = ?`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	s.dedupIndex = newDedupIndex(dedupIndexSizeMax)
+	response = request(t, s, "PUT", "/mytopic", "cpu at 97%", map[string]string{
+		"X-Dedup-Key": "cpu-high",
+	})
+	m3 := toMessage(t, response.Body.String())
+	require.NotEqual(t, m1.ID, m3.ID)
+	require.Equal(t, 1, m3.Count)
+
+	// Index is backed by the message cache
+	s.dedupIndex = newDedupIndex(dedupIndexSizeMax)
+	response = request(t, s, "PUT", "/mytopic", "cpu at 99%", map[string]string{
+		"X-Dedup-Key": "cpu-high",
+	})
+	m4 := toMessage(t, response.Body.String())
+	require.Equal(t, m3.ID, m4.ID)
+	require.Equal(t, 2, m4.Count)
+	require.Equal(t, 1, s.dedupIndex.Len()) // Refilled from the message cache
+}
+
+func TestServer_Dedup_Concurrent(t *testing.T) {
+	c := newTestConfig(t)
+	c.CacheBatchSize = 10
+	c.CacheBatchTimeout = 500 * time.Millisecond
+	s := newTestServer(t, c)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response := request(t, s, "PUT", "/mytopic", "site is down", map[string]string{
+				"X-Dedup": "10m",
+			})
+			require.Equal(t, 200, response.Code)
+		}()
+	}
+	wg.Wait()
+	time.Sleep(700 * time.Millisecond) // Wait for the batch queue
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, 20, messages[0].Count)
+}
+
+func TestServer_Dedup_PublishAsJSON(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	body := `{"topic":"mytopic","message":"disk full","dedup":"1h"}`
+	m1 := toMessage(t, request(t, s, "PUT", "/", body, nil).Body.String())
+	m2 := toMessage(t, request(t, s, "PUT", "/", body, nil).Body.String())
+	require.Equal(t, m1.ID, m2.ID)
+	require.Equal(t, 2, m2.Count)
+}
+
+func TestServer_Dedup_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	for _, dedup := range []string{"abc", "0s", "25h"} {
+		response := request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+			"X-Dedup": dedup,
+		})
+		require.Equal(t, 40052, toHTTPError(t, response.Body.String()).Code, dedup)
+	}
+	response := request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"X-Dedup": "10m",
+		"X-Cache": "no",
+	})
+	require.Equal(t, 40053, toHTTPError(t, response.Body.String()).Code)
+
+	// Explicitly disabled
+	response = request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"X-Dedup": "no",
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, 0, toMessage(t, response.Body.String()).Count)
+}
+
+func TestServer_Dedup_LockPerKey(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	unlock := s.lockDedup("mytopic", "key1")
+
+	// Same topic and key waits for the lock, and unlocking twice is harmless
+	locked := make(chan struct{})
+	go func() {
+		s.lockDedup("mytopic", "key1")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("expected lock to be held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("expected lock to be released")
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"strings"
+	"time"
+)
+
+const (
+	digestWindowMin      = 10 * time.Second
+	digestWindowMax      = time.Hour
+	digestTitlesMax      = 5
+	digestTitleLengthMax = 80
+)
+
+func (s *Server) runDigestSender() {
+	for {
+		select {
+		case <-time.After(s.config.DelayedSenderInterval):
+			s.sendDigests()
+		case <-s.closeChan:
+			return
+		}
+	}
+}
+
+// sendDigests delivers all digests whose window has passed to Firebase, Web Push and e-mail. Stream subscribers
+// are not notified, since they already received every individual message.
+func (s *Server) sendDigests() {
+	digests, err := s.messageCache.DigestsDue()
+	if err != nil {
+		log.Tag(tagPublish).Err(err).Warn("Error retrieving digests")
+		return
+	}
+	for _, d := range digests {
+		if err := s.sendDigest(d); err != nil {
+			log.Tag(tagPublish).Field("topic", d.Topic).Err(err).Warn("Error sending digest")
+		}
+	}
+}
+
+// sendDigest delivers the summary notification of the digest. The summary is added to the message cache, since
+// Firebase only delivers a poll request for it to iOS devices. Each e-mail counts towards the e-mail limit of the
+// publisher of the latest message once, no matter how many messages are in the digest.
+func (s *Server) sendDigest(d *digest) error {
+	var u *user.User
+	if s.userManager != nil && d.User != "" {
+		var err error
+		u, err = s.userManager.UserByID(d.User)
+		if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+			return err
+		}
+	}
+	v, m := s.visitor(d.Sender, u), newDigestMessage(d)
+	logvm(v, m).
+		Tag(tagPublish).
+		Field("digest_count", d.Count).
+		Debug("Sending digest of %d message(s)", d.Count)
+	if d.Count > 1 {
+		if err := s.messageCache.AddMessage(m); err != nil {
+			return err
+		}
+	}
+	if s.firebaseClient != nil && d.Firebase {
+		go s.sendToFirebase(v, m)
+	}
+	if s.config.WebPushPublicKey != "" {
+		go s.publishToWebPushEndpoints(v, m)
+	}
+	if s.smtpSender != nil && len(d.Emails) > 0 {
+		if suppressed, err := s.emailSuppressedByQuietHours(m); err != nil {
+			return err
+		} else if suppressed {
+			logvm(v, m).Tag(tagPublish).Debug("Quiet hours of topic owner active, not sending digest e-mails")
+			return nil
+		}
+		for _, email := range d.Emails {
+			if !v.EmailAllowed() {
+				logvm(v, m).Tag(tagPublish).Info("E-mail limit reached, not sending digest to %s", email)
+				continue
+			}
+			go s.sendEmail(v, m, email)
+		}
+	}
+	return nil
+}
+
+// newDigestMessage creates the summary notification for the given digest. If the digest contains only one message,
+// the message itself is delivered instead.
+func newDigestMessage(d *digest) *message {
+	if d.Count == 1 {
+		return d.Last
+	}
+	var body strings.Builder
+	for _, title := range d.Titles {
+		body.WriteString(fmt.Sprintf("- %s\n", title))
+	}
+	if more := d.Count - len(d.Titles); more > 0 {
+		body.WriteString(fmt.Sprintf("... and %d more", more))
+	}
+	m := newDefaultMessage(d.Topic, strings.TrimSpace(body.String()))
+	m.Title = fmt.Sprintf("%d new messages", d.Count)
+	m.Priority = d.Priority
+	m.Click = d.Last.Click
+	m.Icon = d.Last.Icon
+	m.Expires = d.Last.Expires
+	m.Count = d.Count
+	m.Sender = d.Sender
+	m.User = d.User
+	return m
+}
+
+// digestTitle returns the title of the message as shown in a digest, or the first line of the message if the
+// message does not have a title
+func digestTitle(m *message) string {
+	title := m.Title
+	if title == "" {
+		title, _, _ = strings.Cut(m.Message, "\n")
+	}
+	if runes := []rune(title); len(runes) > digestTitleLengthMax {
+		title = string(runes[:digestTitleLengthMax]) + "..."
+	}
+	return title
+}
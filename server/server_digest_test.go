@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"testing"
+	"time"
+)
+
+func TestServer_Digest_BatchesPushAndEmail(t *testing.T) {
+	sender := newTestFirebaseSender(10)
+	mailer := &testMailer{}
+	c := newTestConfigWithAuthFile(t)
+	c.VisitorEmailLimitBurst = 1
+	s := newTestServer(t, c)
+	s.firebaseClient = newFirebaseClient(sender, &testAuther{Allow: true})
+	s.smtpSender = mailer
+	settings := user.NewTopicSettings("deploys")
+	settings.Digest = 2 * time.Minute
+	require.Nil(t, s.userManager.SetTopicSettings(settings))
+
+	// E-mails are charged once per digest, not per message
+	for i := 1; i <= 3; i++ {
+		response := request(t, s, "PUT", "/deploys", fmt.Sprintf("deploy %d done", i), map[string]string{
+			"X-Email": "phil@example.com",
+		})
+		require.Equal(t, 200, response.Code)
+	}
+
+	// Stream subscribers get every message, push and email nothing yet
+	messages := toMessages(t, request(t, s, "GET", "/deploys/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 3, len(messages))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 0, len(sender.Messages()))
+	require.Equal(t, 0, mailer.Count())
+
+	// Digest survives a restart
+	s.closeDatabases()
+	s = newTestServer(t, c)
+	s.firebaseClient = newFirebaseClient(sender, &testAuther{Allow: true})
+	s.smtpSender = mailer
+
+	// Window passed: one summary notification
+	_, err := s.messageCache.db.Exec(`UPDATE digests SET due = ?`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	s.sendDigests()
+	waitFor(t, func() bool {
+		return len(sender.Messages()) == 1 && mailer.Count() == 1
+	})
+	require.Equal(t, "3 new messages", sender.Messages()[0].Data["title"])
+	require.Equal(t, "- deploy 1 done\n- deploy 2 done\n- deploy 3 done", sender.Messages()[0].Data["message"])
+
+	// Summary is cached, so that poll requests can be answered
+	messages = toMessages(t, request(t, s, "GET", "/deploys/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 4, len(messages))
+	require.Equal(t, "3 new messages", messages[3].Title)
+	require.Equal(t, sender.Messages()[0].Data["id"], messages[3].ID)
+}
+
+func TestServer_Digest_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	for _, digest := range []string{"-1", "1", "7200"} {
+		response := request(t, s, "PATCH", "/v1/topics/deploys/settings", fmt.Sprintf(`{"digest": %s}`, digest), map[string]string{
+			"Authorization": util.BasicAuth("phil", "phil"),
+		})
+		require.Equal(t, 40054, toHTTPError(t, response.Body.String()).Code, digest)
+	}
+}
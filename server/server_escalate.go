@@ -0,0 +1,315 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	escalateActionRenotify = "renotify"
+	escalateActionEmail    = "email"
+	escalateActionCall     = "call"
+	escalationStepsMax     = 5
+	escalationKeyLength    = 16
+	escalationActionLabel  = "Acknowledge"
+)
+
+// parseEscalation parses the X-Escalate header of a published message, and returns the escalation policy
+// for the message, or nil if no policy was given. If the server has a base URL, an "Acknowledge" action button
+// is added to the message, so that the message can be acknowledged right from the notification.
+func (s *Server) parseEscalation(r *http.Request, v *visitor, m *message, cache bool) (*escalation, *errHTTP) {
+	value := readParam(r, "x-escalate", "escalate")
+	if value == "" {
+		return nil, nil
+	} else if !cache || s.config.CacheDuration == 0 {
+		return nil, errHTTPBadRequestEscalateNoCache
+	}
+	steps, err := parseEscalationSteps(value, s.config.MinDelay, s.config.MaxDelay)
+	if err != nil {
+		return nil, errHTTPBadRequestEscalateInvalid.Wrap("%s", err.Error())
+	}
+	for _, step := range steps {
+		switch step.Action {
+		case escalateActionEmail:
+			if s.smtpSender == nil {
+				return nil, errHTTPBadRequestEmailDisabled
+			}
+		case escalateActionCall:
+			if s.config.TwilioAccount == "" || s.userManager == nil {
+				return nil, errHTTPBadRequestPhoneCallsDisabled
+			}
+			to, e := s.convertPhoneNumber(v.User(), step.Target)
+			if e != nil {
+				return nil, e
+			}
+			step.Target = to
+		}
+	}
+	e := &escalation{
+		MessageID: m.ID,
+		Topic:     m.Topic,
+		Key:       util.RandomString(escalationKeyLength),
+		Steps:     steps,
+		Due:       m.Time + steps[0].After,
+	}
+	if s.config.BaseURL != "" && len(m.Actions) < actionsMax {
+		ack := newAction()
+		ack.ID = util.RandomString(actionIDLength)
+		ack.Action = actionHTTP
+		ack.Label = escalationActionLabel
+		ack.URL = fmt.Sprintf("%s/v1/messages/%s/ack?key=%s", s.config.BaseURL, m.ID, e.Key)
+		ack.Method = http.MethodPost
+		ack.Clear = true
+		m.Actions = append(m.Actions, ack)
+	}
+	return e, nil
+}
+
+// parseEscalationSteps parses an escalation policy like "5m renotify, 15m email phil@example.com, 30m call",
+// and returns the steps ordered by their delay. Each step consists of a delay, an action and an optional target.
+func parseEscalationSteps(value string, minDelay, maxDelay time.Duration) ([]*escalationStep, error) {
+	parts := util.SplitNoEmpty(value, ",")
+	if len(parts) == 0 {
+		return nil, errors.New("no steps defined")
+	} else if len(parts) > escalationStepsMax {
+		return nil, fmt.Errorf("only %d steps allowed", escalationStepsMax)
+	}
+	steps := make([]*escalationStep, 0, len(parts))
+	for _, part := range parts {
+		fields := strings.Fields(part)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("step '%s' must have the format 'DELAY ACTION [TARGET]'", strings.TrimSpace(part))
+		}
+		delay, err := util.ParseDuration(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay '%s'", fields[0])
+		} else if delay < minDelay || delay > maxDelay {
+			return nil, fmt.Errorf("delay '%s' must be between %s and %s", fields[0], minDelay, maxDelay)
+		}
+		step := &escalationStep{
+			After:  int64(delay.Seconds()),
+			Action: strings.ToLower(fields[1]),
+		}
+		if len(fields) == 3 {
+			step.Target = fields[2]
+		}
+		switch step.Action {
+		case escalateActionRenotify:
+			if step.Target != "" {
+				return nil, fmt.Errorf("action '%s' does not take a target", step.Action)
+			}
+		case escalateActionEmail:
+			if !strings.Contains(step.Target, "@") {
+				return nil, fmt.Errorf("action '%s' requires an e-mail address", step.Action)
+			}
+		case escalateActionCall:
+			if step.Target == "" {
+				step.Target = "yes"
+			} else if !isBoolValue(step.Target) && !phoneNumberRegex.MatchString(step.Target) {
+				return nil, fmt.Errorf("action '%s' requires a phone number", step.Action)
+			}
+		default:
+			return nil, fmt.Errorf("unknown action '%s', must be one of: %s, %s, %s", step.Action, escalateActionRenotify, escalateActionEmail, escalateActionCall)
+		}
+		steps = append(steps, step)
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].After < steps[j].After
+	})
+	return steps, nil
+}
+
+// handleMessageAck returns the acknowledgement state of a message with an escalation policy (GET), or
+// acknowledges the message (POST/PUT), which stops all further escalation steps. Acknowledging a message
+// twice is not an error.
+func (s *Server) handleMessageAck(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	matches := apiMessageAckRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return errHTTPInternalErrorInvalidPath
+	}
+	e, err := s.messageCache.Escalation(matches[1])
+	if errors.Is(err, errMessageNotFound) {
+		return errHTTPNotFoundEscalation
+	} else if err != nil {
+		return err
+	}
+	if err := s.authorizeEscalation(r, v, e); err != nil {
+		return err
+	}
+	if r.Method != http.MethodGet {
+		var ackedBy string
+		if u := v.User(); u != nil {
+			ackedBy = u.Name
+		}
+		acked, err := s.messageCache.AckEscalation(e.MessageID, ackedBy)
+		if err != nil {
+			return err
+		}
+		if acked {
+			logvr(v, r).
+				Tag(tagPublish).
+				Fields(log.Context{
+					"message_id":    e.MessageID,
+					"message_topic": e.Topic,
+				}).
+				Info("Message acknowledged, stopping escalation")
+			if e, err = s.messageCache.Escalation(e.MessageID); err != nil {
+				return err
+			}
+		}
+	}
+	return s.writeJSON(w, &apiMessageAckResponse{
+		ID:      e.MessageID,
+		Acked:   e.Acked,
+		AckedBy: e.AckedBy,
+		Next:    e.Due,
+	})
+}
+
+// authorizeEscalation allows access to the escalation if the request carries the escalation key (as used in
+// the "Acknowledge" action button), or if the visitor is allowed to read the message's topic
+func (s *Server) authorizeEscalation(r *http.Request, v *visitor, e *escalation) error {
+	key := readParam(r, "x-key", "key")
+	if key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(e.Key)) == 1 {
+		return nil
+	} else if s.userManager == nil {
+		return nil
+	}
+	if err := s.userManager.Authorize(v.User(), e.Topic, user.PermissionRead); err != nil {
+		return errHTTPForbidden.With(v)
+	}
+	return nil
+}
+
+func (s *Server) runEscalationSender() {
+	for {
+		select {
+		case <-time.After(s.config.DelayedSenderInterval):
+			if err := s.sendEscalations(); err != nil {
+				log.Tag(tagPublish).Err(err).Warn("Error sending escalations")
+			}
+		case <-s.closeChan:
+			return
+		}
+	}
+}
+
+func (s *Server) sendEscalations() error {
+	escalations, err := s.messageCache.EscalationsDue()
+	if err != nil {
+		return err
+	}
+	for _, e := range escalations {
+		if err := s.sendEscalation(e); err != nil {
+			log.Tag(tagPublish).Field("message_id", e.MessageID).Err(err).Warn("Error sending escalation")
+		}
+	}
+	return nil
+}
+
+func (s *Server) sendEscalation(e *escalation) error {
+	m, err := s.messageCache.Message(e.MessageID)
+	if errors.Is(err, errMessageNotFound) {
+		return s.messageCache.DeleteMessages(e.MessageID) // Message has expired, also removes escalation
+	} else if err != nil {
+		return err
+	}
+	var u *user.User
+	if s.userManager != nil && m.User != "" {
+		u, err = s.userManager.UserByID(m.User)
+		if errors.Is(err, user.ErrUserNotFound) {
+			// Publisher was deleted, stop escalating instead of retrying this step forever
+			log.Tag(tagPublish).Field("message_id", e.MessageID).Debug("Publisher of message not found, stopping escalation")
+			return s.messageCache.MarkEscalationStep(e.MessageID, len(e.Steps), 0)
+		} else if err != nil {
+			return err
+		}
+	}
+	v := s.visitor(m.Sender, u)
+	step := e.Steps[e.NextStep]
+	// Advance to the next step before executing the current one, so that a step is never executed twice
+	next, due := e.NextStep+1, int64(0)
+	if next < len(e.Steps) {
+		due = m.Time + e.Steps[next].After
+	}
+	if err := s.messageCache.MarkEscalationStep(e.MessageID, next, due); err != nil {
+		return err
+	}
+	logvm(v, m).
+		Tag(tagPublish).
+		Fields(log.Context{
+			"escalation_step":   e.NextStep,
+			"escalation_action": step.Action,
+		}).
+		Debug("Message not acknowledged, escalating")
+	switch step.Action {
+	case escalateActionRenotify:
+		return s.renotify(v, m)
+	case escalateActionEmail:
+		if s.smtpSender == nil {
+			return errHTTPBadRequestEmailDisabled
+		}
+		if suppressed, err := s.emailSuppressedByQuietHours(m); err != nil {
+			return err
+		} else if suppressed {
+			logvm(v, m).Tag(tagPublish).Debug("Quiet hours of topic owner active, skipping escalation step")
+			return nil
+		} else if !v.EmailAllowed() {
+			return errHTTPTooManyRequestsLimitEmails
+		}
+		go s.sendEmail(v, m, step.Target)
+	case escalateActionCall:
+		if s.config.TwilioAccount == "" {
+			return errHTTPBadRequestPhoneCallsDisabled
+		} else if suppressedByQuietHours(u, m) { // Calls only go to the publisher's own verified numbers
+			logvm(v, m).Tag(tagPublish).Debug("Quiet hours active, skipping escalation step")
+			return nil
+		} else if !v.CallAllowed() {
+			return errHTTPTooManyRequestsLimitCalls
+		}
+		go s.callPhone(v, m, step.Target)
+	}
+	return nil
+}
+
+// renotify publishes a copy of the given message with a new ID to all subscribers. The copy carries the
+// same "Acknowledge" action button, and acknowledging the copy by its ID acknowledges the original message.
+// Like any other message, the copy counts towards the message limit of the original publisher.
+func (s *Server) renotify(v *visitor, m *message) error {
+	if !util.ContainsIP(s.config.VisitorRequestExemptIPAddrs, v.ip) && !v.MessageAllowed() {
+		return errHTTPTooManyRequestsLimitMessages
+	}
+	c := *m
+	c.ID = util.RandomString(messageIDLength)
+	c.Time = time.Now().Unix()
+	if m.Expires > 0 {
+		c.Expires = c.Time + (m.Expires - m.Time)
+	}
+	if err := s.messageCache.AddEscalationCopy(c.ID, m.ID); err != nil {
+		return err
+	}
+	return s.publishFromServer(v, &c)
+}
+
+// publishFromServer publishes a message that was generated by the server itself (and not by a publish request)
+// to all subscribers, Firebase and Web Push, and adds it to the message cache
+func (s *Server) publishFromServer(v *visitor, m *message) error {
+	if err := s.publishSeq(v, m); err != nil {
+		return err
+	}
+	if s.firebaseClient != nil {
+		go s.sendToFirebase(v, m)
+	}
+	if s.config.WebPushPublicKey != "" {
+		go s.publishToWebPushEndpoints(v, m)
+	}
+	return s.messageCache.AddMessage(m)
+}
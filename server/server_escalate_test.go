@@ -0,0 +1,238 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_Escalate_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	s.smtpSender = &testMailer{}
+	for _, escalate := range []string{
+		"5m",
+		"5m fly",
+		"5m renotify now",
+		"abc renotify",
+		"1s renotify",
+		"4d renotify",
+		"5m email",
+		"5m email notanemail",
+		"5m call 12345",
+		"1m renotify, 2m renotify, 3m renotify, 4m renotify, 5m renotify, 6m renotify",
+	} {
+		response := request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+			"X-Escalate": escalate,
+		})
+		require.Equal(t, 400, response.Code, escalate)
+		require.Equal(t, 40045, toHTTPError(t, response.Body.String()).Code, escalate)
+	}
+
+	response := request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"X-Escalate": "5m renotify",
+		"Cache":      "no",
+	})
+	require.Equal(t, 40046, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"X-Escalate": "5m call",
+	})
+	require.Equal(t, 40032, toHTTPError(t, response.Body.String()).Code) // Calls disabled
+}
+
+func TestServer_Escalate_RenotifyEmailAndAck(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+
+	response := request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"X-Escalate": "15m email phil@example.com, 5m renotify",
+	})
+	require.Equal(t, 200, response.Code)
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, 1, len(m.Actions))
+	require.Equal(t, "Acknowledge", m.Actions[0].Label)
+	require.Equal(t, "http", m.Actions[0].Action)
+	require.True(t, strings.HasPrefix(m.Actions[0].URL, fmt.Sprintf("http://127.0.0.1:12345/v1/messages/%s/ack?key=", m.ID)))
+
+	// Not acknowledged yet, next step in 5 minutes
+	response = request(t, s, "GET", "/v1/messages/"+m.ID+"/ack", "", nil)
+	require.Equal(t, 200, response.Code)
+	ack, _ := util.UnmarshalJSON[apiMessageAckResponse](io.NopCloser(response.Body))
+	require.Equal(t, int64(0), ack.Acked)
+	require.Equal(t, m.Time+300, ack.Next)
+
+	// Nothing due yet
+	require.Nil(t, s.sendEscalations())
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+
+	// Step 1: Renotify
+	_, err := s.messageCache.db.Exec(`UPDATE escalations SET due = ?`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	require.Nil(t, s.sendEscalations())
+	messages = toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.NotEqual(t, m.ID, messages[1].ID)
+	require.Equal(t, "disk full", messages[1].Message)
+	require.Equal(t, m.Actions[0].URL, messages[1].Actions[0].URL)
+
+	// Step 2: Email
+	_, err = s.messageCache.db.Exec(`UPDATE escalations SET due = ?`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	require.Nil(t, s.sendEscalations())
+	waitFor(t, func() bool {
+		return mailer.Count() == 1
+	})
+
+	// Acknowledge via action button URL, twice
+	ackPath := strings.TrimPrefix(m.Actions[0].URL, "http://127.0.0.1:12345")
+	response = request(t, s, "POST", ackPath, "", nil)
+	require.Equal(t, 200, response.Code)
+	ack, _ = util.UnmarshalJSON[apiMessageAckResponse](io.NopCloser(response.Body))
+	require.True(t, ack.Acked > 0)
+	require.Equal(t, int64(0), ack.Next)
+
+	response = request(t, s, "POST", ackPath, "", nil)
+	require.Equal(t, 200, response.Code)
+
+	// No more steps after ack
+	escalations, err := s.messageCache.EscalationsDue()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(escalations))
+}
+
+func TestServer_Escalate_AckRenotifiedCopy(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	m := toMessage(t, request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"X-Escalate": "5m renotify, 10m renotify",
+	}).Body.String())
+
+	_, err := s.messageCache.db.Exec(`UPDATE escalations SET due = ?`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	require.Nil(t, s.sendEscalations())
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 2, len(messages))
+	copyID := messages[1].ID
+	require.NotEqual(t, m.ID, copyID)
+
+	// Acknowledging the copy acknowledges the original message
+	response := request(t, s, "POST", "/v1/messages/"+copyID+"/ack", "", nil)
+	require.Equal(t, 200, response.Code)
+	ack, _ := util.UnmarshalJSON[apiMessageAckResponse](io.NopCloser(response.Body))
+	require.Equal(t, m.ID, ack.ID)
+	require.True(t, ack.Acked > 0)
+
+	escalations, err := s.messageCache.EscalationsDue()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(escalations))
+}
+
+func TestServer_Escalate_RenotifyMessageLimit(t *testing.T) {
+	c := newTestConfig(t)
+	c.VisitorRequestLimitBurst = 100
+	c.VisitorMessageDailyLimit = 1
+	s := newTestServer(t, c)
+	m := toMessage(t, request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"X-Escalate": "5m renotify",
+	}).Body.String())
+
+	// The publisher has no messages left, so the message is not re-sent
+	_, err := s.messageCache.db.Exec(`UPDATE escalations SET due = ?`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	require.Nil(t, s.sendEscalations())
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, m.ID, messages[0].ID)
+}
+
+func TestServer_Escalate_PublisherDeleted(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	response := request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Escalate":    "5m renotify, 10m renotify",
+	})
+	require.Equal(t, 200, response.Code)
+	require.Nil(t, s.userManager.RemoveUser("phil"))
+	require.Nil(t, s.userManager.RemoveDeletedUsers())
+	_, err := s.userManager.User("phil")
+	require.Equal(t, user.ErrUserNotFound, err)
+
+	// The escalation is stopped, and not retried on every tick
+	_, err = s.messageCache.db.Exec(`UPDATE escalations SET due = ?`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	require.Nil(t, s.sendEscalations())
+	escalations, err := s.messageCache.EscalationsDue()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(escalations))
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+}
+
+func TestServer_Escalate_EmailQuietHoursOfTopicOwner(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddReservation("ben", "backups", user.PermissionReadWrite))
+	setQuietHoursNow(t, s, "ben")
+
+	// Phil publishes, but the e-mail is meant for ben, the owner of the topic
+	response := request(t, s, "PUT", "/backups", "backup failed", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Escalate":    "5m email ben@example.com",
+	})
+	require.Equal(t, 200, response.Code)
+	_, err := s.messageCache.db.Exec(`UPDATE escalations SET due = ?`, time.Now().Add(-time.Second).Unix())
+	require.Nil(t, err)
+	require.Nil(t, s.sendEscalations())
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 0, mailer.Count())
+}
+
+func TestServer_Escalate_AckWithAuth(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AllowAccess("ben", "mytopic", user.PermissionRead))
+
+	response := request(t, s, "PUT", "/mytopic", "disk full", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Escalate":    "5m renotify",
+	})
+	require.Equal(t, 200, response.Code)
+	m := toMessage(t, response.Body.String())
+
+	// Anonymous without key
+	response = request(t, s, "POST", "/v1/messages/"+m.ID+"/ack", "", nil)
+	require.Equal(t, 403, response.Code)
+
+	// Wrong key
+	response = request(t, s, "POST", "/v1/messages/"+m.ID+"/ack?key=wrong", "", nil)
+	require.Equal(t, 403, response.Code)
+
+	// Unknown message
+	response = request(t, s, "POST", "/v1/messages/doesnotexist/ack", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 40402, toHTTPError(t, response.Body.String()).Code)
+
+	// User with read access
+	response = request(t, s, "POST", "/v1/messages/"+m.ID+"/ack", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, response.Code)
+	ack, _ := util.UnmarshalJSON[apiMessageAckResponse](io.NopCloser(response.Body))
+	require.True(t, ack.Acked > 0)
+	require.Equal(t, "ben", ack.AckedBy)
+}
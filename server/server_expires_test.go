@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"testing"
+	"time"
+)
+
+func TestServer_PublishWithExpires(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	// Duration
+	response := request(t, s, "PUT", "/mytopic", "your code is 123456", map[string]string{
+		"X-Expires": "5m",
+	})
+	require.Equal(t, 200, response.Code)
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, m.Time+300, m.Expires)
+
+	// Alias and absolute time
+	expires := time.Now().Add(time.Hour).Unix()
+	response = request(t, s, "PUT", fmt.Sprintf("/mytopic?ttl=%d", expires), "another message", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, expires, toMessage(t, response.Body.String()).Expires)
+
+	// Capped by the message expiry duration (12h)
+	response = request(t, s, "PUT", "/mytopic", "long-lived message", map[string]string{
+		"X-TTL": "3d",
+	})
+	m = toMessage(t, response.Body.String())
+	require.Equal(t, m.Time+12*3600, m.Expires)
+
+	// Relative to the delivery time for delayed messages
+	response = request(t, s, "PUT", "/mytopic", "delayed message", map[string]string{
+		"X-Delay":   "1h",
+		"X-Expires": "10m",
+	})
+	m = toMessage(t, response.Body.String())
+	require.Equal(t, m.Time+600, m.Expires)
+
+	// Invalid
+	for _, value := range []string{"abc", "-5m", "1"} {
+		response = request(t, s, "PUT", "/mytopic", "message", map[string]string{
+			"X-Expires": value,
+		})
+		require.Equal(t, 40056, toHTTPError(t, response.Body.String()).Code, value)
+	}
+}
+
+func TestServer_PublishWithExpires_NotReturnedAfterExpiry(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	response := request(t, s, "PUT", "/mytopic", "your code is 123456", map[string]string{
+		"X-Expires": "1m",
+	})
+	m := toMessage(t, response.Body.String())
+	request(t, s, "PUT", "/mytopic", "regular message", nil)
+
+	// Expired, but not yet pruned: not returned anymore
+	_, err := s.messageCache.db.Exec(`UPDATE messages SET expires = ? WHERE mid = ?`, time.Now().Add(-time.Second).Unix(), m.ID)
+	require.Nil(t, err)
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "regular message", messages[0].Message)
+
+	// Pruned by the manager
+	s.execManager()
+	_, err = s.messageCache.Message(m.ID)
+	require.Equal(t, errMessageNotFound, err)
+}
+
+func TestServer_PublishWithExpires_NoCache(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	response := request(t, s, "PUT", "/mytopic", "your code is 123456", map[string]string{
+		"Cache":     "no",
+		"X-Expires": "30s",
+	})
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, m.Time+30, m.Expires)
+
+	response = request(t, s, "PUT", "/mytopic", "message", map[string]string{
+		"Cache": "no",
+	})
+	require.Equal(t, int64(0), toMessage(t, response.Body.String()).Expires)
+}
+
+func TestServer_PublishWithExpires_TierLimit(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddTier(&user.Tier{
+		Code:                  "test",
+		MessageLimit:          5,
+		MessageExpiryDuration: time.Hour,
+	}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser))
+	require.Nil(t, s.userManager.ChangeTier("phil", "test"))
+
+	response := request(t, s, "PUT", "/mytopic", "message", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Expires":     "2h",
+	})
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, m.Time+3600, m.Expires)
+}
@@ -0,0 +1,387 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+const (
+	feedItemsMax        = 100 // Max. number of messages (newest first) included in a feed
+	feedTitleLengthMax  = 80  // Max. length of an item title derived from the message, if the message has no title
+	rssContentType      = "application/rss+xml"
+	atomContentType     = "application/atom+xml"
+	jsonFeedContentType = "application/feed+json"
+	atomNamespace       = "http://www.w3.org/2005/Atom"
+	jsonFeedVersion     = "https://jsonfeed.org/version/1.1"
+)
+
+var (
+	// feedHTMLPolicy sanitizes the HTML rendered from Markdown messages; policies are safe for concurrent use,
+	// so it is created only once
+	feedHTMLPolicy = bluemonday.UGCPolicy()
+)
+
+// feedRenderer renders the given messages (newest first) as a feed
+type feedRenderer func(info *feedInfo, messages []*message) ([]byte, error)
+
+// feedInfo contains the feed-level information passed to a feedRenderer
+type feedInfo struct {
+	Topics  string // Comma-separated list of topics (and patterns), as in the path
+	BaseURL string
+	HomeURL string // URL of the topic(s) in the web app
+	FeedURL string // URL of the feed itself
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Links      []atomLink     `xml:"link"`
+	Content    atomContent    `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	DatePublished string               `json:"date_published"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	Title       string `json:"title,omitempty"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+func (s *Server) handleSubscribeRSS(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	return s.handleSubscribeFeed(w, r, v, rssContentType, renderRSSFeed)
+}
+
+func (s *Server) handleSubscribeAtom(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	return s.handleSubscribeFeed(w, r, v, atomContentType, renderAtomFeed)
+}
+
+func (s *Server) handleSubscribeJSONFeed(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	return s.handleSubscribeFeed(w, r, v, jsonFeedContentType, renderJSONFeed)
+}
+
+// handleSubscribeFeed renders the cached messages of the topics in the path as a feed (RSS, Atom or JSON Feed), so
+// that topics can be read with standard feed readers. Like poll requests, it returns all cached messages by default,
+// and supports since=... and filters. Only the newest feedItemsMax messages are included, newest first.
+func (s *Server) handleSubscribeFeed(w http.ResponseWriter, r *http.Request, v *visitor, contentType string, render feedRenderer) error {
+	topics, topicsStr, err := s.topicsFromPath(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	patterns, err := s.topicPatternsFromRequest(r, v)
+	if err != nil {
+		return err
+	}
+	since, err := parseSince(r, true)
+	if err != nil {
+		return err
+	} else if err := checkSinceSeq(since, topics, patterns); err != nil {
+		return err
+	}
+	filters, err := parseQueryFilters(r)
+	if err != nil {
+		return err
+	}
+	patternTopics, err := s.cachedTopicsMatchingPatterns(v, patterns, topics)
+	if err != nil {
+		return err
+	}
+	messages := make([]*message, 0)
+	collect := func(_ *visitor, m *message) error {
+		if m.Event == messageEvent && filters.Pass(m) {
+			messages = append(messages, m)
+		}
+		return nil
+	}
+	if err := s.sendOldMessages(append(patternTopics, topics...), since, nil, false, v, collect); err != nil {
+		return err
+	}
+	slices.Reverse(messages) // Newest first
+	if len(messages) > feedItemsMax {
+		messages = messages[:feedItemsMax]
+	}
+	baseURL := s.feedBaseURL(r)
+	info := &feedInfo{
+		Topics:  topicsStr,
+		BaseURL: baseURL,
+		HomeURL: fmt.Sprintf("%s/%s", baseURL, topicsStr),
+		FeedURL: baseURL + r.URL.Path,
+	}
+	b, err := render(info, messages)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Access-Control-Allow-Origin", s.config.AccessControlAllowOrigin) // CORS, allow cross-origin requests
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	_, err = w.Write(b)
+	return err
+}
+
+// feedBaseURL returns the base URL used for the links in feeds. If base-url is not configured, it is derived
+// from the request, since feed readers require absolute URLs.
+func (s *Server) feedBaseURL(r *http.Request) string {
+	if s.config.BaseURL != "" {
+		return strings.TrimSuffix(s.config.BaseURL, "/")
+	} else if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+func renderRSSFeed(info *feedInfo, messages []*message) ([]byte, error) {
+	items := make([]rssItem, 0)
+	for _, m := range messages {
+		item := rssItem{
+			Title:       feedItemTitle(m),
+			Link:        feedItemLink(info, m),
+			Description: feedItemHTML(m),
+			GUID:        rssGUID{IsPermaLink: false, Value: m.ID},
+			PubDate:     time.Unix(m.Time, 0).UTC().Format(time.RFC1123Z),
+			Categories:  m.Tags,
+		}
+		if m.Attachment != nil {
+			item.Enclosure = &rssEnclosure{
+				URL:    m.Attachment.URL,
+				Length: m.Attachment.Size,
+				Type:   feedAttachmentType(m.Attachment),
+			}
+		}
+		items = append(items, item)
+	}
+	feed := &rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         feedTitle(info),
+			Link:          info.HomeURL,
+			Description:   fmt.Sprintf("Messages published to %s", info.Topics),
+			LastBuildDate: feedUpdated(messages).Format(time.RFC1123Z),
+			Items:         items,
+		},
+	}
+	return marshalFeedXML(feed)
+}
+
+func renderAtomFeed(info *feedInfo, messages []*message) ([]byte, error) {
+	entries := make([]atomEntry, 0)
+	for _, m := range messages {
+		date := time.Unix(m.Time, 0).UTC().Format(time.RFC3339)
+		links := []atomLink{{Href: feedItemLink(info, m), Rel: "alternate"}}
+		if m.Attachment != nil {
+			links = append(links, atomLink{
+				Href:   m.Attachment.URL,
+				Rel:    "enclosure",
+				Type:   feedAttachmentType(m.Attachment),
+				Length: m.Attachment.Size,
+			})
+		}
+		categories := make([]atomCategory, 0)
+		for _, tag := range m.Tags {
+			categories = append(categories, atomCategory{Term: tag})
+		}
+		entries = append(entries, atomEntry{
+			Title:      feedItemTitle(m),
+			ID:         fmt.Sprintf("%s/%s#%s", info.BaseURL, m.Topic, m.ID),
+			Updated:    date,
+			Published:  date,
+			Links:      links,
+			Content:    atomContent{Type: "html", Value: feedItemHTML(m)},
+			Categories: categories,
+		})
+	}
+	feed := &atomFeed{
+		XMLNS:   atomNamespace,
+		Title:   feedTitle(info),
+		ID:      info.FeedURL,
+		Updated: feedUpdated(messages).Format(time.RFC3339),
+		Author:  atomAuthor{Name: "ntfy"},
+		Links: []atomLink{
+			{Href: info.HomeURL, Rel: "alternate"},
+			{Href: info.FeedURL, Rel: "self", Type: atomContentType},
+		},
+		Entries: entries,
+	}
+	return marshalFeedXML(feed)
+}
+
+func renderJSONFeed(info *feedInfo, messages []*message) ([]byte, error) {
+	items := make([]jsonFeedItem, 0)
+	for _, m := range messages {
+		item := jsonFeedItem{
+			ID:            m.ID,
+			URL:           feedItemLink(info, m),
+			Title:         m.Title,
+			ContentHTML:   feedItemHTML(m),
+			ContentText:   m.Message,
+			DatePublished: time.Unix(m.Time, 0).UTC().Format(time.RFC3339),
+			Tags:          m.Tags,
+		}
+		if m.Attachment != nil {
+			item.Attachments = []jsonFeedAttachment{{
+				URL:         m.Attachment.URL,
+				MimeType:    feedAttachmentType(m.Attachment),
+				Title:       m.Attachment.Name,
+				SizeInBytes: m.Attachment.Size,
+			}}
+		}
+		items = append(items, item)
+	}
+	return json.Marshal(&jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       feedTitle(info),
+		HomePageURL: info.HomeURL,
+		FeedURL:     info.FeedURL,
+		Items:       items,
+	})
+}
+
+func marshalFeedXML(feed any) ([]byte, error) {
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func feedTitle(info *feedInfo) string {
+	return fmt.Sprintf("ntfy: %s", info.Topics)
+}
+
+// feedItemTitle returns the message title, or the (shortened) first line of the message if it has no title
+func feedItemTitle(m *message) string {
+	if m.Title != "" {
+		return m.Title
+	}
+	title, _, _ := strings.Cut(strings.TrimSpace(m.Message), "\n")
+	if len([]rune(title)) > feedTitleLengthMax {
+		return string([]rune(title)[:feedTitleLengthMax-1]) + "…"
+	}
+	return title
+}
+
+// feedItemLink returns the click action URL of the message, or the URL of its topic in the web app
+func feedItemLink(info *feedInfo, m *message) string {
+	if m.Click != "" && urlRegex.MatchString(m.Click) {
+		return m.Click
+	}
+	return fmt.Sprintf("%s/%s", info.BaseURL, m.Topic)
+}
+
+// feedItemHTML renders the message body as HTML. Markdown messages are rendered and sanitized, plain text
+// messages are escaped, keeping line breaks.
+func feedItemHTML(m *message) string {
+	if m.ContentType == "text/markdown" {
+		rendered := blackfriday.Run([]byte(m.Message))
+		return strings.TrimSpace(string(feedHTMLPolicy.SanitizeBytes(rendered)))
+	}
+	return strings.ReplaceAll(html.EscapeString(m.Message), "\n", "<br>\n")
+}
+
+func feedAttachmentType(a *attachment) string {
+	if a.Type != "" {
+		return a.Type
+	}
+	return "application/octet-stream"
+}
+
+// feedUpdated returns the time of the newest message, or the current time if there are no messages
+func feedUpdated(messages []*message) time.Time {
+	if len(messages) == 0 {
+		return time.Now().UTC()
+	}
+	return time.Unix(messages[0].Time, 0).UTC()
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_Feed_RSS(t *testing.T) {
+	c := newTestConfig(t)
+	c.BaseURL = "https://ntfy.example.com"
+	s := newTestServer(t, c)
+	request(t, s, "PUT", "/mytopic", "first message\nsecond line", nil)
+	request(t, s, "PUT", "/mytopic", "**bold** <script>alert(1)</script>", map[string]string{
+		"Title":    "Backup done",
+		"Tags":     "backup,server",
+		"Markdown": "yes",
+		"Attach":   "https://example.com/backup.log",
+	})
+
+	response := request(t, s, "GET", "/mytopic/rss", "", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "application/rss+xml; charset=utf-8", response.Header().Get("Content-Type"))
+
+	var feed rssFeed
+	require.Nil(t, xml.Unmarshal(response.Body.Bytes(), &feed))
+	require.Equal(t, "2.0", feed.Version)
+	require.Equal(t, "ntfy: mytopic", feed.Channel.Title)
+	require.Equal(t, "https://ntfy.example.com/mytopic", feed.Channel.Link)
+	require.Equal(t, 2, len(feed.Channel.Items))
+
+	// Newest first
+	item := feed.Channel.Items[0]
+	require.Equal(t, "Backup done", item.Title)
+	require.Equal(t, "<p><strong>bold</strong> </p>", item.Description)
+	require.Equal(t, []string{"backup", "server"}, item.Categories)
+	require.NotNil(t, item.Enclosure)
+	require.Equal(t, "https://example.com/backup.log", item.Enclosure.URL)
+	require.NotEmpty(t, item.GUID.Value)
+
+	item = feed.Channel.Items[1]
+	require.Equal(t, "first message", item.Title)
+	require.Equal(t, "first message<br>\nsecond line", item.Description)
+	require.Nil(t, item.Enclosure)
+}
+
+func TestServer_Feed_Atom(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	m := toMessage(t, request(t, s, "PUT", "/mytopic", "some message", map[string]string{"Tags": "warning"}).Body.String())
+
+	response := request(t, s, "GET", "/mytopic/atom", "", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "application/atom+xml; charset=utf-8", response.Header().Get("Content-Type"))
+
+	var feed atomFeed
+	require.Nil(t, xml.Unmarshal(response.Body.Bytes(), &feed))
+	require.Equal(t, "ntfy: mytopic", feed.Title)
+	require.Equal(t, 1, len(feed.Entries))
+	require.Equal(t, "some message", feed.Entries[0].Title)
+	require.Equal(t, "some message", feed.Entries[0].Content.Value)
+	require.Equal(t, []atomCategory{{Term: "warning"}}, feed.Entries[0].Categories)
+	require.True(t, strings.HasSuffix(feed.Entries[0].ID, "#"+m.ID))
+	require.True(t, strings.HasPrefix(feed.ID, "http://")) // Derived from request, no base-url set
+}
+
+func TestServer_Feed_JSONFeed(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	request(t, s, "PUT", "/mytopic", "message 1", nil)
+	request(t, s, "PUT", "/othertopic", "message 2", map[string]string{"Title": "Hi"})
+	request(t, s, "PUT", "/mytopic", "message 3", map[string]string{"Priority": "high"})
+
+	response := request(t, s, "GET", "/mytopic,othertopic/feed.json?priority=high,default", "", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "application/feed+json; charset=utf-8", response.Header().Get("Content-Type"))
+
+	var feed jsonFeed
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&feed))
+	require.Equal(t, "https://jsonfeed.org/version/1.1", feed.Version)
+	require.Equal(t, 3, len(feed.Items))
+	require.ElementsMatch(t, []string{"message 1", "message 2", "message 3"}, []string{feed.Items[0].ContentText, feed.Items[1].ContentText, feed.Items[2].ContentText})
+
+	response = request(t, s, "GET", "/mytopic/feed.json", "", nil)
+	feed = jsonFeed{}
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&feed))
+	require.Equal(t, 2, len(feed.Items))
+	require.Equal(t, "message 3", feed.Items[0].ContentText) // Newest first
+	require.Equal(t, "message 1", feed.Items[1].ContentText)
+
+	response = request(t, s, "GET", "/othertopic/feed.json?priority=high", "", nil)
+	feed = jsonFeed{}
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&feed))
+	require.Equal(t, 0, len(feed.Items))
+}
+
+func TestServer_Feed_AccessControl(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	request(t, s, "PUT", "/private", "secret", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+
+	response := request(t, s, "GET", "/private/rss", "", nil)
+	require.Equal(t, 403, response.Code)
+
+	// Feed readers often cannot set headers, so the auth query parameter is supported as well
+	response = request(t, s, "GET", "/private/rss?auth="+base64.RawURLEncoding.EncodeToString([]byte(util.BasicAuth("phil", "phil"))), "", nil)
+	require.Equal(t, 200, response.Code)
+	require.Contains(t, response.Body.String(), "secret")
+}
+
+func TestServer_Feed_TopicPattern(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServerWithTopicPatterns(t, c)
+	require.Nil(t, s.userManager.AddUser("admin", "admin", user.RoleAdmin))
+	require.Nil(t, s.userManager.ResetAccess("phil", "alerts-*"))
+	require.Nil(t, s.userManager.AllowAccess("phil", "alerts-disk", user.PermissionRead))
+	require.Nil(t, s.userManager.AllowAccess(user.Everyone, "alerts-public", user.PermissionRead))
+	admin := map[string]string{
+		"Authorization": util.BasicAuth("admin", "admin"),
+	}
+	request(t, s, "PUT", "/alerts-disk", "disk full", admin)
+	request(t, s, "PUT", "/alerts-public", "public alert", admin)
+	request(t, s, "PUT", "/other", "other topic", admin)
+
+	// Feeds follow the same rules as other pattern subscriptions
+	response := request(t, s, "GET", "/alerts-*/rss", "", nil)
+	require.Equal(t, 40103, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "GET", "/*/atom?"+topicPatternAuthParam(), "", nil)
+	require.Equal(t, 40066, toHTTPError(t, response.Body.String()).Code)
+
+	// Only topics with an explicit grant are included, not topics readable by everyone
+	response = request(t, s, "GET", "/alerts-*/feed.json?"+topicPatternAuthParam(), "", nil)
+	require.Equal(t, 200, response.Code)
+	var feed jsonFeed
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&feed))
+	require.Equal(t, 1, len(feed.Items))
+	require.Contains(t, feed.Items[0].ContentHTML, "disk full")
+}
+
+func TestFeedItemTitle(t *testing.T) {
+	require.Equal(t, "some title", feedItemTitle(&message{Title: "some title", Message: "message"}))
+	require.Equal(t, "first line", feedItemTitle(&message{Message: "  first line\nsecond line"}))
+	require.Equal(t, strings.Repeat("a", feedTitleLengthMax-1)+"…", feedItemTitle(&message{Message: strings.Repeat("a", 200)}))
+}
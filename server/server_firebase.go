@@ -11,6 +11,7 @@ import (
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
 	"strings"
+	"time"
 )
 
 const (
@@ -184,10 +185,23 @@ func toFirebaseMessage(m *message, auther user.Auther) (*messaging.Message, erro
 			// TODO Handle APNS?
 		}
 	}
+	// Only pass on the expiry time if the publisher asked for it; the default cache expiry is not a reason
+	// for Firebase to drop a notification for a device that is offline
+	expires := m.ExpiresExplicit && m.Expires > 0
 	var androidConfig *messaging.AndroidConfig
-	if m.Priority >= 4 {
-		androidConfig = &messaging.AndroidConfig{
-			Priority: "high",
+	if m.Priority >= 4 || expires {
+		androidConfig = &messaging.AndroidConfig{}
+		if m.Priority >= 4 {
+			androidConfig.Priority = "high"
+		}
+		if expires {
+			ttl := max(time.Until(time.Unix(m.Expires, 0)).Truncate(time.Second), 0)
+			androidConfig.TTL = &ttl
+		}
+	}
+	if apnsConfig != nil && expires {
+		apnsConfig.Headers = map[string]string{
+			"apns-expiration": fmt.Sprintf("%d", m.Expires),
 		}
 	}
 	return maybeTruncateFCMMessage(&messaging.Message{
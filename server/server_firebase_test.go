@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"firebase.google.com/go/v4/messaging"
 	"github.com/stretchr/testify/require"
@@ -343,3 +344,42 @@ func TestToFirebaseSender_Abuse(t *testing.T) {
 	require.Equal(t, errFirebaseTemporarilyBanned, client.Send(visitor, &message{Topic: "mytopic"}))
 	require.Equal(t, 0, len(sender.Messages()))
 }
+
+func TestToFirebaseMessage_Message_Expires(t *testing.T) {
+	m := newDefaultMessage("mytopic", "your code is 123456")
+	m.Expires = time.Now().Add(5 * time.Minute).Unix()
+	m.ExpiresExplicit = true
+	fbm, err := toFirebaseMessage(m, &testAuther{Allow: true})
+	require.Nil(t, err)
+	require.NotNil(t, fbm.Android.TTL)
+	require.True(t, *fbm.Android.TTL > 4*time.Minute && *fbm.Android.TTL <= 5*time.Minute)
+	require.Equal(t, "", fbm.Android.Priority)
+	require.Equal(t, fmt.Sprintf("%d", m.Expires), fbm.APNS.Headers["apns-expiration"])
+}
+
+func TestToFirebaseMessage_Message_DefaultExpires(t *testing.T) {
+	m := newDefaultMessage("mytopic", "this is a message")
+	m.Expires = time.Now().Add(12 * time.Hour).Unix() // Cache expiry, not passed by the publisher
+	fbm, err := toFirebaseMessage(m, &testAuther{Allow: true})
+	require.Nil(t, err)
+	require.Nil(t, fbm.Android)
+	require.Nil(t, fbm.APNS.Headers)
+}
+
+func TestServer_PublishWithExpires_Persisted(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	response := request(t, s, "PUT", "/mytopic", "code 123", map[string]string{
+		"X-Expires": "10m",
+		"X-Delay":   "30m",
+	})
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "PUT", "/mytopic", "no expiry", map[string]string{
+		"X-Delay": "30m",
+	})
+	require.Equal(t, 200, response.Code)
+	messages, err := s.messageCache.Messages("mytopic", sinceAllMessages, true)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+	require.True(t, messages[0].ExpiresExplicit)
+	require.False(t, messages[1].ExpiresExplicit)
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	heartbeatIntervalMin   = time.Minute
+	heartbeatIntervalMax   = 30 * 24 * time.Hour
+	heartbeatAlertTag      = "rotating_light"
+	heartbeatRecoveryTag   = "white_check_mark"
+	heartbeatAlertPriority = 4
+)
+
+// handleHeartbeat registers or pings the heartbeat of a topic. The first ping must define the interval, subsequent
+// pings may change the interval and messages. Pings do not publish messages, unless the heartbeat was overdue, in
+// which case the recovery message is published to the topic.
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	if s.config.CacheDuration == 0 {
+		return errHTTPBadRequestHeartbeatNoCache
+	}
+	t, err := fromContext[*topic](r, contextTopic)
+	if err != nil {
+		return err
+	}
+	h, err := s.messageCache.Heartbeat(t.ID)
+	if errors.Is(err, errHeartbeatNotFound) {
+		h = &heartbeat{Topic: t.ID}
+	} else if err != nil {
+		return err
+	}
+	if value := readParam(r, "x-interval", "interval"); value != "" {
+		interval, err := util.ParseDuration(value)
+		if err != nil || interval < heartbeatIntervalMin || interval > heartbeatIntervalMax {
+			return errHTTPBadRequestHeartbeatInvalid.With(t)
+		}
+		h.Interval = int64(interval.Seconds())
+	} else if h.Interval == 0 {
+		return errHTTPBadRequestHeartbeatInvalid.With(t)
+	}
+	if message := readParam(r, "x-message", "message", "m"); message != "" {
+		h.Message = message
+	}
+	if recovery := readParam(r, "x-recovery-message", "recovery-message", "recovery"); recovery != "" {
+		h.RecoveryMessage = recovery
+	}
+	h.LastPing = time.Now().Unix()
+	h.Sender = v.IP()
+	if u := v.User(); u != nil {
+		h.User = u.ID
+	}
+	recovered, err := s.messageCache.PingHeartbeat(h)
+	if err != nil {
+		return err
+	}
+	ev := logvr(v, r).Tag(tagPublish).With(t).Field("heartbeat_interval", h.Interval)
+	if recovered {
+		ev.Info("Heartbeat recovered, publishing recovery message")
+		if err := s.publishHeartbeatMessage(v, newHeartbeatRecoveryMessage(h)); err != nil {
+			return err
+		}
+	} else if ev.IsTrace() {
+		ev.Trace("Heartbeat received")
+	}
+	return s.writeJSON(w, newHeartbeatResponse(h))
+}
+
+func (s *Server) handleHeartbeatDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	t, err := fromContext[*topic](r, contextTopic)
+	if err != nil {
+		return err
+	}
+	if _, err := s.messageCache.Heartbeat(t.ID); errors.Is(err, errHeartbeatNotFound) {
+		return errHTTPNotFoundHeartbeat.With(t)
+	} else if err != nil {
+		return err
+	}
+	if err := s.messageCache.DeleteHeartbeat(t.ID); err != nil {
+		return err
+	}
+	logvr(v, r).Tag(tagPublish).With(t).Debug("Heartbeat removed")
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// checkHeartbeats publishes an alert message for every heartbeat that has not been pinged within its interval.
+// It is called by the manager, so heartbeats are evaluated every ManagerInterval. Since the state is stored in the
+// message cache, overdue heartbeats are also detected after a restart.
+func (s *Server) checkHeartbeats() {
+	heartbeats, err := s.messageCache.HeartbeatsOverdue()
+	if err != nil {
+		log.Tag(tagManager).Err(err).Warn("Error retrieving overdue heartbeats")
+		return
+	}
+	for _, h := range heartbeats {
+		if err := s.sendHeartbeatAlert(h); err != nil {
+			log.Tag(tagManager).Field("topic", h.Topic).Err(err).Warn("Error sending heartbeat alert")
+		}
+	}
+}
+
+func (s *Server) sendHeartbeatAlert(h *heartbeat) error {
+	marked, err := s.messageCache.MarkHeartbeatOverdue(h.Topic)
+	if err != nil {
+		return err
+	} else if !marked {
+		return nil // Pinged in the meantime
+	}
+	var u *user.User
+	if s.userManager != nil && h.User != "" {
+		u, err = s.userManager.UserByID(h.User)
+		if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+			return err
+		}
+	}
+	v := s.visitor(h.Sender, u)
+	m := newHeartbeatAlertMessage(h)
+	logvm(v, m).
+		Tag(tagManager).
+		Field("heartbeat_interval", h.Interval).
+		Info("Heartbeat overdue, publishing alert message")
+	return s.publishHeartbeatMessage(v, m)
+}
+
+// publishHeartbeatMessage publishes an alert or recovery message. Like any other published message, the message
+// expires according to the limits of the visitor that registered the heartbeat, and the settings of the topic.
+func (s *Server) publishHeartbeatMessage(v *visitor, m *message) error {
+	m.Expires = time.Unix(m.Time, 0).Add(v.Limits().MessageExpiryDuration).Unix()
+	settings, err := s.topicSettings(m.Topic)
+	if err != nil {
+		return err
+	} else if settings != nil {
+		applyTopicSettings(m, settings)
+	}
+	return s.publishFromServer(v, m)
+}
+
+func newHeartbeatAlertMessage(h *heartbeat) *message {
+	m := newDefaultMessage(h.Topic, h.Message)
+	if m.Message == "" {
+		m.Message = fmt.Sprintf("No heartbeat received in the last %s", formatHeartbeatInterval(h.Interval))
+	}
+	m.Priority = heartbeatAlertPriority
+	m.Tags = []string{heartbeatAlertTag}
+	m.User = h.User
+	m.Sender = h.Sender
+	return m
+}
+
+func newHeartbeatRecoveryMessage(h *heartbeat) *message {
+	m := newDefaultMessage(h.Topic, h.RecoveryMessage)
+	if m.Message == "" {
+		m.Message = "Heartbeat received again"
+	}
+	m.Tags = []string{heartbeatRecoveryTag}
+	m.User = h.User
+	m.Sender = h.Sender
+	return m
+}
+
+func newHeartbeatResponse(h *heartbeat) *apiHeartbeatResponse {
+	return &apiHeartbeatResponse{
+		Topic:    h.Topic,
+		Interval: h.Interval,
+		LastPing: h.LastPing,
+		NextDue:  h.LastPing + h.Interval,
+		Overdue:  h.Overdue,
+	}
+}
+
+// formatHeartbeatInterval formats an interval in seconds as a short duration, e.g. "10m" or "1h30m"
+func formatHeartbeatInterval(seconds int64) string {
+	s := (time.Duration(seconds) * time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
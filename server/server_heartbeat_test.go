@@ -0,0 +1,119 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestServer_Heartbeat_OverdueAndRecovery(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	// First ping requires an interval
+	response := request(t, s, "POST", "/backups/heartbeat", "", nil)
+	require.Equal(t, 40050, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/backups/heartbeat?interval=10s", "", nil)
+	require.Equal(t, 40050, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "POST", "/backups/heartbeat", "", map[string]string{
+		"X-Interval": "10m",
+		"X-Message":  "Backup did not run",
+	})
+	require.Equal(t, 200, response.Code)
+	hb, _ := util.UnmarshalJSON[apiHeartbeatResponse](io.NopCloser(response.Body))
+	require.Equal(t, "backups", hb.Topic)
+	require.Equal(t, int64(600), hb.Interval)
+	require.Equal(t, hb.LastPing+600, hb.NextDue)
+	require.False(t, hb.Overdue)
+
+	// Subsequent pings keep the interval, and do not publish messages
+	response = request(t, s, "GET", "/backups/heartbeat", "", nil)
+	require.Equal(t, 200, response.Code)
+	s.checkHeartbeats()
+	messages := toMessages(t, request(t, s, "GET", "/backups/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 0, len(messages))
+
+	// Overdue: alert is published once
+	_, err := s.messageCache.db.Exec(`UPDATE heartbeats SET last_ping = ?`, time.Now().Add(-11*time.Minute).Unix())
+	require.Nil(t, err)
+	s.checkHeartbeats()
+	s.checkHeartbeats()
+	messages = toMessages(t, request(t, s, "GET", "/backups/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "Backup did not run", messages[0].Message)
+	require.Equal(t, 4, messages[0].Priority)
+	require.Equal(t, []string{"rotating_light"}, messages[0].Tags)
+
+	// Ping again: recovery message is published
+	response = request(t, s, "POST", "/backups/heartbeat", "", nil)
+	require.Equal(t, 200, response.Code)
+	messages = toMessages(t, request(t, s, "GET", "/backups/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "Heartbeat received again", messages[1].Message)
+	require.Equal(t, []string{"white_check_mark"}, messages[1].Tags)
+
+	// Delete
+	response = request(t, s, "DELETE", "/backups/heartbeat", "", nil)
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "DELETE", "/backups/heartbeat", "", nil)
+	require.Equal(t, 40403, toHTTPError(t, response.Body.String()).Code)
+}
+
+func TestServer_Heartbeat_SurvivesRestart(t *testing.T) {
+	c := newTestConfig(t)
+	s := newTestServer(t, c)
+	response := request(t, s, "PUT", "/backups/heartbeat?interval=5m", "", nil)
+	require.Equal(t, 200, response.Code)
+	_, err := s.messageCache.db.Exec(`UPDATE heartbeats SET last_ping = ?`, time.Now().Add(-time.Hour).Unix())
+	require.Nil(t, err)
+	s.closeDatabases()
+
+	s = newTestServer(t, c)
+	s.execManager()
+	messages := toMessages(t, request(t, s, "GET", "/backups/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "No heartbeat received in the last 5m", messages[0].Message)
+}
+
+func TestServer_Heartbeat_MessagesExpire(t *testing.T) {
+	c := newTestConfig(t)
+	c.CacheDuration = time.Hour
+	s := newTestServer(t, c)
+	response := request(t, s, "PUT", "/backups/heartbeat?interval=5m", "", nil)
+	require.Equal(t, 200, response.Code)
+	_, err := s.messageCache.db.Exec(`UPDATE heartbeats SET last_ping = ?`, time.Now().Add(-time.Hour).Unix())
+	require.Nil(t, err)
+	s.checkHeartbeats()
+	response = request(t, s, "PUT", "/backups/heartbeat", "", nil)
+	require.Equal(t, 200, response.Code)
+
+	// Alert and recovery message survive the pruning of expired messages, and expire like any other message
+	s.execManager()
+	messages := toMessages(t, request(t, s, "GET", "/backups/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "No heartbeat received in the last 5m", messages[0].Message)
+	require.Equal(t, messages[0].Time+3600, messages[0].Expires)
+	require.Equal(t, "Heartbeat received again", messages[1].Message)
+	require.Equal(t, messages[1].Time+3600, messages[1].Expires)
+}
+
+func TestServer_Heartbeat_NoWriteAccess(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionRead
+	s := newTestServer(t, c)
+
+	response := request(t, s, "PUT", "/backups/heartbeat?interval=5m", "", nil)
+	require.Equal(t, 403, response.Code)
+}
+
+func TestServer_Heartbeat_NoCache(t *testing.T) {
+	c := newTestConfig(t)
+	c.CacheDuration = 0
+	s := newTestServer(t, c)
+
+	response := request(t, s, "PUT", "/backups/heartbeat?interval=5m", "", nil)
+	require.Equal(t, 40051, toHTTPError(t, response.Body.String()).Code)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"heckel.io/ntfy/v2/util"
+)
+
+// longPoll handles long-poll requests (e.g. /mytopic/json?poll=1&wait=60s). It returns the cached messages right away
+// if there are any. Otherwise, it waits until at least one new message arrives, or the wait time expires.
+//
+// Unlike streaming subscriptions, new messages are not written to the response as they arrive. They are collected
+// by the subscriber queue, and written once the wait is over, so that no message is written twice, even if it was
+// published while the cached messages were read.
+func (s *Server) longPoll(r *http.Request, v *visitor, topics []*topic, patterns []string, wait time.Duration, filters *queryFilter, sub subscriber, sendOldMessages func(sub subscriber) error) error {
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	var mu sync.Mutex
+	received := make([]*message, 0)
+	notify := make(chan struct{}, 1)
+	collect := func(_ *visitor, m *message) error {
+		if m.Event != messageEvent || !filters.Pass(m) {
+			return nil
+		}
+		mu.Lock()
+		received = append(received, m)
+		mu.Unlock()
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	// Subscribe before reading the cache, so that we don't miss messages published in between
+	queue := newSubscriberQueue(s.topicPatternSubscriber(v, patterns, isTopicInFunc(topics), collect), cancel, s.config.SubscriberQueueSize, s.config.SubscriberQueueOverflowPolicy)
+	defer queue.Close()
+	go queue.Run()
+	subscriberIDs := make([]int, 0)
+	for _, t := range topics {
+		subscriberIDs = append(subscriberIDs, t.Subscribe(queue, v.MaybeUserID(), cancel))
+	}
+	defer func() {
+		for i, subscriberID := range subscriberIDs {
+			topics[i].Unsubscribe(subscriberID) // Order!
+		}
+	}()
+	defer s.subscribeTopicPatterns(patterns, isTopicInFunc(topics), queue, v.MaybeUserID(), cancel)()
+
+	// Return cached messages right away, if there are any
+	sent := 0
+	err := sendOldMessages(func(v *visitor, m *message) error {
+		if m.Event == messageEvent && filters.Pass(m) {
+			sent++
+		}
+		return sub(v, m)
+	})
+	if err != nil || sent > 0 {
+		return err
+	}
+
+	// Otherwise, wait for new messages
+	logvr(v, r).Tag(tagSubscribe).Trace("No cached messages, waiting up to %s for new messages", wait)
+	select {
+	case <-notify:
+	case <-ctx.Done():
+		return nil
+	}
+	mu.Lock()
+	messages := received
+	received = nil
+	mu.Unlock()
+	for _, m := range messages {
+		if err := sub(v, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLongPollWait parses the "wait=..." parameter of long-poll requests (e.g. wait=60s), and returns zero if it is
+// not set. It can only be used in combination with poll=1.
+func parseLongPollWait(r *http.Request, poll bool) (time.Duration, error) {
+	waitStr := readParam(r, "x-wait", "wait")
+	if waitStr == "" {
+		return 0, nil
+	} else if !poll {
+		return 0, errHTTPBadRequestLongPollWaitInvalid
+	}
+	wait, err := util.ParseDuration(waitStr)
+	if err != nil || wait < 0 || wait > longPollWaitMax {
+		return 0, errHTTPBadRequestLongPollWaitInvalid
+	}
+	return wait, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer_LongPoll_CachedMessages(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	request(t, s, "PUT", "/mytopic", "message 1", nil)
+
+	start := time.Now()
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1&wait=5s", "", nil).Body.String())
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "message 1", messages[0].Message)
+}
+
+func TestServer_LongPoll_WaitForNewMessage(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	m := toMessage(t, request(t, s, "PUT", "/mytopic", "message 1", nil).Body.String())
+
+	rr := httptest.NewRecorder()
+	done := make(chan bool)
+	go func() {
+		rr = request(t, s, "GET", "/mytopic/json?poll=1&wait=5s&since="+m.ID, "", nil)
+		done <- true
+	}()
+	time.Sleep(200 * time.Millisecond)
+	request(t, s, "PUT", "/mytopic", "message 2", nil)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("long-poll request did not return after new message")
+	}
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "message 2", messages[0].Message)
+}
+
+func TestServer_LongPoll_FilteredMessagesDoNotEndWait(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	rr := httptest.NewRecorder()
+	done := make(chan bool)
+	go func() {
+		rr = request(t, s, "GET", "/mytopic/json?poll=1&since=none&wait=5s&priority=high", "", nil)
+		done <- true
+	}()
+	time.Sleep(200 * time.Millisecond)
+	request(t, s, "PUT", "/mytopic", "low priority", nil)
+	time.Sleep(200 * time.Millisecond)
+	request(t, s, "PUT", "/mytopic", "high priority", map[string]string{"Priority": "high"})
+	<-done
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "high priority", messages[0].Message)
+}
+
+func TestServer_LongPoll_Timeout(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	start := time.Now()
+	response := request(t, s, "GET", "/mytopic/json?poll=1&since=none&wait=300ms", "", nil)
+	require.Equal(t, 200, response.Code)
+	require.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	require.Empty(t, response.Body.String())
+}
+
+func TestServer_LongPoll_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "GET", "/mytopic/json?poll=1&wait=10m", "", nil)
+	require.Equal(t, 40063, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "GET", "/mytopic/json?poll=1&wait=invalid", "", nil)
+	require.Equal(t, 40063, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "GET", "/mytopic/json?wait=10s", "", nil)
+	require.Equal(t, 40063, toHTTPError(t, response.Body.String()).Code)
+}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
 	"strings"
+	"time"
 )
 
 func (s *Server) execManager() {
@@ -13,10 +15,16 @@ func (s *Server) execManager() {
 	// Prune all the things
 	s.pruneVisitors()
 	s.pruneTokens()
+	s.pruneAccess()
+	s.pruneScheduleOverrides()
+	s.pruneAuditLog()
 	s.pruneAttachments()
 	s.pruneMessages()
 	s.pruneAndNotifyWebPushSubscriptions()
 
+	// Publish alerts for overdue heartbeats
+	s.checkHeartbeats()
+
 	// Message count per topic
 	var messagesCached int
 	messageCounts, err := s.messageCache.MessageCounts()
@@ -33,24 +41,23 @@ func (s *Server) execManager() {
 	log.
 		Tag(tagManager).
 		Timing(func() {
-			s.mu.Lock()
-			defer s.mu.Unlock()
-			for _, t := range s.topics {
+			// Only one shard of the registry is locked at a time, so publishers and subscribers of
+			// topics in other shards are not blocked while the topics are pruned
+			emptyTopics = s.topics.DeleteFunc(func(_ string, t *topic) bool {
 				subs, lastAccess := t.Stats()
 				ev := log.Tag(tagManager).With(t)
 				if t.Stale() {
 					if ev.IsTrace() {
 						ev.Trace("- topic %s: Deleting stale topic (%d subscribers, accessed %s)", t.ID, subs, util.FormatTime(lastAccess))
 					}
-					emptyTopics++
-					delete(s.topics, t.ID)
-				} else {
-					if ev.IsTrace() {
-						ev.Trace("- topic %s: %d subscribers, accessed %s", t.ID, subs, util.FormatTime(lastAccess))
-					}
-					subscribers += subs
+					return true
 				}
-			}
+				if ev.IsTrace() {
+					ev.Trace("- topic %s: %d subscribers, accessed %s", t.ID, subs, util.FormatTime(lastAccess))
+				}
+				subscribers += subs
+				return false
+			})
 		}).
 		Debug("Removed %d empty topic(s)", emptyTopics)
 
@@ -75,8 +82,9 @@ func (s *Server) execManager() {
 
 	// Print stats
 	s.mu.RLock()
-	messagesCount, topicsCount, visitorsCount := s.messages, len(s.topics), len(s.visitors)
+	messagesCount := s.messages
 	s.mu.RUnlock()
+	topicsCount, visitorsCount := s.topics.Len(), s.visitors.Len()
 
 	// Update stats
 	s.updateAndWriteStats(messagesCount)
@@ -111,15 +119,13 @@ func (s *Server) pruneVisitors() {
 	log.
 		Tag(tagManager).
 		Timing(func() {
-			s.mu.Lock()
-			defer s.mu.Unlock()
-			for ip, v := range s.visitors {
+			staleVisitors = s.visitors.DeleteFunc(func(_ string, v *visitor) bool {
 				if v.Stale() {
 					log.Tag(tagManager).With(v).Trace("Deleting stale visitor")
-					delete(s.visitors, ip)
-					staleVisitors++
+					return true
 				}
-			}
+				return false
+			})
 		}).
 		Field("stale_visitors", staleVisitors).
 		Debug("Deleted %d stale visitor(s)", staleVisitors)
@@ -141,6 +147,66 @@ func (s *Server) pruneTokens() {
 	}
 }
 
+func (s *Server) pruneAccess() {
+	if s.userManager != nil {
+		log.
+			Tag(tagManager).
+			Timing(func() {
+				expired, err := s.userManager.RemoveExpiredAccess()
+				if err != nil {
+					log.Tag(tagManager).Err(err).Warn("Error expiring access control entries")
+					return
+				}
+				for userID, grants := range expired {
+					u, err := s.userManager.UserByID(userID)
+					if err != nil {
+						log.Tag(tagManager).Err(err).Warn("Error looking up user %s for expired access control entries", userID)
+						continue
+					} else if u.Name == user.Everyone {
+						u = &user.User{Name: user.Everyone} // Anonymous subscribers are registered without user ID
+					}
+					for _, grant := range grants {
+						log.Tag(tagManager).Debug("Access control entry for user %s and topic %s expired", u.Name, grant.TopicPattern)
+						if err := s.killUserSubscriber(u, grant.TopicPattern); err != nil {
+							log.Tag(tagManager).Err(err).Warn("Error killing subscribers of user %s", u.Name)
+						}
+					}
+				}
+			}).
+			Debug("Removed expired access control entries")
+	}
+}
+
+func (s *Server) pruneScheduleOverrides() {
+	if s.userManager != nil {
+		log.
+			Tag(tagManager).
+			Timing(func() {
+				if err := s.userManager.RemoveExpiredScheduleOverrides(); err != nil {
+					log.Tag(tagManager).Err(err).Warn("Error removing expired schedule overrides")
+				}
+			}).
+			Debug("Removed expired schedule overrides")
+	}
+}
+
+func (s *Server) pruneAuditLog() {
+	if s.userManager == nil || s.config.AuthAuditRetention == 0 {
+		return
+	}
+	log.
+		Tag(tagManager).
+		Timing(func() {
+			removed, err := s.userManager.RemoveAuditEntriesBefore(time.Now().Add(-s.config.AuthAuditRetention))
+			if err != nil {
+				log.Tag(tagManager).Err(err).Warn("Error removing old audit log entries")
+			} else if removed > 0 {
+				log.Tag(tagManager).Debug("Removed %d audit log entries older than %s", removed, s.config.AuthAuditRetention)
+			}
+		}).
+		Debug("Removed old audit log entries")
+}
+
 func (s *Server) pruneAttachments() {
 	if s.fileCache == nil {
 		return
@@ -168,10 +234,53 @@ func (s *Server) pruneAttachments() {
 		Debug("Deleted expired attachments")
 }
 
+// applyKeepLastRetention enforces the keep-last retention of the server (see Config.CacheKeepLast) for all topics,
+// and the keep-last retention of the owner's tier for reserved topics. It runs before the topic settings are
+// applied, so that the retention and message limit of a topic always win.
+func (s *Server) applyKeepLastRetention() {
+	overrides := make(map[string]int64)
+	if s.userManager != nil {
+		var err error
+		if overrides, err = s.userManager.ReservationsKeepLast(); err != nil {
+			log.Tag(tagManager).Err(err).Warn("Error retrieving keep-last retention of reserved topics")
+			overrides = make(map[string]int64)
+		}
+	}
+	topicsByKeep := make(map[int64][]string)
+	overrideTopics := make([]string, 0, len(overrides))
+	for topic, keep := range overrides {
+		topicsByKeep[keep] = append(topicsByKeep[keep], topic)
+		overrideTopics = append(overrideTopics, topic)
+	}
+	if s.config.CacheKeepLast > 0 {
+		if err := s.keepLastMessages(int64(s.config.CacheKeepLast), overrideTopics, true); err != nil {
+			log.Tag(tagManager).Err(err).Warn("Error applying keep-last retention")
+		}
+	}
+	for keep, topics := range topicsByKeep {
+		if err := s.keepLastMessages(keep, topics, false); err != nil {
+			log.Tag(tagManager).Err(err).Warn("Error applying keep-last retention of tier")
+		}
+	}
+}
+
+// keepLastMessages retains (cache-keep-last-mode "keep") or caps (mode "cap") the newest keep messages of the given
+// topics, or of all topics except the given ones if exclude is set. Retained messages are kept until after the next
+// manager run, at which point their expiry is extended again.
+func (s *Server) keepLastMessages(keep int64, topics []string, exclude bool) error {
+	if s.config.CacheKeepLastMode == KeepLastModeCap {
+		return s.messageCache.ExpireMessagesBeyondLast(keep, topics, exclude)
+	}
+	until := time.Now().Add(2 * s.config.ManagerInterval).Unix()
+	return s.messageCache.KeepLastMessages(keep, until, topics, exclude)
+}
+
 func (s *Server) pruneMessages() {
 	log.
 		Tag(tagManager).
 		Timing(func() {
+			s.applyKeepLastRetention()
+			s.expireMessagesForTopicSettings()
 			expiredMessageIDs, err := s.messageCache.MessagesExpired()
 			if err != nil {
 				log.Tag(tagManager).Err(err).Warn("Error retrieving expired messages")
@@ -187,6 +296,13 @@ func (s *Server) pruneMessages() {
 			} else {
 				log.Tag(tagManager).Debug("No expired messages to delete")
 			}
+			if err := s.messageCache.DeleteExpiredDedups(); err != nil {
+				log.Tag(tagManager).Err(err).Warn("Error deleting expired deduplication entries")
+			}
+			if err := s.messageCache.DeleteStaleConsumers(time.Now().Add(-consumerExpiryDuration)); err != nil {
+				log.Tag(tagManager).Err(err).Warn("Error deleting stale consumer cursors")
+			}
+			s.dedupIndex.Prune()
 		}).
 		Debug("Pruned messages")
 }
@@ -1,8 +1,12 @@
 package server
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
 	"testing"
+	"time"
 )
 
 func TestServer_Manager_Prune_Messages_Without_Attachments_DoesNotPanic(t *testing.T) {
@@ -26,3 +30,59 @@ func TestServer_Manager_Prune_Messages_Without_Attachments_DoesNotPanic(t *testi
 	_, err := s.messageCache.Message(m.ID)
 	require.Equal(t, errMessageNotFound, err)
 }
+
+func TestServer_Manager_KeepLast_KeepMode(t *testing.T) {
+	c := newTestConfig(t)
+	c.CacheKeepLast = 2
+	s := newTestServer(t, c)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, 200, request(t, s, "PUT", "/mytopic", fmt.Sprintf("message %d", i), nil).Code)
+	}
+
+	// All messages are about to expire, only the newest two are retained
+	_, err := s.messageCache.db.Exec(`UPDATE messages SET expires = ?`, time.Now().Unix()+1)
+	require.Nil(t, err)
+	s.execManager()
+	_, err = s.messageCache.db.Exec(`UPDATE messages SET time = time - 86400`) // Age doesn't matter
+	require.Nil(t, err)
+	time.Sleep(2 * time.Second)
+	s.execManager()
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "message 1", messages[0].Message)
+	require.Equal(t, "message 2", messages[1].Message)
+}
+
+func TestServer_Manager_KeepLast_CapModeWithTierOverride(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.CacheKeepLast = 1
+	c.CacheKeepLastMode = KeepLastModeCap
+	s := newTestServer(t, c)
+	require.Nil(t, s.userManager.AddTier(&user.Tier{
+		Code:                  "pro",
+		MessageLimit:          100,
+		MessageExpiryDuration: time.Hour,
+		MessageKeepLast:       3,
+	}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "backups", user.PermissionReadWrite))
+
+	for i := 0; i < 4; i++ {
+		for _, topic := range []string{"backups", "mytopic"} {
+			response := request(t, s, "PUT", "/"+topic, fmt.Sprintf("message %d", i), map[string]string{
+				"Authorization": util.BasicAuth("phil", "phil"),
+			})
+			require.Equal(t, 200, response.Code)
+		}
+	}
+	s.execManager()
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "message 3", messages[0].Message)
+	messages = toMessages(t, request(t, s, "GET", "/backups/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	}).Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, "message 1", messages[0].Message)
+}
@@ -7,6 +7,7 @@ import (
 var (
 	metricMessagesPublishedSuccess     prometheus.Counter
 	metricMessagesPublishedFailure     prometheus.Counter
+	metricMessagesDeduplicated         prometheus.Counter
 	metricMessagesCached               prometheus.Gauge
 	metricMessagePublishDurationMillis prometheus.Gauge
 	metricFirebasePublishedSuccess     prometheus.Counter
@@ -24,6 +25,9 @@ var (
 	metricVisitors                     prometheus.Gauge
 	metricSubscribers                  prometheus.Gauge
 	metricTopics                       prometheus.Gauge
+	metricSubscriberQueueDepth         prometheus.Gauge
+	metricSubscriberMessagesDropped    prometheus.Counter
+	metricSubscribersDisconnected      prometheus.Counter
 	metricUsers                        prometheus.Gauge
 	metricHTTPRequests                 *prometheus.CounterVec
 )
@@ -35,6 +39,9 @@ func initMetrics() {
 	metricMessagesPublishedFailure = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "ntfy_messages_published_failure",
 	})
+	metricMessagesDeduplicated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ntfy_messages_deduplicated",
+	})
 	metricMessagesCached = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "ntfy_messages_cached_total",
 	})
@@ -89,12 +96,22 @@ func initMetrics() {
 	metricTopics = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "ntfy_topics_total",
 	})
+	metricSubscriberQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ntfy_subscriber_queue_depth_total",
+	})
+	metricSubscriberMessagesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ntfy_subscriber_messages_dropped",
+	})
+	metricSubscribersDisconnected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ntfy_subscribers_disconnected_slow",
+	})
 	metricHTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "ntfy_http_requests_total",
 	}, []string{"http_code", "ntfy_code", "http_method"})
 	prometheus.MustRegister(
 		metricMessagesPublishedSuccess,
 		metricMessagesPublishedFailure,
+		metricMessagesDeduplicated,
 		metricMessagesCached,
 		metricMessagePublishDurationMillis,
 		metricFirebasePublishedSuccess,
@@ -113,6 +130,9 @@ func initMetrics() {
 		metricUsers,
 		metricSubscribers,
 		metricTopics,
+		metricSubscriberQueueDepth,
+		metricSubscriberMessagesDropped,
+		metricSubscribersDisconnected,
 		metricHTTPRequests,
 	)
 }
@@ -124,6 +144,13 @@ func minc(counter prometheus.Counter) {
 	}
 }
 
+// madd adds the given value to a prometheus.Gauge if it is non-nil
+func madd[T int | int64 | float64](gauge prometheus.Gauge, value T) {
+	if gauge != nil {
+		gauge.Add(float64(value))
+	}
+}
+
 // mset sets a prometheus.Gauge if it is non-nil
 func mset[T int | int64 | float64](gauge prometheus.Gauge, value T) {
 	if gauge != nil {
@@ -12,6 +12,7 @@ const (
 	contextRateVisitor contextKey = iota + 2586
 	contextTopic
 	contextMatrixPushKey
+	contextCloudEventSource
 )
 
 func (s *Server) limitRequests(next handleFunc) handleFunc {
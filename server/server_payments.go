@@ -448,6 +448,7 @@ func (s *Server) updateSubscriptionAndTier(r *http.Request, v *visitor, u *user.
 		if err := s.userManager.ResetTier(u.Name); err != nil {
 			return err
 		}
+		s.audit(r, v, user.AuditUserTier, u.Name, u.Tier.Code, "")
 	} else if tier != nil && u.TierID() != tier.ID {
 		logvr(v, r).
 			Tag(tagStripe).
@@ -459,6 +460,11 @@ func (s *Server) updateSubscriptionAndTier(r *http.Request, v *visitor, u *user.
 		if err := s.userManager.ChangeTier(u.Name, tier.Code); err != nil {
 			return err
 		}
+		var before string
+		if u.Tier != nil {
+			before = u.Tier.Code
+		}
+		s.audit(r, v, user.AuditUserTier, u.Name, before, tier.Code)
 	}
 	// Update billing fields
 	billing := &user.Billing{
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAccount_ChangeSettings_QuietHours(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser))
+	headers := map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	}
+
+	rr := request(t, s, "PATCH", "/v1/account/settings", `{"notification": {"quiet_hours": {"start": "22:00", "end": "07:00", "timezone": "America/New_York", "min_priority": 4}}}`, headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/account", "", headers)
+	account, _ := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Equal(t, "22:00", account.Notification.QuietHours.Start)
+	require.Equal(t, "07:00", account.Notification.QuietHours.End)
+	require.Equal(t, "America/New_York", account.Notification.QuietHours.Timezone)
+	require.Equal(t, 4, account.Notification.QuietHours.MinPriority)
+
+	rr = request(t, s, "PATCH", "/v1/account/settings", `{"notification": {"quiet_hours": {"start": "22:00", "end": "7pm"}}}`, headers)
+	require.Equal(t, 40055, toHTTPError(t, rr.Body.String()).Code)
+
+	// Remove quiet hours
+	rr = request(t, s, "PATCH", "/v1/account/settings", `{"notification": {"quiet_hours": {}}}`, headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/account", "", headers)
+	account, _ = util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Nil(t, account.Notification.QuietHours)
+}
+
+func TestServer_QuietHours_Email(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddReservation("ben", "backups", user.PermissionReadWrite))
+	setQuietHoursNow(t, s, "ben")
+	headers := map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Email":       "ben@example.com",
+	}
+
+	// Quiet hours of the topic owner apply, not those of the publisher
+	rr := request(t, s, "PUT", "/backups", "backup done", headers)
+	require.Equal(t, 200, rr.Code)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 0, mailer.Count())
+
+	// Urgent messages are sent anyway
+	headers["X-Priority"] = "5"
+	rr = request(t, s, "PUT", "/backups", "server down", headers)
+	require.Equal(t, 200, rr.Code)
+	waitFor(t, func() bool {
+		return mailer.Count() == 1
+	})
+}
+
+func TestServer_QuietHours_EmailPublisherNotRecipient(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddReservation("ben", "backups", user.PermissionReadWrite))
+	setQuietHoursNow(t, s, "phil")
+
+	// Quiet hours of the publisher do not suppress e-mails to others
+	rr := request(t, s, "PUT", "/backups", "backup done", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Email":       "ben@example.com",
+	})
+	require.Equal(t, 200, rr.Code)
+	waitFor(t, func() bool {
+		return mailer.Count() == 1
+	})
+}
+
+func TestServer_QuietHours_WebPush(t *testing.T) {
+	c := newTestConfigWithWebPush(t)
+	c.AuthFile = newTestConfigWithAuthFile(t).AuthFile
+	s := newTestServer(t, c)
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	setQuietHoursNow(t, s, "phil")
+	u, err := s.userManager.User("phil")
+	require.Nil(t, err)
+
+	var received atomic.Int32
+	pushService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer pushService.Close()
+	require.Nil(t, s.webPush.UpsertSubscription(pushService.URL+"/push-receive", "kSC3T8aN1JCQxxPdrFLrZg", "BMKKbxdUU_xLS7G1Wh5AN8PvWOjCzkCuKZYb8apcqYrDxjOF_2piggBnoJLQYx9IeSD70fNuwawI3e9Y8m3S3PE", u.ID, netip.MustParseAddr("1.2.3.4"), []string{"mytopic"}))
+
+	headers := map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	}
+	request(t, s, "PUT", "/mytopic", "backup done", headers)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int32(0), received.Load())
+
+	headers["X-Priority"] = "urgent"
+	request(t, s, "PUT", "/mytopic", "server down", headers)
+	waitFor(t, func() bool {
+		return received.Load() == 1
+	})
+}
+
+// setQuietHoursNow sets quiet hours for the given user that span the current time
+func setQuietHoursNow(t *testing.T, s *Server, username string) {
+	now := time.Now().UTC()
+	rr := request(t, s, "PATCH", "/v1/account/settings", fmt.Sprintf(`{"notification": {"quiet_hours": {"start": "%s", "end": "%s"}}}`, now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04")), map[string]string{
+		"Authorization": util.BasicAuth(username, username),
+	})
+	require.Equal(t, 200, rr.Code)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The benchmarks in this file compare the sharded topic registry (see util.ShardedMap) with the single
+// map that is guarded by one global lock, which it replaced. In both cases, a background Go routine simulates
+// the manager, which iterates over all topics while traffic is coming in.
+//
+// Run with: go test -run=^$ -bench=Registry -benchtime=2s -cpu=1,4,16 ./server
+
+const benchmarkRegistryTopics = 10000
+
+func BenchmarkRegistry_SingleLock(b *testing.B) {
+	var mu sync.RWMutex
+	topics := make(map[string]*topic)
+	for i := 0; i < benchmarkRegistryTopics; i++ {
+		id := fmt.Sprintf("topic%d", i)
+		topics[id] = newTopic(id)
+	}
+	stop := runBenchmarkManager(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for id, t := range topics {
+			if t.Stale() {
+				delete(topics, id)
+			}
+		}
+	})
+	defer stop()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			id := fmt.Sprintf("topic%d", i%benchmarkRegistryTopics)
+			mu.Lock()
+			if _, ok := topics[id]; !ok {
+				topics[id] = newTopic(id)
+			}
+			t := topics[id]
+			mu.Unlock()
+			t.Keepalive()
+			i++
+		}
+	})
+}
+
+func BenchmarkRegistry_Sharded(b *testing.B) {
+	s := newBenchmarkServer(b)
+	for i := 0; i < benchmarkRegistryTopics; i++ {
+		_, err := s.topicFromID(fmt.Sprintf("topic%d", i))
+		require.Nil(b, err)
+	}
+	stop := runBenchmarkManager(func() {
+		s.topics.DeleteFunc(func(_ string, t *topic) bool {
+			return t.Stale()
+		})
+	})
+	defer stop()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			id := fmt.Sprintf("topic%d", i%benchmarkRegistryTopics)
+			t, _, _ := s.topics.GetOrAdd(id, func() (*topic, error) {
+				return newTopic(id), nil
+			})
+			t.Keepalive()
+			i++
+		}
+	})
+}
+
+func BenchmarkRegistry_Visitors(b *testing.B) {
+	s := newBenchmarkServer(b)
+	stop := runBenchmarkManager(s.pruneVisitors)
+	defer stop()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			s.visitor(netip.AddrFrom4([4]byte{10, 0, byte(i / 256 % 256), byte(i % 256)}), nil)
+			i++
+		}
+	})
+}
+
+// BenchmarkRegistry_PublishManySubscribers publishes to topics with many concurrent subscribers
+func BenchmarkRegistry_PublishManySubscribers(b *testing.B) {
+	s := newBenchmarkServer(b)
+	var delivered atomic.Int64
+	sub := func(v *visitor, m *message) error {
+		delivered.Add(1)
+		return nil
+	}
+	for i := 0; i < 1000; i++ {
+		t, err := s.topicFromID(fmt.Sprintf("topic%d", i%100))
+		require.Nil(b, err)
+		queue := newSubscriberQueue(sub, func() {}, DefaultSubscriberQueueSize, SubscriberQueueOverflowDropOldest)
+		go queue.Run()
+		defer queue.Close()
+		t.Subscribe(queue, "", func() {})
+	}
+	v := s.visitor(netip.IPv4Unspecified(), nil)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			t := s.topics.Get(fmt.Sprintf("topic%d", i%100))
+			if err := t.Publish(v, newDefaultMessage(t.ID, "benchmark")); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+func newBenchmarkServer(b *testing.B) *Server {
+	conf := NewConfig()
+	conf.TotalTopicLimit = benchmarkRegistryTopics * 2
+	s, err := New(conf)
+	require.Nil(b, err)
+	return s
+}
+
+func runBenchmarkManager(fn func()) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				fn()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"fmt"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"net/http"
+	"time"
+)
+
+// parseOnCall reads the X-On-Call header, and resolves the user currently on call for the given schedule. It returns
+// the e-mail address and the phone number to notify, either of which may be empty if the channel is not available.
+// Only admins and the owner of the schedule may page it. If no one is on call, if the quiet hours of the user on call
+// are active, or if the publisher is out of e-mail or call quota, the message is still published, and only a log
+// message is written.
+func (s *Server) parseOnCall(r *http.Request, v *visitor, vrate *visitor, m *message) (email string, call string, e *errHTTP) {
+	name := readParam(r, "x-on-call", "on-call", "oncall")
+	if name == "" {
+		return "", "", nil
+	} else if s.userManager == nil || v.User() == nil {
+		return "", "", errHTTPBadRequestOnCallAnonymous
+	}
+	schedule, err := s.userManager.Schedule(name)
+	if err == user.ErrScheduleNotFound {
+		return "", "", errHTTPBadRequestScheduleNotFound
+	} else if err != nil {
+		return "", "", errHTTPInternalError
+	} else if !v.User().IsAdmin() && schedule.Owner != v.User().Name {
+		return "", "", errHTTPForbidden
+	}
+	u, memberEmail, err := s.userManager.OnCall(name)
+	if err == user.ErrScheduleNotFound {
+		return "", "", errHTTPBadRequestScheduleNotFound
+	} else if err == user.ErrUserNotFound {
+		logvr(v, r).Tag(tagPublish).Field("schedule", name).Warn("No one is on call for schedule %s", name)
+		return "", "", nil
+	} else if err != nil {
+		return "", "", errHTTPInternalError
+	} else if suppressedByQuietHours(u, m) {
+		logvr(v, r).Tag(tagPublish).Fields(log.Context{"schedule": name, "on_call_user": u.Name}).Debug("Quiet hours of user %s on call for schedule %s active, not notifying", u.Name, name)
+		return "", "", nil
+	}
+	if s.smtpSender != nil && memberEmail != "" {
+		if vrate.EmailAllowed() {
+			email = memberEmail
+		} else {
+			logvr(v, r).Tag(tagPublish).Field("schedule", name).Info("E-mail limit reached, not e-mailing user %s on call for schedule %s", u.Name, name)
+		}
+	}
+	if s.config.TwilioAccount != "" {
+		phoneNumbers, err := s.userManager.PhoneNumbers(u.ID)
+		if err != nil {
+			return "", "", errHTTPInternalError
+		} else if len(phoneNumbers) > 0 {
+			if vrate.CallAllowed() {
+				call = phoneNumbers[0]
+			} else {
+				logvr(v, r).Tag(tagPublish).Field("schedule", name).Info("Call limit reached, not calling user %s on call for schedule %s", u.Name, name)
+			}
+		}
+	}
+	logvr(v, r).
+		Tag(tagPublish).
+		Fields(log.Context{
+			"schedule":       name,
+			"on_call_user":   u.Name,
+			"on_call_email":  email,
+			"on_call_number": call,
+		}).
+		Debug("Notifying user %s on call for schedule %s", u.Name, name)
+	return email, call, nil
+}
+
+func (s *Server) handleSchedulesGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	schedules, err := s.userManager.Schedules()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	response := make([]*apiScheduleResponse, len(schedules))
+	for i, schedule := range schedules {
+		response[i] = newScheduleResponse(schedule, now)
+	}
+	return s.writeJSON(w, response)
+}
+
+func (s *Server) handleSchedulesAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiScheduleRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if !user.AllowedSchedule(req.Name) || req.Period == nil {
+		return errHTTPBadRequestScheduleInvalid
+	}
+	handoff := time.Now()
+	if req.Handoff != nil {
+		handoff = time.Unix(*req.Handoff, 0)
+	}
+	schedule := &user.Schedule{
+		Name:    req.Name,
+		Handoff: handoff,
+		Period:  time.Duration(*req.Period) * time.Second,
+	}
+	if err := s.userManager.AddSchedule(schedule.Name, schedule.Handoff, schedule.Period); err == user.ErrScheduleExists {
+		return errHTTPConflictScheduleExists
+	} else if err == user.ErrInvalidArgument {
+		return errHTTPBadRequestScheduleInvalid
+	} else if err != nil {
+		return err
+	}
+	if req.Owner != nil && *req.Owner != "" {
+		if err := s.userManager.ChangeScheduleOwner(schedule.Name, *req.Owner); err == user.ErrUserNotFound {
+			return errHTTPBadRequestUserNotFound
+		} else if err != nil {
+			return err
+		}
+		schedule.Owner = *req.Owner
+	}
+	s.audit(r, v, user.AuditScheduleAdd, schedule.Name, "", schedule.Summary())
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleSchedulesChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiScheduleRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	schedule, err := s.userManager.Schedule(req.Name)
+	if err == user.ErrScheduleNotFound {
+		return errHTTPBadRequestScheduleNotFound
+	} else if err != nil {
+		return err
+	}
+	before := schedule.Summary()
+	if req.Handoff != nil {
+		schedule.Handoff = time.Unix(*req.Handoff, 0)
+	}
+	if req.Period != nil {
+		schedule.Period = time.Duration(*req.Period) * time.Second
+	}
+	if err := s.userManager.ChangeSchedule(schedule.Name, schedule.Handoff, schedule.Period); err == user.ErrInvalidArgument {
+		return errHTTPBadRequestScheduleInvalid
+	} else if err != nil {
+		return err
+	}
+	if req.Owner != nil {
+		if err := s.userManager.ChangeScheduleOwner(schedule.Name, *req.Owner); err == user.ErrUserNotFound {
+			return errHTTPBadRequestUserNotFound
+		} else if err != nil {
+			return err
+		}
+		schedule.Owner = *req.Owner
+	}
+	s.audit(r, v, user.AuditScheduleChange, schedule.Name, before, schedule.Summary())
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleSchedulesDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiScheduleDeleteRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	if _, err := s.userManager.Schedule(req.Name); err == user.ErrScheduleNotFound {
+		return errHTTPBadRequestScheduleNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := s.userManager.RemoveSchedule(req.Name); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditScheduleRemove, req.Name, "", "")
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleScheduleMembersAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiScheduleMemberRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	if err := s.userManager.AddScheduleMember(req.Schedule, req.Username, req.Email); err == user.ErrScheduleNotFound {
+		return errHTTPBadRequestScheduleNotFound
+	} else if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditScheduleMemberAdd, req.Schedule, "", req.Username)
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleScheduleMembersRemove(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiScheduleMemberRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	if err := s.userManager.RemoveScheduleMember(req.Schedule, req.Username); err == user.ErrScheduleNotFound {
+		return errHTTPBadRequestScheduleNotFound
+	} else if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditScheduleMemberRemove, req.Schedule, req.Username, "")
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleScheduleOverridesAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiScheduleOverrideRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	start, end := time.Now(), time.Unix(req.End, 0)
+	if req.Start > 0 {
+		start = time.Unix(req.Start, 0)
+	}
+	if !end.After(start) {
+		return errHTTPBadRequest.Wrap("override end must be after start")
+	}
+	override := &user.ScheduleOverride{
+		Username: req.Username,
+		Start:    start,
+		End:      end,
+	}
+	override.ID, err = s.userManager.AddScheduleOverride(req.Schedule, override.Username, override.Start, override.End)
+	if err == user.ErrScheduleNotFound {
+		return errHTTPBadRequestScheduleNotFound
+	} else if err == user.ErrUserNotFound {
+		return errHTTPBadRequestUserNotFound
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditScheduleOverrideAdd, req.Schedule, "", override.String())
+	return s.writeJSON(w, newScheduleOverrideResponse(override))
+}
+
+func (s *Server) handleScheduleOverridesRemove(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiScheduleOverrideDeleteRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	if err := s.userManager.RemoveScheduleOverride(req.Schedule, req.ID); err == user.ErrScheduleNotFound {
+		return errHTTPBadRequestScheduleNotFound
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditScheduleOverrideRemove, req.Schedule, fmt.Sprintf("%d", req.ID), "")
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func newScheduleResponse(schedule *user.Schedule, now time.Time) *apiScheduleResponse {
+	members := make([]*apiScheduleMemberResponse, len(schedule.Members))
+	for i, m := range schedule.Members {
+		members[i] = &apiScheduleMemberResponse{
+			Username: m.Username,
+			Email:    m.Email,
+		}
+	}
+	overrides := make([]*apiScheduleOverrideResponse, len(schedule.Overrides))
+	for i, o := range schedule.Overrides {
+		overrides[i] = newScheduleOverrideResponse(o)
+	}
+	var onCall string
+	if m := schedule.OnCall(now); m != nil {
+		onCall = m.Username
+	}
+	return &apiScheduleResponse{
+		Name:        schedule.Name,
+		Handoff:     schedule.Handoff.Unix(),
+		Period:      int64(schedule.Period.Seconds()),
+		Owner:       schedule.Owner,
+		NextHandoff: schedule.NextHandoff(now).Unix(),
+		OnCall:      onCall,
+		Members:     members,
+		Overrides:   overrides,
+	}
+}
+
+func newScheduleOverrideResponse(o *user.ScheduleOverride) *apiScheduleOverrideResponse {
+	return &apiScheduleOverrideResponse{
+		ID:       o.ID,
+		Username: o.Username,
+		Start:    o.Start.Unix(),
+		End:      o.End.Unix(),
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedules_AddMembersOverridesRemove(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddUser("emma", "emma", user.RoleUser))
+	headers := map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	}
+
+	// Non-admins cannot manage schedules
+	rr := request(t, s, "GET", "/v1/schedules", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Add schedule
+	handoff := time.Now().Add(-time.Hour).Unix()
+	rr = request(t, s, "PUT", "/v1/schedules", fmt.Sprintf(`{"name": "ops", "handoff": %d, "period": 604800, "owner": "ben"}`, handoff), headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/v1/schedules", `{"name": "ops", "period": 604800}`, headers)
+	require.Equal(t, 40908, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "PUT", "/v1/schedules", `{"name": "not valid", "period": 604800}`, headers)
+	require.Equal(t, 40049, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "PUT", "/v1/schedules", `{"name": "short", "period": 1}`, headers)
+	require.Equal(t, 40049, toHTTPError(t, rr.Body.String()).Code)
+
+	// Add members
+	rr = request(t, s, "POST", "/v1/schedules/members", `{"schedule": "ops", "username": "ben", "email": "ben@example.com"}`, headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "POST", "/v1/schedules/members", `{"schedule": "ops", "username": "emma"}`, headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "POST", "/v1/schedules/members", `{"schedule": "doesnotexist", "username": "emma"}`, headers)
+	require.Equal(t, 40048, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "POST", "/v1/schedules/members", `{"schedule": "ops", "username": "doesnotexist"}`, headers)
+	require.Equal(t, 40031, toHTTPError(t, rr.Body.String()).Code)
+
+	// Add override for emma
+	rr = request(t, s, "PUT", "/v1/schedules/overrides", fmt.Sprintf(`{"schedule": "ops", "username": "emma", "end": %d}`, time.Now().Add(time.Hour).Unix()), headers)
+	require.Equal(t, 200, rr.Code)
+	override, _ := util.UnmarshalJSON[apiScheduleOverrideResponse](io.NopCloser(rr.Body))
+	require.True(t, override.ID > 0)
+	require.Equal(t, "emma", override.Username)
+	rr = request(t, s, "POST", "/v1/schedules/overrides", fmt.Sprintf(`{"schedule": "ops", "username": "emma", "end": %d}`, time.Now().Add(-time.Hour).Unix()), headers)
+	require.Equal(t, 400, rr.Code)
+
+	// List
+	rr = request(t, s, "GET", "/v1/schedules", "", headers)
+	require.Equal(t, 200, rr.Code)
+	schedules, _ := util.UnmarshalJSON[[]*apiScheduleResponse](io.NopCloser(rr.Body))
+	require.Equal(t, 1, len(*schedules))
+	ops := (*schedules)[0]
+	require.Equal(t, "ops", ops.Name)
+	require.Equal(t, handoff, ops.Handoff)
+	require.Equal(t, int64(604800), ops.Period)
+	require.Equal(t, "ben", ops.Owner)
+	require.Equal(t, handoff+604800, ops.NextHandoff)
+	require.Equal(t, "emma", ops.OnCall)
+	require.Equal(t, 2, len(ops.Members))
+	require.Equal(t, "ben", ops.Members[0].Username)
+	require.Equal(t, "ben@example.com", ops.Members[0].Email)
+	require.Equal(t, 1, len(ops.Overrides))
+
+	// Remove override, ben is on call
+	rr = request(t, s, "DELETE", "/v1/schedules/overrides", fmt.Sprintf(`{"schedule": "ops", "id": %d}`, override.ID), headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/schedules", "", headers)
+	schedules, _ = util.UnmarshalJSON[[]*apiScheduleResponse](io.NopCloser(rr.Body))
+	require.Equal(t, "ben", (*schedules)[0].OnCall)
+
+	// Change rotation, emma is on call
+	rr = request(t, s, "POST", "/v1/schedules", fmt.Sprintf(`{"name": "ops", "handoff": %d}`, handoff-604800), headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/schedules", "", headers)
+	schedules, _ = util.UnmarshalJSON[[]*apiScheduleResponse](io.NopCloser(rr.Body))
+	require.Equal(t, "emma", (*schedules)[0].OnCall)
+
+	// Remove member and schedule
+	rr = request(t, s, "DELETE", "/v1/schedules/members", `{"schedule": "ops", "username": "emma"}`, headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "DELETE", "/v1/schedules", `{"name": "ops"}`, headers)
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "DELETE", "/v1/schedules", `{"name": "ops"}`, headers)
+	require.Equal(t, 40048, toHTTPError(t, rr.Body.String()).Code)
+
+	// All changes are audited
+	entries, err := s.userManager.AuditEntries(&user.AuditFilter{Action: "schedule"})
+	require.Nil(t, err)
+	require.Equal(t, 8, len(entries))
+	require.Equal(t, user.AuditScheduleRemove, entries[0].Action)
+	require.Equal(t, "phil", entries[0].Actor)
+}
+
+func TestServer_Publish_OnCall_Email(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddSchedule("ops", time.Now().Add(-time.Hour), 7*24*time.Hour))
+	headers := map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-On-Call":     "ops",
+	}
+
+	// No one on call, message is published anyway
+	rr := request(t, s, "PUT", "/alerts", "disk full", headers)
+	require.Equal(t, 200, rr.Code)
+
+	// Ben is on call
+	require.Nil(t, s.userManager.AddScheduleMember("ops", "ben", "ben@example.com"))
+	rr = request(t, s, "PUT", "/alerts", "disk full", headers)
+	require.Equal(t, 200, rr.Code)
+	waitFor(t, func() bool {
+		return mailer.Count() == 1
+	})
+
+	// Anonymous users and unknown schedules
+	rr = request(t, s, "PUT", "/alerts", "disk full", map[string]string{
+		"X-On-Call": "ops",
+	})
+	require.Equal(t, 40047, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "PUT", "/alerts", "disk full", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-On-Call":     "doesnotexist",
+	})
+	require.Equal(t, 40048, toHTTPError(t, rr.Body.String()).Code)
+}
+
+func TestServer_Publish_OnCall_Call(t *testing.T) {
+	var to atomic.Pointer[string]
+	twilioCallsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		require.True(t, strings.Contains(string(body), "To=%2B12223334444"))
+		to.Store(util.String("+12223334444"))
+	}))
+	defer twilioCallsServer.Close()
+
+	c := newTestConfigWithAuthFile(t)
+	c.TwilioCallsBaseURL = twilioCallsServer.URL
+	c.TwilioAccount = "AC1234567890"
+	c.TwilioAuthToken = "AAEAA1234567890"
+	c.TwilioPhoneNumber = "+1234567890"
+	s := newTestServer(t, c)
+
+	require.Nil(t, s.userManager.AddTier(&user.Tier{
+		Code:         "pro",
+		MessageLimit: 10,
+		CallLimit:    1,
+	}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AllowAccess("phil", "alerts", user.PermissionReadWrite))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	ben, err := s.userManager.User("ben")
+	require.Nil(t, err)
+	require.Nil(t, s.userManager.AddPhoneNumber(ben.ID, "+12223334444"))
+	require.Nil(t, s.userManager.AddSchedule("ops", time.Now().Add(-time.Hour), 7*24*time.Hour))
+	require.Nil(t, s.userManager.AddScheduleMember("ops", "ben", ""))
+
+	// Phil does not own the schedule
+	rr := request(t, s, "PUT", "/alerts", "disk full", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"On-Call":       "ops",
+	})
+	require.Equal(t, 403, rr.Code)
+	require.Nil(t, to.Load())
+
+	// Phil publishes, ben is called
+	require.Nil(t, s.userManager.ChangeScheduleOwner("ops", "phil"))
+	rr = request(t, s, "PUT", "/alerts", "disk full", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"On-Call":       "ops",
+	})
+	require.Equal(t, 200, rr.Code)
+	waitFor(t, func() bool {
+		return to.Load() != nil
+	})
+
+	// Call limit of the publisher applies, but the message is still published
+	to.Store(nil)
+	rr = request(t, s, "PUT", "/alerts", "disk full again", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"On-Call":       "ops",
+	})
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, "disk full again", toMessage(t, rr.Body.String()).Message)
+	time.Sleep(100 * time.Millisecond)
+	require.Nil(t, to.Load())
+}
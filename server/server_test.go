@@ -55,10 +55,12 @@ func TestServer_PublishAndPoll(t *testing.T) {
 
 	response = request(t, s, "GET", "/mytopic/sse?poll=1&since=all", "", nil)
 	lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
-	require.Equal(t, 3, len(lines))
-	require.Equal(t, "my first message", toMessage(t, strings.TrimPrefix(lines[0], "data: ")).Message)
-	require.Equal(t, "", lines[1])
-	require.Equal(t, "my second\n\nmessage", toMessage(t, strings.TrimPrefix(lines[2], "data: ")).Message)
+	require.Equal(t, 5, len(lines))
+	require.Equal(t, "id: "+msg1.ID, lines[0])
+	require.Equal(t, "my first message", toMessage(t, strings.TrimPrefix(lines[1], "data: ")).Message)
+	require.Equal(t, "", lines[2])
+	require.Equal(t, "id: "+msg2.ID, lines[3])
+	require.Equal(t, "my second\n\nmessage", toMessage(t, strings.TrimPrefix(lines[4], "data: ")).Message)
 
 	response = request(t, s, "GET", "/mytopic/raw?poll=1", "", nil)
 	lines = strings.Split(strings.TrimSpace(response.Body.String()), "\n")
@@ -645,6 +647,144 @@ func TestServer_PollSinceID_MultipleTopics_IDDoesNotMatch(t *testing.T) {
 	require.Equal(t, "test 6", messages[3].Message)
 }
 
+func TestServer_PollSinceSeq(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	for i := 1; i <= 3; i++ {
+		m := toMessage(t, request(t, s, "PUT", "/mytopic", fmt.Sprintf("test %d", i), nil).Body.String())
+		require.Equal(t, int64(i), m.Seq)
+	}
+	m := toMessage(t, request(t, s, "PUT", "/othertopic", "other test", nil).Body.String())
+	require.Equal(t, int64(1), m.Seq) // Sequence numbers are per topic
+
+	response := request(t, s, "GET", "/mytopic/json?poll=1&since=seq:1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "test 2", messages[0].Message)
+	require.Equal(t, int64(2), messages[0].Seq)
+	require.Equal(t, "test 3", messages[1].Message)
+	require.Equal(t, int64(3), messages[1].Seq)
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1&since=seq:0", "", nil)
+	require.Equal(t, 3, len(toMessages(t, response.Body.String())))
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1&since=seq:abc", "", nil)
+	require.Equal(t, 40008, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "GET", "/mytopic/json?poll=1&since=seq:-1", "", nil)
+	require.Equal(t, 40008, toHTTPError(t, response.Body.String()).Code)
+
+	// Sequence numbers are per topic
+	for _, url := range []string{"/mytopic,othertopic/json?poll=1&since=seq:1", "/mytopic,othertopic/rss?since=seq:1"} {
+		response = request(t, s, "GET", url, "", nil)
+		require.Equal(t, 40068, toHTTPError(t, response.Body.String()).Code, url)
+	}
+}
+
+func TestServer_PublishSeq_TopicRemovedFromMemory(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	request(t, s, "PUT", "/mytopic", "test 1", nil)
+	request(t, s, "PUT", "/mytopic", "test 2", nil)
+
+	// Sequence numbers continue where they left off, even if the topic was pruned (or the server restarted)
+	s.topics.Delete("mytopic")
+	m := toMessage(t, request(t, s, "PUT", "/mytopic", "test 3", nil).Body.String())
+	require.Equal(t, int64(3), m.Seq)
+}
+
+func TestServer_PublishSeq_UncachedAndBatched(t *testing.T) {
+	c := newTestConfig(t)
+	c.CacheBatchSize = 10
+	c.CacheBatchTimeout = time.Hour
+	s := newTestServer(t, c)
+
+	// Uncached messages, and messages still waiting in the cache batch queue, use up their sequence numbers
+	request(t, s, "PUT", "/mytopic", "test 1", map[string]string{"Cache": "no"})
+	request(t, s, "PUT", "/mytopic", "test 2", nil)
+	s.topics.Delete("mytopic")
+	m := toMessage(t, request(t, s, "PUT", "/mytopic", "test 3", nil).Body.String())
+	require.Equal(t, int64(3), m.Seq)
+}
+
+func TestServer_PublishSeq_Concurrent(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request(t, s, "PUT", "/mytopic", "test", nil)
+		}()
+		if i == 10 {
+			s.topics.Delete("mytopic")
+		}
+	}
+	wg.Wait()
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 20, len(messages))
+	seqs := make(map[int64]bool)
+	for _, m := range messages {
+		seqs[m.Seq] = true
+	}
+	require.Equal(t, 20, len(seqs))
+}
+
+func TestServer_PublishSeq_DelayedMessage(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	m := toMessage(t, request(t, s, "PUT", "/mytopic", "delayed", map[string]string{
+		"In": "1h",
+	}).Body.String())
+	require.Equal(t, int64(0), m.Seq) // Not assigned until the message is delivered
+	request(t, s, "PUT", "/mytopic", "test 1", nil)
+
+	// Deliver delayed message
+	_, err := s.messageCache.db.Exec(`UPDATE messages SET time = ? WHERE mid = ?`, time.Now().Add(-10*time.Second).Unix(), m.ID)
+	require.Nil(t, err)
+	require.Nil(t, s.sendDelayedMessages())
+
+	response := request(t, s, "GET", "/mytopic/json?poll=1&since=seq:1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "delayed", messages[0].Message)
+	require.Equal(t, int64(2), messages[0].Seq)
+}
+
+func TestServer_SSE_LastEventID(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	m1 := toMessage(t, request(t, s, "PUT", "/mytopic", "test 1", nil).Body.String())
+	request(t, s, "PUT", "/mytopic", "test 2", nil)
+
+	// Last-Event-ID takes precedence over since=, since the browser keeps the original URL when reconnecting
+	response := request(t, s, "GET", "/mytopic/sse?poll=1&since=all", "", map[string]string{
+		"Last-Event-ID": m1.ID,
+	})
+	lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	require.Equal(t, "test 2", toMessage(t, strings.TrimPrefix(lines[1], "data: ")).Message)
+
+	// Invalid IDs are ignored
+	response = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"Last-Event-ID": "not-an-id",
+	})
+	require.Equal(t, 2, len(toMessages(t, response.Body.String())))
+}
+
+func TestServer_SSE_Retry(t *testing.T) {
+	c := newTestConfig(t)
+	c.SSERetry = 10 * time.Second
+	s := newTestServer(t, c)
+
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/mytopic/sse", rr)
+	cancel()
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	require.Equal(t, "retry: 10000", lines[0])
+	require.Equal(t, "event: open", lines[1])
+}
+
 func TestServer_PublishViaGET(t *testing.T) {
 	s := newTestServer(t, newTestConfig(t))
 
@@ -1289,28 +1429,28 @@ func TestServer_PublishAndExpungeTopicAfter16Hours(t *testing.T) {
 	require.Equal(t, 200, response.Code)
 	waitFor(t, func() bool {
 		// .lastAccess set in t.Publish() -> t.Keepalive() in Goroutine
-		s.topics["mytopic"].mu.RLock()
-		defer s.topics["mytopic"].mu.RUnlock()
-		return s.topics["mytopic"].lastAccess.Unix() >= time.Now().Unix()-2 &&
-			s.topics["mytopic"].lastAccess.Unix() <= time.Now().Unix()+2
+		s.topics.Get("mytopic").mu.RLock()
+		defer s.topics.Get("mytopic").mu.RUnlock()
+		return s.topics.Get("mytopic").lastAccess.Unix() >= time.Now().Unix()-2 &&
+			s.topics.Get("mytopic").lastAccess.Unix() <= time.Now().Unix()+2
 	})
 
 	// Topic won't get pruned
 	s.execManager()
-	require.NotNil(t, s.topics["mytopic"])
+	require.NotNil(t, s.topics.Get("mytopic"))
 
 	// Fudge with last access, but subscribe, and see that it won't get pruned (because of subscriber)
-	subID := s.topics["mytopic"].Subscribe(subFn, "", func() {})
-	s.topics["mytopic"].mu.Lock()
-	s.topics["mytopic"].lastAccess = time.Now().Add(-17 * time.Hour)
-	s.topics["mytopic"].mu.Unlock()
+	subID := s.topics.Get("mytopic").Subscribe(newSubscriberQueue(subFn, func() {}, 0, SubscriberQueueOverflowDropOldest), "", func() {})
+	s.topics.Get("mytopic").mu.Lock()
+	s.topics.Get("mytopic").lastAccess = time.Now().Add(-17 * time.Hour)
+	s.topics.Get("mytopic").mu.Unlock()
 	s.execManager()
-	require.NotNil(t, s.topics["mytopic"])
+	require.NotNil(t, s.topics.Get("mytopic"))
 
 	// It'll finally get pruned now that there are no subscribers and last access is 17 hours ago
-	s.topics["mytopic"].Unsubscribe(subID)
+	s.topics.Get("mytopic").Unsubscribe(subID)
 	s.execManager()
-	require.Nil(t, s.topics["mytopic"])
+	require.Nil(t, s.topics.Get("mytopic"))
 }
 
 func TestServer_TopicKeepaliveOnPoll(t *testing.T) {
@@ -1322,13 +1462,13 @@ func TestServer_TopicKeepaliveOnPoll(t *testing.T) {
 	require.Equal(t, 200, response.Code)
 
 	// Mess with last access time
-	s.topics["mytopic"].lastAccess = time.Now().Add(-17 * time.Hour)
+	s.topics.Get("mytopic").lastAccess = time.Now().Add(-17 * time.Hour)
 
 	// Poll again and check keepalive time
 	response = request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
 	require.Equal(t, 200, response.Code)
-	require.True(t, s.topics["mytopic"].lastAccess.Unix() >= time.Now().Unix()-2)
-	require.True(t, s.topics["mytopic"].lastAccess.Unix() <= time.Now().Unix()+2)
+	require.True(t, s.topics.Get("mytopic").lastAccess.Unix() >= time.Now().Unix()-2)
+	require.True(t, s.topics.Get("mytopic").lastAccess.Unix() <= time.Now().Unix()+2)
 }
 
 func TestServer_UnifiedPushDiscovery(t *testing.T) {
@@ -1470,10 +1610,10 @@ func TestServer_MatrixGateway_Push_Failure_NoSubscriber_After13Hours(t *testing.
 	response := request(t, s, "POST", "/_matrix/push/v1/notify", notification, nil)
 	require.Equal(t, 507, response.Code)
 	require.Equal(t, 50701, toHTTPError(t, response.Body.String()).Code)
-	require.Nil(t, s.topics["mytopic"].rateVisitor)
+	require.Nil(t, s.topics.Get("mytopic").rateVisitor)
 
 	// Fake: This topic has been around for 13 hours without a rate visitor
-	s.topics["mytopic"].lastAccess = time.Now().Add(-13 * time.Hour)
+	s.topics.Get("mytopic").lastAccess = time.Now().Add(-13 * time.Hour)
 
 	// Same request should now return HTTP 200 with a rejected pushkey
 	response = request(t, s, "POST", "/_matrix/push/v1/notify", notification, nil)
@@ -1481,9 +1621,9 @@ func TestServer_MatrixGateway_Push_Failure_NoSubscriber_After13Hours(t *testing.
 	require.Equal(t, `{"rejected":["http://127.0.0.1:12345/mytopic?up=1"]}`, strings.TrimSpace(response.Body.String()))
 
 	// Slightly unrelated: Test that topic is pruned after 16 hours
-	s.topics["mytopic"].lastAccess = time.Now().Add(-17 * time.Hour)
+	s.topics.Get("mytopic").lastAccess = time.Now().Add(-17 * time.Hour)
 	s.execManager()
-	require.Nil(t, s.topics["mytopic"])
+	require.Nil(t, s.topics.Get("mytopic"))
 }
 
 func TestServer_MatrixGateway_Push_Failure_InvalidPushkey(t *testing.T) {
@@ -2275,7 +2415,7 @@ func TestServer_SubscriberRateLimiting_Success(t *testing.T) {
 	}, subscriber1Fn)
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Equal(t, "1.2.3.4", s.topics["subscriber1topic"].rateVisitor.ip.String())
+	require.Equal(t, "1.2.3.4", s.topics.Get("subscriber1topic").rateVisitor.ip.String())
 
 	// "Register" visitor 8.7.7.1 to topic "up012345678912" as a rate limit visitor (implicitly via topic name)
 	subscriber2Fn := func(r *http.Request) {
@@ -2284,7 +2424,7 @@ func TestServer_SubscriberRateLimiting_Success(t *testing.T) {
 	rr = request(t, s, "GET", "/up012345678912/json?poll=1", "", nil, subscriber2Fn)
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Equal(t, "8.7.7.1", s.topics["up012345678912"].rateVisitor.ip.String())
+	require.Equal(t, "8.7.7.1", s.topics.Get("up012345678912").rateVisitor.ip.String())
 
 	// Publish 2 messages to "subscriber1topic" as visitor 9.9.9.9. It'd be 3 normally, but the
 	// GET request before is also counted towards the request limiter.
@@ -2332,7 +2472,7 @@ func TestServer_SubscriberRateLimiting_NotEnabled_Failed(t *testing.T) {
 	})
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Nil(t, s.topics["subscriber1topic"].rateVisitor)
+	require.Nil(t, s.topics.Get("subscriber1topic").rateVisitor)
 
 	// Registering visitor 8.7.7.1 to topic has no effect
 	rr = request(t, s, "GET", "/up012345678912/json?poll=1", "", nil, func(r *http.Request) {
@@ -2340,7 +2480,7 @@ func TestServer_SubscriberRateLimiting_NotEnabled_Failed(t *testing.T) {
 	})
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Nil(t, s.topics["up012345678912"].rateVisitor)
+	require.Nil(t, s.topics.Get("up012345678912").rateVisitor)
 
 	// Publish 3 messages to "subscriber1topic" as visitor 9.9.9.9
 	for i := 0; i < 3; i++ {
@@ -2419,26 +2559,26 @@ func TestServer_SubscriberRateLimiting_VisitorExpiration(t *testing.T) {
 		"rate-topics": "mytopic",
 	}, subscriberFn)
 	require.Equal(t, 200, rr.Code)
-	require.Equal(t, "1.2.3.4", s.topics["mytopic"].rateVisitor.ip.String())
-	require.Equal(t, s.visitors["ip:1.2.3.4"], s.topics["mytopic"].rateVisitor)
+	require.Equal(t, "1.2.3.4", s.topics.Get("mytopic").rateVisitor.ip.String())
+	require.Equal(t, s.visitors.Get("ip:1.2.3.4"), s.topics.Get("mytopic").rateVisitor)
 
 	// Publish message, observe rate visitor tokens being decreased
 	response := request(t, s, "POST", "/mytopic", "some message", nil)
 	require.Equal(t, 200, response.Code)
-	require.Equal(t, int64(0), s.visitors["ip:9.9.9.9"].messagesLimiter.Value())
-	require.Equal(t, int64(1), s.topics["mytopic"].rateVisitor.messagesLimiter.Value())
-	require.Equal(t, s.visitors["ip:1.2.3.4"], s.topics["mytopic"].rateVisitor)
+	require.Equal(t, int64(0), s.visitors.Get("ip:9.9.9.9").messagesLimiter.Value())
+	require.Equal(t, int64(1), s.topics.Get("mytopic").rateVisitor.messagesLimiter.Value())
+	require.Equal(t, s.visitors.Get("ip:1.2.3.4"), s.topics.Get("mytopic").rateVisitor)
 
 	// Expire visitor
-	s.visitors["ip:1.2.3.4"].seen = time.Now().Add(-1 * 25 * time.Hour)
+	s.visitors.Get("ip:1.2.3.4").seen = time.Now().Add(-1 * 25 * time.Hour)
 	s.pruneVisitors()
 
 	// Publish message again, observe that rateVisitor is not used anymore and is reset
 	response = request(t, s, "POST", "/mytopic", "some message", nil)
 	require.Equal(t, 200, response.Code)
-	require.Equal(t, int64(1), s.visitors["ip:9.9.9.9"].messagesLimiter.Value())
-	require.Nil(t, s.topics["mytopic"].rateVisitor)
-	require.Nil(t, s.visitors["ip:1.2.3.4"])
+	require.Equal(t, int64(1), s.visitors.Get("ip:9.9.9.9").messagesLimiter.Value())
+	require.Nil(t, s.topics.Get("mytopic").rateVisitor)
+	require.Nil(t, s.visitors.Get("ip:1.2.3.4"))
 }
 
 func TestServer_SubscriberRateLimiting_ProtectedTopics(t *testing.T) {
@@ -2471,9 +2611,9 @@ func TestServer_SubscriberRateLimiting_ProtectedTopics(t *testing.T) {
 		"Rate-Topics":   "reserved-for-phil,public_topic,announcements",
 	})
 	require.Equal(t, 200, rr.Code)
-	require.Equal(t, "phil", s.topics["reserved-for-phil"].rateVisitor.user.Name)
-	require.Equal(t, "phil", s.topics["public_topic"].rateVisitor.user.Name)
-	require.Nil(t, s.topics["announcements"].rateVisitor)
+	require.Equal(t, "phil", s.topics.Get("reserved-for-phil").rateVisitor.user.Name)
+	require.Equal(t, "phil", s.topics.Get("public_topic").rateVisitor.user.Name)
+	require.Nil(t, s.topics.Get("announcements").rateVisitor)
 
 	// Set rate visitor as user "ben" on topic
 	// - "reserved-for-phil": NOT allowed, because I am not the owner
@@ -2484,9 +2624,9 @@ func TestServer_SubscriberRateLimiting_ProtectedTopics(t *testing.T) {
 		"Rate-Topics":   "reserved-for-phil,public_topic,announcements",
 	})
 	require.Equal(t, 200, rr.Code)
-	require.Equal(t, "phil", s.topics["reserved-for-phil"].rateVisitor.user.Name)
-	require.Equal(t, "ben", s.topics["public_topic"].rateVisitor.user.Name)
-	require.Equal(t, "ben", s.topics["announcements"].rateVisitor.user.Name)
+	require.Equal(t, "phil", s.topics.Get("reserved-for-phil").rateVisitor.user.Name)
+	require.Equal(t, "ben", s.topics.Get("public_topic").rateVisitor.user.Name)
+	require.Equal(t, "ben", s.topics.Get("announcements").rateVisitor.user.Name)
 }
 
 func TestServer_SubscriberRateLimiting_ProtectedTopics_WithDefaultReadWrite(t *testing.T) {
@@ -2505,8 +2645,8 @@ func TestServer_SubscriberRateLimiting_ProtectedTopics_WithDefaultReadWrite(t *t
 		r.RemoteAddr = "1.2.3.4"
 	})
 	require.Equal(t, 200, rr.Code)
-	require.Equal(t, "1.2.3.4", s.topics["up123456789012"].rateVisitor.ip.String())
-	require.Nil(t, s.topics["announcements"].rateVisitor)
+	require.Equal(t, "1.2.3.4", s.topics.Get("up123456789012").rateVisitor.ip.String())
+	require.Nil(t, s.topics.Get("announcements").rateVisitor)
 }
 
 func TestServer_MessageHistoryAndStatsEndpoint(t *testing.T) {
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"net/http"
+)
+
+// topicInfo returns the metadata of the given topic, or nil if no metadata was stored for the topic, or if the
+// user manager is not enabled
+func (s *Server) topicInfo(topic string) (*user.TopicInfo, error) {
+	if s.userManager == nil {
+		return nil, nil
+	}
+	info, err := s.userManager.TopicInfo(topic)
+	if errors.Is(err, user.ErrTopicInfoNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *Server) handleTopicInfo(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	t, err := fromContext[*topic](r, contextTopic)
+	if err != nil {
+		return err
+	}
+	info, err := s.topicInfo(t.ID)
+	if err != nil {
+		return err
+	} else if info == nil {
+		info = &user.TopicInfo{Topic: t.ID}
+	}
+	return s.writeJSON(w, newTopicInfoResponse(info))
+}
+
+func (s *Server) handleTopicInfoChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.authorizeTopicInfo(r, v)
+	if err != nil {
+		return err
+	}
+	req, err := readJSONWithLimit[apiTopicInfoRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	info, err := s.topicInfo(topic)
+	if err != nil {
+		return err
+	} else if info == nil {
+		info = &user.TopicInfo{Topic: topic}
+	}
+	before := info.DisplayName
+	if req.DisplayName != nil {
+		info.DisplayName = *req.DisplayName
+	}
+	if req.Description != nil {
+		info.Description = *req.Description
+	}
+	if req.Icon != nil {
+		if *req.Icon != "" && !urlRegex.MatchString(*req.Icon) {
+			return errHTTPBadRequestTopicInfoInvalid
+		}
+		info.Icon = *req.Icon
+	}
+	if req.Contact != nil {
+		info.Contact = *req.Contact
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":              topic,
+			"topic_display_name": info.DisplayName,
+		}).
+		Debug("Changing topic info")
+	if err := s.userManager.SetTopicInfo(info); errors.Is(err, user.ErrInvalidArgument) {
+		return errHTTPBadRequestTopicInfoInvalid
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditTopicInfoChange, topic, before, info.DisplayName)
+	return s.writeJSON(w, newTopicInfoResponse(info))
+}
+
+func (s *Server) handleTopicInfoDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.authorizeTopicInfo(r, v)
+	if err != nil {
+		return err
+	}
+	if err := s.userManager.RemoveTopicInfo(topic); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditTopicInfoRemove, topic, "", "")
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// authorizeTopicInfo returns the topic from the request path, if the user is an admin or owns the reservation
+// of the topic. Like topic settings, the topic info is shown to everyone using the topic.
+func (s *Server) authorizeTopicInfo(r *http.Request, v *visitor) (string, error) {
+	matches := apiTopicInfoRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return "", errHTTPInternalErrorInvalidPath
+	}
+	topic, u := matches[1], v.User()
+	if u.IsAdmin() {
+		return topic, nil
+	}
+	owner, err := s.userManager.HasReservation(u.Name, topic)
+	if err != nil {
+		return "", err
+	} else if !owner {
+		return "", errHTTPUnauthorized
+	}
+	return topic, nil
+}
+
+func newTopicInfoResponse(info *user.TopicInfo) *apiTopicInfoResponse {
+	return &apiTopicInfoResponse{
+		Topic:       info.Topic,
+		DisplayName: info.DisplayName,
+		Description: info.Description,
+		Icon:        info.Icon,
+		Contact:     info.Contact,
+	}
+}
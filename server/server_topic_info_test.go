@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"testing"
+)
+
+func TestServer_TopicInfo_ChangeAndGet(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddUser("emma", "emma", user.RoleUser))
+	require.Nil(t, s.userManager.AddReservation("ben", "backups", user.PermissionRead))
+
+	// No metadata yet
+	response := request(t, s, "GET", "/backups/info", "", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, `{"topic":"backups"}`+"\n", response.Body.String())
+
+	// Owner sets metadata, others cannot
+	response = request(t, s, "PATCH", "/v1/topics/backups/info", `{"display_name": "Backups (production)", "contact": "ops@example.com"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "PATCH", "/v1/topics/backups/info", `{"description": "Nightly database backups"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "PATCH", "/v1/topics/backups/info", `{"display_name": "Hijacked"}`, map[string]string{
+		"Authorization": util.BasicAuth("emma", "emma"),
+	})
+	require.Equal(t, 401, response.Code)
+	response = request(t, s, "PATCH", "/v1/topics/backups/info", `{"icon": "not a url"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 40058, toHTTPError(t, response.Body.String()).Code)
+
+	// Everyone with read access sees the metadata
+	response = request(t, s, "GET", "/backups/info", "", nil)
+	require.Equal(t, 200, response.Code)
+	info, _ := util.UnmarshalJSON[apiTopicInfoResponse](io.NopCloser(response.Body))
+	require.Equal(t, "backups", info.Topic)
+	require.Equal(t, "Backups (production)", info.DisplayName)
+	require.Equal(t, "Nightly database backups", info.Description)
+	require.Equal(t, "ops@example.com", info.Contact)
+
+	// Delete
+	response = request(t, s, "DELETE", "/v1/topics/backups/info", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, response.Code)
+	_, err := s.userManager.TopicInfo("backups")
+	require.Equal(t, user.ErrTopicInfoNotFound, err)
+}
+
+func TestServer_TopicInfo_NoReadAccess(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	require.Nil(t, s.userManager.SetTopicInfo(&user.TopicInfo{Topic: "backups", DisplayName: "Backups"}))
+
+	response := request(t, s, "GET", "/backups/info", "", nil)
+	require.Equal(t, 403, response.Code)
+}
+
+func TestServer_TopicInfo_AccountSubscriptions(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser))
+	require.Nil(t, s.userManager.SetTopicInfo(&user.TopicInfo{Topic: "backups", DisplayName: "Backups (production)"}))
+
+	for _, body := range []string{`{"base_url": "http://127.0.0.1:12345", "topic": "backups"}`, `{"base_url": "http://abc.com", "topic": "backups"}`} {
+		response := request(t, s, "POST", "/v1/account/subscription", body, map[string]string{
+			"Authorization": util.BasicAuth("phil", "phil"),
+		})
+		require.Equal(t, 200, response.Code)
+	}
+	response := request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, response.Code)
+	account, _ := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(response.Body))
+	require.Equal(t, 2, len(account.Subscriptions))
+	require.Equal(t, "Backups (production)", account.Subscriptions[0].Info.DisplayName)
+	require.Nil(t, account.Subscriptions[1].Info) // Other server
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+)
+
+var (
+	// topicPatternRegex matches valid topic patterns: patterns must start with a literal prefix, so that a
+	// pattern cannot match all (or almost all) topics, e.g. "alerts-*", but not "*" or "*-prod"
+	topicPatternRegex = regexp.MustCompile(`^[-_A-Za-z0-9]+[-_A-Za-z0-9*]*$`)
+)
+
+// topicPatternSubscription subscribes a subscriber to all topics whose ID matches one of its patterns, e.g.
+// "alerts-*". It is attached to all matching topics when it is created, and to all matching topics that are
+// created afterwards (see topicPatternRegistry.Attach). If more than limit topics match, no further topics are
+// attached, but the subscriber stays subscribed to the topics it is already attached to.
+type topicPatternSubscription struct {
+	patterns      []string
+	regexes       []*regexp.Regexp
+	explicit      func(topicID string) bool // Returns true if the subscriber is subscribed to the topic explicitly
+	queue         *subscriberQueue
+	userID        string // May be empty
+	cancel        func()
+	limit         int
+	limitReached  bool // True if a matching topic was not attached because of the limit, used to log only once
+	topics        map[string]*topic
+	subscriberIDs map[string]int
+	mu            sync.Mutex
+}
+
+func newTopicPatternSubscription(patterns []string, explicit func(topicID string) bool, queue *subscriberQueue, userID string, cancel func(), limit int) *topicPatternSubscription {
+	regexes := make([]*regexp.Regexp, 0)
+	for _, pattern := range patterns {
+		regexes = append(regexes, topicPatternToRegex(pattern))
+	}
+	return &topicPatternSubscription{
+		patterns:      patterns,
+		regexes:       regexes,
+		explicit:      explicit,
+		queue:         queue,
+		userID:        userID,
+		cancel:        cancel,
+		limit:         limit,
+		topics:        make(map[string]*topic),
+		subscriberIDs: make(map[string]int),
+	}
+}
+
+// Matches returns true if the given topic ID matches any of the patterns, and is not subscribed to explicitly
+func (p *topicPatternSubscription) Matches(topicID string) bool {
+	return matchesTopicPatterns(p.regexes, topicID) && !p.explicit(topicID)
+}
+
+// Attach subscribes to the given topic, unless it is already subscribed. If the limit of topics is
+// reached, the topic is not attached.
+func (p *topicPatternSubscription) Attach(t *topic) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, exists := p.topics[t.ID]; exists && existing == t {
+		return
+	} else if exists {
+		// The topic was pruned and re-created while we were attaching to it; move over to the new one
+		existing.Unsubscribe(p.subscriberIDs[t.ID])
+	} else if len(p.topics) >= p.limit {
+		if !p.limitReached {
+			log.
+				Tag(tagSubscribe).
+				With(t).
+				Field("topic_patterns", strings.Join(p.patterns, ",")).
+				Info("Topic patterns match more than %d topics, not attaching new topics to subscriber", p.limit)
+			p.limitReached = true
+		}
+		return
+	}
+	p.topics[t.ID] = t
+	p.subscriberIDs[t.ID] = t.Subscribe(p.queue, p.userID, p.cancel)
+}
+
+// DetachAll unsubscribes from all topics, and must be called when the subscriber goes away
+func (p *topicPatternSubscription) DetachAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, t := range p.topics {
+		t.Unsubscribe(p.subscriberIDs[id])
+	}
+	p.topics = make(map[string]*topic)
+	p.subscriberIDs = make(map[string]int)
+}
+
+// topicPatternRegistry holds all active topic pattern subscriptions, so that they can be attached
+// to newly created topics
+type topicPatternRegistry struct {
+	subscriptions map[*topicPatternSubscription]struct{}
+	mu            sync.RWMutex
+}
+
+func newTopicPatternRegistry() *topicPatternRegistry {
+	return &topicPatternRegistry{
+		subscriptions: make(map[*topicPatternSubscription]struct{}),
+	}
+}
+
+// Add registers the subscription, so that it is attached to matching topics created from now on
+func (r *topicPatternRegistry) Add(p *topicPatternSubscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscriptions[p] = struct{}{}
+}
+
+// Remove unregisters the subscription; it does not detach it from its topics
+func (r *topicPatternRegistry) Remove(p *topicPatternSubscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.subscriptions, p)
+}
+
+// Attach attaches all matching subscriptions to the given (newly created) topic
+func (r *topicPatternRegistry) Attach(t *topic) {
+	r.mu.RLock()
+	matching := make([]*topicPatternSubscription, 0)
+	for p := range r.subscriptions {
+		if p.Matches(t.ID) {
+			matching = append(matching, p)
+		}
+	}
+	r.mu.RUnlock()
+	for _, p := range matching {
+		p.Attach(t)
+	}
+}
+
+// subscribeTopicPatterns subscribes the queue to all current and future topics matching the given patterns,
+// except for the explicitly subscribed topics. The returned function removes the subscription again.
+func (s *Server) subscribeTopicPatterns(patterns []string, explicit func(topicID string) bool, queue *subscriberQueue, userID string, cancel func()) (unsubscribe func()) {
+	if len(patterns) == 0 {
+		return func() {}
+	}
+	p := newTopicPatternSubscription(patterns, explicit, queue, userID, cancel, s.config.SubscriberPatternTopicLimit)
+	s.topicPatterns.Add(p)
+	s.topics.Range(func(id string, t *topic) bool {
+		if p.Matches(id) {
+			p.Attach(t)
+		}
+		return true
+	})
+	return func() {
+		s.topicPatterns.Remove(p)
+		p.DetachAll()
+	}
+}
+
+// cachedTopicsMatchingPatterns returns the topics with cached messages that match the given patterns, except
+// for the explicitly subscribed topics, and which the visitor is allowed to read. It is used to replay the history
+// of pattern subscriptions (since=...). If the patterns match more topics than allowed, an error is returned.
+func (s *Server) cachedTopicsMatchingPatterns(v *visitor, patterns []string, topics []*topic) ([]*topic, error) {
+	if len(patterns) == 0 {
+		return make([]*topic, 0), nil
+	}
+	regexes := make([]*regexp.Regexp, 0)
+	for _, pattern := range patterns {
+		regexes = append(regexes, topicPatternToRegex(pattern))
+	}
+	exclude := topicIDs(topics)
+	matching := make(map[string]bool)
+	s.topics.Range(func(id string, _ *topic) bool {
+		if matchesTopicPatterns(regexes, id) && !isTopicIn(exclude, id) {
+			matching[id] = false
+		}
+		return true
+	})
+	cachedTopics, err := s.messageCache.Topics()
+	if err != nil {
+		return nil, err
+	}
+	for id := range cachedTopics {
+		if matchesTopicPatterns(regexes, id) && !isTopicIn(exclude, id) {
+			matching[id] = true
+		}
+	}
+	if len(matching) > s.config.SubscriberPatternTopicLimit {
+		return nil, errHTTPBadRequestTopicPatternTooBroad
+	}
+	cached := make([]*topic, 0)
+	for id, hasMessages := range matching {
+		if !hasMessages {
+			continue
+		}
+		allowed, err := s.topicPatternReadAllowed(v.User(), id)
+		if err != nil {
+			return nil, err
+		} else if allowed {
+			cached = append(cached, cachedTopics[id])
+		}
+	}
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].ID < cached[j].ID
+	})
+	return cached, nil
+}
+
+// topicPatternSubscriber wraps the given subscriber, and only forwards messages of topics that are not subscribed
+// to explicitly (i.e. that were matched by a pattern) if the visitor is allowed to read them via a pattern (see
+// topicPatternReadAllowed). Access is checked for every message, so that changes to the access control list take
+// effect immediately.
+func (s *Server) topicPatternSubscriber(v *visitor, patterns []string, explicit func(topicID string) bool, sub subscriber) subscriber {
+	if len(patterns) == 0 {
+		return sub
+	}
+	return func(pv *visitor, m *message) error {
+		if m.Event == messageEvent && !explicit(m.Topic) {
+			allowed, err := s.topicPatternReadAllowed(v.User(), m.Topic)
+			if err != nil {
+				return err
+			} else if !allowed {
+				logvm(v, m).Tag(tagSubscribe).Trace("Not forwarding message to pattern subscriber, access to topic %s not granted explicitly", m.Topic)
+				return nil
+			}
+		}
+		return sub(pv, m)
+	}
+}
+
+// topicPatternReadAllowed returns true if the given user may receive the messages of the given topic via a topic
+// pattern. Unlike for regular subscriptions, read access via an everyone entry or the default access is not enough:
+// the user (or one of their groups) must have been granted read access explicitly, so that patterns cannot be used
+// to discover topics of other users. Admins may read all topics.
+func (s *Server) topicPatternReadAllowed(u *user.User, topic string) (bool, error) {
+	match, err := s.userManager.ExplainAccess(u, topic)
+	if err != nil {
+		return false, err
+	}
+	switch match.Source {
+	case user.AccessSourceAdmin:
+		return true, nil
+	case user.AccessSourceUser, user.AccessSourceGroup:
+		return match.Allow.IsRead(), nil
+	default:
+		return false, nil
+	}
+}
+
+// topicPatternsFromRequest returns the topic patterns from the request path (see topicPatternsFromPath). Pattern
+// subscriptions must be enabled (see Config.EnableTopicPatterns), are only available to logged-in users, and each
+// pattern must start with a literal prefix (see topicPatternRegex).
+func (s *Server) topicPatternsFromRequest(r *http.Request, v *visitor) ([]string, error) {
+	patterns := topicPatternsFromPath(r.URL.Path)
+	if len(patterns) == 0 {
+		return patterns, nil
+	} else if !s.config.EnableTopicPatterns || s.userManager == nil {
+		return nil, errHTTPBadRequestTopicInvalid
+	} else if v.User() == nil {
+		return nil, errHTTPUnauthorizedTopicPattern
+	}
+	for _, pattern := range patterns {
+		if !topicPatternRegex.MatchString(pattern) {
+			return nil, errHTTPBadRequestTopicPatternInvalid
+		}
+	}
+	return patterns, nil
+}
+
+// topicPatternsFromPath returns the topic patterns from a root path (e.g. /mytopic,alerts-*), see topicsFromPath
+func topicPatternsFromPath(path string) []string {
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 {
+		return nil
+	}
+	patterns := make([]string, 0)
+	for _, id := range strings.Split(parts[1], ",") {
+		if isTopicPattern(id) {
+			patterns = append(patterns, id)
+		}
+	}
+	return patterns
+}
+
+// isTopicPattern returns true if the given topic contains a wildcard, e.g. "alerts-*"
+func isTopicPattern(topic string) bool {
+	return strings.Contains(topic, "*")
+}
+
+// topicPatternToRegex converts a topic pattern to a regular expression, "*" matching any number of characters
+func topicPatternToRegex(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$")
+}
+
+func matchesTopicPatterns(regexes []*regexp.Regexp, topicID string) bool {
+	for _, re := range regexes {
+		if re.MatchString(topicID) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTopicIn(topicIDs []string, topicID string) bool {
+	for _, id := range topicIDs {
+		if id == topicID {
+			return true
+		}
+	}
+	return false
+}
+
+func topicIDs(topics []*topic) []string {
+	ids := make([]string, 0, len(topics))
+	for _, t := range topics {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+// isTopicInFunc returns a function that returns true if the given topic ID is one of the given topics, to be
+// used as the explicit topic check of pattern subscriptions whose explicit topics cannot change
+func isTopicInFunc(topics []*topic) func(topicID string) bool {
+	ids := topicIDs(topics)
+	return func(topicID string) bool {
+		return isTopicIn(ids, topicID)
+	}
+}
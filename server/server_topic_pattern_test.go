@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer_TopicPattern_SubscribeNewTopics(t *testing.T) {
+	s := newTestServerWithTopicPatterns(t, newTestConfigWithAuthFile(t))
+	request(t, s, "PUT", "/alerts-existing", "not in history", nil)
+
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/alerts-*/json?"+topicPatternAuthParam(), rr)
+	request(t, s, "PUT", "/alerts-existing", "existing topic", nil)
+	request(t, s, "PUT", "/alerts-new", "new topic", nil)
+	request(t, s, "PUT", "/other", "does not match", nil)
+	cancel()
+
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, openEvent, messages[0].Event)
+	require.Equal(t, "alerts-*", messages[0].Topic)
+	require.Equal(t, "existing topic", messages[1].Message)
+	require.Equal(t, "alerts-existing", messages[1].Topic)
+	require.Equal(t, "new topic", messages[2].Message)
+	require.Equal(t, "alerts-new", messages[2].Topic)
+
+	// Patterns do not create topics
+	require.Nil(t, s.topics.Get("alerts-*"))
+}
+
+func TestServer_TopicPattern_Since(t *testing.T) {
+	s := newTestServerWithTopicPatterns(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AllowAccess("phil", "other", user.PermissionRead))
+	request(t, s, "PUT", "/alerts-disk", "disk full", nil)
+	request(t, s, "PUT", "/alerts-cpu", "cpu hot", nil)
+	request(t, s, "PUT", "/other", "does not match", nil)
+
+	messages := toMessages(t, request(t, s, "GET", "/alerts-*/json?poll=1", "", topicPatternAuth()).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.ElementsMatch(t, []string{"disk full", "cpu hot"}, []string{messages[0].Message, messages[1].Message})
+
+	// Topics that were removed from memory are still replayed from the cache
+	s.topics.Delete("alerts-disk")
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/alerts-d*,other/json?since=all&"+topicPatternAuthParam(), rr)
+	cancel()
+	messages = toMessages(t, rr.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.ElementsMatch(t, []string{"disk full", "does not match"}, []string{messages[1].Message, messages[2].Message})
+}
+
+func TestServer_TopicPattern_NoDuplicates(t *testing.T) {
+	s := newTestServerWithTopicPatterns(t, newTestConfigWithAuthFile(t))
+
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/alerts-disk,alerts-*,alerts-d*/json?"+topicPatternAuthParam(), rr)
+	request(t, s, "PUT", "/alerts-disk", "disk full", nil)
+	request(t, s, "PUT", "/alerts-dns", "dns down", nil)
+	cancel()
+
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, "disk full", messages[1].Message)
+	require.Equal(t, "dns down", messages[2].Message)
+}
+
+func TestServer_TopicPattern_ExplicitGrantsOnly(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServerWithTopicPatterns(t, c)
+	require.Nil(t, s.userManager.AddUser("admin", "admin", user.RoleAdmin))
+	require.Nil(t, s.userManager.ResetAccess("phil", "alerts-*"))
+	require.Nil(t, s.userManager.AllowAccess("phil", "alerts-mine", user.PermissionRead))
+	require.Nil(t, s.userManager.AllowAccess(user.Everyone, "alerts-public", user.PermissionRead))
+	admin := map[string]string{
+		"Authorization": util.BasicAuth("admin", "admin"),
+	}
+	request(t, s, "PUT", "/alerts-mine", "mine 1", admin)
+	request(t, s, "PUT", "/alerts-public", "public 1", admin)
+	request(t, s, "PUT", "/alerts-private", "private 1", admin)
+
+	// History only contains topics the user was granted access to explicitly, not topics readable by everyone
+	messages := toMessages(t, request(t, s, "GET", "/alerts-*/json?poll=1", "", topicPatternAuth()).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "mine 1", messages[0].Message)
+
+	// Access is checked for every message
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/alerts-*/json?"+topicPatternAuthParam(), rr)
+	request(t, s, "PUT", "/alerts-private", "private 2", admin)
+	request(t, s, "PUT", "/alerts-public", "public 2", admin)
+	request(t, s, "PUT", "/alerts-mine", "mine 2", admin)
+	time.Sleep(200 * time.Millisecond) // Messages are delivered asynchronously
+	require.Nil(t, s.userManager.AllowAccess("phil", "alerts-private", user.PermissionRead))
+	request(t, s, "PUT", "/alerts-private", "private 3", admin)
+	cancel()
+
+	messages = toMessages(t, rr.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, "mine 2", messages[1].Message)
+	require.Equal(t, "private 3", messages[2].Message)
+}
+
+func TestServer_TopicPattern_Rejected(t *testing.T) {
+	// Disabled by default
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser))
+	for _, path := range []string{"/alerts-*/json", "/alerts-*/cloudevents"} {
+		response := request(t, s, "GET", path+"?poll=1", "", topicPatternAuth())
+		require.Equal(t, 40009, toHTTPError(t, response.Body.String()).Code, path)
+	}
+
+	// Anonymous users, and patterns without a literal prefix
+	s = newTestServerWithTopicPatterns(t, newTestConfigWithAuthFile(t))
+	for _, path := range []string{"/alerts-*/json", "/alerts-*/cloudevents"} {
+		response := request(t, s, "GET", path+"?poll=1", "", nil)
+		require.Equal(t, 40103, toHTTPError(t, response.Body.String()).Code, path)
+	}
+	for _, path := range []string{"/*/json", "/*-prod/json", "/mytopic,*/sse", "/*/cloudevents"} {
+		response := request(t, s, "GET", path+"?poll=1", "", topicPatternAuth())
+		require.Equal(t, 40066, toHTTPError(t, response.Body.String()).Code, path)
+	}
+}
+
+func TestServer_TopicPattern_WebSocket(t *testing.T) {
+	s := newTestServerWithTopicPatterns(t, newTestConfigWithAuthFile(t))
+	request(t, s, "PUT", "/alerts-disk", "disk full", nil)
+
+	conn := dialWebSocket(t, s, "/alerts-*/ws?since=all", http.Header{
+		"Authorization": []string{util.BasicAuth("phil", "phil")},
+	})
+	require.Equal(t, "open", readWebSocketFrame(t, conn)["event"])
+	require.Equal(t, "disk full", readWebSocketFrame(t, conn)["message"])
+
+	request(t, s, "PUT", "/alerts-cpu", "cpu hot", nil)
+	frame := readWebSocketFrame(t, conn)
+	require.Equal(t, "cpu hot", frame["message"])
+	require.Equal(t, "alerts-cpu", frame["topic"])
+}
+
+func TestServer_TopicPattern_WebSocket_NoDuplicates(t *testing.T) {
+	s := newTestServerWithTopicPatterns(t, newTestConfigWithAuthFile(t))
+	conn := dialWebSocket(t, s, "/alerts-disk,alerts-*/ws", http.Header{
+		"Authorization": []string{util.BasicAuth("phil", "phil")},
+	})
+	require.Equal(t, "open", readWebSocketFrame(t, conn)["event"])
+
+	// Topics subscribed to explicitly, when connecting or later, are not also delivered via the pattern
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "1", "action": "subscribe", "topic": "alerts-cpu"}))
+	require.Equal(t, "ack", readWebSocketFrame(t, conn)["event"])
+	request(t, s, "PUT", "/alerts-cpu", "cpu hot", nil)
+	request(t, s, "PUT", "/alerts-disk", "disk full", nil)
+	request(t, s, "PUT", "/alerts-dns", "dns down", nil)
+	require.Equal(t, "cpu hot", readWebSocketFrame(t, conn)["message"])
+	require.Equal(t, "disk full", readWebSocketFrame(t, conn)["message"])
+	require.Equal(t, "dns down", readWebSocketFrame(t, conn)["message"])
+
+	// After unsubscribing, messages are delivered via the pattern
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "2", "action": "unsubscribe", "topic": "alerts-disk"}))
+	require.Equal(t, "ack", readWebSocketFrame(t, conn)["event"])
+	request(t, s, "PUT", "/alerts-disk", "disk still full", nil)
+	request(t, s, "PUT", "/alerts-dns", "dns still down", nil)
+	require.Equal(t, "disk still full", readWebSocketFrame(t, conn)["message"])
+	require.Equal(t, "dns still down", readWebSocketFrame(t, conn)["message"])
+}
+
+func TestServer_TopicPattern_Limit(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.SubscriberPatternTopicLimit = 2
+	s := newTestServerWithTopicPatterns(t, c)
+	request(t, s, "PUT", "/alerts-1", "message 1", nil)
+	request(t, s, "PUT", "/alerts-2", "message 2", nil)
+	request(t, s, "PUT", "/alerts-3", "message 3", nil)
+
+	// Patterns that match too many topics are rejected
+	response := request(t, s, "GET", "/alerts-*/json?poll=1", "", topicPatternAuth())
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40062, toHTTPError(t, response.Body.String()).Code)
+
+	// Once the pattern matches too many topics, new topics are not attached, but the subscriber stays connected
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/alerts-1*/json?"+topicPatternAuthParam(), rr)
+	request(t, s, "PUT", "/alerts-10", "message 10", nil)
+	time.Sleep(200 * time.Millisecond) // Messages are delivered asynchronously
+	request(t, s, "PUT", "/alerts-11", "message 11", nil)
+	request(t, s, "PUT", "/alerts-1", "message 1 again", nil)
+	cancel()
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, "message 10", messages[1].Message)
+	require.Equal(t, "message 1 again", messages[2].Message)
+}
+
+// newTestServerWithTopicPatterns creates a server with topic patterns enabled, and a user "phil" who was granted
+// read access to alerts-*; everyone else can read and write all topics
+func newTestServerWithTopicPatterns(t *testing.T, c *Config) *Server {
+	c.EnableTopicPatterns = true
+	s := newTestServer(t, c)
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser))
+	require.Nil(t, s.userManager.AllowAccess("phil", "alerts-*", user.PermissionRead))
+	return s
+}
+
+func topicPatternAuth() map[string]string {
+	return map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	}
+}
+
+func topicPatternAuthParam() string {
+	return "auth=" + base64.RawURLEncoding.EncodeToString([]byte(util.BasicAuth("phil", "phil")))
+}
+
+func TestTopicPatternToRegex(t *testing.T) {
+	re := topicPatternToRegex("alerts-*")
+	require.True(t, re.MatchString("alerts-"))
+	require.True(t, re.MatchString("alerts-disk"))
+	require.False(t, re.MatchString("my-alerts-disk"))
+	require.False(t, re.MatchString("alerts"))
+	require.True(t, topicPatternToRegex("*-prod").MatchString("db-prod"))
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"errors"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"net/http"
+	"time"
+)
+
+// topicSettings returns the settings of the given topic, or nil if no settings were stored for the topic, or if
+// the user manager is not enabled
+func (s *Server) topicSettings(topic string) (*user.TopicSettings, error) {
+	if s.userManager == nil {
+		return nil, nil
+	}
+	settings, err := s.userManager.TopicSettings(topic)
+	if errors.Is(err, user.ErrTopicSettingsNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// applyTopicSettings sets the default priority, tags and icon of the topic if the message does not set them, and
+// shortens the message expiry to the retention of the topic
+func applyTopicSettings(m *message, settings *user.TopicSettings) {
+	if m.Priority == 0 {
+		m.Priority = settings.Priority
+	}
+	if len(m.Tags) == 0 && len(settings.Tags) > 0 {
+		m.Tags = settings.Tags
+	}
+	if m.Icon == "" {
+		m.Icon = settings.Icon
+	}
+	if settings.MessageExpiryDuration > 0 && m.Expires > 0 {
+		m.Expires = min(m.Expires, time.Unix(m.Time, 0).Add(settings.MessageExpiryDuration).Unix())
+	}
+}
+
+// expireMessagesForTopicSettings marks messages as expired that exceed the retention or the message limit of
+// their topic, so that they are deleted with all other expired messages
+func (s *Server) expireMessagesForTopicSettings() {
+	if s.userManager == nil {
+		return
+	}
+	settings, err := s.userManager.AllTopicSettings()
+	if err != nil {
+		log.Tag(tagManager).Err(err).Warn("Error retrieving topic settings")
+		return
+	}
+	for _, ts := range settings {
+		if ts.MessageExpiryDuration > 0 {
+			if err := s.messageCache.ExpireMessagesBefore(ts.Topic, time.Now().Add(-ts.MessageExpiryDuration).Unix()); err != nil {
+				log.Tag(tagManager).Field("topic", ts.Topic).Err(err).Warn("Error expiring messages beyond topic retention")
+			}
+		}
+		if ts.MessageLimit > 0 {
+			if err := s.messageCache.ExpireMessagesBeyondCount(ts.Topic, ts.MessageLimit); err != nil {
+				log.Tag(tagManager).Field("topic", ts.Topic).Err(err).Warn("Error expiring messages beyond topic message limit")
+			}
+		}
+	}
+}
+
+func (s *Server) handleTopicSettingsGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.authorizeTopicSettings(r, v)
+	if err != nil {
+		return err
+	}
+	settings, err := s.topicSettings(topic)
+	if err != nil {
+		return err
+	} else if settings == nil {
+		settings = user.NewTopicSettings(topic)
+	}
+	return s.writeJSON(w, newTopicSettingsResponse(settings))
+}
+
+func (s *Server) handleTopicSettingsChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.authorizeTopicSettings(r, v)
+	if err != nil {
+		return err
+	}
+	req, err := readJSONWithLimit[apiTopicSettingsRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	settings, err := s.topicSettings(topic)
+	if err != nil {
+		return err
+	} else if settings == nil {
+		settings = user.NewTopicSettings(topic)
+	}
+	before := settings.String()
+	if req.MessagesExpiryDuration != nil {
+		settings.MessageExpiryDuration = time.Duration(*req.MessagesExpiryDuration) * time.Second
+	}
+	if req.Messages != nil {
+		settings.MessageLimit = *req.Messages
+	}
+	if req.AttachmentFileSize != nil {
+		settings.AttachmentFileSizeLimit = *req.AttachmentFileSize
+	}
+	if req.Priority != nil {
+		settings.Priority = *req.Priority
+	}
+	if req.Tags != nil {
+		settings.Tags = *req.Tags
+	}
+	if req.Icon != nil {
+		if *req.Icon != "" && !urlRegex.MatchString(*req.Icon) {
+			return errHTTPBadRequestTopicSettingsInvalid
+		}
+		settings.Icon = *req.Icon
+	}
+	if req.Firebase != nil {
+		settings.Firebase = *req.Firebase
+	}
+	if req.Digest != nil {
+		digest := time.Duration(*req.Digest) * time.Second
+		if digest != 0 && (digest < digestWindowMin || digest > digestWindowMax) {
+			return errHTTPBadRequestDigestInvalid
+		}
+		settings.Digest = digest
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":          topic,
+			"topic_settings": settings.String(),
+		}).
+		Debug("Changing topic settings")
+	if err := s.userManager.SetTopicSettings(settings); errors.Is(err, user.ErrInvalidArgument) {
+		return errHTTPBadRequestTopicSettingsInvalid
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditTopicSettingsChange, topic, before, settings.String())
+	return s.writeJSON(w, newTopicSettingsResponse(settings))
+}
+
+func (s *Server) handleTopicSettingsDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.authorizeTopicSettings(r, v)
+	if err != nil {
+		return err
+	}
+	if err := s.userManager.RemoveTopicSettings(topic); err != nil {
+		return err
+	}
+	s.audit(r, v, user.AuditTopicSettingsRemove, topic, "", "")
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// authorizeTopicSettings returns the topic from the request path, if the user is an admin or owns the reservation
+// of the topic. Topic settings can only be managed by the topic owner, since they affect everyone using the topic.
+func (s *Server) authorizeTopicSettings(r *http.Request, v *visitor) (string, error) {
+	matches := apiTopicSettingsRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return "", errHTTPInternalErrorInvalidPath
+	}
+	topic, u := matches[1], v.User()
+	if u.IsAdmin() {
+		return topic, nil
+	}
+	owner, err := s.userManager.HasReservation(u.Name, topic)
+	if err != nil {
+		return "", err
+	} else if !owner {
+		return "", errHTTPUnauthorized
+	}
+	return topic, nil
+}
+
+func newTopicSettingsResponse(settings *user.TopicSettings) *apiTopicSettingsResponse {
+	tags := settings.Tags
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	return &apiTopicSettingsResponse{
+		Topic:                  settings.Topic,
+		MessagesExpiryDuration: int64(settings.MessageExpiryDuration.Seconds()),
+		Messages:               settings.MessageLimit,
+		AttachmentFileSize:     settings.AttachmentFileSizeLimit,
+		Priority:               settings.Priority,
+		Tags:                   tags,
+		Icon:                   settings.Icon,
+		Firebase:               settings.Firebase,
+		Digest:                 int64(settings.Digest.Seconds()),
+	}
+}
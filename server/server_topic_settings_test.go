@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestServer_TopicSettings_OwnerAndAdmin(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AddUser("emma", "emma", user.RoleUser))
+	require.Nil(t, s.userManager.AddReservation("ben", "backups", user.PermissionRead))
+
+	// Defaults if no settings were stored
+	response := request(t, s, "GET", "/v1/topics/backups/settings", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, response.Code)
+	settings, _ := util.UnmarshalJSON[apiTopicSettingsResponse](io.NopCloser(response.Body))
+	require.Equal(t, "backups", settings.Topic)
+	require.Equal(t, int64(0), settings.Messages)
+	require.Equal(t, []string{}, settings.Tags)
+	require.True(t, settings.Firebase)
+
+	// Owner changes settings, partial updates keep the other settings
+	response = request(t, s, "PATCH", "/v1/topics/backups/settings", `{"messages": 10, "priority": 4, "tags": ["floppy_disk"]}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "PATCH", "/v1/topics/backups/settings", `{"firebase": false}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, response.Code)
+	settings, _ = util.UnmarshalJSON[apiTopicSettingsResponse](io.NopCloser(response.Body))
+	require.Equal(t, int64(10), settings.Messages)
+	require.Equal(t, 4, settings.Priority)
+	require.Equal(t, []string{"floppy_disk"}, settings.Tags)
+	require.False(t, settings.Firebase)
+
+	// Other users and anonymous users cannot read or change the settings
+	response = request(t, s, "GET", "/v1/topics/backups/settings", "", map[string]string{
+		"Authorization": util.BasicAuth("emma", "emma"),
+	})
+	require.Equal(t, 401, response.Code)
+	response = request(t, s, "PATCH", "/v1/topics/backups/settings", `{"priority": 1}`, nil)
+	require.Equal(t, 401, response.Code)
+
+	// Invalid settings
+	response = request(t, s, "PATCH", "/v1/topics/backups/settings", `{"priority": 6}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 40057, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "PATCH", "/v1/topics/backups/settings", `{"icon": "not a url"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 40057, toHTTPError(t, response.Body.String()).Code)
+
+	// Delete
+	response = request(t, s, "DELETE", "/v1/topics/backups/settings", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, response.Code)
+	_, err := s.userManager.TopicSettings("backups")
+	require.Equal(t, user.ErrTopicSettingsNotFound, err)
+}
+
+func TestServer_TopicSettings_PublishDefaults(t *testing.T) {
+	sender := newTestFirebaseSender(10)
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	s.firebaseClient = newFirebaseClient(sender, &testAuther{Allow: true})
+	settings := user.NewTopicSettings("backups")
+	settings.Priority = 4
+	settings.Tags = []string{"floppy_disk"}
+	settings.Icon = "https://example.com/backup.png"
+	settings.Firebase = false
+	require.Nil(t, s.userManager.SetTopicSettings(settings))
+
+	m := toMessage(t, request(t, s, "PUT", "/backups", "backup done", nil).Body.String())
+	require.Equal(t, 4, m.Priority)
+	require.Equal(t, []string{"floppy_disk"}, m.Tags)
+	require.Equal(t, "https://example.com/backup.png", m.Icon)
+
+	// Explicit values win
+	m = toMessage(t, request(t, s, "PUT", "/backups", "backup failed", map[string]string{
+		"Priority": "5",
+		"Tags":     "warning",
+	}).Body.String())
+	require.Equal(t, 5, m.Priority)
+	require.Equal(t, []string{"warning"}, m.Tags)
+
+	// Not forwarded to Firebase
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 0, len(sender.Messages()))
+}
+
+func TestServer_TopicSettings_RetentionAndMessageLimit(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	settings := user.NewTopicSettings("backups")
+	settings.MessageExpiryDuration = time.Hour
+	settings.MessageLimit = 2
+	require.Nil(t, s.userManager.SetTopicSettings(settings))
+
+	// Expiry is shortened to the topic retention
+	m := toMessage(t, request(t, s, "PUT", "/backups", "backup 0", map[string]string{
+		"X-Expires": "1d",
+	}).Body.String())
+	require.Equal(t, m.Time+3600, m.Expires)
+
+	for i := 1; i <= 3; i++ {
+		response := request(t, s, "PUT", "/backups", fmt.Sprintf("backup %d", i), nil)
+		require.Equal(t, 200, response.Code)
+	}
+	s.execManager()
+	messages := toMessages(t, request(t, s, "GET", "/backups/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "backup 2", messages[0].Message)
+	require.Equal(t, "backup 3", messages[1].Message)
+
+	// Messages published before the retention was lowered are pruned as well
+	_, err := s.messageCache.db.Exec(`UPDATE messages SET time = ? WHERE message = 'backup 2'`, time.Now().Add(-2*time.Hour).Unix())
+	require.Nil(t, err)
+	s.execManager()
+	messages = toMessages(t, request(t, s, "GET", "/backups/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "backup 3", messages[0].Message)
+}
+
+func TestServer_TopicSettings_AttachmentFileSizeLimit(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	settings := user.NewTopicSettings("backups")
+	settings.AttachmentFileSizeLimit = 5000
+	require.Nil(t, s.userManager.SetTopicSettings(settings))
+
+	response := request(t, s, "PUT", "/backups", util.RandomString(5001), nil)
+	require.Equal(t, 41301, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "PUT", "/othertopic", util.RandomString(5001), nil)
+	require.Equal(t, 200, response.Code)
+}
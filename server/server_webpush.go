@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/SherClockHolmes/webpush-go"
 	"heckel.io/ntfy/v2/log"
@@ -88,13 +89,33 @@ func (s *Server) publishToWebPushEndpoints(v *visitor, m *message) {
 		log.Tag(tagWebPush).Err(err).With(v, m).Warn("Unable to marshal expiring payload")
 		return
 	}
+	quiet := make(map[string]bool) // User ID -> quiet hours active, to only look up each user once
 	for _, subscription := range subscriptions {
-		if err := s.sendWebPushNotification(subscription, payload, v, m); err != nil {
+		if s.webPushQuietHours(subscription, m, quiet) {
+			log.Tag(tagWebPush).With(v, m, subscription).Debug("Quiet hours active, not publishing web push message")
+			continue
+		}
+		if err := s.sendWebPushNotification(subscription, payload, webPushTTL(m, s.config.CacheDuration), v, m); err != nil {
 			log.Tag(tagWebPush).Err(err).With(v, m, subscription).Warn("Unable to publish web push message")
 		}
 	}
 }
 
+// webPushQuietHours returns true if the subscription belongs to a user whose quiet hours suppress the message
+func (s *Server) webPushQuietHours(subscription *webPushSubscription, m *message, quiet map[string]bool) bool {
+	if s.userManager == nil || subscription.UserID == "" {
+		return false
+	} else if q, ok := quiet[subscription.UserID]; ok {
+		return q
+	}
+	u, err := s.userManager.UserByID(subscription.UserID)
+	if err != nil {
+		return false
+	}
+	quiet[subscription.UserID] = suppressedByQuietHours(u, m)
+	return quiet[subscription.UserID]
+}
+
 func (s *Server) pruneAndNotifyWebPushSubscriptions() {
 	if s.config.WebPushPublicKey == "" {
 		return
@@ -124,7 +145,7 @@ func (s *Server) pruneAndNotifyWebPushSubscriptionsInternal() error {
 	}
 	warningSent := make([]*webPushSubscription, 0)
 	for _, subscription := range subscriptions {
-		if err := s.sendWebPushNotification(subscription, payload); err != nil {
+		if err := s.sendWebPushNotification(subscription, payload, s.config.CacheDuration); err != nil {
 			log.Tag(tagWebPush).Err(err).With(subscription).Warn("Unable to publish expiry imminent warning")
 			continue
 		}
@@ -137,7 +158,7 @@ func (s *Server) pruneAndNotifyWebPushSubscriptionsInternal() error {
 	return nil
 }
 
-func (s *Server) sendWebPushNotification(sub *webPushSubscription, message []byte, contexters ...log.Contexter) error {
+func (s *Server) sendWebPushNotification(sub *webPushSubscription, message []byte, ttl time.Duration, contexters ...log.Contexter) error {
 	log.Tag(tagWebPush).With(sub).With(contexters...).Debug("Sending web push message")
 	payload := &webpush.Subscription{
 		Endpoint: sub.Endpoint,
@@ -151,7 +172,7 @@ func (s *Server) sendWebPushNotification(sub *webPushSubscription, message []byt
 		VAPIDPublicKey:  s.config.WebPushPublicKey,
 		VAPIDPrivateKey: s.config.WebPushPrivateKey,
 		Urgency:         webpush.UrgencyHigh, // iOS requires this to ensure delivery
-		TTL:             int(s.config.CacheDuration.Seconds()),
+		TTL:             int(ttl.Seconds()),
 	})
 	if err != nil {
 		log.Tag(tagWebPush).With(sub).With(contexters...).Err(err).Debug("Unable to publish web push message, removing endpoint")
@@ -169,3 +190,12 @@ func (s *Server) sendWebPushNotification(sub *webPushSubscription, message []byt
 	}
 	return nil
 }
+
+// webPushTTL returns the time-to-live of the web push message, i.e. the time until the message expires,
+// or the given default if the message does not expire
+func webPushTTL(m *message, defaultTTL time.Duration) time.Duration {
+	if m.Expires == 0 {
+		return defaultTTL
+	}
+	return max(time.Until(time.Unix(m.Expires, 0)), 0)
+}
@@ -254,3 +254,22 @@ func requireSubscriptionCount(t *testing.T, s *Server, topic string, expectedLen
 	require.Nil(t, err)
 	require.Len(t, subs, expectedLength)
 }
+
+func TestServer_WebPush_Publish_TTL(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithWebPush(t))
+
+	var ttl atomic.Pointer[string]
+	pushService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ttl.Store(util.String(r.Header.Get("TTL")))
+	}))
+	defer pushService.Close()
+
+	addSubscription(t, s, pushService.URL+"/push-receive", "test-topic")
+	request(t, s, "POST", "/test-topic", "your code is 123456", map[string]string{
+		"X-Expires": "90s",
+	})
+	waitFor(t, func() bool {
+		return ttl.Load() != nil
+	})
+	require.Contains(t, []string{"89", "90"}, *ttl.Load())
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Actions that WebSocket clients can send, see wsRequest
+const (
+	wsActionPublish     = "publish"
+	wsActionSubscribe   = "subscribe"
+	wsActionUnsubscribe = "unsubscribe"
+)
+
+// wsReadLimitHeadroom is the size that a WebSocket frame may exceed the size of a JSON publish request by,
+// to leave room for the fields of the request that are not part of the message (see wsReadLimit)
+const wsReadLimitHeadroom = 16 * 1024
+
+// Events that are sent to WebSocket clients in response to a wsRequest
+const (
+	wsAckEvent   = "ack"
+	wsErrorEvent = "error"
+)
+
+// wsRequest is a JSON frame sent by a WebSocket client, e.g.
+//
+//	{"id":"1","action":"publish","topic":"mytopic","message":"Hi there","priority":4}
+//	{"id":"2","action":"subscribe","topic":"othertopic","since":"10m"}
+//	{"id":"3","action":"unsubscribe","topic":"othertopic"}
+//
+// The fields of a publish request are the same as the ones in the JSON publishing format (see publishMessage).
+type wsRequest struct {
+	ID     string `json:"id"`     // Chosen by the client, and returned in the response
+	Action string `json:"action"` // One of the wsAction* constants
+	Since  string `json:"since"`  // Only for "subscribe", same format as the since= parameter
+	publishMessage
+}
+
+// wsResponse is the JSON frame sent to a WebSocket client after it sent a wsRequest, either an "ack"
+// if the request was successful, or an "error"
+type wsResponse struct {
+	Event     string   `json:"event"`
+	RequestID string   `json:"request_id,omitempty"`
+	Topic     string   `json:"topic,omitempty"`
+	Message   *message `json:"message,omitempty"` // Published message, only for "publish" requests
+	Code      int      `json:"code,omitempty"`
+	HTTPCode  int      `json:"http,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Link      string   `json:"link,omitempty"`
+}
+
+// wsSession is the state of a WebSocket subscription, most importantly the topics it is subscribed to,
+// which can be changed by the client while the connection is open
+type wsSession struct {
+	queue      *subscriberQueue
+	sub        subscriber
+	consumer   *consumer // May be nil
+	scheduled  bool
+	rateTopics []string // Topics for which the visitor should be the rate visitor, see maybeSetRateVisitors
+	userID     string   // May be empty
+	cancel     func()
+	topics     map[string]*wsSessionTopic
+	mu         sync.Mutex
+}
+
+type wsSessionTopic struct {
+	topic        *topic
+	subscriberID int
+}
+
+func newWSSession(queue *subscriberQueue, sub subscriber, consumer *consumer, scheduled bool, rateTopics []string, userID string, cancel func()) *wsSession {
+	return &wsSession{
+		queue:      queue,
+		sub:        sub,
+		consumer:   consumer,
+		scheduled:  scheduled,
+		rateTopics: rateTopics,
+		userID:     userID,
+		cancel:     cancel,
+		topics:     make(map[string]*wsSessionTopic),
+	}
+}
+
+// Subscribe subscribes the session to the given topic, and returns false if it was already subscribed
+func (s *wsSession) Subscribe(t *topic) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.topics[t.ID]; exists {
+		return false
+	}
+	s.topics[t.ID] = &wsSessionTopic{
+		topic:        t,
+		subscriberID: t.Subscribe(s.queue, s.userID, s.cancel),
+	}
+	return true
+}
+
+// Unsubscribe removes the subscription to the topic with the given ID, if it exists
+func (s *wsSession) Unsubscribe(topicID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, exists := s.topics[topicID]; exists {
+		st.topic.Unsubscribe(st.subscriberID)
+		delete(s.topics, topicID)
+	}
+}
+
+// UnsubscribeAll removes all subscriptions, and must be called when the connection is closed
+func (s *wsSession) UnsubscribeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for topicID, st := range s.topics {
+		st.topic.Unsubscribe(st.subscriberID)
+		delete(s.topics, topicID)
+	}
+}
+
+// Subscribed returns true if the session is subscribed to the topic with the given ID
+func (s *wsSession) Subscribed(topicID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.topics[topicID]
+	return exists
+}
+
+// Topics returns the topics the session is currently subscribed to
+func (s *wsSession) Topics() []*topic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topics := make([]*topic, 0, len(s.topics))
+	for _, st := range s.topics {
+		topics = append(topics, st.topic)
+	}
+	return topics
+}
+
+// handleWebSocketRequest parses and executes a request sent by a WebSocket client, and returns the response
+// that should be sent back. Errors are never returned, but instead sent back to the client as "error" frame,
+// so that a single bad request does not close the connection.
+func (s *Server) handleWebSocketRequest(r *http.Request, v *visitor, session *wsSession, data []byte) *wsResponse {
+	var req wsRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return newWSErrorResponse(&req, errHTTPBadRequestWebSocketRequestInvalid)
+	}
+	logvr(v, r).
+		Tag(tagWebsocket).
+		Fields(log.Context{
+			"websocket_request_id":     req.ID,
+			"websocket_request_action": req.Action,
+			"websocket_request_topic":  req.Topic,
+		}).
+		Debug("Received WebSocket %s request", req.Action)
+	var m *message
+	var err error
+	switch req.Action {
+	case wsActionPublish:
+		m, err = s.handleWebSocketPublish(r, v, &req)
+	case wsActionSubscribe:
+		err = s.handleWebSocketSubscribe(r, v, session, &req)
+	case wsActionUnsubscribe:
+		err = s.handleWebSocketUnsubscribe(session, &req)
+	default:
+		err = errHTTPBadRequestWebSocketRequestInvalid
+	}
+	if err != nil {
+		var httpErr *errHTTP
+		if !errors.As(err, &httpErr) {
+			logvr(v, r).Tag(tagWebsocket).Err(err).Warn("Error handling WebSocket %s request", req.Action)
+			httpErr = errHTTPInternalError
+		}
+		return newWSErrorResponse(&req, httpErr)
+	}
+	return &wsResponse{
+		Event:     wsAckEvent,
+		RequestID: req.ID,
+		Topic:     req.Topic,
+		Message:   m,
+	}
+}
+
+// handleWebSocketPublish publishes a message via the same handler chain as a JSON publish request (see
+// transformBodyJSON), so that rate limits and access control are applied exactly as if the message had been
+// published via HTTP. Only the fields of the request are used, not the headers of the WebSocket request.
+func (s *Server) handleWebSocketPublish(r *http.Request, v *visitor, req *wsRequest) (*message, error) {
+	body, err := json.Marshal(&req.publishMessage)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := http.NewRequestWithContext(r.Context(), http.MethodPost, "/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	pr.RemoteAddr = r.RemoteAddr
+	var m *message
+	publish := func(_ http.ResponseWriter, r *http.Request, v *visitor) error {
+		m, err = s.handlePublishInternal(r, v)
+		return err
+	}
+	// None of the handlers in the chain write to the response writer, so we can pass nil
+	if err := s.transformBodyJSON(s.limitRequestsWithTopic(s.authorizeTopicWrite(publish)))(nil, pr, v); err != nil {
+		minc(metricMessagesPublishedFailure)
+		return nil, err
+	}
+	minc(metricMessagesPublishedSuccess)
+	return m, nil
+}
+
+// handleWebSocketSubscribe adds a topic to the session, and sends cached messages if "since" is set. The same
+// limits apply as when subscribing via HTTP: the request limit of the visitor (see limitRequests), the total topic
+// limit (see topicsFromIDs), and the rate topics passed when the connection was opened (see maybeSetRateVisitors).
+func (s *Server) handleWebSocketSubscribe(r *http.Request, v *visitor, session *wsSession, req *wsRequest) error {
+	if !topicRegex.MatchString(req.Topic) {
+		return errHTTPBadRequestWebSocketRequestInvalid
+	} else if !util.ContainsIP(s.config.VisitorRequestExemptIPAddrs, v.ip) && !v.RequestAllowed() {
+		return errHTTPTooManyRequestsLimitRequests
+	}
+	since, err := parseSinceString(req.Since, false)
+	if err != nil {
+		return err
+	}
+	if s.userManager != nil {
+		if err := s.userManager.Authorize(v.User(), req.Topic, user.PermissionRead); err != nil {
+			return errHTTPForbidden
+		}
+	}
+	t, err := s.topicFromID(req.Topic)
+	if err != nil {
+		return err
+	}
+	if !session.Subscribe(t) {
+		return nil // Already subscribed, nothing to do
+	}
+	if err := s.maybeSetRateVisitors(r, v, []*topic{t}, session.rateTopics); err != nil {
+		return err
+	}
+	return s.sendOldMessages([]*topic{t}, since, session.consumer, session.scheduled, v, session.sub)
+}
+
+// handleWebSocketUnsubscribe removes a topic from the session; unsubscribing from a topic that the session
+// is not subscribed to is not an error. If the topic matches one of the topic patterns of the session, messages
+// are delivered via the pattern subscription from now on.
+func (s *Server) handleWebSocketUnsubscribe(session *wsSession, req *wsRequest) error {
+	if !topicRegex.MatchString(req.Topic) {
+		return errHTTPBadRequestWebSocketRequestInvalid
+	}
+	session.Unsubscribe(req.Topic)
+	if t := s.topics.Get(req.Topic); t != nil {
+		s.topicPatterns.Attach(t)
+	}
+	return nil
+}
+
+func newWSErrorResponse(req *wsRequest, err *errHTTP) *wsResponse {
+	return &wsResponse{
+		Event:     wsErrorEvent,
+		RequestID: req.ID,
+		Topic:     req.Topic,
+		Code:      err.Code,
+		HTTPCode:  err.HTTPCode,
+		Error:     err.Message,
+		Link:      err.Link,
+	}
+}
+
+// wsReadLimit returns the maximum size of a frame a WebSocket client may send, which is the maximum size of a
+// JSON publish request (see transformBodyJSON) plus room for the other fields of the request. Frames larger than
+// this close the connection, whereas publish requests that are only too large for transformBodyJSON are answered
+// with an "error" frame.
+func (s *Server) wsReadLimit() int64 {
+	return util.Max(int64(s.config.MessageLimit)*2+wsReadLimitHeadroom, wsBufferSize)
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_WebSocket_Publish(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	conn := dialWebSocket(t, s, "/mytopic/ws", nil)
+	require.Equal(t, "open", readWebSocketFrame(t, conn)["event"])
+
+	require.Nil(t, conn.WriteJSON(map[string]any{
+		"id":       "req1",
+		"action":   "publish",
+		"topic":    "mytopic",
+		"message":  "hi there",
+		"title":    "some title",
+		"priority": 4,
+	}))
+
+	// The ack and the message itself may arrive in any order
+	frames := map[string]map[string]any{}
+	for i := 0; i < 2; i++ {
+		frame := readWebSocketFrame(t, conn)
+		frames[frame["event"].(string)] = frame
+	}
+	require.Equal(t, "req1", frames["ack"]["request_id"])
+	published := frames["ack"]["message"].(map[string]any)
+	require.Equal(t, "hi there", published["message"])
+	require.Equal(t, "hi there", frames["message"]["message"])
+	require.Equal(t, "some title", frames["message"]["title"])
+	require.Equal(t, float64(4), frames["message"]["priority"])
+	require.Equal(t, published["id"], frames["message"]["id"])
+
+	messages := toMessages(t, request(t, s, "GET", "/mytopic/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "hi there", messages[0].Message)
+}
+
+func TestServer_WebSocket_SubscribeUnsubscribe(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	request(t, s, "PUT", "/topic2", "old message", nil)
+
+	conn := dialWebSocket(t, s, "/topic1/ws", nil)
+	require.Equal(t, "open", readWebSocketFrame(t, conn)["event"])
+
+	// Subscribe to topic2, including cached messages
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "1", "action": "subscribe", "topic": "topic2", "since": "all"}))
+	frame := readWebSocketFrame(t, conn)
+	require.Equal(t, "message", frame["event"])
+	require.Equal(t, "old message", frame["message"])
+	frame = readWebSocketFrame(t, conn)
+	require.Equal(t, "ack", frame["event"])
+	require.Equal(t, "1", frame["request_id"])
+	require.Equal(t, "topic2", frame["topic"])
+
+	request(t, s, "PUT", "/topic2", "new message", nil)
+	frame = readWebSocketFrame(t, conn)
+	require.Equal(t, "topic2", frame["topic"])
+	require.Equal(t, "new message", frame["message"])
+
+	// Unsubscribe from topic2, messages in topic1 are still received
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "2", "action": "unsubscribe", "topic": "topic2"}))
+	frame = readWebSocketFrame(t, conn)
+	require.Equal(t, "ack", frame["event"])
+	require.Equal(t, "2", frame["request_id"])
+
+	request(t, s, "PUT", "/topic2", "ignored message", nil)
+	request(t, s, "PUT", "/topic1", "topic1 message", nil)
+	frame = readWebSocketFrame(t, conn)
+	require.Equal(t, "topic1", frame["topic"])
+	require.Equal(t, "topic1 message", frame["message"])
+}
+
+func TestServer_WebSocket_AccessControl(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser))
+	require.Nil(t, s.userManager.AllowAccess("ben", "readonly", user.PermissionRead))
+
+	conn := dialWebSocket(t, s, "/readonly/ws", http.Header{
+		"Authorization": []string{util.BasicAuth("ben", "ben")},
+	})
+	require.Equal(t, "open", readWebSocketFrame(t, conn)["event"])
+
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "1", "action": "publish", "topic": "readonly", "message": "hi"}))
+	frame := readWebSocketFrame(t, conn)
+	require.Equal(t, "error", frame["event"])
+	require.Equal(t, "1", frame["request_id"])
+	require.Equal(t, float64(40301), frame["code"])
+	require.Equal(t, float64(403), frame["http"])
+
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "2", "action": "subscribe", "topic": "secret"}))
+	frame = readWebSocketFrame(t, conn)
+	require.Equal(t, "error", frame["event"])
+	require.Equal(t, float64(40301), frame["code"])
+}
+
+func TestServer_WebSocket_SubscribeLimits(t *testing.T) {
+	c := newTestConfig(t)
+	c.TotalTopicLimit = 2
+	c.VisitorSubscriberRateLimiting = true
+	s := newTestServer(t, c)
+
+	conn := dialWebSocket(t, s, "/topic1/ws?rate-topics=topic2", nil)
+	require.Equal(t, "open", readWebSocketFrame(t, conn)["event"])
+
+	// Rate topics passed when connecting apply to topics subscribed later
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "1", "action": "subscribe", "topic": "topic2"}))
+	require.Equal(t, "ack", readWebSocketFrame(t, conn)["event"])
+	topic2, err := s.topicFromID("topic2")
+	require.Nil(t, err)
+	require.NotNil(t, topic2.RateVisitor())
+
+	// The total topic limit applies as well
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "2", "action": "subscribe", "topic": "topic3"}))
+	frame := readWebSocketFrame(t, conn)
+	require.Equal(t, "error", frame["event"])
+	require.Equal(t, float64(42904), frame["code"])
+}
+
+func TestServer_WebSocket_InvalidRequest(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	conn := dialWebSocket(t, s, "/mytopic/ws", nil)
+	require.Equal(t, "open", readWebSocketFrame(t, conn)["event"])
+
+	require.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	frame := readWebSocketFrame(t, conn)
+	require.Equal(t, "error", frame["event"])
+	require.Equal(t, float64(40061), frame["code"])
+
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "1", "action": "dance", "topic": "mytopic"}))
+	frame = readWebSocketFrame(t, conn)
+	require.Equal(t, "1", frame["request_id"])
+	require.Equal(t, float64(40061), frame["code"])
+
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "2", "action": "subscribe", "topic": "not a topic!"}))
+	frame = readWebSocketFrame(t, conn)
+	require.Equal(t, "2", frame["request_id"])
+	require.Equal(t, float64(40061), frame["code"])
+}
+
+func TestServer_WebSocket_PublishTooLarge(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	conn := dialWebSocket(t, s, "/mytopic/ws", nil)
+	require.Equal(t, "open", readWebSocketFrame(t, conn)["event"])
+
+	// Too large for a JSON publish request, but within the read limit, so the connection stays open
+	require.Nil(t, conn.WriteJSON(map[string]any{
+		"id":      "1",
+		"action":  "publish",
+		"topic":   "mytopic",
+		"message": strings.Repeat("x", s.config.MessageLimit*2+100),
+	}))
+	frame := readWebSocketFrame(t, conn)
+	require.Equal(t, "error", frame["event"])
+	require.Equal(t, "1", frame["request_id"])
+	require.Equal(t, float64(41303), frame["code"])
+
+	require.Nil(t, conn.WriteJSON(map[string]any{"id": "2", "action": "unsubscribe", "topic": "othertopic"}))
+	frame = readWebSocketFrame(t, conn)
+	require.Equal(t, "ack", frame["event"])
+	require.Equal(t, "2", frame["request_id"])
+}
+
+func dialWebSocket(t *testing.T, s *Server, path string, header http.Header) *websocket.Conn {
+	httpServer := httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(httpServer.Close)
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(httpServer.URL, "http://", "ws://", 1)+path, header)
+	require.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readWebSocketFrame(t *testing.T, conn *websocket.Conn) map[string]any {
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var frame map[string]any
+	require.Nil(t, conn.ReadJSON(&frame))
+	return frame
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"sync"
+)
+
+// subscriberQueue is a bounded, ordered queue of messages for a single subscriber (i.e. a single HTTP stream or
+// WebSocket connection). Messages are added by the topics without blocking, and are written to the subscriber by a
+// single writer Go routine (see Run), so that a slow subscriber cannot block publishers or other subscribers, and
+// messages are delivered in the order in which they were published.
+type subscriberQueue struct {
+	subscriber subscriber
+	cancel     func()
+	size       int
+	policy     string
+	items      []*subscriberQueueItem
+	notifyChan chan struct{}
+	closeChan  chan struct{}
+	closed     bool
+	mu         sync.Mutex
+}
+
+type subscriberQueueItem struct {
+	v *visitor
+	m *message
+}
+
+// newSubscriberQueue creates a new queue for the given subscriber. The cancel function is called if the queue
+// overflows and the policy is SubscriberQueueOverflowDisconnect.
+func newSubscriberQueue(sub subscriber, cancel func(), size int, policy string) *subscriberQueue {
+	if size <= 0 {
+		size = DefaultSubscriberQueueSize
+	}
+	return &subscriberQueue{
+		subscriber: sub,
+		cancel:     cancel,
+		size:       size,
+		policy:     policy,
+		items:      make([]*subscriberQueueItem, 0),
+		notifyChan: make(chan struct{}, 1),
+		closeChan:  make(chan struct{}),
+	}
+}
+
+// Enqueue adds the message to the queue without blocking. If the queue is full, the overflow policy is applied.
+func (q *subscriberQueue) Enqueue(v *visitor, m *message) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	if len(q.items) >= q.size {
+		if q.policy == SubscriberQueueOverflowDisconnect {
+			q.closed = true
+			madd(metricSubscriberQueueDepth, -len(q.items))
+			q.items = nil
+			q.mu.Unlock()
+			logvm(v, m).Tag(tagSubscribe).Field("subscriber_queue_size", q.size).Debug("Subscriber queue full, disconnecting slow subscriber")
+			minc(metricSubscribersDisconnected)
+			q.cancel()
+			return
+		}
+		q.items = q.items[1:]
+		madd(metricSubscriberQueueDepth, -1)
+		minc(metricSubscriberMessagesDropped)
+		logvm(v, m).Tag(tagSubscribe).Field("subscriber_queue_size", q.size).Trace("Subscriber queue full, dropping oldest message")
+	}
+	q.items = append(q.items, &subscriberQueueItem{v: v, m: m})
+	madd(metricSubscriberQueueDepth, 1)
+	q.mu.Unlock()
+	select {
+	case q.notifyChan <- struct{}{}:
+	default:
+	}
+}
+
+// Run writes queued messages to the subscriber until the queue is closed. It must only be called once.
+func (q *subscriberQueue) Run() {
+	for {
+		select {
+		case <-q.notifyChan:
+			for {
+				item := q.dequeue()
+				if item == nil {
+					break
+				}
+				if err := q.subscriber(item.v, item.m); err != nil {
+					logvm(item.v, item.m).Tag(tagPublish).Err(err).Warn("Error forwarding to subscriber")
+				}
+			}
+		case <-q.closeChan:
+			return
+		}
+	}
+}
+
+// Depth returns the number of messages waiting to be written to the subscriber
+func (q *subscriberQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Close stops the writer Go routine and discards all queued messages
+func (q *subscriberQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		madd(metricSubscriberQueueDepth, -len(q.items))
+		q.items = nil
+	}
+	select {
+	case <-q.closeChan:
+	default:
+		close(q.closeChan)
+	}
+}
+
+func (q *subscriberQueue) dequeue() *subscriberQueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || len(q.items) == 0 {
+		return nil
+	}
+	item := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	madd(metricSubscriberQueueDepth, -1)
+	return item
+}
@@ -23,13 +23,14 @@ type topic struct {
 	subscribers map[int]*topicSubscriber
 	rateVisitor *visitor
 	lastAccess  time.Time
+	seqMu       sync.Mutex // Serializes assigning sequence numbers and publishing, see PublishSeq
 	mu          sync.RWMutex
 }
 
 type topicSubscriber struct {
-	userID     string // User ID associated with this subscription, may be empty
-	subscriber subscriber
-	cancel     func()
+	userID string // User ID associated with this subscription, may be empty
+	queue  *subscriberQueue
+	cancel func()
 }
 
 // subscriber is a function that is called for every new message on a topic
@@ -44,8 +45,8 @@ func newTopic(id string) *topic {
 	}
 }
 
-// Subscribe subscribes to this topic
-func (t *topic) Subscribe(s subscriber, userID string, cancel func()) (subscriberID int) {
+// Subscribe subscribes to this topic. Messages are added to the given queue, which may be shared between topics.
+func (t *topic) Subscribe(q *subscriberQueue, userID string, cancel func()) (subscriberID int) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	for i := 0; i < 5; i++ { // Best effort retry
@@ -56,9 +57,9 @@ func (t *topic) Subscribe(s subscriber, userID string, cancel func()) (subscribe
 		}
 	}
 	t.subscribers[subscriberID] = &topicSubscriber{
-		userID:     userID, // May be empty
-		subscriber: s,
-		cancel:     cancel,
+		userID: userID, // May be empty
+		queue:  q,
+		cancel: cancel,
 	}
 	t.lastAccess = time.Now()
 	return subscriberID
@@ -102,31 +103,42 @@ func (t *topic) Unsubscribe(id int) {
 	delete(t.subscribers, id)
 }
 
-// Publish asynchronously publishes to all subscribers
+// Publish asynchronously publishes to all subscribers. The message is added to the queue of each subscriber,
+// which never blocks, so individual slow subscribers cannot block others, or the publisher.
 func (t *topic) Publish(v *visitor, m *message) error {
-	go func() {
-		// We want to lock the topic as short as possible, so we make a shallow copy of the
-		// subscribers map here. Actually sending out the messages then doesn't have to lock.
-		subscribers := t.subscribersCopy()
-		if len(subscribers) > 0 {
-			logvm(v, m).Tag(tagPublish).Debug("Forwarding to %d subscriber(s)", len(subscribers))
-			for _, s := range subscribers {
-				// We call the subscriber functions in their own Go routines because they are blocking, and
-				// we don't want individual slow subscribers to be able to block others.
-				go func(s subscriber) {
-					if err := s(v, m); err != nil {
-						logvm(v, m).Tag(tagPublish).Err(err).Warn("Error forwarding to subscriber")
-					}
-				}(s.subscriber)
+	// We want to lock the topic as short as possible, so we make a shallow copy of the
+	// subscribers map here. Actually queueing the messages then doesn't have to lock.
+	subscribers := t.subscribersCopy()
+	if len(subscribers) > 0 {
+		logvm(v, m).Tag(tagPublish).Debug("Forwarding to %d subscriber(s)", len(subscribers))
+		// A queue may be subscribed more than once, e.g. explicitly and via a topic pattern (see
+		// topicPatternSubscription), but the message must only be added to it once
+		queued := make(map[*subscriberQueue]struct{}, len(subscribers))
+		for _, s := range subscribers {
+			if _, exists := queued[s.queue]; exists {
+				continue
 			}
-		} else {
-			logvm(v, m).Tag(tagPublish).Trace("No stream or WebSocket subscribers, not forwarding")
+			queued[s.queue] = struct{}{}
+			s.queue.Enqueue(v, m)
 		}
-		t.Keepalive()
-	}()
+	} else {
+		logvm(v, m).Tag(tagPublish).Trace("No stream or WebSocket subscribers, not forwarding")
+	}
+	t.Keepalive()
 	return nil
 }
 
+// PublishSeq assigns the next sequence number of this topic to the message, and then publishes it to all
+// subscribers (see Publish). Both happen while holding the same lock, so subscribers always receive messages
+// in sequence order. The sequence number is taken from nextSeq, which keeps the counters of all topics, so that
+// a number is not handed out twice if the topic is removed from memory and loaded again.
+func (t *topic) PublishSeq(v *visitor, m *message, nextSeq func(topic string) int64) error {
+	t.seqMu.Lock()
+	defer t.seqMu.Unlock()
+	m.Seq = nextSeq(t.ID)
+	return t.Publish(v, m)
+}
+
 // Stats returns the number of subscribers and last access to this topic
 func (t *topic) Stats() (int, time.Time) {
 	t.mu.RLock()
@@ -152,14 +164,13 @@ func (t *topic) CancelSubscribersExceptUser(exceptUserID string) {
 	}
 }
 
-// CancelSubscriberUser kills the subscriber with the given user ID
-func (t *topic) CancelSubscriberUser(userID string) {
+// CancelSubscribersUser kills all subscribers with the given user ID
+func (t *topic) CancelSubscribersUser(userID string) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 	for _, s := range t.subscribers {
 		if s.userID == userID {
 			t.cancelUserSubscriber(s)
-			return
 		}
 	}
 }
@@ -198,9 +209,9 @@ func (t *topic) subscribersCopy() map[int]*topicSubscriber {
 	subscribers := make(map[int]*topicSubscriber)
 	for k, sub := range t.subscribers {
 		subscribers[k] = &topicSubscriber{
-			userID:     sub.userID,
-			subscriber: sub.subscriber,
-			cancel:     sub.cancel,
+			userID: sub.userID,
+			queue:  sub.queue,
+			cancel: sub.cancel,
 		}
 	}
 	return subscribers
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"math/rand"
 	"sync/atomic"
 	"testing"
@@ -24,8 +25,8 @@ func TestTopic_CancelSubscribersExceptUser(t *testing.T) {
 		canceled2.Store(true)
 	}
 	to := newTopic("mytopic")
-	to.Subscribe(subFn, "", cancelFn1)
-	to.Subscribe(subFn, "u_phil", cancelFn2)
+	to.Subscribe(newSubscriberQueue(subFn, cancelFn1, 0, SubscriberQueueOverflowDropOldest), "", cancelFn1)
+	to.Subscribe(newSubscriberQueue(subFn, cancelFn2, 0, SubscriberQueueOverflowDropOldest), "u_phil", cancelFn2)
 
 	to.CancelSubscribersExceptUser("u_phil")
 	require.True(t, canceled1.Load())
@@ -46,13 +47,19 @@ func TestTopic_CancelSubscribersUser(t *testing.T) {
 	cancelFn2 := func() {
 		canceled2.Store(true)
 	}
+	canceled3 := atomic.Bool{}
+	cancelFn3 := func() {
+		canceled3.Store(true)
+	}
 	to := newTopic("mytopic")
-	to.Subscribe(subFn, "u_another", cancelFn1)
-	to.Subscribe(subFn, "u_phil", cancelFn2)
+	to.Subscribe(newSubscriberQueue(subFn, cancelFn1, 0, SubscriberQueueOverflowDropOldest), "u_another", cancelFn1)
+	to.Subscribe(newSubscriberQueue(subFn, cancelFn2, 0, SubscriberQueueOverflowDropOldest), "u_phil", cancelFn2)
+	to.Subscribe(newSubscriberQueue(subFn, cancelFn3, 0, SubscriberQueueOverflowDropOldest), "u_phil", cancelFn3)
 
-	to.CancelSubscriberUser("u_phil")
+	to.CancelSubscribersUser("u_phil")
 	require.False(t, canceled1.Load())
 	require.True(t, canceled2.Load())
+	require.True(t, canceled3.Load())
 }
 
 func TestTopic_Keepalive(t *testing.T) {
@@ -73,9 +80,9 @@ func TestTopic_Subscribe_DuplicateID(t *testing.T) {
 	rand.Seed(1)
 	a := rand.Int()
 	to.subscribers[a] = &topicSubscriber{
-		userID:     "a",
-		subscriber: nil,
-		cancel:     func() {},
+		userID: "a",
+		queue:  nil,
+		cancel: func() {},
 	}
 
 	subFn := func(v *visitor, msg *message) error {
@@ -84,9 +91,65 @@ func TestTopic_Subscribe_DuplicateID(t *testing.T) {
 
 	//lint:ignore SA1019 Force rand.Int to generate the same id once more
 	rand.Seed(1)
-	id := to.Subscribe(subFn, "b", func() {})
+	id := to.Subscribe(newSubscriberQueue(subFn, func() {}, 0, SubscriberQueueOverflowDropOldest), "b", func() {})
 	res := to.subscribers[id]
 
 	require.NotEqual(t, id, a)
 	require.Equal(t, "b", res.userID, "b")
 }
+
+func TestTopic_Publish_OrderedWithSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan string, 10)
+	slowFn := func(v *visitor, msg *message) error {
+		time.Sleep(10 * time.Millisecond)
+		received <- msg.Message
+		return nil
+	}
+	queue := newSubscriberQueue(slowFn, func() {}, 10, SubscriberQueueOverflowDropOldest)
+	defer queue.Close()
+	go queue.Run()
+
+	to := newTopic("mytopic")
+	to.Subscribe(queue, "", func() {})
+	for i := 0; i < 5; i++ {
+		require.Nil(t, to.Publish(nil, newDefaultMessage("mytopic", fmt.Sprintf("message %d", i))))
+	}
+	for i := 0; i < 5; i++ {
+		require.Equal(t, fmt.Sprintf("message %d", i), <-received)
+	}
+}
+
+func TestTopic_Publish_SubscriberQueueDropOldest(t *testing.T) {
+	t.Parallel()
+
+	queue := newSubscriberQueue(func(v *visitor, msg *message) error { return nil }, func() {}, 3, SubscriberQueueOverflowDropOldest)
+	defer queue.Close()
+
+	to := newTopic("mytopic")
+	to.Subscribe(queue, "", func() {})
+	for i := 0; i < 5; i++ {
+		require.Nil(t, to.Publish(nil, newDefaultMessage("mytopic", fmt.Sprintf("message %d", i))))
+	}
+	require.Equal(t, 3, queue.Depth())
+	require.Equal(t, "message 2", queue.dequeue().m.Message)
+}
+
+func TestTopic_Publish_SubscriberQueueDisconnect(t *testing.T) {
+	t.Parallel()
+
+	canceled := atomic.Bool{}
+	queue := newSubscriberQueue(func(v *visitor, msg *message) error { return nil }, func() { canceled.Store(true) }, 3, SubscriberQueueOverflowDisconnect)
+	defer queue.Close()
+
+	to := newTopic("mytopic")
+	to.Subscribe(queue, "", func() {})
+	for i := 0; i < 3; i++ {
+		require.Nil(t, to.Publish(nil, newDefaultMessage("mytopic", fmt.Sprintf("message %d", i))))
+	}
+	require.False(t, canceled.Load())
+	require.Nil(t, to.Publish(nil, newDefaultMessage("mytopic", "one too many")))
+	require.True(t, canceled.Load())
+	require.Equal(t, 0, queue.Depth())
+}
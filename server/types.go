@@ -25,24 +25,28 @@ const (
 
 // message represents a message published to a topic
 type message struct {
-	ID          string      `json:"id"`                // Random message ID
-	Time        int64       `json:"time"`              // Unix time in seconds
-	Expires     int64       `json:"expires,omitempty"` // Unix time in seconds (not required for open/keepalive)
-	Event       string      `json:"event"`             // One of the above
-	Topic       string      `json:"topic"`
-	Title       string      `json:"title,omitempty"`
-	Message     string      `json:"message,omitempty"`
-	Priority    int         `json:"priority,omitempty"`
-	Tags        []string    `json:"tags,omitempty"`
-	Click       string      `json:"click,omitempty"`
-	Icon        string      `json:"icon,omitempty"`
-	Actions     []*action   `json:"actions,omitempty"`
-	Attachment  *attachment `json:"attachment,omitempty"`
-	PollID      string      `json:"poll_id,omitempty"`
-	ContentType string      `json:"content_type,omitempty"` // text/plain by default (if empty), or text/markdown
-	Encoding    string      `json:"encoding,omitempty"`     // empty for raw UTF-8, or "base64" for encoded bytes
-	Sender      netip.Addr  `json:"-"`                      // IP address of uploader, used for rate limiting
-	User        string      `json:"-"`                      // UserID of the uploader, used to associated attachments
+	ID              string      `json:"id"`                // Random message ID
+	Time            int64       `json:"time"`              // Unix time in seconds
+	Expires         int64       `json:"expires,omitempty"` // Unix time in seconds (not required for open/keepalive)
+	Event           string      `json:"event"`             // One of the above
+	Topic           string      `json:"topic"`
+	Seq             int64       `json:"seq,omitempty"` // Per-topic sequence number, increases by one with every published message
+	Title           string      `json:"title,omitempty"`
+	Message         string      `json:"message,omitempty"`
+	Priority        int         `json:"priority,omitempty"`
+	Tags            []string    `json:"tags,omitempty"`
+	Click           string      `json:"click,omitempty"`
+	Icon            string      `json:"icon,omitempty"`
+	Actions         []*action   `json:"actions,omitempty"`
+	Attachment      *attachment `json:"attachment,omitempty"`
+	PollID          string      `json:"poll_id,omitempty"`
+	ContentType     string      `json:"content_type,omitempty"` // text/plain by default (if empty), or text/markdown
+	Encoding        string      `json:"encoding,omitempty"`     // empty for raw UTF-8, or "base64" for encoded bytes
+	Count           int         `json:"count,omitempty"`        // Number of identical messages received within the deduplication window, see X-Dedup
+	Source          string      `json:"source,omitempty"`       // Source of the CloudEvent the message was published from, see transformCloudEvent
+	Sender          netip.Addr  `json:"-"`                      // IP address of uploader, used for rate limiting
+	User            string      `json:"-"`                      // UserID of the uploader, used to associated attachments
+	ExpiresExplicit bool        `json:"-"`                      // True if the publisher passed X-Expires/X-TTL, used for the push TTL
 }
 
 func (m *message) Context() log.Context {
@@ -51,6 +55,7 @@ func (m *message) Context() log.Context {
 		"message_id":        m.ID,
 		"message_time":      m.Time,
 		"message_event":     m.Event,
+		"message_seq":       m.Seq,
 		"message_body_size": len(m.Message),
 	}
 	if m.Sender.IsValid() {
@@ -62,6 +67,38 @@ func (m *message) Context() log.Context {
 	return fields
 }
 
+// escalation is the escalation policy of a message (see X-Escalate), and its acknowledgement state
+type escalation struct {
+	MessageID string
+	Topic     string
+	Key       string // Random key to acknowledge the message without credentials, used in the action button
+	Steps     []*escalationStep
+	NextStep  int    // Index of the next step in Steps
+	Due       int64  // Unix time in seconds at which the next step is due, 0 if no steps are left
+	Acked     int64  // Unix time in seconds of the acknowledgement, 0 if not acknowledged
+	AckedBy   string // Username of the acknowledging user, empty if anonymous
+}
+
+// heartbeat is a dead man's switch for a topic: if the topic is not pinged at least every Interval seconds,
+// an alert message is published to the topic, and once it is pinged again, a recovery message
+type heartbeat struct {
+	Topic           string
+	Interval        int64 // Seconds between pings
+	LastPing        int64 // Unix time in seconds of the last ping
+	Overdue         bool  // True if the alert message was published, and no ping has been received since
+	Message         string
+	RecoveryMessage string
+	Sender          netip.Addr
+	User            string // User ID of the user who last pinged the heartbeat, if any
+}
+
+// escalationStep is a single step of an escalation policy, e.g. "15m call"
+type escalationStep struct {
+	After  int64  `json:"after"`            // Seconds after the message time
+	Action string `json:"action"`           // One of the escalateAction... constants
+	Target string `json:"target,omitempty"` // E-mail address or phone number
+}
+
 type attachment struct {
 	Name    string `json:"name"`
 	Type    string `json:"type,omitempty"`
@@ -106,6 +143,11 @@ type publishMessage struct {
 	Email    string   `json:"email"`
 	Call     string   `json:"call"`
 	Delay    string   `json:"delay"`
+	Escalate string   `json:"escalate"`
+	OnCall   string   `json:"on_call"`
+	Dedup    string   `json:"dedup"`
+	DedupKey string   `json:"dedup_key"`
+	TTL      string   `json:"ttl"`
 }
 
 // messageEncoder is a function that knows how to encode a message
@@ -151,14 +193,19 @@ func validMessageID(s string) bool {
 type sinceMarker struct {
 	time time.Time
 	id   string
+	seq  int64
 }
 
 func newSinceTime(timestamp int64) sinceMarker {
-	return sinceMarker{time.Unix(timestamp, 0), ""}
+	return sinceMarker{time.Unix(timestamp, 0), "", 0}
 }
 
 func newSinceID(id string) sinceMarker {
-	return sinceMarker{time.Unix(0, 0), id}
+	return sinceMarker{time.Unix(0, 0), id, 0}
+}
+
+func newSinceSeq(seq int64) sinceMarker {
+	return sinceMarker{time.Unix(0, 0), "", seq}
 }
 
 func (t sinceMarker) IsAll() bool {
@@ -173,6 +220,10 @@ func (t sinceMarker) IsID() bool {
 	return t.id != ""
 }
 
+func (t sinceMarker) IsSeq() bool {
+	return t.seq > 0
+}
+
 func (t sinceMarker) Time() time.Time {
 	return t.time
 }
@@ -181,9 +232,13 @@ func (t sinceMarker) ID() string {
 	return t.id
 }
 
+func (t sinceMarker) Seq() int64 {
+	return t.seq
+}
+
 var (
-	sinceAllMessages = sinceMarker{time.Unix(0, 0), ""}
-	sinceNoMessages  = sinceMarker{time.Unix(1, 0), ""}
+	sinceAllMessages = sinceMarker{time.Unix(0, 0), "", 0}
+	sinceNoMessages  = sinceMarker{time.Unix(1, 0), "", 0}
 )
 
 type queryFilter struct {
@@ -265,16 +320,135 @@ type apiUserResponse struct {
 type apiUserGrantResponse struct {
 	Topic      string `json:"topic"` // This may be a pattern
 	Permission string `json:"permission"`
+	Expires    int64  `json:"expires,omitempty"` // Unix timestamp
+}
+
+type apiUserChangeRequest struct {
+	Username string  `json:"username"`
+	Role     string  `json:"role,omitempty"` // Role is not changed if empty
+	Tier     *string `json:"tier,omitempty"` // Tier is not changed if nil, and removed if empty
 }
 
 type apiUserDeleteRequest struct {
 	Username string `json:"username"`
 }
 
+type apiUserTokenDeleteRequest struct {
+	Username string `json:"username"`
+	Token    string `json:"token,omitempty"` // Masked token (e.g. "tk_abcde..."), as returned when listing tokens
+	Label    string `json:"label,omitempty"`
+}
+
+type apiUserReservationRequest struct {
+	Username string `json:"username"`
+	Topic    string `json:"topic"`
+	Everyone string `json:"everyone"`
+}
+
+type apiUserReservationDeleteRequest struct {
+	Username       string `json:"username"`
+	Topic          string `json:"topic"`
+	DeleteMessages bool   `json:"delete_messages,omitempty"`
+}
+
+type apiTierRequest struct {
+	Code                     string  `json:"code"`
+	Name                     *string `json:"name,omitempty"`
+	Messages                 *int64  `json:"messages,omitempty"`
+	MessagesExpiryDuration   *int64  `json:"messages_expiry_duration,omitempty"` // Seconds
+	MessagesKeepLast         *int64  `json:"messages_keep_last,omitempty"`
+	Emails                   *int64  `json:"emails,omitempty"`
+	Calls                    *int64  `json:"calls,omitempty"`
+	Reservations             *int64  `json:"reservations,omitempty"`
+	AttachmentTotalSize      *int64  `json:"attachment_total_size,omitempty"`      // Bytes
+	AttachmentFileSize       *int64  `json:"attachment_file_size,omitempty"`       // Bytes
+	AttachmentExpiryDuration *int64  `json:"attachment_expiry_duration,omitempty"` // Seconds
+	AttachmentBandwidth      *int64  `json:"attachment_bandwidth,omitempty"`       // Bytes
+	StripeMonthlyPriceID     *string `json:"stripe_monthly_price_id,omitempty"`
+	StripeYearlyPriceID      *string `json:"stripe_yearly_price_id,omitempty"`
+}
+
+type apiTierResponse struct {
+	Code                 string            `json:"code"`
+	Name                 string            `json:"name"`
+	Limits               *apiAccountLimits `json:"limits"`
+	StripeMonthlyPriceID string            `json:"stripe_monthly_price_id,omitempty"`
+	StripeYearlyPriceID  string            `json:"stripe_yearly_price_id,omitempty"`
+}
+
+type apiTierDeleteRequest struct {
+	Code string `json:"code"`
+}
+
+type apiMessageAckResponse struct {
+	ID      string `json:"id"`
+	Acked   int64  `json:"acked,omitempty"`
+	AckedBy string `json:"acked_by,omitempty"`
+	Next    int64  `json:"next,omitempty"` // Time of the next escalation step, if not acknowledged
+}
+
+type apiHeartbeatResponse struct {
+	Topic    string `json:"topic"`
+	Interval int64  `json:"interval"`
+	LastPing int64  `json:"last_ping"`
+	NextDue  int64  `json:"next_due"`
+	Overdue  bool   `json:"overdue,omitempty"`
+}
+
+type apiTopicSettingsRequest struct {
+	MessagesExpiryDuration *int64    `json:"messages_expiry_duration,omitempty"` // Seconds
+	Messages               *int64    `json:"messages,omitempty"`
+	AttachmentFileSize     *int64    `json:"attachment_file_size,omitempty"` // Bytes
+	Priority               *int      `json:"priority,omitempty"`
+	Tags                   *[]string `json:"tags,omitempty"`
+	Icon                   *string   `json:"icon,omitempty"`
+	Firebase               *bool     `json:"firebase,omitempty"`
+	Digest                 *int64    `json:"digest,omitempty"` // Seconds, zero to disable
+}
+
+type apiTopicSettingsResponse struct {
+	Topic                  string   `json:"topic"`
+	MessagesExpiryDuration int64    `json:"messages_expiry_duration"` // Seconds
+	Messages               int64    `json:"messages"`
+	AttachmentFileSize     int64    `json:"attachment_file_size"` // Bytes
+	Priority               int      `json:"priority"`
+	Tags                   []string `json:"tags"`
+	Icon                   string   `json:"icon"`
+	Firebase               bool     `json:"firebase"`
+	Digest                 int64    `json:"digest"` // Seconds
+}
+
+type apiTopicInfoRequest struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Icon        *string `json:"icon,omitempty"`
+	Contact     *string `json:"contact,omitempty"`
+}
+
+type apiTopicInfoResponse struct {
+	Topic       string `json:"topic"`
+	DisplayName string `json:"display_name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Contact     string `json:"contact,omitempty"`
+}
+
+type apiAuditEntryResponse struct {
+	ID     int64  `json:"id"`
+	Time   int64  `json:"time"`
+	Actor  string `json:"actor,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	Action string `json:"action"`
+	Target string `json:"target,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
 type apiAccessAllowRequest struct {
 	Username   string `json:"username"`
 	Topic      string `json:"topic"` // This may be a pattern
 	Permission string `json:"permission"`
+	Expires    int64  `json:"expires,omitempty"` // Unix timestamp, grant does not expire if zero
 }
 
 type apiAccessResetRequest struct {
@@ -282,6 +456,88 @@ type apiAccessResetRequest struct {
 	Topic    string `json:"topic"`
 }
 
+type apiGroupAddRequest struct {
+	Name string `json:"name"`
+}
+
+type apiGroupDeleteRequest struct {
+	Name string `json:"name"`
+}
+
+type apiGroupResponse struct {
+	Name    string                  `json:"name"`
+	Members []string                `json:"members"`
+	Grants  []*apiUserGrantResponse `json:"grants,omitempty"`
+}
+
+type apiGroupMemberRequest struct {
+	Group    string `json:"group"`
+	Username string `json:"username"`
+}
+
+type apiGroupAccessAllowRequest struct {
+	Group      string `json:"group"`
+	Topic      string `json:"topic"` // This may be a pattern
+	Permission string `json:"permission"`
+}
+
+type apiGroupAccessResetRequest struct {
+	Group string `json:"group"`
+	Topic string `json:"topic"`
+}
+
+type apiScheduleRequest struct {
+	Name    string  `json:"name"`
+	Handoff *int64  `json:"handoff,omitempty"` // Unix time of the first handoff
+	Period  *int64  `json:"period,omitempty"`  // Seconds between handoffs
+	Owner   *string `json:"owner,omitempty"`   // Username allowed to page the schedule, empty to remove the owner
+}
+
+type apiScheduleDeleteRequest struct {
+	Name string `json:"name"`
+}
+
+type apiScheduleResponse struct {
+	Name        string                         `json:"name"`
+	Handoff     int64                          `json:"handoff"`
+	Period      int64                          `json:"period"`
+	Owner       string                         `json:"owner,omitempty"`
+	NextHandoff int64                          `json:"next_handoff"`
+	OnCall      string                         `json:"on_call,omitempty"`
+	Members     []*apiScheduleMemberResponse   `json:"members"`
+	Overrides   []*apiScheduleOverrideResponse `json:"overrides,omitempty"`
+}
+
+type apiScheduleMemberRequest struct {
+	Schedule string `json:"schedule"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+}
+
+type apiScheduleMemberResponse struct {
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+}
+
+type apiScheduleOverrideRequest struct {
+	Schedule string `json:"schedule"`
+	Username string `json:"username"`
+	Start    int64  `json:"start"` // Unix time, defaults to now
+	End      int64  `json:"end"`   // Unix time
+}
+
+type apiScheduleOverrideDeleteRequest struct {
+	Schedule string `json:"schedule"`
+	ID       int64  `json:"id"`
+}
+
+type apiScheduleOverrideResponse struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+}
+
 type apiAccountCreateRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -334,6 +590,7 @@ type apiAccountLimits struct {
 	Basis                    string `json:"basis,omitempty"` // "ip" or "tier"
 	Messages                 int64  `json:"messages"`
 	MessagesExpiryDuration   int64  `json:"messages_expiry_duration"`
+	MessagesKeepLast         int64  `json:"messages_keep_last,omitempty"`
 	Emails                   int64  `json:"emails"`
 	Calls                    int64  `json:"calls"`
 	Reservations             int64  `json:"reservations"`
@@ -376,7 +633,7 @@ type apiAccountResponse struct {
 	SyncTopic     string                     `json:"sync_topic,omitempty"`
 	Language      string                     `json:"language,omitempty"`
 	Notification  *user.NotificationPrefs    `json:"notification,omitempty"`
-	Subscriptions []*user.Subscription       `json:"subscriptions,omitempty"`
+	Subscriptions []*apiAccountSubscription  `json:"subscriptions,omitempty"`
 	Reservations  []*apiAccountReservation   `json:"reservations,omitempty"`
 	Tokens        []*apiAccountTokenResponse `json:"tokens,omitempty"`
 	PhoneNumbers  []string                   `json:"phone_numbers,omitempty"`
@@ -386,6 +643,13 @@ type apiAccountResponse struct {
 	Billing       *apiAccountBilling         `json:"billing,omitempty"`
 }
 
+type apiAccountSubscription struct {
+	BaseURL     string                `json:"base_url"`
+	Topic       string                `json:"topic"`
+	DisplayName *string               `json:"display_name"`
+	Info        *apiTopicInfoResponse `json:"info,omitempty"` // Topic metadata, only for topics on this server
+}
+
 type apiAccountReservationRequest struct {
 	Topic    string `json:"topic"`
 	Everyone string `json:"everyone"`
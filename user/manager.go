@@ -12,6 +12,7 @@ import (
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/util"
 	"net/netip"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -24,11 +25,20 @@ const (
 	syncTopicLength                 = 16
 	userIDPrefix                    = "u_"
 	userIDLength                    = 12
+	groupIDPrefix                   = "gr_"
+	groupIDLength                   = 8
+	scheduleIDPrefix                = "sc_"
+	scheduleIDLength                = 8
 	userAuthIntentionalSlowDownHash = "$2a$10$YFCQvqQDwIIwnJM1xkAYOeih0dg17UVGanaTStnrSzC8NCWxcLDwy" // Cost should match DefaultUserPasswordBcryptCost
 	userHardDeleteAfterDuration     = 7 * 24 * time.Hour
 	tokenPrefix                     = "tk_"
 	tokenLength                     = 32
+	tokenMaskedLength               = 8  // Prefix "tk_" plus 5 characters, see MaskToken
 	tokenMaxCount                   = 20 // Only keep this many tokens in the table per user
+	topicSettingsTagsMax            = 10 // Max number of default tags per topic
+	topicInfoDisplayNameLengthMax   = 64
+	topicInfoDescriptionLengthMax   = 1024
+	topicInfoURLLengthMax           = 1024
 	tag                             = "user_manager"
 )
 
@@ -39,9 +49,8 @@ const (
 )
 
 var (
-	errNoTokenProvided    = errors.New("no token provided")
-	errTopicOwnedByOthers = errors.New("topic owned by others")
-	errNoRows             = errors.New("no rows found")
+	errNoTokenProvided = errors.New("no token provided")
+	errNoRows          = errors.New("no rows found")
 )
 
 // Manager-related queries
@@ -54,6 +63,7 @@ const (
 			name TEXT NOT NULL,
 			messages_limit INT NOT NULL,
 			messages_expiry_duration INT NOT NULL,
+			messages_keep_last INT NOT NULL DEFAULT (0),
 			emails_limit INT NOT NULL,
 			calls_limit INT NOT NULL,
 			reservations_limit INT NOT NULL,
@@ -97,6 +107,7 @@ const (
 			read INT NOT NULL,
 			write INT NOT NULL,
 			owner_user_id INT,
+			expires INT NOT NULL,
 			PRIMARY KEY (user_id, topic),
 			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
 		    FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
@@ -117,6 +128,84 @@ const (
 			PRIMARY KEY (user_id, phone_number),
 			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
 		);
+		CREATE TABLE IF NOT EXISTS user_group (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			created INT NOT NULL
+		);
+		CREATE UNIQUE INDEX idx_user_group_name ON user_group (name);
+		CREATE TABLE IF NOT EXISTS user_group_member (
+			group_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			PRIMARY KEY (group_id, user_id),
+			FOREIGN KEY (group_id) REFERENCES user_group (id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS user_group_access (
+			group_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			read INT NOT NULL,
+			write INT NOT NULL,
+			PRIMARY KEY (group_id, topic),
+			FOREIGN KEY (group_id) REFERENCES user_group (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			time INT NOT NULL,
+			actor TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT NOT NULL,
+			old_value TEXT NOT NULL,
+			new_value TEXT NOT NULL
+		);
+		CREATE INDEX idx_audit_log_time ON audit_log (time);
+		CREATE TABLE IF NOT EXISTS schedule (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			handoff INT NOT NULL,
+			period INT NOT NULL,
+			owner_user_id TEXT,
+			created INT NOT NULL,
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE SET NULL
+		);
+		CREATE UNIQUE INDEX idx_schedule_name ON schedule (name);
+		CREATE TABLE IF NOT EXISTS schedule_member (
+			schedule_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			position INT NOT NULL,
+			email TEXT NOT NULL,
+			PRIMARY KEY (schedule_id, user_id),
+			FOREIGN KEY (schedule_id) REFERENCES schedule (id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS schedule_override (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			schedule_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			start INT NOT NULL,
+			end INT NOT NULL,
+			FOREIGN KEY (schedule_id) REFERENCES schedule (id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS topic_settings (
+			topic TEXT PRIMARY KEY,
+			messages_expiry_duration INT NOT NULL,
+			messages_limit INT NOT NULL,
+			attachment_file_size_limit INT NOT NULL,
+			priority INT NOT NULL,
+			tags TEXT NOT NULL,
+			icon TEXT NOT NULL,
+			firebase INT NOT NULL,
+			digest INT NOT NULL DEFAULT (0)
+		);
+		CREATE TABLE IF NOT EXISTS topic_info (
+			topic TEXT PRIMARY KEY,
+			display_name TEXT NOT NULL,
+			description TEXT NOT NULL,
+			icon TEXT NOT NULL,
+			contact TEXT NOT NULL
+		);
 		CREATE TABLE IF NOT EXISTS schemaVersion (
 			id INT PRIMARY KEY,
 			version INT NOT NULL
@@ -132,36 +221,47 @@ const (
 	`
 
 	selectUserByIDQuery = `
-		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
+		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.messages_keep_last, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
 		FROM user u
 		LEFT JOIN tier t on t.id = u.tier_id
 		WHERE u.id = ?
 	`
 	selectUserByNameQuery = `
-		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
+		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.messages_keep_last, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
 		FROM user u
 		LEFT JOIN tier t on t.id = u.tier_id
 		WHERE user = ?
 	`
 	selectUserByTokenQuery = `
-		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
+		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.messages_keep_last, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
 		FROM user u
 		JOIN user_token tk on u.id = tk.user_id
 		LEFT JOIN tier t on t.id = u.tier_id
 		WHERE tk.token = ? AND (tk.expires = 0 OR tk.expires >= ?)
 	`
 	selectUserByStripeCustomerIDQuery = `
-		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
+		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.messages_keep_last, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
 		FROM user u
 		LEFT JOIN tier t on t.id = u.tier_id
 		WHERE u.stripe_customer_id = ?
 	`
 	selectTopicPermsQuery = `
-		SELECT read, write
+		SELECT a.topic, a.read, a.write, 1 AS precedence, '' AS group_name
+		FROM user_access a
+		JOIN user u ON u.id = a.user_id
+		WHERE u.user = ? AND ? LIKE a.topic ESCAPE '\' AND (a.expires = 0 OR a.expires > ?)
+		UNION ALL
+		SELECT a.topic, a.read, a.write, 2 AS precedence, g.name AS group_name
+		FROM user_group_access a
+		JOIN user_group g ON g.id = a.group_id
+		JOIN user_group_member m ON m.group_id = a.group_id
+		JOIN user u ON u.id = m.user_id
+		WHERE u.user = ? AND ? LIKE a.topic ESCAPE '\'
+		UNION ALL
+		SELECT a.topic, a.read, a.write, 3 AS precedence, '' AS group_name
 		FROM user_access a
 		JOIN user u ON u.id = a.user_id
-		WHERE (u.user = ? OR u.user = ?) AND ? LIKE a.topic ESCAPE '\'
-		ORDER BY u.user DESC, LENGTH(a.topic) DESC, a.write DESC
+		WHERE u.user = ? AND ? LIKE a.topic ESCAPE '\' AND (a.expires = 0 OR a.expires > ?)
 	`
 
 	insertUserQuery = `
@@ -189,18 +289,19 @@ const (
 	deleteUserQuery              = `DELETE FROM user WHERE user = ?`
 
 	upsertUserAccessQuery = `
-		INSERT INTO user_access (user_id, topic, read, write, owner_user_id)
-		VALUES ((SELECT id FROM user WHERE user = ?), ?, ?, ?, (SELECT IIF(?='',NULL,(SELECT id FROM user WHERE user=?))))
+		INSERT INTO user_access (user_id, topic, read, write, owner_user_id, expires)
+		VALUES ((SELECT id FROM user WHERE user = ?), ?, ?, ?, (SELECT IIF(?='',NULL,(SELECT id FROM user WHERE user=?))), ?)
 		ON CONFLICT (user_id, topic)
-		DO UPDATE SET read=excluded.read, write=excluded.write, owner_user_id=excluded.owner_user_id
+		DO UPDATE SET read=excluded.read, write=excluded.write, owner_user_id=excluded.owner_user_id, expires=excluded.expires
+		WHERE excluded.expires = 0 OR user_access.expires > 0
 	`
 	selectUserAllAccessQuery = `
-		SELECT user_id, topic, read, write
+		SELECT user_id, topic, read, write, expires
 		FROM user_access
 		ORDER BY LENGTH(topic) DESC, write DESC, read DESC, topic
 	`
 	selectUserAccessQuery = `
-		SELECT topic, read, write
+		SELECT topic, read, write, expires
 		FROM user_access
 		WHERE user_id = (SELECT id FROM user WHERE user = ?)
 		ORDER BY LENGTH(topic) DESC, write DESC, read DESC, topic
@@ -219,6 +320,14 @@ const (
 		WHERE user_id = owner_user_id 
 		  AND owner_user_id = (SELECT id FROM user WHERE user = ?)
 	`
+	selectReservationsKeepLastQuery = `
+		SELECT a.topic, t.messages_keep_last
+		FROM user_access a
+		JOIN user u ON u.id = a.user_id
+		JOIN tier t ON t.id = u.tier_id
+		WHERE a.user_id = a.owner_user_id
+		  AND t.messages_keep_last > 0
+	`
 	selectUserReservationsOwnerQuery = `
 		SELECT owner_user_id
 		FROM user_access
@@ -234,12 +343,25 @@ const (
 	`
 	selectOtherAccessCountQuery = `
 		SELECT COUNT(*)
+		FROM (
+			SELECT topic
+			FROM user_access
+			WHERE (topic = ? OR ? LIKE topic ESCAPE '\')
+			  AND (owner_user_id IS NULL OR owner_user_id != (SELECT id FROM user WHERE user = ?))
+			UNION ALL
+			SELECT topic
+			FROM user_group_access
+			WHERE (topic = ? OR ? LIKE topic ESCAPE '\')
+		)
+	`
+	selectExpiredAccessQuery = `
+		SELECT user_id, topic, read, write, expires
 		FROM user_access
-		WHERE (topic = ? OR ? LIKE topic ESCAPE '\')
-		  AND (owner_user_id IS NULL OR owner_user_id != (SELECT id FROM user WHERE user = ?))
+		WHERE expires > 0 AND expires <= ?
 	`
-	deleteAllAccessQuery  = `DELETE FROM user_access`
-	deleteUserAccessQuery = `
+	deleteExpiredAccessQuery = `DELETE FROM user_access WHERE expires > 0 AND expires <= ?`
+	deleteAllAccessQuery     = `DELETE FROM user_access`
+	deleteUserAccessQuery    = `
 		DELETE FROM user_access
 		WHERE user_id = (SELECT id FROM user WHERE user = ?)
 		   OR owner_user_id = (SELECT id FROM user WHERE user = ?)
@@ -272,30 +394,139 @@ const (
 		)
 	`
 
+	insertGroupQuery       = `INSERT INTO user_group (id, name, created) VALUES (?, ?, ?)`
+	selectGroupsQuery      = `SELECT id, name FROM user_group ORDER BY name`
+	selectGroupByNameQuery = `SELECT id, name FROM user_group WHERE name = ?`
+	selectUserGroupsQuery  = `
+		SELECT g.id, g.name
+		FROM user_group g
+		JOIN user_group_member m ON m.group_id = g.id
+		JOIN user u ON u.id = m.user_id
+		WHERE u.user = ?
+		ORDER BY g.name
+	`
+	selectGroupMembersQuery = `
+		SELECT u.user
+		FROM user_group_member m
+		JOIN user u ON u.id = m.user_id
+		WHERE m.group_id = ?
+		ORDER BY u.user
+	`
+	deleteGroupQuery       = `DELETE FROM user_group WHERE name = ?`
+	insertGroupMemberQuery = `
+		INSERT INTO user_group_member (group_id, user_id)
+		VALUES (?, ?)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`
+	deleteGroupMemberQuery = `DELETE FROM user_group_member WHERE group_id = ? AND user_id = ?`
+	upsertGroupAccessQuery = `
+		INSERT INTO user_group_access (group_id, topic, read, write)
+		VALUES ((SELECT id FROM user_group WHERE name = ?), ?, ?, ?)
+		ON CONFLICT (group_id, topic)
+		DO UPDATE SET read=excluded.read, write=excluded.write
+	`
+	selectGroupAccessQuery = `
+		SELECT topic, read, write
+		FROM user_group_access
+		WHERE group_id = (SELECT id FROM user_group WHERE name = ?)
+		ORDER BY LENGTH(topic) DESC, write DESC, read DESC, topic
+	`
+	deleteGroupAccessQuery      = `DELETE FROM user_group_access WHERE group_id = (SELECT id FROM user_group WHERE name = ?)`
+	deleteGroupTopicAccessQuery = `DELETE FROM user_group_access WHERE group_id = (SELECT id FROM user_group WHERE name = ?) AND topic = ?`
+
+	insertScheduleQuery      = `INSERT INTO schedule (id, name, handoff, period, created) VALUES (?, ?, ?, ?, ?)`
+	updateScheduleQuery      = `UPDATE schedule SET handoff = ?, period = ? WHERE name = ?`
+	updateScheduleOwnerQuery = `UPDATE schedule SET owner_user_id = ? WHERE name = ?`
+	selectSchedulesQuery     = `
+		SELECT s.id, s.name, s.handoff, s.period, IFNULL(u.user, '')
+		FROM schedule s
+		LEFT JOIN user u ON u.id = s.owner_user_id
+		ORDER BY s.name
+	`
+	selectScheduleByNameQuery = `
+		SELECT s.id, s.name, s.handoff, s.period, IFNULL(u.user, '')
+		FROM schedule s
+		LEFT JOIN user u ON u.id = s.owner_user_id
+		WHERE s.name = ?
+	`
+	deleteScheduleQuery        = `DELETE FROM schedule WHERE name = ?`
+	selectScheduleMembersQuery = `
+		SELECT u.user, m.email
+		FROM schedule_member m
+		JOIN user u ON u.id = m.user_id
+		WHERE m.schedule_id = ?
+		ORDER BY m.position
+	`
+	upsertScheduleMemberQuery = `
+		INSERT INTO schedule_member (schedule_id, user_id, position, email)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position), -1) + 1 FROM schedule_member WHERE schedule_id = ?), ?)
+		ON CONFLICT (schedule_id, user_id)
+		DO UPDATE SET email = excluded.email
+	`
+	deleteScheduleMemberQuery    = `DELETE FROM schedule_member WHERE schedule_id = ? AND user_id = ?`
+	selectScheduleOverridesQuery = `
+		SELECT o.id, u.user, COALESCE(m.email, ''), o.start, o.end
+		FROM schedule_override o
+		JOIN user u ON u.id = o.user_id
+		LEFT JOIN schedule_member m ON m.schedule_id = o.schedule_id AND m.user_id = o.user_id
+		WHERE o.schedule_id = ?
+		ORDER BY o.id
+	`
+	insertScheduleOverrideQuery         = `INSERT INTO schedule_override (schedule_id, user_id, start, end) VALUES (?, ?, ?, ?)`
+	deleteScheduleOverrideQuery         = `DELETE FROM schedule_override WHERE schedule_id = ? AND id = ?`
+	deleteExpiredScheduleOverridesQuery = `DELETE FROM schedule_override WHERE end <= ?`
+
+	selectTopicSettingsQuery = `
+		SELECT topic, messages_expiry_duration, messages_limit, attachment_file_size_limit, priority, tags, icon, firebase, digest
+		FROM topic_settings
+		WHERE topic = ?
+	`
+	selectAllTopicSettingsQuery = `
+		SELECT topic, messages_expiry_duration, messages_limit, attachment_file_size_limit, priority, tags, icon, firebase, digest
+		FROM topic_settings
+		ORDER BY topic
+	`
+	upsertTopicSettingsQuery = `
+		INSERT INTO topic_settings (topic, messages_expiry_duration, messages_limit, attachment_file_size_limit, priority, tags, icon, firebase, digest)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (topic)
+		DO UPDATE SET messages_expiry_duration = excluded.messages_expiry_duration, messages_limit = excluded.messages_limit, attachment_file_size_limit = excluded.attachment_file_size_limit, priority = excluded.priority, tags = excluded.tags, icon = excluded.icon, firebase = excluded.firebase, digest = excluded.digest
+	`
+	deleteTopicSettingsQuery = `DELETE FROM topic_settings WHERE topic = ?`
+
+	selectTopicInfoQuery = `SELECT topic, display_name, description, icon, contact FROM topic_info WHERE topic = ?`
+	upsertTopicInfoQuery = `
+		INSERT INTO topic_info (topic, display_name, description, icon, contact)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (topic)
+		DO UPDATE SET display_name = excluded.display_name, description = excluded.description, icon = excluded.icon, contact = excluded.contact
+	`
+	deleteTopicInfoQuery = `DELETE FROM topic_info WHERE topic = ?`
+
 	selectPhoneNumbersQuery = `SELECT phone_number FROM user_phone WHERE user_id = ?`
 	insertPhoneNumberQuery  = `INSERT INTO user_phone (user_id, phone_number) VALUES (?, ?)`
 	deletePhoneNumberQuery  = `DELETE FROM user_phone WHERE user_id = ? AND phone_number = ?`
 
 	insertTierQuery = `
-		INSERT INTO tier (id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO tier (id, code, name, messages_limit, messages_expiry_duration, messages_keep_last, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	updateTierQuery = `
 		UPDATE tier
-		SET name = ?, messages_limit = ?, messages_expiry_duration = ?, emails_limit = ?, calls_limit = ?, reservations_limit = ?, attachment_file_size_limit = ?, attachment_total_size_limit = ?, attachment_expiry_duration = ?, attachment_bandwidth_limit = ?, stripe_monthly_price_id = ?, stripe_yearly_price_id = ?
+		SET name = ?, messages_limit = ?, messages_expiry_duration = ?, messages_keep_last = ?, emails_limit = ?, calls_limit = ?, reservations_limit = ?, attachment_file_size_limit = ?, attachment_total_size_limit = ?, attachment_expiry_duration = ?, attachment_bandwidth_limit = ?, stripe_monthly_price_id = ?, stripe_yearly_price_id = ?
 		WHERE code = ?
 	`
 	selectTiersQuery = `
-		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
+		SELECT id, code, name, messages_limit, messages_expiry_duration, messages_keep_last, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
 		FROM tier
 	`
 	selectTierByCodeQuery = `
-		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
+		SELECT id, code, name, messages_limit, messages_expiry_duration, messages_keep_last, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
 		FROM tier
 		WHERE code = ?
 	`
 	selectTierByPriceIDQuery = `
-		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
+		SELECT id, code, name, messages_limit, messages_expiry_duration, messages_keep_last, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
 		FROM tier
 		WHERE (stripe_monthly_price_id = ? OR stripe_yearly_price_id = ?)
 	`
@@ -303,6 +534,34 @@ const (
 	deleteUserTierQuery = `UPDATE user SET tier_id = null WHERE user = ?`
 	deleteTierQuery     = `DELETE FROM tier WHERE code = ?`
 
+	insertAuditEntryQuery = `
+		INSERT INTO audit_log (time, actor, ip, action, target, old_value, new_value)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	insertAuditEntryExpiredAccessQuery = `
+		INSERT INTO audit_log (time, actor, ip, action, target, old_value, new_value)
+		SELECT ?, ?, '', ?, user, ?, ''
+		FROM user
+		WHERE id = ?
+	`
+	insertAuditEntriesUsersMarkedQuery = `
+		INSERT INTO audit_log (time, actor, ip, action, target, old_value, new_value)
+		SELECT ?, ?, '', ?, user, '', ''
+		FROM user
+		WHERE deleted < ?
+	`
+	selectAuditEntriesQuery = `
+		SELECT id, time, actor, ip, action, target, old_value, new_value
+		FROM audit_log
+		WHERE (? = '' OR actor = ?)
+		  AND (? = '' OR action = ? OR action LIKE ? || '.%')
+		  AND (? = '' OR target = ?)
+		  AND time >= ?
+		ORDER BY time DESC, id DESC
+		LIMIT ?
+	`
+	deleteAuditEntriesBeforeQuery = `DELETE FROM audit_log WHERE time < ?`
+
 	updateBillingQuery = `
 		UPDATE user
 		SET stripe_customer_id = ?, stripe_subscription_id = ?, stripe_subscription_status = ?, stripe_subscription_interval = ?, stripe_subscription_paid_until = ?, stripe_subscription_cancel_at = ?
@@ -312,7 +571,7 @@ const (
 
 // Schema management queries
 const (
-	currentSchemaVersion     = 5
+	currentSchemaVersion     = 14
 	insertSchemaVersion      = `INSERT INTO schemaVersion VALUES (1, ?)`
 	updateSchemaVersion      = `UPDATE schemaVersion SET version = ? WHERE id = 1`
 	selectSchemaVersionQuery = `SELECT version FROM schemaVersion WHERE id = 1`
@@ -427,14 +686,137 @@ const (
 	migrate4To5UpdateQueries = `
 		UPDATE user_access SET topic = REPLACE(topic, '_', '\_');
 	`
+
+	// 5 -> 6
+	migrate5To6UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS user_group (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			created INT NOT NULL
+		);
+		CREATE UNIQUE INDEX idx_user_group_name ON user_group (name);
+		CREATE TABLE IF NOT EXISTS user_group_member (
+			group_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			PRIMARY KEY (group_id, user_id),
+			FOREIGN KEY (group_id) REFERENCES user_group (id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS user_group_access (
+			group_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			read INT NOT NULL,
+			write INT NOT NULL,
+			PRIMARY KEY (group_id, topic),
+			FOREIGN KEY (group_id) REFERENCES user_group (id) ON DELETE CASCADE
+		);
+	`
+
+	// 6 -> 7
+	migrate6To7UpdateQueries = `
+		ALTER TABLE user_access ADD COLUMN expires INT NOT NULL DEFAULT (0);
+	`
+
+	// 7 -> 8
+	migrate7To8UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			time INT NOT NULL,
+			actor TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT NOT NULL,
+			old_value TEXT NOT NULL,
+			new_value TEXT NOT NULL
+		);
+		CREATE INDEX idx_audit_log_time ON audit_log (time);
+	`
+
+	// 8 -> 9
+	migrate8To9UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS schedule (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			handoff INT NOT NULL,
+			period INT NOT NULL,
+			created INT NOT NULL
+		);
+		CREATE UNIQUE INDEX idx_schedule_name ON schedule (name);
+		CREATE TABLE IF NOT EXISTS schedule_member (
+			schedule_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			position INT NOT NULL,
+			email TEXT NOT NULL,
+			PRIMARY KEY (schedule_id, user_id),
+			FOREIGN KEY (schedule_id) REFERENCES schedule (id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS schedule_override (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			schedule_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			start INT NOT NULL,
+			end INT NOT NULL,
+			FOREIGN KEY (schedule_id) REFERENCES schedule (id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+	`
+	// 9 -> 10
+	migrate9To10UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS topic_settings (
+			topic TEXT PRIMARY KEY,
+			messages_expiry_duration INT NOT NULL,
+			messages_limit INT NOT NULL,
+			attachment_file_size_limit INT NOT NULL,
+			priority INT NOT NULL,
+			tags TEXT NOT NULL,
+			icon TEXT NOT NULL,
+			firebase INT NOT NULL
+		);
+	`
+
+	// 10 -> 11
+	migrate10To11UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS topic_info (
+			topic TEXT PRIMARY KEY,
+			display_name TEXT NOT NULL,
+			description TEXT NOT NULL,
+			icon TEXT NOT NULL,
+			contact TEXT NOT NULL
+		);
+	`
+
+	// 11 -> 12
+	migrate11To12UpdateQueries = `
+		ALTER TABLE tier ADD COLUMN messages_keep_last INT NOT NULL DEFAULT (0);
+	`
+
+	// 12 -> 13
+	migrate12To13UpdateQueries = `
+		ALTER TABLE schedule ADD COLUMN owner_user_id TEXT REFERENCES user (id) ON DELETE SET NULL;
+	`
+
+	// 13 -> 14
+	migrate13To14UpdateQueries = `
+		ALTER TABLE topic_settings ADD COLUMN digest INT NOT NULL DEFAULT (0);
+	`
 )
 
 var (
 	migrations = map[int]func(db *sql.DB) error{
-		1: migrateFrom1,
-		2: migrateFrom2,
-		3: migrateFrom3,
-		4: migrateFrom4,
+		1:  migrateFrom1,
+		2:  migrateFrom2,
+		3:  migrateFrom3,
+		4:  migrateFrom4,
+		5:  migrateFrom5,
+		6:  migrateFrom6,
+		7:  migrateFrom7,
+		8:  migrateFrom8,
+		9:  migrateFrom9,
+		10: migrateFrom10,
+		11: migrateFrom11,
+		12: migrateFrom12,
+		13: migrateFrom13,
 	}
 )
 
@@ -708,10 +1090,19 @@ func (a *Manager) RemovePhoneNumber(userID string, phoneNumber string) error {
 
 // RemoveDeletedUsers deletes all users that have been marked deleted for
 func (a *Manager) RemoveDeletedUsers() error {
-	if _, err := a.db.Exec(deleteUsersMarkedQuery, time.Now().Unix()); err != nil {
+	tx, err := a.db.Begin()
+	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	if _, err := tx.Exec(insertAuditEntriesUsersMarkedQuery, now, AuditActorServer, AuditUserPurge, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deleteUsersMarkedQuery, now); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // ChangeSettings persists the user settings
@@ -826,32 +1217,53 @@ func (a *Manager) writeTokenUpdateQueue() error {
 // Authorize returns nil if the given user has access to the given topic using the desired
 // permission. The user param may be nil to signal an anonymous user.
 func (a *Manager) Authorize(user *User, topic string, perm Permission) error {
+	match, err := a.ExplainAccess(user, topic)
+	if err != nil {
+		return err
+	}
+	return a.resolvePerms(match.Allow, perm)
+}
+
+// ExplainAccess returns the access control entry that decides the access of the given user to the
+// given topic. The user param may be nil to signal an anonymous user.
+//
+// The entry is selected as follows:
+// - User entries take precedence over group entries, which take precedence over everyone entries
+// - Within these, more specific patterns win: more literal characters, then fewer '*' wildcards, e.g. "test-?" > "test*" > "*"
+// - If equally specific entries match, explicit deny entries win, then entries with write permission
+// - If no entry matches, the default access applies
+func (a *Manager) ExplainAccess(user *User, topic string) (*AccessMatch, error) {
 	if user != nil && user.Role == RoleAdmin {
-		return nil // Admin can do everything
+		return &AccessMatch{Allow: PermissionReadWrite, Source: AccessSourceAdmin}, nil // Admin can do everything
 	}
 	username := Everyone
 	if user != nil {
 		username = user.Name
 	}
-	// Select the read/write permissions for this user/topic combo.
-	// - The query may return two rows (one for everyone, and one for the user), but prioritizes the user.
-	// - Furthermore, the query prioritizes more specific permissions (longer!) over more generic ones, e.g. "test*" > "*"
-	// - It also prioritizes write permissions over read permissions
-	rows, err := a.db.Query(selectTopicPermsQuery, Everyone, username, topic)
+	now := time.Now().Unix()
+	rows, err := a.db.Query(selectTopicPermsQuery, username, topic, now, username, topic, Everyone, topic, now)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
-	if !rows.Next() {
-		return a.resolvePerms(a.defaultAccess, perm)
+	entries := make([]*accessEntry, 0)
+	for rows.Next() {
+		var e accessEntry
+		if err := rows.Scan(&e.topic, &e.read, &e.write, &e.precedence, &e.group); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		e.literals, e.wildcards = patternSpecificity(e.topic)
+		entries = append(entries, &e)
 	}
-	var read, write bool
-	if err := rows.Scan(&read, &write); err != nil {
-		return err
-	} else if err := rows.Err(); err != nil {
-		return err
+	if len(entries) == 0 {
+		return &AccessMatch{Allow: a.defaultAccess, Source: AccessSourceDefault}, nil
 	}
-	return a.resolvePerms(NewPermission(read, write), perm)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].before(entries[j])
+	})
+	return entries[0].match(), nil
 }
 
 func (a *Manager) resolvePerms(base, perm Permission) error {
@@ -1006,11 +1418,11 @@ func (a *Manager) readUser(rows *sql.Rows) (*User, error) {
 	var id, username, hash, role, prefs, syncTopic string
 	var stripeCustomerID, stripeSubscriptionID, stripeSubscriptionStatus, stripeSubscriptionInterval, stripeMonthlyPriceID, stripeYearlyPriceID, tierID, tierCode, tierName sql.NullString
 	var messages, emails, calls int64
-	var messagesLimit, messagesExpiryDuration, emailsLimit, callsLimit, reservationsLimit, attachmentFileSizeLimit, attachmentTotalSizeLimit, attachmentExpiryDuration, attachmentBandwidthLimit, stripeSubscriptionPaidUntil, stripeSubscriptionCancelAt, deleted sql.NullInt64
+	var messagesLimit, messagesExpiryDuration, messagesKeepLast, emailsLimit, callsLimit, reservationsLimit, attachmentFileSizeLimit, attachmentTotalSizeLimit, attachmentExpiryDuration, attachmentBandwidthLimit, stripeSubscriptionPaidUntil, stripeSubscriptionCancelAt, deleted sql.NullInt64
 	if !rows.Next() {
 		return nil, ErrUserNotFound
 	}
-	if err := rows.Scan(&id, &username, &hash, &role, &prefs, &syncTopic, &messages, &emails, &calls, &stripeCustomerID, &stripeSubscriptionID, &stripeSubscriptionStatus, &stripeSubscriptionInterval, &stripeSubscriptionPaidUntil, &stripeSubscriptionCancelAt, &deleted, &tierID, &tierCode, &tierName, &messagesLimit, &messagesExpiryDuration, &emailsLimit, &callsLimit, &reservationsLimit, &attachmentFileSizeLimit, &attachmentTotalSizeLimit, &attachmentExpiryDuration, &attachmentBandwidthLimit, &stripeMonthlyPriceID, &stripeYearlyPriceID); err != nil {
+	if err := rows.Scan(&id, &username, &hash, &role, &prefs, &syncTopic, &messages, &emails, &calls, &stripeCustomerID, &stripeSubscriptionID, &stripeSubscriptionStatus, &stripeSubscriptionInterval, &stripeSubscriptionPaidUntil, &stripeSubscriptionCancelAt, &deleted, &tierID, &tierCode, &tierName, &messagesLimit, &messagesExpiryDuration, &messagesKeepLast, &emailsLimit, &callsLimit, &reservationsLimit, &attachmentFileSizeLimit, &attachmentTotalSizeLimit, &attachmentExpiryDuration, &attachmentBandwidthLimit, &stripeMonthlyPriceID, &stripeYearlyPriceID); err != nil {
 		return nil, err
 	} else if err := rows.Err(); err != nil {
 		return nil, err
@@ -1048,6 +1460,7 @@ func (a *Manager) readUser(rows *sql.Rows) (*User, error) {
 			Name:                     tierName.String,
 			MessageLimit:             messagesLimit.Int64,
 			MessageExpiryDuration:    time.Duration(messagesExpiryDuration.Int64) * time.Second,
+			MessageKeepLast:          messagesKeepLast.Int64,
 			EmailLimit:               emailsLimit.Int64,
 			CallLimit:                callsLimit.Int64,
 			ReservationLimit:         reservationsLimit.Int64,
@@ -1068,51 +1481,62 @@ func (a *Manager) AllGrants() (map[string][]Grant, error) {
 	if err != nil {
 		return nil, err
 	}
+	return readGrantsByUserID(rows)
+}
+
+// Grants returns all user-specific access control entries
+func (a *Manager) Grants(username string) ([]Grant, error) {
+	rows, err := a.db.Query(selectUserAccessQuery, username)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
-	grants := make(map[string][]Grant, 0)
+	grants := make([]Grant, 0)
 	for rows.Next() {
-		var userID, topic string
+		var topic string
 		var read, write bool
-		if err := rows.Scan(&userID, &topic, &read, &write); err != nil {
+		var expires int64
+		if err := rows.Scan(&topic, &read, &write, &expires); err != nil {
 			return nil, err
 		} else if err := rows.Err(); err != nil {
 			return nil, err
 		}
-		if _, ok := grants[userID]; !ok {
-			grants[userID] = make([]Grant, 0)
-		}
-		grants[userID] = append(grants[userID], Grant{
-			TopicPattern: fromSQLWildcard(topic),
-			Allow:        NewPermission(read, write),
-		})
+		grants = append(grants, newGrant(topic, read, write, expires))
 	}
 	return grants, nil
 }
 
-// Grants returns all user-specific access control entries
-func (a *Manager) Grants(username string) ([]Grant, error) {
-	rows, err := a.db.Query(selectUserAccessQuery, username)
-	if err != nil {
-		return nil, err
-	}
+func readGrantsByUserID(rows *sql.Rows) (map[string][]Grant, error) {
 	defer rows.Close()
-	grants := make([]Grant, 0)
+	grants := make(map[string][]Grant, 0)
 	for rows.Next() {
-		var topic string
+		var userID, topic string
 		var read, write bool
-		if err := rows.Scan(&topic, &read, &write); err != nil {
+		var expires int64
+		if err := rows.Scan(&userID, &topic, &read, &write, &expires); err != nil {
 			return nil, err
 		} else if err := rows.Err(); err != nil {
 			return nil, err
 		}
-		grants = append(grants, Grant{
-			TopicPattern: fromSQLWildcard(topic),
-			Allow:        NewPermission(read, write),
-		})
+		if _, ok := grants[userID]; !ok {
+			grants[userID] = make([]Grant, 0)
+		}
+		grants[userID] = append(grants[userID], newGrant(topic, read, write, expires))
 	}
 	return grants, nil
 }
 
+func newGrant(topic string, read, write bool, expires int64) Grant {
+	grant := Grant{
+		TopicPattern: fromSQLWildcard(topic),
+		Allow:        NewPermission(read, write),
+	}
+	if expires > 0 {
+		grant.Expires = time.Unix(expires, 0)
+	}
+	return grant
+}
+
 // Reservations returns all user-owned topics, and the associated everyone-access
 func (a *Manager) Reservations(username string) ([]Reservation, error) {
 	rows, err := a.db.Query(selectUserReservationsQuery, Everyone, username)
@@ -1191,6 +1615,28 @@ func (a *Manager) ReservationOwner(topic string) (string, error) {
 	return ownerUserID, nil
 }
 
+// ReservationsKeepLast returns the number of messages to keep for all reserved topics whose owner is on a tier
+// with a keep-last retention (see Tier.MessageKeepLast), mapped by topic
+func (a *Manager) ReservationsKeepLast() (map[string]int64, error) {
+	rows, err := a.db.Query(selectReservationsKeepLastQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keepLast := make(map[string]int64)
+	for rows.Next() {
+		var topic string
+		var messagesKeepLast int64
+		if err := rows.Scan(&topic, &messagesKeepLast); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		keepLast[unescapeUnderscore(topic)] = messagesKeepLast
+	}
+	return keepLast, nil
+}
+
 // ChangePassword changes a user's password
 func (a *Manager) ChangePassword(username, password string) error {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
@@ -1271,7 +1717,7 @@ func (a *Manager) AllowReservation(username string, topic string) error {
 	if (!AllowedUsername(username) && username != Everyone) || !AllowedTopic(topic) {
 		return ErrInvalidArgument
 	}
-	rows, err := a.db.Query(selectOtherAccessCountQuery, escapeUnderscore(topic), escapeUnderscore(topic), username)
+	rows, err := a.db.Query(selectOtherAccessCountQuery, escapeUnderscore(topic), escapeUnderscore(topic), username, escapeUnderscore(topic), escapeUnderscore(topic))
 	if err != nil {
 		return err
 	}
@@ -1284,7 +1730,7 @@ func (a *Manager) AllowReservation(username string, topic string) error {
 		return err
 	}
 	if otherCount > 0 {
-		return errTopicOwnedByOthers
+		return ErrTopicOwnedByOthers
 	}
 	return nil
 }
@@ -1293,18 +1739,73 @@ func (a *Manager) AllowReservation(username string, topic string) error {
 // read/write access to a topic. The parameter topicPattern may include wildcards (*). The ACL entry
 // owner may either be a user (username), or the system (empty).
 func (a *Manager) AllowAccess(username string, topicPattern string, permission Permission) error {
+	return a.AllowAccessUntil(username, topicPattern, permission, time.Time{})
+}
+
+// AllowAccessUntil is like AllowAccess, but the entry expires at the given time. Expired entries are
+// ignored, and removed by RemoveExpiredAccess. If expires is the zero time, the entry never expires.
+//
+// An expiring entry never replaces an existing permanent entry for the same user and topic, since the
+// permanent access would be removed along with it once it expires. In that case, ErrAccessPermanent is returned.
+func (a *Manager) AllowAccessUntil(username string, topicPattern string, permission Permission, expires time.Time) error {
 	if !AllowedUsername(username) && username != Everyone {
 		return ErrInvalidArgument
 	} else if !AllowedTopicPattern(topicPattern) {
 		return ErrInvalidArgument
+	} else if !expires.IsZero() && !expires.After(time.Now()) {
+		return ErrInvalidArgument
 	}
 	owner := ""
-	if _, err := a.db.Exec(upsertUserAccessQuery, username, toSQLWildcard(topicPattern), permission.IsRead(), permission.IsWrite(), owner, owner); err != nil {
+	var expiresUnix int64
+	if !expires.IsZero() {
+		expiresUnix = expires.Unix()
+	}
+	result, err := a.db.Exec(upsertUserAccessQuery, username, toSQLWildcard(topicPattern), permission.IsRead(), permission.IsWrite(), owner, owner, expiresUnix)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
 		return err
+	} else if rows == 0 {
+		return ErrAccessPermanent
 	}
 	return nil
 }
 
+// RemoveExpiredAccess deletes all expired access control entries from the database, and returns
+// the deleted entries, mapped to their respective user IDs
+func (a *Manager) RemoveExpiredAccess() (map[string][]Grant, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	rows, err := tx.Query(selectExpiredAccessQuery, now)
+	if err != nil {
+		return nil, err
+	}
+	grants, err := readGrantsByUserID(rows)
+	if err != nil {
+		return nil, err
+	}
+	for userID, userGrants := range grants {
+		for _, grant := range userGrants {
+			if _, err := tx.Exec(insertAuditEntryExpiredAccessQuery, now, AuditActorServer, AuditAccessExpire, grant.String(), userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if _, err := tx.Exec(deleteExpiredAccessQuery, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
 // ResetAccess removes an access control list entry for a specific username/topic, or (if topic is
 // empty) for an entire user. The parameter topicPattern may include wildcards (*).
 func (a *Manager) ResetAccess(username string, topicPattern string) error {
@@ -1336,10 +1837,10 @@ func (a *Manager) AddReservation(username string, topic string, everyone Permiss
 		return err
 	}
 	defer tx.Rollback()
-	if _, err := tx.Exec(upsertUserAccessQuery, username, escapeUnderscore(topic), true, true, username, username); err != nil {
+	if _, err := tx.Exec(upsertUserAccessQuery, username, escapeUnderscore(topic), true, true, username, username, 0); err != nil {
 		return err
 	}
-	if _, err := tx.Exec(upsertUserAccessQuery, Everyone, escapeUnderscore(topic), everyone.IsRead(), everyone.IsWrite(), username, username); err != nil {
+	if _, err := tx.Exec(upsertUserAccessQuery, Everyone, escapeUnderscore(topic), everyone.IsRead(), everyone.IsWrite(), username, username, 0); err != nil {
 		return err
 	}
 	return tx.Commit()
@@ -1377,72 +1878,272 @@ func (a *Manager) DefaultAccess() Permission {
 	return a.defaultAccess
 }
 
-// AddTier creates a new tier in the database
-func (a *Manager) AddTier(tier *Tier) error {
-	if tier.ID == "" {
-		tier.ID = util.RandomStringPrefix(tierIDPrefix, tierIDLength)
-	}
-	if _, err := a.db.Exec(insertTierQuery, tier.ID, tier.Code, tier.Name, tier.MessageLimit, int64(tier.MessageExpiryDuration.Seconds()), tier.EmailLimit, tier.CallLimit, tier.ReservationLimit, tier.AttachmentFileSizeLimit, tier.AttachmentTotalSizeLimit, int64(tier.AttachmentExpiryDuration.Seconds()), tier.AttachmentBandwidthLimit, nullString(tier.StripeMonthlyPriceID), nullString(tier.StripeYearlyPriceID)); err != nil {
-		return err
+// AddGroup creates a new, empty group with the given name
+func (a *Manager) AddGroup(name string) error {
+	if !AllowedGroup(name) {
+		return ErrInvalidArgument
 	}
-	return nil
-}
-
-// UpdateTier updates a tier's properties in the database
-func (a *Manager) UpdateTier(tier *Tier) error {
-	if _, err := a.db.Exec(updateTierQuery, tier.Name, tier.MessageLimit, int64(tier.MessageExpiryDuration.Seconds()), tier.EmailLimit, tier.CallLimit, tier.ReservationLimit, tier.AttachmentFileSizeLimit, tier.AttachmentTotalSizeLimit, int64(tier.AttachmentExpiryDuration.Seconds()), tier.AttachmentBandwidthLimit, nullString(tier.StripeMonthlyPriceID), nullString(tier.StripeYearlyPriceID), tier.Code); err != nil {
+	groupID := util.RandomStringPrefix(groupIDPrefix, groupIDLength)
+	if _, err := a.db.Exec(insertGroupQuery, groupID, name, time.Now().Unix()); err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return ErrGroupExists
+		}
 		return err
 	}
 	return nil
 }
 
-// RemoveTier deletes the tier with the given code
-func (a *Manager) RemoveTier(code string) error {
-	if !AllowedTier(code) {
+// RemoveGroup deletes the group with the given name. Memberships and group access control
+// entries are deleted via foreign keys.
+func (a *Manager) RemoveGroup(name string) error {
+	if !AllowedGroup(name) {
 		return ErrInvalidArgument
 	}
-	// This fails if any user has this tier
-	if _, err := a.db.Exec(deleteTierQuery, code); err != nil {
+	if _, err := a.db.Exec(deleteGroupQuery, name); err != nil {
 		return err
 	}
 	return nil
 }
 
-// ChangeBilling updates a user's billing fields, namely the Stripe customer ID, and subscription information
-func (a *Manager) ChangeBilling(username string, billing *Billing) error {
-	if _, err := a.db.Exec(updateBillingQuery, nullString(billing.StripeCustomerID), nullString(billing.StripeSubscriptionID), nullString(string(billing.StripeSubscriptionStatus)), nullString(string(billing.StripeSubscriptionInterval)), nullInt64(billing.StripeSubscriptionPaidUntil.Unix()), nullInt64(billing.StripeSubscriptionCancelAt.Unix()), username); err != nil {
-		return err
+// Groups returns a list of all groups, including their members
+func (a *Manager) Groups() ([]*Group, error) {
+	rows, err := a.db.Query(selectGroupsQuery)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return a.readGroups(rows)
 }
 
-// Tiers returns a list of all Tier structs
-func (a *Manager) Tiers() ([]*Tier, error) {
-	rows, err := a.db.Query(selectTiersQuery)
+// Group returns the group with the given name if it exists, or ErrGroupNotFound otherwise
+func (a *Manager) Group(name string) (*Group, error) {
+	rows, err := a.db.Query(selectGroupByNameQuery, name)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	tiers := make([]*Tier, 0)
-	for {
-		tier, err := a.readTier(rows)
-		if err == ErrTierNotFound {
-			break
-		} else if err != nil {
-			return nil, err
-		}
-		tiers = append(tiers, tier)
+	groups, err := a.readGroups(rows)
+	if err != nil {
+		return nil, err
+	} else if len(groups) == 0 {
+		return nil, ErrGroupNotFound
 	}
-	return tiers, nil
+	return groups[0], nil
 }
 
-// Tier returns a Tier based on the code, or ErrTierNotFound if it does not exist
-func (a *Manager) Tier(code string) (*Tier, error) {
-	rows, err := a.db.Query(selectTierByCodeQuery, code)
+// UserGroups returns all groups the user with the given username is a member of
+func (a *Manager) UserGroups(username string) ([]*Group, error) {
+	rows, err := a.db.Query(selectUserGroupsQuery, username)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return a.readGroups(rows)
+}
+
+func (a *Manager) readGroups(rows *sql.Rows) ([]*Group, error) {
+	defer rows.Close()
+	groups := make([]*Group, 0)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		groups = append(groups, &Group{
+			ID:   id,
+			Name: name,
+		})
+	}
+	rows.Close()
+	for _, group := range groups {
+		members, err := a.groupMembers(group.ID)
+		if err != nil {
+			return nil, err
+		}
+		group.Members = members
+	}
+	return groups, nil
+}
+
+func (a *Manager) groupMembers(groupID string) ([]string, error) {
+	rows, err := a.db.Query(selectGroupMembersQuery, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		members = append(members, username)
+	}
+	return members, nil
+}
+
+// AddGroupMember adds the user with the given username to a group. Adding a user that is
+// already a member of the group is not an error.
+func (a *Manager) AddGroupMember(name, username string) error {
+	if !AllowedGroup(name) || !AllowedUsername(username) {
+		return ErrInvalidArgument
+	}
+	group, err := a.Group(name)
+	if err != nil {
+		return err
+	}
+	u, err := a.User(username)
+	if err != nil {
+		return err
+	}
+	if _, err := a.db.Exec(insertGroupMemberQuery, group.ID, u.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveGroupMember removes the user with the given username from a group
+func (a *Manager) RemoveGroupMember(name, username string) error {
+	if !AllowedGroup(name) || !AllowedUsername(username) {
+		return ErrInvalidArgument
+	}
+	group, err := a.Group(name)
+	if err != nil {
+		return err
+	}
+	u, err := a.User(username)
+	if err != nil {
+		return err
+	}
+	if _, err := a.db.Exec(deleteGroupMemberQuery, group.ID, u.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GroupGrants returns all access control entries for the group with the given name
+func (a *Manager) GroupGrants(name string) ([]Grant, error) {
+	rows, err := a.db.Query(selectGroupAccessQuery, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	grants := make([]Grant, 0)
+	for rows.Next() {
+		var topic string
+		var read, write bool
+		if err := rows.Scan(&topic, &read, &write); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		grants = append(grants, Grant{
+			TopicPattern: fromSQLWildcard(topic),
+			Allow:        NewPermission(read, write),
+		})
+	}
+	return grants, nil
+}
+
+// AllowGroupAccess adds or updates an entry in the access control list for a group. All members
+// of the group inherit the permission, unless they have a user-specific entry for the topic.
+// The parameter topicPattern may include wildcards (*).
+func (a *Manager) AllowGroupAccess(name string, topicPattern string, permission Permission) error {
+	if !AllowedGroup(name) || !AllowedTopicPattern(topicPattern) {
+		return ErrInvalidArgument
+	}
+	if _, err := a.Group(name); err != nil {
+		return err
+	}
+	if _, err := a.db.Exec(upsertGroupAccessQuery, name, toSQLWildcard(topicPattern), permission.IsRead(), permission.IsWrite()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ResetGroupAccess removes an access control list entry for a specific group/topic, or (if topic is
+// empty) for the entire group. The parameter topicPattern may include wildcards (*).
+func (a *Manager) ResetGroupAccess(name string, topicPattern string) error {
+	if !AllowedGroup(name) {
+		return ErrInvalidArgument
+	} else if !AllowedTopicPattern(topicPattern) && topicPattern != "" {
+		return ErrInvalidArgument
+	}
+	if topicPattern == "" {
+		_, err := a.db.Exec(deleteGroupAccessQuery, name)
+		return err
+	}
+	_, err := a.db.Exec(deleteGroupTopicAccessQuery, name, toSQLWildcard(topicPattern))
+	return err
+}
+
+// AddTier creates a new tier in the database
+func (a *Manager) AddTier(tier *Tier) error {
+	if tier.ID == "" {
+		tier.ID = util.RandomStringPrefix(tierIDPrefix, tierIDLength)
+	}
+	if _, err := a.db.Exec(insertTierQuery, tier.ID, tier.Code, tier.Name, tier.MessageLimit, int64(tier.MessageExpiryDuration.Seconds()), tier.MessageKeepLast, tier.EmailLimit, tier.CallLimit, tier.ReservationLimit, tier.AttachmentFileSizeLimit, tier.AttachmentTotalSizeLimit, int64(tier.AttachmentExpiryDuration.Seconds()), tier.AttachmentBandwidthLimit, nullString(tier.StripeMonthlyPriceID), nullString(tier.StripeYearlyPriceID)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateTier updates a tier's properties in the database
+func (a *Manager) UpdateTier(tier *Tier) error {
+	if _, err := a.db.Exec(updateTierQuery, tier.Name, tier.MessageLimit, int64(tier.MessageExpiryDuration.Seconds()), tier.MessageKeepLast, tier.EmailLimit, tier.CallLimit, tier.ReservationLimit, tier.AttachmentFileSizeLimit, tier.AttachmentTotalSizeLimit, int64(tier.AttachmentExpiryDuration.Seconds()), tier.AttachmentBandwidthLimit, nullString(tier.StripeMonthlyPriceID), nullString(tier.StripeYearlyPriceID), tier.Code); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveTier deletes the tier with the given code
+func (a *Manager) RemoveTier(code string) error {
+	if !AllowedTier(code) {
+		return ErrInvalidArgument
+	}
+	// This fails if any user has this tier
+	if _, err := a.db.Exec(deleteTierQuery, code); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ChangeBilling updates a user's billing fields, namely the Stripe customer ID, and subscription information
+func (a *Manager) ChangeBilling(username string, billing *Billing) error {
+	if _, err := a.db.Exec(updateBillingQuery, nullString(billing.StripeCustomerID), nullString(billing.StripeSubscriptionID), nullString(string(billing.StripeSubscriptionStatus)), nullString(string(billing.StripeSubscriptionInterval)), nullInt64(billing.StripeSubscriptionPaidUntil.Unix()), nullInt64(billing.StripeSubscriptionCancelAt.Unix()), username); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tiers returns a list of all Tier structs
+func (a *Manager) Tiers() ([]*Tier, error) {
+	rows, err := a.db.Query(selectTiersQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tiers := make([]*Tier, 0)
+	for {
+		tier, err := a.readTier(rows)
+		if err == ErrTierNotFound {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+// Tier returns a Tier based on the code, or ErrTierNotFound if it does not exist
+func (a *Manager) Tier(code string) (*Tier, error) {
+	rows, err := a.db.Query(selectTierByCodeQuery, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	return a.readTier(rows)
 }
 
@@ -1459,11 +2160,11 @@ func (a *Manager) TierByStripePrice(priceID string) (*Tier, error) {
 func (a *Manager) readTier(rows *sql.Rows) (*Tier, error) {
 	var id, code, name string
 	var stripeMonthlyPriceID, stripeYearlyPriceID sql.NullString
-	var messagesLimit, messagesExpiryDuration, emailsLimit, callsLimit, reservationsLimit, attachmentFileSizeLimit, attachmentTotalSizeLimit, attachmentExpiryDuration, attachmentBandwidthLimit sql.NullInt64
+	var messagesLimit, messagesExpiryDuration, messagesKeepLast, emailsLimit, callsLimit, reservationsLimit, attachmentFileSizeLimit, attachmentTotalSizeLimit, attachmentExpiryDuration, attachmentBandwidthLimit sql.NullInt64
 	if !rows.Next() {
 		return nil, ErrTierNotFound
 	}
-	if err := rows.Scan(&id, &code, &name, &messagesLimit, &messagesExpiryDuration, &emailsLimit, &callsLimit, &reservationsLimit, &attachmentFileSizeLimit, &attachmentTotalSizeLimit, &attachmentExpiryDuration, &attachmentBandwidthLimit, &stripeMonthlyPriceID, &stripeYearlyPriceID); err != nil {
+	if err := rows.Scan(&id, &code, &name, &messagesLimit, &messagesExpiryDuration, &messagesKeepLast, &emailsLimit, &callsLimit, &reservationsLimit, &attachmentFileSizeLimit, &attachmentTotalSizeLimit, &attachmentExpiryDuration, &attachmentBandwidthLimit, &stripeMonthlyPriceID, &stripeYearlyPriceID); err != nil {
 		return nil, err
 	} else if err := rows.Err(); err != nil {
 		return nil, err
@@ -1475,6 +2176,7 @@ func (a *Manager) readTier(rows *sql.Rows) (*Tier, error) {
 		Name:                     name,
 		MessageLimit:             messagesLimit.Int64,
 		MessageExpiryDuration:    time.Duration(messagesExpiryDuration.Int64) * time.Second,
+		MessageKeepLast:          messagesKeepLast.Int64,
 		EmailLimit:               emailsLimit.Int64,
 		CallLimit:                callsLimit.Int64,
 		ReservationLimit:         reservationsLimit.Int64,
@@ -1487,21 +2189,549 @@ func (a *Manager) readTier(rows *sql.Rows) (*Tier, error) {
 	}, nil
 }
 
+// AddSchedule creates a new on-call schedule without members. The first member goes on call at the
+// given handoff time, and hands off to the next member after the given period.
+func (a *Manager) AddSchedule(name string, handoff time.Time, period time.Duration) error {
+	if !AllowedSchedule(name) || period < time.Minute {
+		return ErrInvalidArgument
+	}
+	scheduleID := util.RandomStringPrefix(scheduleIDPrefix, scheduleIDLength)
+	if _, err := a.db.Exec(insertScheduleQuery, scheduleID, name, handoff.Unix(), int64(period.Seconds()), time.Now().Unix()); err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return ErrScheduleExists
+		}
+		return err
+	}
+	return nil
+}
+
+// ChangeSchedule changes the handoff time and the rotation period of a schedule
+func (a *Manager) ChangeSchedule(name string, handoff time.Time, period time.Duration) error {
+	if !AllowedSchedule(name) || period < time.Minute {
+		return ErrInvalidArgument
+	}
+	res, err := a.db.Exec(updateScheduleQuery, handoff.Unix(), int64(period.Seconds()), name)
+	if err != nil {
+		return err
+	} else if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// ChangeScheduleOwner sets the owner of a schedule. Besides admins, only the owner may page the schedule
+// when publishing a message. If username is empty, the owner is removed.
+func (a *Manager) ChangeScheduleOwner(name, username string) error {
+	if !AllowedSchedule(name) {
+		return ErrInvalidArgument
+	}
+	var ownerUserID sql.NullString
+	if username != "" {
+		u, err := a.User(username)
+		if err != nil {
+			return err
+		}
+		ownerUserID = nullString(u.ID)
+	}
+	res, err := a.db.Exec(updateScheduleOwnerQuery, ownerUserID, name)
+	if err != nil {
+		return err
+	} else if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// RemoveSchedule deletes the schedule with the given name. Members and overrides are deleted via foreign keys.
+func (a *Manager) RemoveSchedule(name string) error {
+	if !AllowedSchedule(name) {
+		return ErrInvalidArgument
+	}
+	if _, err := a.db.Exec(deleteScheduleQuery, name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Schedules returns a list of all schedules, including their members and overrides
+func (a *Manager) Schedules() ([]*Schedule, error) {
+	rows, err := a.db.Query(selectSchedulesQuery)
+	if err != nil {
+		return nil, err
+	}
+	return a.readSchedules(rows)
+}
+
+// Schedule returns the schedule with the given name if it exists, or ErrScheduleNotFound otherwise
+func (a *Manager) Schedule(name string) (*Schedule, error) {
+	rows, err := a.db.Query(selectScheduleByNameQuery, name)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := a.readSchedules(rows)
+	if err != nil {
+		return nil, err
+	} else if len(schedules) == 0 {
+		return nil, ErrScheduleNotFound
+	}
+	return schedules[0], nil
+}
+
+// OnCall returns the user that is currently on call for the schedule with the given name, along with
+// the member's e-mail address (may be empty). If the schedule has no members, ErrUserNotFound is returned.
+func (a *Manager) OnCall(name string) (*User, string, error) {
+	schedule, err := a.Schedule(name)
+	if err != nil {
+		return nil, "", err
+	}
+	member := schedule.OnCall(time.Now())
+	if member == nil {
+		return nil, "", ErrUserNotFound
+	}
+	u, err := a.User(member.Username)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, member.Email, nil
+}
+
+func (a *Manager) readSchedules(rows *sql.Rows) ([]*Schedule, error) {
+	defer rows.Close()
+	schedules := make([]*Schedule, 0)
+	for rows.Next() {
+		var id, name, owner string
+		var handoff, period int64
+		if err := rows.Scan(&id, &name, &handoff, &period, &owner); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, &Schedule{
+			ID:      id,
+			Name:    name,
+			Handoff: time.Unix(handoff, 0),
+			Period:  time.Duration(period) * time.Second,
+			Owner:   owner,
+		})
+	}
+	rows.Close()
+	for _, schedule := range schedules {
+		members, err := a.scheduleMembers(schedule.ID)
+		if err != nil {
+			return nil, err
+		}
+		overrides, err := a.scheduleOverrides(schedule.ID)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Members = members
+		schedule.Overrides = overrides
+	}
+	return schedules, nil
+}
+
+func (a *Manager) scheduleMembers(scheduleID string) ([]*ScheduleMember, error) {
+	rows, err := a.db.Query(selectScheduleMembersQuery, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := make([]*ScheduleMember, 0)
+	for rows.Next() {
+		var username, email string
+		if err := rows.Scan(&username, &email); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		members = append(members, &ScheduleMember{
+			Username: username,
+			Email:    email,
+		})
+	}
+	return members, nil
+}
+
+func (a *Manager) scheduleOverrides(scheduleID string) ([]*ScheduleOverride, error) {
+	rows, err := a.db.Query(selectScheduleOverridesQuery, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	overrides := make([]*ScheduleOverride, 0)
+	for rows.Next() {
+		var id, start, end int64
+		var username, email string
+		if err := rows.Scan(&id, &username, &email, &start, &end); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, &ScheduleOverride{
+			ID:       id,
+			Username: username,
+			Email:    email,
+			Start:    time.Unix(start, 0),
+			End:      time.Unix(end, 0),
+		})
+	}
+	return overrides, nil
+}
+
+// AddScheduleMember adds the user with the given username to the end of the schedule's rotation. If the
+// user is already a member, only the e-mail address is updated, and the position in the rotation is kept.
+func (a *Manager) AddScheduleMember(name, username, email string) error {
+	if !AllowedSchedule(name) || !AllowedUsername(username) {
+		return ErrInvalidArgument
+	}
+	schedule, err := a.Schedule(name)
+	if err != nil {
+		return err
+	}
+	u, err := a.User(username)
+	if err != nil {
+		return err
+	}
+	if _, err := a.db.Exec(upsertScheduleMemberQuery, schedule.ID, u.ID, schedule.ID, email); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveScheduleMember removes the user with the given username from the schedule's rotation. Overrides
+// for the user are not affected.
+func (a *Manager) RemoveScheduleMember(name, username string) error {
+	if !AllowedSchedule(name) || !AllowedUsername(username) {
+		return ErrInvalidArgument
+	}
+	schedule, err := a.Schedule(name)
+	if err != nil {
+		return err
+	}
+	u, err := a.User(username)
+	if err != nil {
+		return err
+	}
+	if _, err := a.db.Exec(deleteScheduleMemberQuery, schedule.ID, u.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddScheduleOverride puts the user with the given username on call for the given time span, and
+// returns the ID of the override
+func (a *Manager) AddScheduleOverride(name, username string, start, end time.Time) (int64, error) {
+	if !AllowedSchedule(name) || !AllowedUsername(username) || !end.After(start) {
+		return 0, ErrInvalidArgument
+	}
+	schedule, err := a.Schedule(name)
+	if err != nil {
+		return 0, err
+	}
+	u, err := a.User(username)
+	if err != nil {
+		return 0, err
+	}
+	res, err := a.db.Exec(insertScheduleOverrideQuery, schedule.ID, u.ID, start.Unix(), end.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// RemoveScheduleOverride deletes the override with the given ID from the schedule
+func (a *Manager) RemoveScheduleOverride(name string, id int64) error {
+	if !AllowedSchedule(name) {
+		return ErrInvalidArgument
+	}
+	schedule, err := a.Schedule(name)
+	if err != nil {
+		return err
+	}
+	if _, err := a.db.Exec(deleteScheduleOverrideQuery, schedule.ID, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveExpiredScheduleOverrides deletes all overrides that have ended
+func (a *Manager) RemoveExpiredScheduleOverrides() error {
+	if _, err := a.db.Exec(deleteExpiredScheduleOverridesQuery, time.Now().Unix()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TopicSettings returns the settings of the given topic, or ErrTopicSettingsNotFound if no settings were stored
+func (a *Manager) TopicSettings(topic string) (*TopicSettings, error) {
+	rows, err := a.db.Query(selectTopicSettingsQuery, topic)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := a.readTopicSettings(rows)
+	if err != nil {
+		return nil, err
+	} else if len(settings) == 0 {
+		return nil, ErrTopicSettingsNotFound
+	}
+	return settings[0], nil
+}
+
+// AllTopicSettings returns the settings of all topics that have settings
+func (a *Manager) AllTopicSettings() ([]*TopicSettings, error) {
+	rows, err := a.db.Query(selectAllTopicSettingsQuery)
+	if err != nil {
+		return nil, err
+	}
+	return a.readTopicSettings(rows)
+}
+
+// SetTopicSettings creates or replaces the settings of a topic
+func (a *Manager) SetTopicSettings(settings *TopicSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	_, err := a.db.Exec(
+		upsertTopicSettingsQuery,
+		settings.Topic,
+		int64(settings.MessageExpiryDuration.Seconds()),
+		settings.MessageLimit,
+		settings.AttachmentFileSizeLimit,
+		settings.Priority,
+		strings.Join(settings.Tags, ","),
+		settings.Icon,
+		settings.Firebase,
+		int64(settings.Digest.Seconds()),
+	)
+	return err
+}
+
+// RemoveTopicSettings deletes the settings of a topic, so that the server defaults apply again
+func (a *Manager) RemoveTopicSettings(topic string) error {
+	if !AllowedTopic(topic) {
+		return ErrInvalidArgument
+	}
+	if _, err := a.db.Exec(deleteTopicSettingsQuery, topic); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *Manager) readTopicSettings(rows *sql.Rows) ([]*TopicSettings, error) {
+	defer rows.Close()
+	settings := make([]*TopicSettings, 0)
+	for rows.Next() {
+		var topic, tags, icon string
+		var messagesExpiryDuration, messagesLimit, attachmentFileSizeLimit, digest int64
+		var priority int
+		var firebase bool
+		if err := rows.Scan(&topic, &messagesExpiryDuration, &messagesLimit, &attachmentFileSizeLimit, &priority, &tags, &icon, &firebase, &digest); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		var tagsList []string
+		if tags != "" {
+			tagsList = strings.Split(tags, ",")
+		}
+		settings = append(settings, &TopicSettings{
+			Topic:                   topic,
+			MessageExpiryDuration:   time.Duration(messagesExpiryDuration) * time.Second,
+			MessageLimit:            messagesLimit,
+			AttachmentFileSizeLimit: attachmentFileSizeLimit,
+			Priority:                priority,
+			Tags:                    tagsList,
+			Icon:                    icon,
+			Firebase:                firebase,
+			Digest:                  time.Duration(digest) * time.Second,
+		})
+	}
+	return settings, nil
+}
+
+// TopicInfo returns the metadata of the given topic, or ErrTopicInfoNotFound if no metadata was stored
+func (a *Manager) TopicInfo(topic string) (*TopicInfo, error) {
+	rows, err := a.db.Query(selectTopicInfoQuery, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, ErrTopicInfoNotFound
+	}
+	var info TopicInfo
+	if err := rows.Scan(&info.Topic, &info.DisplayName, &info.Description, &info.Icon, &info.Contact); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// SetTopicInfo creates or replaces the metadata of a topic
+func (a *Manager) SetTopicInfo(info *TopicInfo) error {
+	if err := info.Validate(); err != nil {
+		return err
+	}
+	_, err := a.db.Exec(upsertTopicInfoQuery, info.Topic, info.DisplayName, info.Description, info.Icon, info.Contact)
+	return err
+}
+
+// RemoveTopicInfo deletes the metadata of a topic
+func (a *Manager) RemoveTopicInfo(topic string) error {
+	if !AllowedTopic(topic) {
+		return ErrInvalidArgument
+	}
+	if _, err := a.db.Exec(deleteTopicInfoQuery, topic); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddAuditEntry writes an entry to the audit log. If the entry's time is not set, the current time is used.
+func (a *Manager) AddAuditEntry(entry *AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	var ip string
+	if entry.IP.IsValid() {
+		ip = entry.IP.String()
+	}
+	_, err := a.db.Exec(insertAuditEntryQuery, entry.Time.Unix(), entry.Actor, ip, string(entry.Action), entry.Target, entry.Before, entry.After)
+	return err
+}
+
+// AuditEntries returns the audit log entries matching the given filter, newest first. The filter's
+// action also matches all sub-actions, e.g. "user" matches "user.add" and "user.remove".
+func (a *Manager) AuditEntries(filter *AuditFilter) ([]*AuditEntry, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+	var since int64
+	if !filter.Since.IsZero() {
+		since = filter.Since.Unix()
+	}
+	action := string(filter.Action)
+	rows, err := a.db.Query(selectAuditEntriesQuery, filter.Actor, filter.Actor, action, action, action, filter.Target, filter.Target, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]*AuditEntry, 0)
+	for rows.Next() {
+		var id, timestamp int64
+		var actor, ip, action, target, before, after string
+		if err := rows.Scan(&id, &timestamp, &actor, &ip, &action, &target, &before, &after); err != nil {
+			return nil, err
+		}
+		entry := &AuditEntry{
+			ID:     id,
+			Time:   time.Unix(timestamp, 0),
+			Actor:  actor,
+			Action: AuditAction(action),
+			Target: target,
+			Before: before,
+			After:  after,
+		}
+		if ip != "" {
+			entry.IP, err = netip.ParseAddr(ip)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RemoveAuditEntriesBefore deletes all audit log entries older than the given time, and returns the
+// number of deleted entries
+func (a *Manager) RemoveAuditEntriesBefore(before time.Time) (int64, error) {
+	result, err := a.db.Exec(deleteAuditEntriesBeforeQuery, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Close closes the underlying database
 func (a *Manager) Close() error {
 	return a.db.Close()
 }
 
-// toSQLWildcard converts a wildcard string to a SQL wildcard string. It only allows '*' as wildcards,
+// toSQLWildcard converts a wildcard string to a SQL wildcard string. It allows '*' and '?' as wildcards,
 // and escapes '_', assuming '\' as escape character.
 func toSQLWildcard(s string) string {
-	return escapeUnderscore(strings.ReplaceAll(s, "*", "%"))
+	return strings.NewReplacer("_", "\\_", "*", "%", "?", "_").Replace(s)
 }
 
-// fromSQLWildcard converts a SQL wildcard string to a wildcard string. It converts '%' to '*',
+// fromSQLWildcard converts a SQL wildcard string to a wildcard string. It converts '%' to '*' and '_' to '?',
 // and removes the '\_' escape character.
 func fromSQLWildcard(s string) string {
-	return strings.ReplaceAll(unescapeUnderscore(s), "%", "*")
+	return strings.NewReplacer("\\_", "_", "%", "*", "_", "?").Replace(s)
+}
+
+// accessEntry is a matching access control entry, as returned by selectTopicPermsQuery
+type accessEntry struct {
+	topic      string // SQL wildcard pattern
+	read       bool
+	write      bool
+	precedence int // 1 = user, 2 = group, 3 = everyone
+	group      string
+	literals   int
+	wildcards  int
+}
+
+// before returns true if the entry e wins over the entry other, see ExplainAccess for the rules
+func (e *accessEntry) before(other *accessEntry) bool {
+	if e.precedence != other.precedence {
+		return e.precedence < other.precedence
+	} else if e.literals != other.literals {
+		return e.literals > other.literals
+	} else if e.wildcards != other.wildcards {
+		return e.wildcards < other.wildcards
+	}
+	eDeny, otherDeny := !e.read && !e.write, !other.read && !other.write
+	if eDeny != otherDeny {
+		return eDeny
+	} else if e.write != other.write {
+		return e.write
+	}
+	return e.read && !other.read
+}
+
+func (e *accessEntry) match() *AccessMatch {
+	source := AccessSourceUser
+	if e.precedence == 2 {
+		source = AccessSourceGroup
+	} else if e.precedence == 3 {
+		source = AccessSourceEveryone
+	}
+	return &AccessMatch{
+		Allow:        NewPermission(e.read, e.write),
+		Source:       source,
+		Group:        e.group,
+		TopicPattern: fromSQLWildcard(e.topic),
+	}
+}
+
+// patternSpecificity returns the number of literal characters and the number of '%' wildcards
+// in the given SQL wildcard pattern. The single-character wildcard '_' counts as neither.
+func patternSpecificity(pattern string) (literals int, wildcards int) {
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern) && pattern[i+1] == '_':
+			literals++
+			i++
+		case pattern[i] == '%':
+			wildcards++
+		case pattern[i] != '_':
+			literals++
+		}
+	}
+	return
 }
 
 func escapeUnderscore(s string) string {
@@ -1663,6 +2893,150 @@ func migrateFrom4(db *sql.DB) error {
 	return tx.Commit()
 }
 
+func migrateFrom5(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 5 to 6")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate5To6UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 6); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom6(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 6 to 7")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate6To7UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 7); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom7(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 7 to 8")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate7To8UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 8); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom8(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 8 to 9")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate8To9UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 9); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom9(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 9 to 10")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate9To10UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 10); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom10(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 10 to 11")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate10To11UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 11); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom11(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 11 to 12")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate11To12UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 12); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom12(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 12 to 13")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate12To13UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 13); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom13(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 13 to 14")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate13To14UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 14); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func nullString(s string) sql.NullString {
 	if s == "" {
 		return sql.NullString{}
@@ -52,10 +52,10 @@ func TestManager_FullScenario_Default_DenyAll(t *testing.T) {
 	benGrants, err := a.Grants("ben")
 	require.Nil(t, err)
 	require.Equal(t, []Grant{
-		{"everyonewrite", PermissionDenyAll},
-		{"mytopic", PermissionReadWrite},
-		{"writeme", PermissionWrite},
-		{"readme", PermissionRead},
+		{TopicPattern: "everyonewrite", Allow: PermissionDenyAll},
+		{TopicPattern: "mytopic", Allow: PermissionReadWrite},
+		{TopicPattern: "writeme", Allow: PermissionWrite},
+		{TopicPattern: "readme", Allow: PermissionRead},
 	}, benGrants)
 
 	john, err := a.Authenticate("john", "john")
@@ -67,10 +67,10 @@ func TestManager_FullScenario_Default_DenyAll(t *testing.T) {
 	johnGrants, err := a.Grants("john")
 	require.Nil(t, err)
 	require.Equal(t, []Grant{
-		{"mytopic_deny*", PermissionDenyAll},
-		{"mytopic_ro*", PermissionRead},
-		{"mytopic*", PermissionReadWrite},
-		{"*", PermissionRead},
+		{TopicPattern: "mytopic_deny*", Allow: PermissionDenyAll},
+		{TopicPattern: "mytopic_ro*", Allow: PermissionRead},
+		{TopicPattern: "mytopic*", Allow: PermissionReadWrite},
+		{TopicPattern: "*", Allow: PermissionRead},
 	}, johnGrants)
 
 	notben, err := a.Authenticate("ben", "this is wrong")
@@ -277,10 +277,10 @@ func TestManager_UserManagement(t *testing.T) {
 	benGrants, err := a.Grants("ben")
 	require.Nil(t, err)
 	require.Equal(t, []Grant{
-		{"everyonewrite", PermissionDenyAll},
-		{"mytopic", PermissionReadWrite},
-		{"writeme", PermissionWrite},
-		{"readme", PermissionRead},
+		{TopicPattern: "everyonewrite", Allow: PermissionDenyAll},
+		{TopicPattern: "mytopic", Allow: PermissionReadWrite},
+		{TopicPattern: "writeme", Allow: PermissionWrite},
+		{TopicPattern: "readme", Allow: PermissionRead},
 	}, benGrants)
 
 	everyone, err := a.User(Everyone)
@@ -292,8 +292,8 @@ func TestManager_UserManagement(t *testing.T) {
 	everyoneGrants, err := a.Grants(Everyone)
 	require.Nil(t, err)
 	require.Equal(t, []Grant{
-		{"everyonewrite", PermissionReadWrite},
-		{"announcements", PermissionRead},
+		{TopicPattern: "everyonewrite", Allow: PermissionReadWrite},
+		{TopicPattern: "announcements", Allow: PermissionRead},
 	}, everyoneGrants)
 
 	// Ben: Before revoking
@@ -427,10 +427,10 @@ func TestManager_Reservations(t *testing.T) {
 	require.Equal(t, int64(0), count)
 
 	err = a.AllowReservation("phil", "readme")
-	require.Equal(t, errTopicOwnedByOthers, err)
+	require.Equal(t, ErrTopicOwnedByOthers, err)
 
 	err = a.AllowReservation("phil", "ztopic_")
-	require.Equal(t, errTopicOwnedByOthers, err)
+	require.Equal(t, ErrTopicOwnedByOthers, err)
 
 	err = a.AllowReservation("phil", "ztopicX")
 	require.Nil(t, err)
@@ -616,6 +616,83 @@ func TestManager_Token_Expire(t *testing.T) {
 	require.Nil(t, result.Close())
 }
 
+func TestManager_Access_Expire(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	expires := time.Now().Add(time.Hour)
+	require.Nil(t, a.AllowAccessUntil("ben", "incident-*", PermissionReadWrite, expires))
+	require.Nil(t, a.AllowAccessUntil(Everyone, "status", PermissionRead, expires))
+	require.Nil(t, a.AllowAccess("ben", "mytopic", PermissionReadWrite))
+
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+
+	grants, err := a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, []Grant{
+		{TopicPattern: "incident-*", Allow: PermissionReadWrite, Expires: time.Unix(expires.Unix(), 0)},
+		{TopicPattern: "mytopic", Allow: PermissionReadWrite},
+	}, grants)
+
+	// Grants work until they expire
+	require.Nil(t, a.Authorize(ben, "incident-123", PermissionWrite))
+	require.Nil(t, a.Authorize(nil, "status", PermissionRead))
+
+	expired, err := a.RemoveExpiredAccess()
+	require.Nil(t, err)
+	require.Empty(t, expired)
+
+	// Modify expiration in database
+	_, err = a.db.Exec("UPDATE user_access SET expires = 1 WHERE expires > 0")
+	require.Nil(t, err)
+
+	// Expired grants are ignored, even before they are removed
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "incident-123", PermissionWrite))
+	require.Equal(t, ErrUnauthorized, a.Authorize(nil, "status", PermissionRead))
+	require.Nil(t, a.Authorize(ben, "mytopic", PermissionWrite))
+
+	// Remove expired grants, and check that they are returned
+	expired, err = a.RemoveExpiredAccess()
+	require.Nil(t, err)
+	require.Equal(t, map[string][]Grant{
+		ben.ID:     {{TopicPattern: "incident-*", Allow: PermissionReadWrite, Expires: time.Unix(1, 0)}},
+		everyoneID: {{TopicPattern: "status", Allow: PermissionRead, Expires: time.Unix(1, 0)}},
+	}, expired)
+
+	grants, err = a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, []Grant{
+		{TopicPattern: "mytopic", Allow: PermissionReadWrite},
+	}, grants)
+}
+
+func TestManager_Access_ExpireInvalid(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+
+	// Expiry must be in the future
+	require.Equal(t, ErrInvalidArgument, a.AllowAccessUntil("ben", "mytopic", PermissionRead, time.Now().Add(-time.Minute)))
+
+	// Expiring entries do not replace permanent entries
+	require.Nil(t, a.AllowAccess("ben", "mytopic", PermissionReadWrite))
+	require.Equal(t, ErrAccessPermanent, a.AllowAccessUntil("ben", "mytopic", PermissionRead, time.Now().Add(time.Hour)))
+	grants, err := a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, []Grant{{TopicPattern: "mytopic", Allow: PermissionReadWrite}}, grants)
+
+	// Expiring entries can be changed, or made permanent
+	expires := time.Now().Add(time.Hour)
+	require.Nil(t, a.AllowAccessUntil("ben", "other", PermissionRead, time.Now().Add(time.Minute)))
+	require.Nil(t, a.AllowAccessUntil("ben", "other", PermissionReadWrite, expires))
+	grants, err = a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, Grant{TopicPattern: "other", Allow: PermissionReadWrite, Expires: time.Unix(expires.Unix(), 0)}, grants[1])
+	require.Nil(t, a.AllowAccess("ben", "other", PermissionRead))
+	grants, err = a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, Grant{TopicPattern: "other", Allow: PermissionRead}, grants[1])
+}
+
 func TestManager_Token_Extend(t *testing.T) {
 	a := newTestManager(t, PermissionDenyAll)
 	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
@@ -1065,6 +1142,121 @@ func TestManager_Topic_Wildcard_With_Underscore(t *testing.T) {
 	require.Equal(t, ErrUnauthorized, a.Authorize(nil, "mytopicX", PermissionWrite))
 }
 
+func TestManager_Group_AddMembersRemove(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	require.Nil(t, a.AddUser("emma", "emma", RoleUser))
+	require.Nil(t, a.AddGroup("ops"))
+	require.Nil(t, a.AddGroup("devs"))
+	require.Equal(t, ErrGroupExists, a.AddGroup("ops"))
+	require.Equal(t, ErrInvalidArgument, a.AddGroup("not valid"))
+
+	require.Nil(t, a.AddGroupMember("ops", "ben"))
+	require.Nil(t, a.AddGroupMember("ops", "emma"))
+	require.Nil(t, a.AddGroupMember("ops", "emma")) // Idempotent
+	require.Nil(t, a.AddGroupMember("devs", "ben"))
+	require.Equal(t, ErrGroupNotFound, a.AddGroupMember("doesnotexist", "ben"))
+	require.Equal(t, ErrUserNotFound, a.AddGroupMember("ops", "doesnotexist"))
+
+	groups, err := a.Groups()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(groups))
+	require.Equal(t, "devs", groups[0].Name)
+	require.Equal(t, []string{"ben"}, groups[0].Members)
+	require.Equal(t, "ops", groups[1].Name)
+	require.True(t, strings.HasPrefix(groups[1].ID, "gr_"))
+	require.Equal(t, []string{"ben", "emma"}, groups[1].Members)
+
+	benGroups, err := a.UserGroups("ben")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(benGroups))
+	require.Equal(t, "devs", benGroups[0].Name)
+	require.Equal(t, "ops", benGroups[1].Name)
+
+	require.Nil(t, a.RemoveGroupMember("ops", "ben"))
+	ops, err := a.Group("ops")
+	require.Nil(t, err)
+	require.Equal(t, []string{"emma"}, ops.Members)
+
+	// Removing the user removes the membership
+	require.Nil(t, a.RemoveUser("emma"))
+	ops, err = a.Group("ops")
+	require.Nil(t, err)
+	require.Equal(t, []string{}, ops.Members)
+
+	require.Nil(t, a.RemoveGroup("ops"))
+	_, err = a.Group("ops")
+	require.Equal(t, ErrGroupNotFound, err)
+}
+
+func TestManager_Group_Authorize_Precedence(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	require.Nil(t, a.AddUser("emma", "emma", RoleUser))
+	require.Nil(t, a.AddUser("john", "john", RoleUser))
+	require.Nil(t, a.AddGroup("ops"))
+	require.Nil(t, a.AddGroup("oncall"))
+	require.Nil(t, a.AddGroupMember("ops", "ben"))
+	require.Nil(t, a.AddGroupMember("ops", "emma"))
+	require.Nil(t, a.AddGroupMember("oncall", "emma"))
+	require.Nil(t, a.AllowGroupAccess("ops", "ops-*", PermissionRead))
+	require.Nil(t, a.AllowGroupAccess("oncall", "ops-*", PermissionReadWrite))
+	require.Nil(t, a.AllowGroupAccess("ops", "ops-secret", PermissionDenyAll))
+	require.Nil(t, a.AllowAccess("ben", "ops-ben", PermissionReadWrite))
+	require.Nil(t, a.AllowAccess(Everyone, "ops-public", PermissionReadWrite))
+	require.Equal(t, ErrGroupNotFound, a.AllowGroupAccess("doesnotexist", "ops-*", PermissionRead))
+
+	grants, err := a.GroupGrants("ops")
+	require.Nil(t, err)
+	require.Equal(t, []Grant{
+		{TopicPattern: "ops-secret", Allow: PermissionDenyAll},
+		{TopicPattern: "ops-*", Allow: PermissionRead},
+	}, grants)
+
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	emma, err := a.User("emma")
+	require.Nil(t, err)
+	john, err := a.User("john")
+	require.Nil(t, err)
+
+	// Group grants apply to members only
+	require.Nil(t, a.Authorize(ben, "ops-alerts", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "ops-alerts", PermissionWrite))
+	require.Equal(t, ErrUnauthorized, a.Authorize(john, "ops-alerts", PermissionRead))
+
+	// User grants take precedence over group grants
+	require.Nil(t, a.Authorize(ben, "ops-ben", PermissionWrite))
+
+	// More specific group grants take precedence over less specific ones
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "ops-secret", PermissionRead))
+
+	// For equally specific group grants, the more permissive one wins
+	require.Nil(t, a.Authorize(emma, "ops-alerts", PermissionWrite))
+
+	// Group grants take precedence over everyone grants
+	require.Nil(t, a.Authorize(ben, "ops-public", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "ops-public", PermissionWrite))
+	require.Nil(t, a.Authorize(john, "ops-public", PermissionWrite))
+	require.Nil(t, a.Authorize(nil, "ops-public", PermissionWrite))
+
+	// Resetting group access
+	require.Nil(t, a.ResetGroupAccess("ops", "ops-secret"))
+	require.Nil(t, a.Authorize(ben, "ops-secret", PermissionRead))
+	require.Nil(t, a.ResetGroupAccess("ops", ""))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "ops-alerts", PermissionRead))
+	require.Nil(t, a.Authorize(emma, "ops-alerts", PermissionWrite))
+}
+
+func TestManager_Group_AllowReservation(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	require.Nil(t, a.AddGroup("ops"))
+	require.Nil(t, a.AllowGroupAccess("ops", "ops-*", PermissionRead))
+	require.Nil(t, a.AllowReservation("ben", "mytopic"))
+	require.Equal(t, ErrTopicOwnedByOthers, a.AllowReservation("ben", "ops-alerts"))
+}
+
 func TestToFromSQLWildcard(t *testing.T) {
 	require.Equal(t, "up%", toSQLWildcard("up*"))
 	require.Equal(t, "up\\_%", toSQLWildcard("up_*"))
@@ -1077,6 +1269,392 @@ func TestToFromSQLWildcard(t *testing.T) {
 	require.Equal(t, "up*", fromSQLWildcard(toSQLWildcard("up*")))
 	require.Equal(t, "up_*", fromSQLWildcard(toSQLWildcard("up_*")))
 	require.Equal(t, "foo", fromSQLWildcard(toSQLWildcard("foo")))
+
+	require.Equal(t, "up\\_\\__-%", toSQLWildcard("up__?-*"))
+	require.Equal(t, "up__?-*", fromSQLWildcard(toSQLWildcard("up__?-*")))
+}
+
+func TestManager_Topic_Wildcard_Glob(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AllowAccess(Everyone, "*-alerts-*", PermissionRead))
+	require.Nil(t, a.AllowAccess(Everyone, "backup-??", PermissionWrite))
+	require.Equal(t, ErrInvalidArgument, a.AllowAccess(Everyone, "backup-%", PermissionWrite))
+
+	require.Nil(t, a.Authorize(nil, "prod-alerts-db", PermissionRead))
+	require.Nil(t, a.Authorize(nil, "-alerts-", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(nil, "prod-alerts", PermissionRead))
+	require.Nil(t, a.Authorize(nil, "backup-01", PermissionWrite))
+	require.Nil(t, a.Authorize(nil, "backup-_1", PermissionWrite))
+	require.Equal(t, ErrUnauthorized, a.Authorize(nil, "backup-1", PermissionWrite))
+	require.Equal(t, ErrUnauthorized, a.Authorize(nil, "backup-123", PermissionWrite))
+
+	grants, err := a.Grants(Everyone)
+	require.Nil(t, err)
+	require.Equal(t, []Grant{
+		{TopicPattern: "*-alerts-*", Allow: PermissionRead},
+		{TopicPattern: "backup-??", Allow: PermissionWrite},
+	}, grants)
+}
+
+func TestManager_Access_Deny_Specificity(t *testing.T) {
+	a := newTestManager(t, PermissionReadWrite)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	require.Nil(t, a.AllowAccess(Everyone, "prod-*", PermissionDenyAll))
+	require.Nil(t, a.AllowAccess(Everyone, "prod-public", PermissionRead))
+	require.Nil(t, a.AllowAccess("ben", "*-log", PermissionReadWrite))
+	require.Nil(t, a.AllowAccess("ben", "app-*", PermissionDenyAll))
+	require.Nil(t, a.AllowAccess("ben", "app-?", PermissionRead))
+
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+
+	// Lock down prod-*, but keep prod-public open
+	require.Equal(t, ErrUnauthorized, a.Authorize(nil, "prod-db", PermissionRead))
+	require.Nil(t, a.Authorize(nil, "prod-public", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(nil, "prod-public", PermissionWrite))
+	require.Nil(t, a.Authorize(nil, "staging-db", PermissionWrite)) // Default access
+
+	// Equally specific entries: explicit deny wins ("*-log" and "app-*" both have 4 literals)
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "app-log", PermissionRead))
+	require.Nil(t, a.Authorize(ben, "web-log", PermissionWrite))
+
+	// Same number of literals, but '?' is more specific than '*'
+	require.Nil(t, a.Authorize(ben, "app-1", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "app-12", PermissionRead))
+}
+
+func TestManager_ExplainAccess(t *testing.T) {
+	a := newTestManager(t, PermissionRead)
+	require.Nil(t, a.AddUser("phil", "phil", RoleAdmin))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	require.Nil(t, a.AddGroup("ops"))
+	require.Nil(t, a.AddGroupMember("ops", "ben"))
+	require.Nil(t, a.AllowGroupAccess("ops", "ops-*", PermissionReadWrite))
+	require.Nil(t, a.AllowAccess("ben", "ops-secret", PermissionDenyAll))
+	require.Nil(t, a.AllowAccess(Everyone, "announcements", PermissionRead))
+
+	phil, err := a.User("phil")
+	require.Nil(t, err)
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+
+	match, err := a.ExplainAccess(phil, "ops-secret")
+	require.Nil(t, err)
+	require.Equal(t, &AccessMatch{Allow: PermissionReadWrite, Source: AccessSourceAdmin}, match)
+
+	match, err = a.ExplainAccess(ben, "ops-secret")
+	require.Nil(t, err)
+	require.Equal(t, &AccessMatch{Allow: PermissionDenyAll, Source: AccessSourceUser, TopicPattern: "ops-secret"}, match)
+
+	match, err = a.ExplainAccess(ben, "ops-alerts")
+	require.Nil(t, err)
+	require.Equal(t, &AccessMatch{Allow: PermissionReadWrite, Source: AccessSourceGroup, Group: "ops", TopicPattern: "ops-*"}, match)
+
+	match, err = a.ExplainAccess(ben, "announcements")
+	require.Nil(t, err)
+	require.Equal(t, &AccessMatch{Allow: PermissionRead, Source: AccessSourceEveryone, TopicPattern: "announcements"}, match)
+
+	match, err = a.ExplainAccess(nil, "something")
+	require.Nil(t, err)
+	require.Equal(t, &AccessMatch{Allow: PermissionRead, Source: AccessSourceDefault}, match)
+}
+
+func TestManager_AuditEntries(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+
+	now := time.Now()
+	require.Nil(t, a.AddAuditEntry(&AuditEntry{
+		Time:   now.Add(-2 * time.Hour),
+		Actor:  "phil",
+		IP:     netip.MustParseAddr("1.2.3.4"),
+		Action: AuditUserAdd,
+		Target: "ben",
+	}))
+	require.Nil(t, a.AddAuditEntry(&AuditEntry{
+		Time:   now.Add(-time.Hour),
+		Actor:  "phil",
+		IP:     netip.MustParseAddr("1.2.3.4"),
+		Action: AuditUserRole,
+		Target: "ben",
+		Before: "user",
+		After:  "admin",
+	}))
+	require.Nil(t, a.AddAuditEntry(&AuditEntry{
+		Actor:  AuditActorCLI,
+		Action: AuditTierAdd,
+		Target: "pro",
+	}))
+
+	// All entries, newest first
+	entries, err := a.AuditEntries(&AuditFilter{})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, AuditTierAdd, entries[0].Action)
+	require.Equal(t, AuditActorCLI, entries[0].Actor)
+	require.False(t, entries[0].IP.IsValid())
+	require.Equal(t, AuditUserRole, entries[1].Action)
+	require.Equal(t, "user", entries[1].Before)
+	require.Equal(t, "admin", entries[1].After)
+	require.Equal(t, "1.2.3.4", entries[1].IP.String())
+	require.Equal(t, now.Add(-time.Hour).Unix(), entries[1].Time.Unix())
+
+	// Filters
+	entries, err = a.AuditEntries(&AuditFilter{Action: "user"})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+
+	entries, err = a.AuditEntries(&AuditFilter{Action: "user.ad"})
+	require.Nil(t, err)
+	require.Empty(t, entries)
+
+	entries, err = a.AuditEntries(&AuditFilter{Actor: "phil", Since: now.Add(-90 * time.Minute)})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, AuditUserRole, entries[0].Action)
+
+	entries, err = a.AuditEntries(&AuditFilter{Target: "ben", Limit: 1})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, AuditUserRole, entries[0].Action)
+}
+
+func TestManager_RemoveAuditEntriesBefore(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	now := time.Now()
+	require.Nil(t, a.AddAuditEntry(&AuditEntry{Time: now.Add(-48 * time.Hour), Action: AuditLoginFailed, Target: "ben"}))
+	require.Nil(t, a.AddAuditEntry(&AuditEntry{Time: now.Add(-time.Hour), Action: AuditLoginFailed, Target: "phil"}))
+
+	removed, err := a.RemoveAuditEntriesBefore(now.Add(-24 * time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, int64(1), removed)
+
+	entries, err := a.AuditEntries(&AuditFilter{})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, "phil", entries[0].Target)
+}
+
+func TestManager_AuditEntries_ExpiredAccessAndDeletedUsers(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	require.Nil(t, a.AllowAccessUntil("ben", "incident-*", PermissionReadWrite, time.Now().Add(time.Hour)))
+	_, err := a.db.Exec("UPDATE user_access SET expires = 1 WHERE expires > 0")
+	require.Nil(t, err)
+	_, err = a.RemoveExpiredAccess()
+	require.Nil(t, err)
+
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.Nil(t, a.MarkUserRemoved(ben))
+	_, err = a.db.Exec("UPDATE user SET deleted = 1 WHERE user = 'ben'")
+	require.Nil(t, err)
+	require.Nil(t, a.RemoveDeletedUsers())
+
+	entries, err := a.AuditEntries(&AuditFilter{Actor: AuditActorServer})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, AuditUserPurge, entries[0].Action)
+	require.Equal(t, "ben", entries[0].Target)
+	require.Equal(t, AuditAccessExpire, entries[1].Action)
+	require.Equal(t, "ben", entries[1].Target)
+	require.Equal(t, "incident-*: read-write (expires 1970-01-01T00:00:01Z)", entries[1].Before)
+}
+
+func TestManager_Schedules(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	require.Nil(t, a.AddUser("emma", "emma", RoleUser))
+
+	handoff := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.Nil(t, a.AddSchedule("ops", handoff, 24*time.Hour))
+	require.Equal(t, ErrScheduleExists, a.AddSchedule("ops", handoff, 24*time.Hour))
+	require.Equal(t, ErrInvalidArgument, a.AddSchedule("not valid", handoff, 24*time.Hour))
+	require.Equal(t, ErrInvalidArgument, a.AddSchedule("short", handoff, time.Second))
+
+	// No members, no one on call
+	_, _, err := a.OnCall("ops")
+	require.Equal(t, ErrUserNotFound, err)
+
+	require.Nil(t, a.AddScheduleMember("ops", "phil", "phil@example.com"))
+	require.Nil(t, a.AddScheduleMember("ops", "ben", ""))
+	require.Nil(t, a.AddScheduleMember("ops", "emma", ""))
+	require.Nil(t, a.AddScheduleMember("ops", "phil", "phil@example.org")) // Keeps position, updates e-mail
+	require.Equal(t, ErrScheduleNotFound, a.AddScheduleMember("doesnotexist", "ben", ""))
+	require.Equal(t, ErrUserNotFound, a.AddScheduleMember("ops", "doesnotexist", ""))
+
+	schedule, err := a.Schedule("ops")
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(schedule.ID, "sc_"))
+	require.Equal(t, handoff.Unix(), schedule.Handoff.Unix())
+	require.Equal(t, 24*time.Hour, schedule.Period)
+	require.Equal(t, 3, len(schedule.Members))
+	require.Equal(t, "phil", schedule.Members[0].Username)
+	require.Equal(t, "phil@example.org", schedule.Members[0].Email)
+	require.Equal(t, "ben", schedule.Members[1].Username)
+	require.Equal(t, "emma", schedule.Members[2].Username)
+
+	u, email, err := a.OnCall("ops")
+	require.Nil(t, err)
+	require.Equal(t, "phil", u.Name)
+	require.Equal(t, "phil@example.org", email)
+
+	// Handoff to ben
+	require.Nil(t, a.ChangeSchedule("ops", handoff.Add(-24*time.Hour), 24*time.Hour))
+	require.Equal(t, ErrScheduleNotFound, a.ChangeSchedule("doesnotexist", handoff, 24*time.Hour))
+	u, _, err = a.OnCall("ops")
+	require.Nil(t, err)
+	require.Equal(t, "ben", u.Name)
+
+	// Owner
+	require.Nil(t, a.ChangeScheduleOwner("ops", "emma"))
+	require.Equal(t, ErrUserNotFound, a.ChangeScheduleOwner("ops", "doesnotexist"))
+	require.Equal(t, ErrScheduleNotFound, a.ChangeScheduleOwner("doesnotexist", "emma"))
+	schedule, err = a.Schedule("ops")
+	require.Nil(t, err)
+	require.Equal(t, "emma", schedule.Owner)
+	require.Nil(t, a.ChangeScheduleOwner("ops", ""))
+	schedule, err = a.Schedule("ops")
+	require.Nil(t, err)
+	require.Equal(t, "", schedule.Owner)
+
+	// Override for emma, plus an expired one
+	id, err := a.AddScheduleOverride("ops", "emma", time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	_, err = a.AddScheduleOverride("ops", "phil", time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	require.Nil(t, err)
+	_, err = a.AddScheduleOverride("ops", "phil", time.Now(), time.Now().Add(-time.Hour))
+	require.Equal(t, ErrInvalidArgument, err)
+	u, _, err = a.OnCall("ops")
+	require.Nil(t, err)
+	require.Equal(t, "emma", u.Name)
+
+	require.Nil(t, a.RemoveExpiredScheduleOverrides())
+	schedule, err = a.Schedule("ops")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(schedule.Overrides))
+	require.Equal(t, id, schedule.Overrides[0].ID)
+
+	require.Nil(t, a.RemoveScheduleOverride("ops", id))
+	u, _, err = a.OnCall("ops")
+	require.Nil(t, err)
+	require.Equal(t, "ben", u.Name)
+
+	// Removing members and users
+	require.Nil(t, a.RemoveScheduleMember("ops", "ben"))
+	require.Nil(t, a.RemoveUser("emma"))
+	schedule, err = a.Schedule("ops")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(schedule.Members))
+	require.Equal(t, "phil", schedule.Members[0].Username)
+
+	require.Nil(t, a.RemoveSchedule("ops"))
+	_, err = a.Schedule("ops")
+	require.Equal(t, ErrScheduleNotFound, err)
+	schedules, err := a.Schedules()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(schedules))
+}
+
+func TestManager_TopicSettings(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	_, err := a.TopicSettings("mytopic")
+	require.Equal(t, ErrTopicSettingsNotFound, err)
+
+	settings := NewTopicSettings("mytopic")
+	settings.MessageExpiryDuration = 2 * time.Hour
+	settings.MessageLimit = 100
+	settings.Priority = 4
+	settings.Tags = []string{"warning", "backup"}
+	settings.Icon = "https://example.com/icon.png"
+	settings.Digest = 2 * time.Minute
+	require.Nil(t, a.SetTopicSettings(settings))
+	require.Nil(t, a.SetTopicSettings(NewTopicSettings("othertopic")))
+
+	settings, err = a.TopicSettings("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 2*time.Hour, settings.MessageExpiryDuration)
+	require.Equal(t, int64(100), settings.MessageLimit)
+	require.Equal(t, int64(0), settings.AttachmentFileSizeLimit)
+	require.Equal(t, 4, settings.Priority)
+	require.Equal(t, []string{"warning", "backup"}, settings.Tags)
+	require.Equal(t, "https://example.com/icon.png", settings.Icon)
+	require.True(t, settings.Firebase)
+	require.Equal(t, 2*time.Minute, settings.Digest)
+	require.Equal(t, "messages_expiry_duration=2h0m0s, messages=100, priority=4, tags=warning,backup, icon=https://example.com/icon.png, digest=2m0s", settings.String())
+
+	// Replace settings
+	settings.Tags = nil
+	settings.Firebase = false
+	require.Nil(t, a.SetTopicSettings(settings))
+	settings, err = a.TopicSettings("mytopic")
+	require.Nil(t, err)
+	require.Nil(t, settings.Tags)
+	require.False(t, settings.Firebase)
+
+	// Invalid settings
+	require.Equal(t, ErrInvalidArgument, a.SetTopicSettings(&TopicSettings{Topic: "not valid"}))
+	require.Equal(t, ErrInvalidArgument, a.SetTopicSettings(&TopicSettings{Topic: "mytopic", Priority: 6}))
+	require.Equal(t, ErrInvalidArgument, a.SetTopicSettings(&TopicSettings{Topic: "mytopic", MessageLimit: -1}))
+	require.Equal(t, ErrInvalidArgument, a.SetTopicSettings(&TopicSettings{Topic: "mytopic", Tags: []string{"a,b"}}))
+
+	all, err := a.AllTopicSettings()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(all))
+	require.Equal(t, "mytopic", all[0].Topic)
+	require.Equal(t, "othertopic", all[1].Topic)
+
+	require.Nil(t, a.RemoveTopicSettings("mytopic"))
+	_, err = a.TopicSettings("mytopic")
+	require.Equal(t, ErrTopicSettingsNotFound, err)
+}
+
+func TestManager_TopicInfo(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	_, err := a.TopicInfo("backups")
+	require.Equal(t, ErrTopicInfoNotFound, err)
+
+	require.Nil(t, a.SetTopicInfo(&TopicInfo{
+		Topic:       "backups",
+		DisplayName: "Backups (production)",
+		Description: "Nightly database backups",
+		Contact:     "ops@example.com",
+	}))
+	info, err := a.TopicInfo("backups")
+	require.Nil(t, err)
+	require.Equal(t, "Backups (production)", info.DisplayName)
+	require.Equal(t, "Nightly database backups", info.Description)
+	require.Equal(t, "", info.Icon)
+	require.Equal(t, "ops@example.com", info.Contact)
+
+	require.Equal(t, ErrInvalidArgument, a.SetTopicInfo(&TopicInfo{Topic: "not valid"}))
+	require.Equal(t, ErrInvalidArgument, a.SetTopicInfo(&TopicInfo{Topic: "backups", DisplayName: strings.Repeat("x", 65)}))
+
+	require.Nil(t, a.RemoveTopicInfo("backups"))
+	_, err = a.TopicInfo("backups")
+	require.Equal(t, ErrTopicInfoNotFound, err)
+}
+
+func TestManager_ReservationsKeepLast(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddTier(&Tier{Code: "pro", MessageKeepLast: 100}))
+	require.Nil(t, a.AddTier(&Tier{Code: "basic"}))
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser))
+	require.Nil(t, a.ChangeTier("phil", "pro"))
+	require.Nil(t, a.ChangeTier("ben", "basic"))
+	require.Nil(t, a.AddReservation("phil", "my_backups", PermissionRead))
+	require.Nil(t, a.AddReservation("ben", "ben-topic", PermissionRead))
+	require.Nil(t, a.AllowAccess("ben", "my_backups", PermissionRead)) // Not the owner
+
+	tier, err := a.Tier("pro")
+	require.Nil(t, err)
+	require.Equal(t, int64(100), tier.MessageKeepLast)
+
+	keepLast, err := a.ReservationsKeepLast()
+	require.Nil(t, err)
+	require.Equal(t, map[string]int64{"my_backups": 100}, keepLast)
 }
 
 func TestMigrationFrom1(t *testing.T) {
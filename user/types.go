@@ -2,12 +2,14 @@ package user
 
 import (
 	"errors"
+	"fmt"
 	"github.com/stripe/stripe-go/v74"
 	"heckel.io/ntfy/v2/log"
 	"net/netip"
 	"regexp"
 	"strings"
 	"time"
+	_ "time/tzdata" // Embed time zone database for quiet hours, the Docker image does not ship one
 )
 
 // User is a struct that represents a user
@@ -85,6 +87,7 @@ type Tier struct {
 	Name                     string        // Name of the tier
 	MessageLimit             int64         // Daily message limit
 	MessageExpiryDuration    time.Duration // Cache duration for messages
+	MessageKeepLast          int64         // Number of messages to keep per reserved topic, see Config.CacheKeepLast
 	EmailLimit               int64         // Daily email limit
 	CallLimit                int64         // Daily phone call limit
 	ReservationLimit         int64         // Number of topic reservations allowed by user
@@ -123,9 +126,77 @@ func (s *Subscription) Context() log.Context {
 
 // NotificationPrefs represents the user's notification settings
 type NotificationPrefs struct {
-	Sound       *string `json:"sound,omitempty"`
-	MinPriority *int    `json:"min_priority,omitempty"`
-	DeleteAfter *int    `json:"delete_after,omitempty"`
+	Sound       *string     `json:"sound,omitempty"`
+	MinPriority *int        `json:"min_priority,omitempty"`
+	DeleteAfter *int        `json:"delete_after,omitempty"`
+	QuietHours  *QuietHours `json:"quiet_hours,omitempty"`
+}
+
+// QuietHours defines a daily time window in which the server does not send non-urgent messages to the user
+// via e-mail, phone calls or web push. The window may span midnight, e.g. from 22:00 to 07:00.
+type QuietHours struct {
+	Start       string `json:"start"`                  // Time of day in the format "HH:MM"
+	End         string `json:"end"`                    // Time of day in the format "HH:MM"
+	Timezone    string `json:"timezone,omitempty"`     // IANA time zone name, e.g. "Europe/Berlin"; UTC if empty
+	MinPriority int    `json:"min_priority,omitempty"` // Messages with at least this priority are still sent, 5 if unset
+}
+
+// Validate checks that start, end, time zone and priority of the quiet hours are valid
+func (q *QuietHours) Validate() error {
+	if _, err := parseTimeOfDay(q.Start); err != nil {
+		return ErrInvalidArgument
+	} else if _, err := parseTimeOfDay(q.End); err != nil {
+		return ErrInvalidArgument
+	} else if q.Start == q.End {
+		return ErrInvalidArgument
+	} else if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return ErrInvalidArgument
+	} else if q.MinPriority < 0 || q.MinPriority > 5 {
+		return ErrInvalidArgument
+	}
+	return nil
+}
+
+// Suppress returns true if a message with the given priority must not be sent at the given time, i.e. if the
+// time is within the quiet hours, and the priority is below the minimum priority. Priority 0 is the default priority 3.
+func (q *QuietHours) Suppress(now time.Time, priority int) bool {
+	if priority == 0 {
+		priority = 3
+	}
+	minPriority := q.MinPriority
+	if minPriority == 0 {
+		minPriority = 5
+	}
+	if priority >= minPriority {
+		return false
+	}
+	start, err := parseTimeOfDay(q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseTimeOfDay(q.End)
+	if err != nil {
+		return false
+	}
+	location, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+	current := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	if start < end {
+		return current >= start && current < end
+	}
+	return current >= start || current < end // Spans midnight
+}
+
+// parseTimeOfDay parses a time of day in the format "HH:MM", and returns it as duration since midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
 }
 
 // Stats is a struct holding daily user statistics
@@ -147,8 +218,198 @@ type Billing struct {
 
 // Grant is a struct that represents an access control entry to a topic by a user
 type Grant struct {
-	TopicPattern string // May include wildcard (*)
+	TopicPattern string // May include wildcards (* and ?)
 	Allow        Permission
+	Expires      time.Time // Zero if the grant does not expire
+}
+
+// String returns a human-readable representation of the grant, e.g. "alerts*: read-write"
+func (g Grant) String() string {
+	if g.Expires.IsZero() {
+		return fmt.Sprintf("%s: %s", g.TopicPattern, g.Allow.String())
+	}
+	return fmt.Sprintf("%s: %s (expires %s)", g.TopicPattern, g.Allow.String(), g.Expires.UTC().Format(time.RFC3339))
+}
+
+// Group is a struct that represents a named set of users, which share the group's access control entries
+type Group struct {
+	ID      string   // Group identifier (gr_...)
+	Name    string   // Name of the group
+	Members []string // Usernames of all group members
+}
+
+// TopicSettings are per-topic overrides of the server defaults, managed by the owner of the topic reservation
+// or by an admin. Limits can only be lowered, not raised: they apply in addition to the limits of the publisher.
+// Defaults are applied to messages that do not set the respective field.
+type TopicSettings struct {
+	Topic                   string
+	MessageExpiryDuration   time.Duration // Max time messages are kept for the topic, zero for the server default
+	MessageLimit            int64         // Max number of messages kept for the topic, zero for no limit
+	AttachmentFileSizeLimit int64         // Max file size per attachment (bytes), zero for the server default
+	Priority                int           // Default priority, zero for none
+	Tags                    []string      // Default tags
+	Icon                    string        // Default icon URL
+	Firebase                bool          // Whether messages may be forwarded to Firebase
+	Digest                  time.Duration // Window to collect messages into one push/e-mail notification, zero for none
+}
+
+// NewTopicSettings returns the settings of a topic without any overrides
+func NewTopicSettings(topic string) *TopicSettings {
+	return &TopicSettings{
+		Topic:    topic,
+		Firebase: true,
+	}
+}
+
+// Validate returns ErrInvalidArgument if the topic or any of the settings is invalid
+func (s *TopicSettings) Validate() error {
+	if !AllowedTopic(s.Topic) || s.MessageExpiryDuration < 0 || s.MessageLimit < 0 || s.AttachmentFileSizeLimit < 0 || s.Digest < 0 {
+		return ErrInvalidArgument
+	} else if s.Priority < 0 || s.Priority > 5 || len(s.Tags) > topicSettingsTagsMax {
+		return ErrInvalidArgument
+	}
+	for _, tag := range s.Tags {
+		if tag == "" || strings.Contains(tag, ",") {
+			return ErrInvalidArgument
+		}
+	}
+	return nil
+}
+
+// String returns a human-readable representation of all settings that differ from the server defaults,
+// e.g. "messages_expiry_duration=1h0m0s, priority=4, firebase=false"
+func (s *TopicSettings) String() string {
+	settings := make([]string, 0)
+	if s.MessageExpiryDuration > 0 {
+		settings = append(settings, fmt.Sprintf("messages_expiry_duration=%s", s.MessageExpiryDuration.String()))
+	}
+	if s.MessageLimit > 0 {
+		settings = append(settings, fmt.Sprintf("messages=%d", s.MessageLimit))
+	}
+	if s.AttachmentFileSizeLimit > 0 {
+		settings = append(settings, fmt.Sprintf("attachment_file_size=%d", s.AttachmentFileSizeLimit))
+	}
+	if s.Priority > 0 {
+		settings = append(settings, fmt.Sprintf("priority=%d", s.Priority))
+	}
+	if len(s.Tags) > 0 {
+		settings = append(settings, fmt.Sprintf("tags=%s", strings.Join(s.Tags, ",")))
+	}
+	if s.Icon != "" {
+		settings = append(settings, fmt.Sprintf("icon=%s", s.Icon))
+	}
+	if !s.Firebase {
+		settings = append(settings, "firebase=false")
+	}
+	if s.Digest > 0 {
+		settings = append(settings, fmt.Sprintf("digest=%s", s.Digest.String()))
+	}
+	return strings.Join(settings, ", ")
+}
+
+// TopicInfo is the metadata of a topic, managed by the owner of the topic reservation or by an admin. It is
+// visible to everyone who can read the topic, so that shared topics look the same for all subscribers.
+type TopicInfo struct {
+	Topic       string
+	DisplayName string // Human-readable name of the topic, e.g. "Backups (production)"
+	Description string // What the topic is used for
+	Icon        string // Icon URL
+	Contact     string // How to reach the owner of the topic, e.g. an e-mail address or URL
+}
+
+// Validate returns ErrInvalidArgument if the topic is invalid, or if any of the fields is too long
+func (i *TopicInfo) Validate() error {
+	if !AllowedTopic(i.Topic) {
+		return ErrInvalidArgument
+	} else if len(i.DisplayName) > topicInfoDisplayNameLengthMax || len(i.Description) > topicInfoDescriptionLengthMax {
+		return ErrInvalidArgument
+	} else if len(i.Icon) > topicInfoURLLengthMax || len(i.Contact) > topicInfoURLLengthMax {
+		return ErrInvalidArgument
+	}
+	return nil
+}
+
+// Schedule is an on-call schedule, a rotation of users that hand off to each other at regular intervals.
+// Overrides temporarily put a specific user on call, e.g. to cover for vacations.
+type Schedule struct {
+	ID        string            // Schedule identifier (sc_...)
+	Name      string            // Name of the schedule
+	Handoff   time.Time         // Time of the first handoff, at which the first member goes on call
+	Period    time.Duration     // Time between handoffs, e.g. one week
+	Owner     string            // Username of the user allowed to page the schedule (besides admins), may be empty
+	Members   []*ScheduleMember // Members in rotation order
+	Overrides []*ScheduleOverride
+}
+
+// ScheduleMember is a user in the rotation of a schedule
+type ScheduleMember struct {
+	Username string
+	Email    string // E-mail address to notify when on call, may be empty
+}
+
+// ScheduleOverride puts a user on call for the given time span, regardless of the rotation
+type ScheduleOverride struct {
+	ID       int64
+	Username string
+	Email    string // E-mail address of the user, if the user is a member of the schedule
+	Start    time.Time
+	End      time.Time
+}
+
+// String returns a human-readable representation of the override, e.g. "ben from 2024-01-01T09:00:00Z until 2024-01-02T09:00:00Z"
+func (o *ScheduleOverride) String() string {
+	return fmt.Sprintf("%s from %s until %s", o.Username, o.Start.UTC().Format(time.RFC3339), o.End.UTC().Format(time.RFC3339))
+}
+
+// Rotation returns a human-readable representation of the schedule's rotation, e.g. "every 168h0m0s, starting 2024-01-01T09:00:00Z"
+func (s *Schedule) Rotation() string {
+	return fmt.Sprintf("every %s, starting %s", s.Period.String(), s.Handoff.UTC().Format(time.RFC3339))
+}
+
+// Summary returns the rotation and the owner of the schedule, e.g. as recorded in the audit log
+func (s *Schedule) Summary() string {
+	if s.Owner == "" {
+		return s.Rotation()
+	}
+	return fmt.Sprintf("%s, owned by %s", s.Rotation(), s.Owner)
+}
+
+// OnCall returns the member that is on call at the given time, or nil if the schedule has no members.
+// Overrides take precedence over the rotation. If overrides overlap, the most recently added one wins.
+func (s *Schedule) OnCall(now time.Time) *ScheduleMember {
+	for i := len(s.Overrides) - 1; i >= 0; i-- {
+		o := s.Overrides[i]
+		if !now.Before(o.Start) && now.Before(o.End) {
+			return &ScheduleMember{Username: o.Username, Email: o.Email}
+		}
+	}
+	if len(s.Members) == 0 {
+		return nil
+	}
+	n := s.handoffs(now) % int64(len(s.Members))
+	if n < 0 {
+		n += int64(len(s.Members))
+	}
+	return s.Members[n]
+}
+
+// NextHandoff returns the time of the first regular handoff after the given time
+func (s *Schedule) NextHandoff(now time.Time) time.Time {
+	return s.Handoff.Add(time.Duration(s.handoffs(now)+1) * s.Period)
+}
+
+// handoffs returns the number of handoffs between the first handoff and the given time, which
+// is negative if the given time is before the first handoff
+func (s *Schedule) handoffs(now time.Time) int64 {
+	if s.Period <= 0 {
+		return 0
+	}
+	d := now.Sub(s.Handoff)
+	n := int64(d / s.Period)
+	if d < 0 && d%s.Period != 0 {
+		n--
+	}
+	return n
 }
 
 // Reservation is a struct that represents the ownership over a topic by a user
@@ -158,6 +419,94 @@ type Reservation struct {
 	Everyone Permission
 }
 
+// AccessSource describes where the permission for a topic came from, see AccessMatch
+type AccessSource string
+
+// Access sources, in order of precedence
+const (
+	AccessSourceAdmin    = AccessSource("admin")    // User is an admin, no entries are checked
+	AccessSourceUser     = AccessSource("user")     // User-specific access control entry
+	AccessSourceGroup    = AccessSource("group")    // Entry inherited from one of the user's groups
+	AccessSourceEveryone = AccessSource("everyone") // Entry for anonymous users (Everyone)
+	AccessSourceDefault  = AccessSource("default")  // No entry matched, the default access applies
+)
+
+// AccessMatch describes which access control entry decided the access of a user to a topic
+type AccessMatch struct {
+	Allow        Permission
+	Source       AccessSource
+	Group        string // Only set if Source is AccessSourceGroup
+	TopicPattern string // Empty if Source is AccessSourceAdmin or AccessSourceDefault
+}
+
+// AuditAction describes the kind of action recorded in an AuditEntry
+type AuditAction string
+
+// Audited actions
+const (
+	AuditUserAdd                = AuditAction("user.add")
+	AuditUserRemove             = AuditAction("user.remove")
+	AuditUserPurge              = AuditAction("user.purge") // User was marked deleted, and is now removed for good
+	AuditUserPassword           = AuditAction("user.password")
+	AuditUserRole               = AuditAction("user.role")
+	AuditUserTier               = AuditAction("user.tier")
+	AuditAccessAllow            = AuditAction("access.allow")
+	AuditAccessReset            = AuditAction("access.reset")
+	AuditAccessExpire           = AuditAction("access.expire")
+	AuditGroupAdd               = AuditAction("group.add")
+	AuditGroupRemove            = AuditAction("group.remove")
+	AuditGroupMemberAdd         = AuditAction("group.member.add")
+	AuditGroupMemberRemove      = AuditAction("group.member.remove")
+	AuditGroupAccessAllow       = AuditAction("group.access.allow")
+	AuditGroupAccessReset       = AuditAction("group.access.reset")
+	AuditTokenCreate            = AuditAction("token.create")
+	AuditTokenRemove            = AuditAction("token.remove")
+	AuditReservationAdd         = AuditAction("reservation.add")
+	AuditReservationRemove      = AuditAction("reservation.remove")
+	AuditTierAdd                = AuditAction("tier.add")
+	AuditTierChange             = AuditAction("tier.change")
+	AuditTierRemove             = AuditAction("tier.remove")
+	AuditScheduleAdd            = AuditAction("schedule.add")
+	AuditScheduleChange         = AuditAction("schedule.change")
+	AuditScheduleRemove         = AuditAction("schedule.remove")
+	AuditScheduleMemberAdd      = AuditAction("schedule.member.add")
+	AuditScheduleMemberRemove   = AuditAction("schedule.member.remove")
+	AuditScheduleOverrideAdd    = AuditAction("schedule.override.add")
+	AuditScheduleOverrideRemove = AuditAction("schedule.override.remove")
+	AuditTopicSettingsChange    = AuditAction("topic.settings.change")
+	AuditTopicSettingsRemove    = AuditAction("topic.settings.remove")
+	AuditTopicInfoChange        = AuditAction("topic.info.change")
+	AuditTopicInfoRemove        = AuditAction("topic.info.remove")
+	AuditLoginFailed            = AuditAction("login.failed")
+)
+
+// Audit actors that are not users. Parentheses are not allowed in usernames, so these cannot clash.
+const (
+	AuditActorServer = "(server)" // Action was performed by the server itself, e.g. when pruning
+	AuditActorCLI    = "(cli)"    // Action was performed via the command line, with direct access to the database
+)
+
+// AuditEntry is a single entry of the audit log, recording who changed what, and from where
+type AuditEntry struct {
+	ID     int64
+	Time   time.Time
+	Actor  string     // Username, AuditActorServer or AuditActorCLI; may be empty for anonymous actors
+	IP     netip.Addr // Invalid if the action was not performed via HTTP
+	Action AuditAction
+	Target string // Affected user, group or tier
+	Before string // Value before the change, if any
+	After  string // Value after the change, if any
+}
+
+// AuditFilter restricts the entries returned by Manager.AuditEntries; empty fields match everything
+type AuditFilter struct {
+	Actor  string
+	Action AuditAction
+	Target string
+	Since  time.Time
+	Limit  int
+}
+
 // Permission represents a read or write permission to a topic
 type Permission uint8
 
@@ -241,10 +590,12 @@ const (
 )
 
 var (
-	allowedUsernameRegex     = regexp.MustCompile(`^[-_.@a-zA-Z0-9]+$`)     // Does not include Everyone (*)
-	allowedTopicRegex        = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)  // No '*'
-	allowedTopicPatternRegex = regexp.MustCompile(`^[-_*A-Za-z0-9]{1,64}$`) // Adds '*' for wildcards!
+	allowedUsernameRegex     = regexp.MustCompile(`^[-_.@a-zA-Z0-9]+$`)      // Does not include Everyone (*)
+	allowedTopicRegex        = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)   // No '*'
+	allowedTopicPatternRegex = regexp.MustCompile(`^[-_*?A-Za-z0-9]{1,64}$`) // Adds '*' and '?' for wildcards!
 	allowedTierRegex         = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+	allowedGroupRegex        = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+	allowedScheduleRegex     = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
 )
 
 // AllowedRole returns true if the given role can be used for new users
@@ -262,7 +613,7 @@ func AllowedTopic(topic string) bool {
 	return allowedTopicRegex.MatchString(topic)
 }
 
-// AllowedTopicPattern returns true if the given topic pattern is valid; this includes the wildcard character (*)
+// AllowedTopicPattern returns true if the given topic pattern is valid; this includes the wildcard characters (* and ?)
 func AllowedTopicPattern(topic string) bool {
 	return allowedTopicPatternRegex.MatchString(topic)
 }
@@ -272,16 +623,42 @@ func AllowedTier(tier string) bool {
 	return allowedTierRegex.MatchString(tier)
 }
 
+// MaskToken shortens a token so that it can be identified (e.g. in the audit log), but not used
+func MaskToken(token string) string {
+	if len(token) <= tokenMaskedLength {
+		return token
+	}
+	return token[:tokenMaskedLength] + "..."
+}
+
+// AllowedGroup returns true if the given group name is valid
+func AllowedGroup(group string) bool {
+	return allowedGroupRegex.MatchString(group)
+}
+
+// AllowedSchedule returns true if the given schedule name is valid
+func AllowedSchedule(schedule string) bool {
+	return allowedScheduleRegex.MatchString(schedule)
+}
+
 // Error constants used by the package
 var (
-	ErrUnauthenticated     = errors.New("unauthenticated")
-	ErrUnauthorized        = errors.New("unauthorized")
-	ErrInvalidArgument     = errors.New("invalid argument")
-	ErrUserNotFound        = errors.New("user not found")
-	ErrUserExists          = errors.New("user already exists")
-	ErrTierNotFound        = errors.New("tier not found")
-	ErrTokenNotFound       = errors.New("token not found")
-	ErrPhoneNumberNotFound = errors.New("phone number not found")
-	ErrTooManyReservations = errors.New("new tier has lower reservation limit")
-	ErrPhoneNumberExists   = errors.New("phone number already exists")
+	ErrUnauthenticated       = errors.New("unauthenticated")
+	ErrUnauthorized          = errors.New("unauthorized")
+	ErrInvalidArgument       = errors.New("invalid argument")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUserExists            = errors.New("user already exists")
+	ErrTierNotFound          = errors.New("tier not found")
+	ErrTokenNotFound         = errors.New("token not found")
+	ErrPhoneNumberNotFound   = errors.New("phone number not found")
+	ErrTooManyReservations   = errors.New("new tier has lower reservation limit")
+	ErrPhoneNumberExists     = errors.New("phone number already exists")
+	ErrGroupNotFound         = errors.New("group not found")
+	ErrGroupExists           = errors.New("group already exists")
+	ErrScheduleNotFound      = errors.New("schedule not found")
+	ErrScheduleExists        = errors.New("schedule already exists")
+	ErrTopicSettingsNotFound = errors.New("topic settings not found")
+	ErrTopicInfoNotFound     = errors.New("topic info not found")
+	ErrAccessPermanent       = errors.New("permanent access control entry exists")
+	ErrTopicOwnedByOthers    = errors.New("topic owned by others")
 )
@@ -3,6 +3,7 @@ package user
 import (
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestPermission(t *testing.T) {
@@ -61,3 +62,74 @@ func TestTierContext(t *testing.T) {
 	require.Equal(t, "price_456", context["stripe_yearly_price_id"])
 
 }
+
+func TestSchedule_OnCall(t *testing.T) {
+	handoff := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	schedule := &Schedule{
+		Name:    "ops",
+		Handoff: handoff,
+		Period:  7 * 24 * time.Hour,
+		Members: []*ScheduleMember{
+			{Username: "phil", Email: "phil@example.com"},
+			{Username: "ben"},
+			{Username: "emma"},
+		},
+	}
+	require.Equal(t, "phil", schedule.OnCall(handoff).Username)
+	require.Equal(t, "phil", schedule.OnCall(handoff.Add(6*24*time.Hour)).Username)
+	require.Equal(t, "ben", schedule.OnCall(handoff.Add(7*24*time.Hour)).Username)
+	require.Equal(t, "emma", schedule.OnCall(handoff.Add(15*24*time.Hour)).Username)
+	require.Equal(t, "phil", schedule.OnCall(handoff.Add(21*24*time.Hour)).Username)
+	require.Equal(t, "emma", schedule.OnCall(handoff.Add(-time.Hour)).Username) // Before first handoff
+	require.Equal(t, handoff.Add(7*24*time.Hour), schedule.NextHandoff(handoff))
+	require.Equal(t, handoff, schedule.NextHandoff(handoff.Add(-time.Hour)))
+
+	// Overrides win, the most recent one first
+	schedule.Overrides = []*ScheduleOverride{
+		{ID: 1, Username: "ben", Start: handoff.Add(time.Hour), End: handoff.Add(3 * time.Hour)},
+		{ID: 2, Username: "emma", Start: handoff.Add(2 * time.Hour), End: handoff.Add(4 * time.Hour)},
+	}
+	require.Equal(t, "phil", schedule.OnCall(handoff).Username)
+	require.Equal(t, "phil@example.com", schedule.OnCall(handoff).Email)
+	require.Equal(t, "ben", schedule.OnCall(handoff.Add(time.Hour)).Username)
+	require.Equal(t, "emma", schedule.OnCall(handoff.Add(2*time.Hour)).Username)
+	require.Equal(t, "emma", schedule.OnCall(handoff.Add(3*time.Hour)).Username)
+	require.Equal(t, "phil", schedule.OnCall(handoff.Add(4*time.Hour)).Username)
+
+	// No members
+	require.Nil(t, (&Schedule{Period: time.Hour}).OnCall(handoff))
+}
+
+func TestQuietHours_Suppress(t *testing.T) {
+	q := &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}
+	require.Nil(t, q.Validate())
+
+	night := time.Date(2024, 1, 10, 2, 30, 0, 0, time.UTC)   // 03:30 in Berlin
+	day := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)     // 13:00 in Berlin
+	evening := time.Date(2024, 1, 10, 21, 0, 0, 0, time.UTC) // 22:00 in Berlin
+	morning := time.Date(2024, 1, 10, 6, 0, 0, 0, time.UTC)  // 07:00 in Berlin
+	require.True(t, q.Suppress(night, 0))
+	require.True(t, q.Suppress(night, 4))
+	require.False(t, q.Suppress(night, 5)) // Urgent messages are still sent
+	require.False(t, q.Suppress(day, 0))
+	require.True(t, q.Suppress(evening, 3))
+	require.False(t, q.Suppress(morning, 3))
+
+	q.MinPriority = 4
+	require.False(t, q.Suppress(night, 4))
+	require.True(t, q.Suppress(night, 3))
+
+	// Not spanning midnight, UTC
+	q = &QuietHours{Start: "12:00", End: "13:00"}
+	require.Nil(t, q.Validate())
+	require.True(t, q.Suppress(day, 3))
+	require.False(t, q.Suppress(night, 3))
+}
+
+func TestQuietHours_Validate(t *testing.T) {
+	require.Equal(t, ErrInvalidArgument, (&QuietHours{Start: "22:00"}).Validate())
+	require.Equal(t, ErrInvalidArgument, (&QuietHours{Start: "25:00", End: "07:00"}).Validate())
+	require.Equal(t, ErrInvalidArgument, (&QuietHours{Start: "07:00", End: "07:00"}).Validate())
+	require.Equal(t, ErrInvalidArgument, (&QuietHours{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}).Validate())
+	require.Equal(t, ErrInvalidArgument, (&QuietHours{Start: "22:00", End: "07:00", MinPriority: 6}).Validate())
+}
@@ -0,0 +1,149 @@
+package util
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedMap is a concurrency-safe map with string keys, which is split into a fixed number of shards,
+// each with its own lock. Compared to a single map guarded by a single lock, lookups and inserts of different
+// keys rarely contend with each other, and iterating or pruning the map only ever locks one shard at a time.
+//
+// Example:
+//
+//	m := NewShardedMap[time.Time](32)
+//	lastSeen, _, _ := m.GetOrAdd("phil", func() (time.Time, error) { return time.Now(), nil })
+//	m.DeleteFunc(func(name string, lastSeen time.Time) bool { return time.Since(lastSeen) > time.Hour })
+type ShardedMap[V any] struct {
+	shards []*shardedMapShard[V]
+	size   atomic.Int64
+}
+
+type shardedMapShard[V any] struct {
+	items map[string]V
+	mu    sync.RWMutex
+}
+
+// NewShardedMap creates a new ShardedMap with the given number of shards
+func NewShardedMap[V any](shards int) *ShardedMap[V] {
+	if shards < 1 {
+		shards = 1
+	}
+	m := &ShardedMap[V]{
+		shards: make([]*shardedMapShard[V], shards),
+	}
+	for i := range m.shards {
+		m.shards[i] = &shardedMapShard[V]{
+			items: make(map[string]V),
+		}
+	}
+	return m
+}
+
+// Get returns the value for the given key, or the zero value if the key does not exist
+func (m *ShardedMap[V]) Get(key string) V {
+	shard := m.shard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.items[key]
+}
+
+// Set sets the value for the given key, replacing any existing value
+func (m *ShardedMap[V]) Set(key string, value V) {
+	shard := m.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, exists := shard.items[key]; !exists {
+		m.size.Add(1)
+	}
+	shard.items[key] = value
+}
+
+// GetOrAdd returns the value for the given key if it exists (loaded is true). Otherwise, it calls the create
+// function and stores the returned value. The create function is called while the key's shard is locked, so it
+// must not access the map. If it returns an error, nothing is stored and the error is returned.
+func (m *ShardedMap[V]) GetOrAdd(key string, create func() (V, error)) (value V, loaded bool, err error) {
+	shard := m.shard(key)
+	shard.mu.RLock()
+	value, loaded = shard.items[key]
+	shard.mu.RUnlock()
+	if loaded {
+		return value, true, nil // Fast path, existing keys only take the read lock
+	}
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if value, exists := shard.items[key]; exists {
+		return value, true, nil
+	}
+	value, err = create()
+	if err != nil {
+		return value, false, err
+	}
+	shard.items[key] = value
+	m.size.Add(1)
+	return value, false, nil
+}
+
+// Delete removes the given key from the map
+func (m *ShardedMap[V]) Delete(key string) {
+	shard := m.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, exists := shard.items[key]; exists {
+		delete(shard.items, key)
+		m.size.Add(-1)
+	}
+}
+
+// DeleteFunc removes all entries for which the given function returns true, and returns the number of removed
+// entries. Only one shard is locked at a time, and the function must not access the map.
+func (m *ShardedMap[V]) DeleteFunc(fn func(key string, value V) bool) int {
+	deleted := 0
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		for key, value := range shard.items {
+			if fn(key, value) {
+				delete(shard.items, key)
+				m.size.Add(-1)
+				deleted++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return deleted
+}
+
+// Range calls the given function for all entries, until it returns false. The function is called without
+// holding any locks, so it may access the map; entries added or removed during the iteration may or may
+// not be visited.
+func (m *ShardedMap[V]) Range(fn func(key string, value V) bool) {
+	for _, shard := range m.shards {
+		shard.mu.RLock()
+		keys, values := make([]string, 0, len(shard.items)), make([]V, 0, len(shard.items))
+		for key, value := range shard.items {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		shard.mu.RUnlock()
+		for i := range keys {
+			if !fn(keys[i], values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of entries in the map
+func (m *ShardedMap[V]) Len() int {
+	return int(m.size.Load())
+}
+
+// shard returns the shard for the given key, using the FNV-1a hash of the key (inlined to avoid allocations)
+func (m *ShardedMap[V]) shard(key string) *shardedMapShard[V] {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return m.shards[h%uint32(len(m.shards))]
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestShardedMap_GetSetDelete(t *testing.T) {
+	m := NewShardedMap[*string](4)
+	require.Nil(t, m.Get("a"))
+
+	a, b := "a", "b"
+	m.Set("a", &a)
+	m.Set("b", &b)
+	m.Set("b", &b) // Replace does not change size
+	require.Equal(t, &a, m.Get("a"))
+	require.Equal(t, 2, m.Len())
+
+	m.Delete("a")
+	m.Delete("a") // Not found, no-op
+	require.Nil(t, m.Get("a"))
+	require.Equal(t, 1, m.Len())
+}
+
+func TestShardedMap_GetOrAdd(t *testing.T) {
+	m := NewShardedMap[int](4)
+	v, loaded, err := m.GetOrAdd("a", func() (int, error) { return 1, nil })
+	require.Nil(t, err)
+	require.False(t, loaded)
+	require.Equal(t, 1, v)
+
+	v, loaded, err = m.GetOrAdd("a", func() (int, error) { return 2, nil })
+	require.Nil(t, err)
+	require.True(t, loaded)
+	require.Equal(t, 1, v)
+
+	_, _, err = m.GetOrAdd("b", func() (int, error) { return 0, errors.New("limit reached") })
+	require.Equal(t, "limit reached", err.Error())
+	require.Equal(t, 1, m.Len())
+}
+
+func TestShardedMap_DeleteFuncAndRange(t *testing.T) {
+	m := NewShardedMap[int](8)
+	for i := 0; i < 100; i++ {
+		m.Set(fmt.Sprintf("key%d", i), i)
+	}
+	deleted := m.DeleteFunc(func(key string, value int) bool {
+		return value%2 == 0
+	})
+	require.Equal(t, 50, deleted)
+	require.Equal(t, 50, m.Len())
+
+	sum := 0
+	m.Range(func(key string, value int) bool {
+		m.Get(key) // Accessing the map while iterating does not deadlock
+		sum += value
+		return true
+	})
+	require.Equal(t, 2500, sum) // 1 + 3 + ... + 99
+}
+
+func TestShardedMap_Concurrent(t *testing.T) {
+	m := NewShardedMap[int](16)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.GetOrAdd(fmt.Sprintf("key%d", j), func() (int, error) { return i, nil })
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 100, m.Len())
+}
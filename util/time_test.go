@@ -92,3 +92,19 @@ func TestParseDuration(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, time.Duration(0), d)
 }
+
+func TestParsePastTime(t *testing.T) {
+	d, err := ParsePastTime("2d", base)
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2021, 12, 8, 10, 17, 23, 0, time.UTC), d)
+
+	d, err = ParsePastTime("1639131443", base)
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2021, 12, 10, 10, 17, 23, 0, time.UTC), d)
+
+	_, err = ParsePastTime("1739131443", base) // In the future
+	require.Equal(t, errUnparsableTime, err)
+
+	_, err = ParsePastTime("tomorrow", base)
+	require.Equal(t, errUnparsableTime, err)
+}
@@ -4,6 +4,7 @@ import {
   topicShortUrl,
   topicUrl,
   topicUrlAuth,
+  topicUrlInfo,
   topicUrlJsonPoll,
   topicUrlJsonPollWithSince,
   webPushUrl,
@@ -115,6 +116,27 @@ class Api {
     throw new Error(`Unexpected server response ${response.status}`);
   }
 
+  /**
+   * Fetches the topic info (display name, description, icon, contact) set by the topic owner. Returns null
+   * if the topic has no info, or if the server does not support it.
+   */
+  async topicInfo(baseUrl, topic) {
+    const user = await userManager.get(baseUrl);
+    const url = topicUrlInfo(baseUrl, topic);
+    console.log(`[Api] Fetching topic info from ${url}`);
+    const response = await fetch(url, {
+      headers: maybeWithAuth({}, user),
+    });
+    if (response.status < 200 || response.status > 299) {
+      return null; // Old servers, or no read access
+    }
+    const info = await response.json();
+    if (!info.display_name && !info.description && !info.icon && !info.contact) {
+      return null;
+    }
+    return info;
+  }
+
   async updateWebPush(pushSubscription, topics) {
     const user = await userManager.get(config.base_url);
     const url = webPushUrl(config.base_url);
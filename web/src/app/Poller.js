@@ -40,6 +40,7 @@ class Poller {
   async poll(subscription) {
     console.log(`[Poller] Polling ${subscription.id}`);
 
+    await this.pollInfo(subscription);
     const since = subscription.last;
     const notifications = await api.poll(subscription.baseUrl, subscription.topic, since);
     if (!notifications || notifications.length === 0) {
@@ -50,6 +51,15 @@ class Poller {
     await subscriptionManager.addNotifications(subscription.id, notifications);
   }
 
+  async pollInfo(subscription) {
+    try {
+      const info = await api.topicInfo(subscription.baseUrl, subscription.topic);
+      await subscriptionManager.setInfo(subscription.id, info);
+    } catch (e) {
+      console.log(`[Poller] Error fetching topic info for ${subscription.id}`, e);
+    }
+  }
+
   pollInBackground(subscription) {
     (async () => {
       try {
@@ -102,6 +102,7 @@ class SubscriptionManager {
           displayName: remote.display_name, // May be undefined
           reservation, // May be null!
         });
+        await this.setInfo(local.id, remote.info ?? null); // Topic metadata may change at any time
 
         return local.id;
       })
@@ -244,6 +245,12 @@ class SubscriptionManager {
     });
   }
 
+  async setInfo(subscriptionId, info) {
+    await this.db.subscriptions.update(subscriptionId, {
+      info,
+    });
+  }
+
   async setReservation(subscriptionId, reservation) {
     await this.db.subscriptions.update(subscriptionId, {
       reservation,
@@ -20,6 +20,7 @@ export const topicUrlJson = (baseUrl, topic) => `${topicUrl(baseUrl, topic)}/jso
 export const topicUrlJsonPoll = (baseUrl, topic) => `${topicUrlJson(baseUrl, topic)}?poll=1`;
 export const topicUrlJsonPollWithSince = (baseUrl, topic, since) => `${topicUrlJson(baseUrl, topic)}?poll=1&since=${since}`;
 export const topicUrlAuth = (baseUrl, topic) => `${topicUrl(baseUrl, topic)}/auth`;
+export const topicUrlInfo = (baseUrl, topic) => `${topicUrl(baseUrl, topic)}/info`;
 export const topicShortUrl = (baseUrl, topic) => shortUrl(topicUrl(baseUrl, topic));
 export const webPushUrl = (baseUrl) => `${baseUrl}/v1/webpush`;
 export const accountUrl = (baseUrl) => `${baseUrl}/v1/account`;
@@ -49,6 +50,9 @@ export const topicDisplayName = (subscription) => {
   if (subscription.displayName) {
     return subscription.displayName;
   }
+  if (subscription.info?.display_name) {
+    return subscription.info.display_name;
+  }
   if (subscription.baseUrl === config.base_url) {
     return subscription.topic;
   }
@@ -18,6 +18,7 @@ import {
   Box,
   IconButton,
   Button,
+  Avatar,
   useTheme,
 } from "@mui/material";
 import * as React from "react";
@@ -292,7 +293,11 @@ const SubscriptionItem = (props) => {
       <CircularProgress size="24px" />
     ) : (
       <Badge badgeContent={iconBadge} invisible={subscription.new === 0} color="primary">
-        <ChatBubbleOutlineIcon />
+        {subscription.info?.icon ? (
+          <Avatar src={subscription.info.icon} alt="" variant="rounded" sx={{ width: 24, height: 24 }} />
+        ) : (
+          <ChatBubbleOutlineIcon />
+        )}
       </Badge>
     );
 
@@ -307,9 +312,13 @@ const SubscriptionItem = (props) => {
         <ListItemIcon>{icon}</ListItemIcon>
         <ListItemText
           primary={displayName}
+          secondary={subscription.info?.description}
           primaryTypographyProps={{
             style: { overflow: "hidden", textOverflow: "ellipsis" },
           }}
+          secondaryTypographyProps={{
+            style: { overflow: "hidden", textOverflow: "ellipsis", whiteSpace: "nowrap" },
+          }}
         />
         {subscription.reservation?.everyone && (
           <ListItemIcon edge="end" sx={{ minWidth: "26px" }}>